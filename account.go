@@ -0,0 +1,818 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// structs
+
+// note: a user can ask for a copy of everything they have access to, which is put together in the background as a zip archive
+//		and kept in the blob store until it can be downloaded. The archive holds:
+//			profile.json		the user's account
+//			categories.json		every category the user has access to, with their role in it
+//			tasks.json			every task in those categories, including the ones in the trash (with their deleted_at)
+//			tasks.csv			the tasks that are not in the trash, in a form /importtasks reads back in
+//			history.json		every revision of those tasks
+//			comments.json		the comments on those tasks
+//			attachments.json	the files attached to those tasks, whose contents are under attachments/
+//		Timestamps are in the user's timezone. Archives are deleted accountExportLifetime after they are ready
+type AccountExport struct {
+	Id int `json:"id"`
+	// "pending", "running", "ready" or "failed"
+	Status string `json:"status"`
+	// the size of the archive in bytes, once it is ready
+	Size null.Int64 `json:"size"`
+	// why the export failed
+	Error null.String `json:"error"`
+	Created_at Timestamp `json:"created_at"`
+	Finished_at Timestamp `json:"finished_at"`
+	// when the archive is deleted
+	Expires_at Timestamp `json:"expires_at"`
+}
+
+type AccountExportIdParams struct {
+	Id int `json:"id"`
+}
+
+type DeleteAccountParams struct {
+	// the user's password, asked for again so that a stolen session cannot delete the account
+	Password string `json:"password"`
+}
+
+// note: deleting an account deletes everything the user owns. Categories the user owns that are shared with anyone
+//		are handed over instead, along with their tasks, to the member with the highest role (the longest-standing one if there is a tie),
+//		who stops being a member and becomes the owner; categories handed over this way are taken out of the user's workspaces.
+//		The user's memberships of other users' categories, their comments and the files they attached are removed,
+//		and the changes they made stay in the history of tasks that remain, without their name
+type AccountDeletion struct {
+	Deleted_Categories int64 `json:"deleted_categories"`
+	Deleted_Tasks int64 `json:"deleted_tasks"`
+	Transferred_Categories []TransferredCategory `json:"transferred_categories"`
+}
+
+type TransferredCategory struct {
+	Category_Id int `json:"category_id"`
+	Category_Title string `json:"category_title"`
+	// the member who now owns the category
+	Owner_Id int `json:"owner_id"`
+	Owner string `json:"owner"`
+}
+
+type exportedRevision struct {
+	Task_Id int `json:"task_id"`
+	TaskRevision
+}
+
+type exportedAttachment struct {
+	Attachment
+	// where the contents are in the archive, empty if they could not be found in the blob store
+	Path string `json:"path"`
+}
+
+const (
+	exportPending = "pending"
+	exportRunning = "running"
+	exportReady = "ready"
+	exportFailed = "failed"
+)
+
+// how long an archive can be downloaded for once it is ready; failed exports are forgotten after the same time
+const accountExportLifetime = 7 * 24 * time.Hour
+
+// how often the server checks for exports to put together, and for ones that have expired
+const accountExportPollInterval = 5 * time.Second
+const accountExportCleanupInterval = time.Hour
+
+// how long an export that has been started is left to the instance that started it, before another instance starts it over;
+//		longer than putting together the largest archive can take
+const accountExportClaimDuration = 30 * time.Minute
+
+// the columns of tasks.csv, named the way /importtasks expects (see csvColumns)
+var accountExportCSVColumns = []string{"title", "description", "category", "deadline", "completed", "priority", "tags", "recurrence"}
+
+/* ------------------------------------------------------------ EXPORTS --------------------- */
+/* Asks for a new export of a user's data and returns it; if one is already waiting or being put together, that one is returned instead */
+func requestAccountExport(userId int, client *gin.Context, cancel context.CancelFunc) (AccountExport, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var e AccountExport;
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return e, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// lock the user, so that asking twice at once cannot start two exports
+	_, err = tx.Exec(context.Background(), "SELECT id FROM users WHERE id=$1 FOR UPDATE;", userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return e, err;
+	}
+
+	row := tx.QueryRow(context.Background(), "SELECT " + accountExportColumns + " FROM account_exports WHERE user_id=$1 AND status IN ($2, $3) ORDER BY id DESC LIMIT 1;", userId, exportPending, exportRunning)
+	err = scanAccountExport(row, &e);
+	if (err == pgx.ErrNoRows) {
+		row = tx.QueryRow(context.Background(), "INSERT INTO account_exports (user_id) VALUES ($1) RETURNING " + accountExportColumns + ";", userId)
+		err = scanAccountExport(row, &e);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return e, err;
+	}
+
+	return e, nil;
+}
+
+/* Returns a user's exports, newest first */
+func getAccountExports(userId int, client *gin.Context, cancel context.CancelFunc) ([]AccountExport) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	exports, err := c.Query(context.Background(), "SELECT " + accountExportColumns + " FROM account_exports WHERE user_id=$1 ORDER BY id DESC;", userId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer exports.Close();
+
+	exportSlice := []AccountExport{}
+	for exports.Next() {
+		var e AccountExport
+		err = scanAccountExport(exports, &e)
+		assertDBOperationSuccess(client, cancel, err);
+		exportSlice = append(exportSlice, e)
+	}
+
+	return exportSlice;
+}
+
+/* Returns one of a user's exports and the key its archive is kept under, which is empty until it is ready */
+func getAccountExport(id int, userId int, client *gin.Context, cancel context.CancelFunc) (AccountExport, string, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var e AccountExport;
+	var key null.String;
+	row := c.QueryRow(context.Background(), "SELECT " + accountExportColumns + ", blob_key FROM account_exports WHERE id=$1 AND user_id=$2;", id, userId)
+	err := scanAccountExport(row, &e, &key);
+	if (err == pgx.ErrNoRows) {
+		return e, "", assertAccountExportFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return e, "", err;
+	}
+
+	return e, key.String, nil;
+}
+
+// sends the archive of a ready export to the client as a download
+func serveAccountExport(e AccountExport, key string, username string, client *gin.Context, cancel context.CancelFunc) error {
+	if (e.Status != exportReady) {
+		return assertAccountExportReady(client, cancel, fmt.Errorf("export with id: %v is %v, not ready", e.Id, e.Status));
+	}
+
+	store, err := openBlobStore();
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	contents, err := store.Get(key);
+	if (err == errBlobNotFound) {
+		return assertAccountExportFound(client, cancel, e.Id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer contents.Close();
+
+	client.DataFromReader(200, e.Size.Int64, "application/zip", contents, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%v"`, accountExportFilename(username, e)),
+		"X-Content-Type-Options": "nosniff",
+	});
+
+	return nil;
+}
+
+// returns the name an archive is downloaded as, e.g. "johndoe-export-2026-10-19.zip"
+func accountExportFilename(username string, e AccountExport) string {
+	name := strings.Map(func(r rune) rune {
+		if ((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
+			return r;
+		}
+		return '_';
+	}, username);
+
+	return name + "-export-" + e.Created_at.Time.Time.Format("2006-01-02") + ".zip";
+}
+
+// the columns of account_exports in the order scanAccountExport reads them
+const accountExportColumns = "id, status, size, error, created_at, finished_at, expires_at"
+
+// scans a row of accountExportColumns into e, followed by any extra columns
+func scanAccountExport(row pgx.Row, e *AccountExport, extra ...interface{}) error {
+	dest := []interface{}{
+		&e.Id,
+		&e.Status,
+		&e.Size,
+		&e.Error,
+		&e.Created_at,
+		&e.Finished_at,
+		&e.Expires_at,
+	}
+
+	return row.Scan(append(dest, extra...)...);
+}
+
+// converts the timestamps of every export into the given timezone
+func localiseAccountExports(exports []AccountExport, loc *time.Location) []AccountExport {
+	for i := range exports {
+		exports[i] = localiseAccountExport(exports[i], loc);
+	}
+
+	return exports;
+}
+
+func localiseAccountExport(e AccountExport, loc *time.Location) AccountExport {
+	for _, t := range []*Timestamp{&e.Created_at, &e.Finished_at, &e.Expires_at} {
+		if (t.Valid) {
+			t.Time.Time = t.Time.Time.In(loc);
+		}
+	}
+
+	return e;
+}
+
+/* ------------------------------------------------------------ BACKGROUND JOBS --------------------- */
+// puts together the exports users have asked for, one at a time, and deletes the ones that have expired;
+//		runs for as long as the server is up
+func runAccountExports() {
+	lastCleanup := time.Time{};
+	for {
+		built, err := buildNextAccountExport();
+		if (err == nil && time.Since(lastCleanup) > accountExportCleanupInterval) {
+			err = cleanUpAccountExports();
+			lastCleanup = time.Now();
+		}
+		if (err != nil) {
+			fmt.Fprintf(os.Stderr, "Unable to export accounts: %v\n", err);
+		}
+		// keep going while there is a backlog
+		if (err != nil || !built) {
+			time.Sleep(accountExportPollInterval);
+		}
+	}
+}
+
+/* Claims the oldest export that is waiting, or that an instance started but did not finish in time, and puts it together;
+		returns whether there was one. An export that cannot be put together is marked as failed */
+func buildNextAccountExport() (bool, error) {
+	godotenv.Load(".env")
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return false, err;
+	}
+	defer c.Close(context.Background())
+
+	var id, userId int;
+	err = c.QueryRow(context.Background(), `
+		WITH next AS (
+			SELECT id FROM account_exports
+			WHERE status=$1 OR (status=$2 AND claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE account_exports SET status=$2, claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		FROM next WHERE account_exports.id=next.id
+		RETURNING account_exports.id, account_exports.user_id;`, exportPending, exportRunning, accountExportClaimDuration.Seconds()).Scan(&id, &userId)
+	if (err == pgx.ErrNoRows) {
+		return false, nil;
+	}
+	if (err != nil) {
+		return false, err;
+	}
+
+	key, size, err := buildAccountArchive(c, userId);
+	if (err != nil) {
+		fmt.Fprintf(os.Stderr, "Unable to put together export %v: %v\n", id, err);
+		_, err = c.Exec(context.Background(), `
+			UPDATE account_exports SET status=$1, error=$2, finished_at=CURRENT_TIMESTAMP, expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+			WHERE id=$4;`, exportFailed, "the export could not be put together, please try again", accountExportLifetime.Seconds(), id)
+		return true, err;
+	}
+
+	tag, err := c.Exec(context.Background(), `
+		UPDATE account_exports SET status=$1, blob_key=$2, size=$3, finished_at=CURRENT_TIMESTAMP, expires_at = CURRENT_TIMESTAMP + make_interval(secs => $4)
+		WHERE id=$5 AND status=$6;`, exportReady, key, size, accountExportLifetime.Seconds(), id, exportRunning)
+	if (err != nil || tag.RowsAffected() == 0) {
+		// the account was deleted in the meantime, so nothing points at the archive
+		deleteBlobs([]string{key});
+	}
+
+	return true, err;
+}
+
+/* Deletes the exports, and the archives of the exports, that have expired */
+func cleanUpAccountExports() error {
+	godotenv.Load(".env")
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return err;
+	}
+	defer c.Close(context.Background())
+
+	var blobKeys []string;
+	err = c.QueryRow(context.Background(), `
+		WITH expired AS (DELETE FROM account_exports WHERE expires_at < CURRENT_TIMESTAMP RETURNING blob_key)
+		SELECT ARRAY(SELECT blob_key FROM expired WHERE blob_key IS NOT NULL);`).Scan(&blobKeys)
+	if (err != nil) {
+		return err;
+	}
+	deleteBlobs(blobKeys);
+
+	return nil;
+}
+
+/* ------------------------------------------------------------ ARCHIVES --------------------- */
+// puts together the archive of a user's data in a temporary file, stores it in the blob store,
+//		and returns the key it is kept under and its size
+func buildAccountArchive(c *pgx.Conn, userId int) (string, int64, error) {
+	store, err := openBlobStore();
+	if (err != nil) {
+		return "", 0, err;
+	}
+
+	f, err := ioutil.TempFile("", "account-export-*.zip");
+	if (err != nil) {
+		return "", 0, err;
+	}
+	defer os.Remove(f.Name());
+	defer f.Close();
+
+	sum := sha256.New();
+	counter := &countingWriter{w: io.MultiWriter(f, sum)};
+	err = writeAccountArchive(c, userId, store, counter);
+	if (err != nil) {
+		return "", 0, err;
+	}
+
+	_, err = f.Seek(0, io.SeekStart);
+	if (err != nil) {
+		return "", 0, err;
+	}
+	key, err := newBlobKey();
+	if (err != nil) {
+		return "", 0, err;
+	}
+	err = store.Put(key, f, counter.n, hex.EncodeToString(sum.Sum(nil)));
+
+	return key, counter.n, err;
+}
+
+// writes the zip archive of everything a user has access to (see AccountExport)
+func writeAccountArchive(c *pgx.Conn, userId int, store BlobStore, w io.Writer) error {
+	var user User;
+	err := c.QueryRow(context.Background(), "SELECT id, username, timezone FROM users WHERE id=$1;", userId).Scan(&user.Id, &user.Username, &user.Timezone)
+	if (err != nil) {
+		return err;
+	}
+	loc := locationOf(user);
+
+	categories, err := accessibleCategories(c, userId);
+	if (err != nil) {
+		return err;
+	}
+	tasks, err := exportTasks(c, userId, loc);
+	if (err != nil) {
+		return err;
+	}
+	taskIds := []int{};
+	for _, t := range tasks {
+		taskIds = append(taskIds, t.Id);
+	}
+	revisions, err := exportRevisions(c, taskIds, loc);
+	if (err != nil) {
+		return err;
+	}
+	comments, err := exportComments(c, taskIds, loc);
+	if (err != nil) {
+		return err;
+	}
+	attachments, blobKeys, err := exportAttachments(c, taskIds, loc);
+	if (err != nil) {
+		return err;
+	}
+
+	zw := zip.NewWriter(w);
+	profile := struct {
+		User
+		Exported_at time.Time `json:"exported_at"`
+	}{user, time.Now().In(loc).Truncate(time.Second)};
+	files := []struct {
+		name string
+		value interface{}
+	}{
+		{"profile.json", profile},
+		{"categories.json", categories},
+		{"tasks.json", tasks},
+		{"history.json", revisions},
+		{"comments.json", comments},
+	};
+	for _, file := range files {
+		err = writeArchiveJSON(zw, file.name, file.value);
+		if (err != nil) {
+			return err;
+		}
+	}
+
+	err = writeTasksCSV(zw, tasks, loc);
+	if (err != nil) {
+		return err;
+	}
+
+	for i := range attachments {
+		path := fmt.Sprintf("attachments/%v/%v", attachments[i].Id, attachments[i].Filename);
+		contents, err := store.Get(blobKeys[i]);
+		if (err == errBlobNotFound) {
+			fmt.Fprintf(os.Stderr, "Unable to export attachment %v: its blob is missing\n", attachments[i].Id);
+			continue;
+		}
+		if (err != nil) {
+			return err;
+		}
+		fw, err := zw.Create(path);
+		if (err == nil) {
+			_, err = io.Copy(fw, contents);
+		}
+		contents.Close();
+		if (err != nil) {
+			return err;
+		}
+		attachments[i].Path = path;
+	}
+	err = writeArchiveJSON(zw, "attachments.json", attachments);
+	if (err != nil) {
+		return err;
+	}
+
+	return zw.Close();
+}
+
+// adds a file to an archive holding a value as indented JSON
+func writeArchiveJSON(zw *zip.Writer, name string, value interface{}) error {
+	fw, err := zw.Create(name);
+	if (err != nil) {
+		return err;
+	}
+
+	enc := json.NewEncoder(fw);
+	enc.SetIndent("", "\t");
+	return enc.Encode(value);
+}
+
+// adds tasks.csv to an archive, holding the tasks that are not in the trash
+func writeTasksCSV(zw *zip.Writer, tasks []TrashedTask, loc *time.Location) error {
+	fw, err := zw.Create("tasks.csv");
+	if (err != nil) {
+		return err;
+	}
+
+	cw := csv.NewWriter(fw);
+	cw.Write(accountExportCSVColumns);
+	for _, t := range tasks {
+		if (t.Deleted_at.Valid) {
+			continue;
+		}
+
+		deadline := "";
+		if (t.Deadline_Date.Valid) {
+			deadline = t.Deadline_Date.Time.Time.Format("2006-01-02");
+		} else if (t.Deadline.Valid) {
+			deadline = t.Deadline.Time.Time.In(loc).Format(time.RFC3339);
+		}
+		completed := "no";
+		if (t.Completed) {
+			completed = "yes";
+		}
+
+		cw.Write([]string{t.Title, t.Description, t.Category, deadline, completed, t.Priority.String, strings.Join(t.Tags, ", "), t.Recurrence.String});
+	}
+	cw.Flush();
+
+	return cw.Error();
+}
+
+// returns every category a user has access to
+func accessibleCategories(c *pgx.Conn, userId int) ([]Category, error) {
+	rows, err := c.Query(context.Background(), "SELECT categories.id, categories.title, accessible.role, categories.workspace_id, categories.parent_id from categories INNER JOIN public.get_accessible_categories($1) AS accessible ON categories.id=accessible.category_id ORDER BY categories.id;", userId)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+
+	categories := []Category{};
+	for rows.Next() {
+		var cat Category
+		err = rows.Scan(&cat.Id, &cat.Title, &cat.Role, &cat.Workspace_Id, &cat.Parent_Id)
+		if (err != nil) {
+			return nil, err;
+		}
+		categories = append(categories, cat)
+	}
+
+	return categories, rows.Err();
+}
+
+// returns every task in the categories a user has access to, the ones in the trash last
+func exportTasks(c *pgx.Conn, userId int, loc *time.Location) ([]TrashedTask, error) {
+	// tasks that are not in the trash have a null deleted_at
+	tasks := []TrashedTask{};
+
+	rows, err := c.Query(context.Background(), "SELECT * from public.get_all_tasks($1);", userId)
+	if (err != nil) {
+		return nil, err;
+	}
+	for rows.Next() {
+		var t TrashedTask
+		err = scanTask(rows, &t.Task)
+		if (err != nil) {
+			rows.Close();
+			return nil, err;
+		}
+		tasks = append(tasks, localiseTrashedTask(t, loc))
+	}
+	rows.Close();
+	if (rows.Err() != nil) {
+		return nil, rows.Err();
+	}
+
+	rows, err = c.Query(context.Background(), "SELECT * from public.get_trashed_tasks($1);", userId)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+	for rows.Next() {
+		var t TrashedTask
+		err = scanTask(rows, &t.Task, &t.Deleted_at)
+		if (err != nil) {
+			return nil, err;
+		}
+		tasks = append(tasks, localiseTrashedTask(t, loc))
+	}
+
+	return tasks, rows.Err();
+}
+
+// returns every revision of the given tasks, oldest first
+func exportRevisions(c *pgx.Conn, taskIds []int, loc *time.Location) ([]exportedRevision, error) {
+	rows, err := c.Query(context.Background(), `
+		SELECT task_revisions.task_id, task_revisions.revision, task_revisions.action, task_revisions.user_id, users.username, task_revisions.created_at, task_revisions.changes
+		FROM task_revisions
+			LEFT JOIN users ON task_revisions.user_id=users.id
+		WHERE task_revisions.task_id = ANY($1)
+		ORDER BY task_revisions.task_id, task_revisions.revision;`, taskIds)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+
+	revisions := []exportedRevision{};
+	for rows.Next() {
+		var rev exportedRevision
+		var changes []byte
+		err = rows.Scan(&rev.Task_Id, &rev.Revision, &rev.Action, &rev.User_Id, &rev.Username, &rev.Created_at, &changes)
+		if (err != nil) {
+			return nil, err;
+		}
+		json.Unmarshal(changes, &rev.Changes);
+		if (rev.Created_at.Valid) {
+			rev.Created_at.Time.Time = rev.Created_at.Time.Time.In(loc);
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err();
+}
+
+// returns the comments on the given tasks that have not been deleted, oldest first
+func exportComments(c *pgx.Conn, taskIds []int, loc *time.Location) ([]Comment, error) {
+	rows, err := c.Query(context.Background(), `
+		SELECT task_comments.id, task_comments.task_id, task_comments.author_id, users.username, task_comments.body, task_comments.created_at, task_comments.edited_at,
+			COALESCE(
+				(SELECT json_agg(json_build_object('user_id', mentioned.id, 'username', mentioned.username) ORDER BY mentioned.username)
+				FROM comment_mentions INNER JOIN users AS mentioned ON comment_mentions.user_id=mentioned.id
+				WHERE comment_mentions.comment_id=task_comments.id),
+				'[]'::JSON)
+		FROM task_comments
+			INNER JOIN users ON task_comments.author_id=users.id
+		WHERE task_comments.task_id = ANY($1) AND task_comments.deleted_at IS NULL
+		ORDER BY task_comments.task_id, task_comments.created_at, task_comments.id;`, taskIds)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+
+	comments := []Comment{};
+	for rows.Next() {
+		var cm Comment
+		err = rows.Scan(&cm.Id, &cm.Task_Id, &cm.Author_Id, &cm.Author, &cm.Body, &cm.Created_at, &cm.Edited_at, &cm.Mentions)
+		if (err != nil) {
+			return nil, err;
+		}
+		comments = append(comments, cm)
+	}
+
+	return localiseComments(comments, loc), rows.Err();
+}
+
+// returns the files attached to the given tasks, along with the keys their contents are kept under
+func exportAttachments(c *pgx.Conn, taskIds []int, loc *time.Location) ([]exportedAttachment, []string, error) {
+	rows, err := c.Query(context.Background(), `
+		SELECT task_attachments.id, task_attachments.task_id, task_attachments.uploader_id, users.username, task_attachments.filename,
+			task_attachments.content_type, task_attachments.size, task_attachments.checksum, task_attachments.created_at, task_attachments.blob_key
+		FROM task_attachments
+			INNER JOIN users ON task_attachments.uploader_id=users.id
+		WHERE task_attachments.task_id = ANY($1)
+		ORDER BY task_attachments.task_id, task_attachments.created_at, task_attachments.id;`, taskIds)
+	if (err != nil) {
+		return nil, nil, err;
+	}
+	defer rows.Close();
+
+	attachments := []exportedAttachment{};
+	blobKeys := []string{};
+	for rows.Next() {
+		var a exportedAttachment
+		var key string
+		err = scanAttachment(rows, &a.Attachment, &key)
+		if (err != nil) {
+			return nil, nil, err;
+		}
+		if (a.Created_at.Valid) {
+			a.Created_at.Time.Time = a.Created_at.Time.Time.In(loc);
+		}
+		attachments = append(attachments, a)
+		blobKeys = append(blobKeys, key)
+	}
+
+	return attachments, blobKeys, rows.Err();
+}
+
+// passes writes on to w, counting the bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p);
+	cw.n += int64(n);
+	return n, err;
+}
+
+/* ------------------------------------------------------------ ACCOUNT DELETION --------------------- */
+/* Deletes a user's account once their password has been confirmed (see AccountDeletion) */
+func deleteAccount(userId int, password string, client *gin.Context, cancel context.CancelFunc) (AccountDeletion, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	result := AccountDeletion{Transferred_Categories: []TransferredCategory{}};
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	var storedPassword string;
+	err = tx.QueryRow(context.Background(), "SELECT password FROM users WHERE id=$1 FOR UPDATE;", userId).Scan(&storedPassword);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password));
+	if (err != nil) {
+		return result, assertAuthorised(client, cancel, errors.New("incorrect password"));
+	}
+
+	// hand each shared category over to its highest-ranking member
+	rows, err := tx.Query(context.Background(), `
+		WITH heirs AS (
+			SELECT DISTINCT ON (category_members.category_id) category_members.category_id, category_members.user_id
+			FROM category_members
+				INNER JOIN categories ON category_members.category_id=categories.id
+			WHERE categories.owner_id=$1 AND category_members.user_id<>$1
+			ORDER BY category_members.category_id,
+				CASE category_members.role WHEN 'admin' THEN 3 WHEN 'editor' THEN 2 ELSE 1 END DESC,
+				category_members.created_at, category_members.user_id
+		)
+		UPDATE categories SET owner_id=heirs.user_id
+		FROM heirs, users
+		WHERE categories.id=heirs.category_id AND users.id=heirs.user_id
+		RETURNING categories.id, categories.title, users.id, users.username;`, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	transferredIds := []int{};
+	for rows.Next() {
+		var t TransferredCategory;
+		err = rows.Scan(&t.Category_Id, &t.Category_Title, &t.Owner_Id, &t.Owner);
+		if (err != nil) {
+			break;
+		}
+		result.Transferred_Categories = append(result.Transferred_Categories, t);
+		transferredIds = append(transferredIds, t.Category_Id);
+	}
+	rows.Close();
+	if (err == nil) {
+		err = rows.Err();
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	// the new owners were members until now
+	_, err = tx.Exec(context.Background(), `
+		DELETE FROM category_members USING categories
+		WHERE category_members.category_id=categories.id AND category_members.user_id=categories.owner_id AND categories.id = ANY($1);`, transferredIds)
+	// categories that stay must not go with the user's workspaces, or with the categories of the user's they are nested in
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "UPDATE categories SET workspace_id=NULL WHERE owner_id<>$1 AND workspace_id IN (SELECT id FROM workspaces WHERE owner_id=$1);", userId)
+	}
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "UPDATE categories SET parent_id=NULL WHERE owner_id<>$1 AND parent_id IN (SELECT id FROM categories WHERE owner_id=$1);", userId)
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	// tasks do not go away with their category on their own, so they are purged first, trash included
+	var blobKeys, uploadKeys, exportKeys []string;
+	result.Deleted_Tasks, blobKeys, err = purgeTasks(tx, "category_id IN (SELECT id FROM categories WHERE owner_id=$1)", userId);
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "WITH deleted AS (DELETE FROM categories WHERE owner_id=$1 RETURNING id) SELECT COUNT(*) FROM deleted;", userId).Scan(&result.Deleted_Categories);
+	}
+	// the files the user attached to other users' tasks go with the user, but their contents have to be deleted by hand
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "WITH deleted AS (DELETE FROM task_attachments WHERE uploader_id=$1 RETURNING blob_key) SELECT ARRAY(SELECT blob_key FROM deleted);", userId).Scan(&uploadKeys);
+	}
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "SELECT ARRAY(SELECT blob_key FROM account_exports WHERE user_id=$1 AND blob_key IS NOT NULL);", userId).Scan(&exportKeys);
+	}
+	// everything else the user owns goes with them (see create_tables.sql)
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "DELETE FROM users WHERE id=$1;", userId);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	deleteBlobs(append(append(blobKeys, uploadKeys...), exportKeys...));
+
+	return result, nil;
+}
+
+/* ------------------------------------------------------------ HELPER FUNCTIONS --------------------- */
+// reports to the client that the user has no export with the given id,
+//		and stops execution of any remaining function-calls
+func assertAccountExportFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("there is no export with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to download export: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that an export cannot be downloaded yet, or failed,
+//		and stops execution of any remaining function-calls
+func assertAccountExportReady(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to download export: %v\n", e);
+
+	// return http code of 409 to the client, which stands for "Conflict"
+	client.JSON(409, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -6,6 +6,14 @@ import (
 	"github.com/jackc/pgx/v4"
 	"context"
 	"os"
+	"strings"
+	"strconv"
+	"net/url"
+	"time"
+	_ "time/tzdata"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"github.com/joho/godotenv"
 	"github.com/emvi/null"
 	"golang.org/x/crypto/bcrypt"
@@ -19,30 +27,104 @@ import (
 //		causing an empty object ("{}") to be returned
 
 type Credentials struct {
-	Username string `json:username`
-	Password string `json:password`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Timezone string `json:"timezone"`
 }
 
 type User struct {
-	Id int `json:id`
-	Username string `json:username`
+	Id int `json:"id"`
+	Username string `json:"username"`
+	Timezone string `json:"timezone"`
+	Token string `json:"token,omitempty"`
+}
+
+// a nullable point in time that is always sent to the client in RFC 3339 format,
+//		e.g. "2018-04-13T19:24:00+08:00"
+type Timestamp struct {
+	null.Time
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if (!t.Valid) {
+		return []byte("null"), nil
+	}
+
+	return []byte(`"` + t.Time.Time.Format(time.RFC3339) + `"`), nil
+}
+
+// a nullable calendar date without a time-of-day, e.g. "2018-04-13"
+type Date struct {
+	null.Time
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if (!d.Valid) {
+		return []byte("null"), nil
+	}
+
+	return []byte(`"` + d.Time.Time.Format("2006-01-02") + `"`), nil
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if (string(data) == "null" || string(data) == `""`) {
+		d.SetNil();
+		return nil;
+	}
+
+	value, err := time.Parse(`"2006-01-02"`, string(data));
+	if (err != nil) {
+		return err;
+	}
+
+	d.SetValid(value);
+	return nil;
 }
 
+// note: a task either has a timed Deadline, or is due on Deadline_Date as an all-day task;
+//		for all-day tasks, Deadline is filled in as the end of that day in the user's timezone
 type Task struct {
 	Id int `json:"id"`
 	Title string `json:"title"`
 	Description string `json:"description"`
 	Category_Id int `json:"category_id"`
 	Category string `json:"category"`
-	Deadline null.Time `json:"deadline"`
+	Deadline Timestamp `json:"deadline"`
+	Deadline_Date Date `json:"deadline_date"`
+	All_Day bool `json:"all_day"`
 	Completed bool `json:"completed"`
-	Created_at null.Time `json:"created_at"`
-	Updated_at null.Time `json:"updated_at"`
+	Created_at Timestamp `json:"created_at"`
+	Updated_at Timestamp `json:"updated_at"`
+	// tasks in a category are shown in ascending order of rank (see ranking.go)
+	Rank string `json:"rank"`
+	Assignees []Assignee `json:"assignees"`
+	Comment_Count int `json:"comment_count"`
+	// whether the task is waiting on an incomplete task (see task_dependencies)
+	Blocked bool `json:"blocked"`
+	// the column of its category's board the task is in; Completed is whether this is a done status (see workflows.go)
+	Status_Id null.Int64 `json:"status_id"`
+	Status null.String `json:"status"`
+	Checklist []ChecklistItem `json:"checklist"`
+	// "low", "medium" or "high"
+	Priority null.String `json:"priority"`
+	Tags []string `json:"tags"`
+	// how often the task repeats, as an iCalendar RRULE value, e.g. "FREQ=WEEKLY;BYDAY=MO"
+	Recurrence null.String `json:"recurrence"`
+	// how long the task is expected to take, against the time tracked on it so far (see timetracking.go)
+	Estimate_Minutes null.Int64 `json:"estimate_minutes"`
+	Tracked_Minutes int `json:"tracked_minutes"`
 }
 
 type Category struct {
 	Id int `json:"category_id"`
 	Title string `json:"category_title"`
+	// the role the logged-in user has in the category (see sharing.go)
+	Role string `json:"role"`
+	// where the category sits in the hierarchy (see workspaces.go), null at the top level
+	Workspace_Id null.Int64 `json:"workspace_id"`
+	Parent_Id null.Int64 `json:"parent_id"`
+	// only filled in when categories are returned as a tree
+	Children []Category `json:"children,omitempty"`
 }
 
 type CreateTaskParams struct {
@@ -50,14 +132,26 @@ type CreateTaskParams struct {
 	Description string `json:"description"`
 	Category_Id string `json:"category_id"`
 	Deadline null.Time `json:"deadline"`
+	Deadline_Date Date `json:"deadline_date"`
+	Priority null.String `json:"priority"`
+	Tags []string `json:"tags"`
+	Recurrence null.String `json:"recurrence"`
 }
 
 type UpdateTaskParams struct {
-	Id int `json:id`
+	Id int `json:"id"`
 	Title string `json:"title"`
 	Description string `json:"description"`
 	Category_Id int `json:"category_id"`
-	Deadline null.Time `json:"deadline"`	
+	Deadline null.Time `json:"deadline"`
+	Deadline_Date Date `json:"deadline_date"`
+	Priority null.String `json:"priority"`
+	Tags []string `json:"tags"`
+	Recurrence null.String `json:"recurrence"`
+}
+
+type SetTimezoneParams struct {
+	Timezone string `json:"timezone"`
 }
 
 type GetTaskByIdParams struct {
@@ -65,7 +159,9 @@ type GetTaskByIdParams struct {
 }
 
 type GetTaskByCategoryIdParams struct {
-	Category_Id int `json:category_id`
+	Category_Id int `json:"category_id"`
+	// also return the tasks of every category nested inside this one
+	Include_Descendants bool `json:"include_descendants"`
 }
 
 // CORS middleware
@@ -73,10 +169,11 @@ func CORSMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
         c.Header("Access-Control-Allow-Origin", "*")
         c.Header("Access-Control-Allow-Credentials", "true")
-        c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+        c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Last-Event-ID")
         c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
 
-        if c.Request.Method == "OPTIONS" {
+        // CalDAV apps send OPTIONS to find out what /dav supports, rather than as a CORS preflight
+        if c.Request.Method == "OPTIONS" && !strings.HasPrefix(c.Request.URL.Path, "/dav/") {
             c.AbortWithStatus(204)
             return
         }
@@ -85,12 +182,52 @@ func CORSMiddleware() gin.HandlerFunc {
     }
 }
 
+// writes a line to the log for every request, as gin.Default() does, but without the secrets some addresses hold:
+//		the session token /events takes as ?token=, and the tokens in the addresses of calendar feeds and share links
+func logFormatter(param gin.LogFormatterParams) string {
+	path := param.Path;
+	if i := strings.Index(path, "?"); (i >= 0) {
+		if query, err := url.ParseQuery(path[i + 1:]); (err == nil && query.Get("token") != "") {
+			query.Set("token", "REDACTED");
+			path = path[:i] + "?" + query.Encode();
+		}
+	}
+	for _, prefix := range []string{calendarFeedPath, sharedListPath} {
+		if (strings.HasPrefix(path, prefix)) {
+			path = prefix + "REDACTED";
+		}
+	}
+
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		path,
+		param.ErrorMessage,
+	)
+}
+
 func main() {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(logFormatter), gin.Recovery());
 
 	// allow CORS
 	r.Use(CORSMiddleware());
 
+	// pass changes on to the clients following /events
+	go events.run();
+
+	// send the queued webhook deliveries
+	go runWebhookDeliveries();
+
+	// put together the exports users have asked for
+	go runAccountExports();
+
+	// permanently delete tasks that have been in the trash for longer than the retention period
+	go purgeExpiredTrashPeriodically();
+
 	/* --------------------------------------------------------------- URL ENDPOINTS -------------- */
 
 	// ping test
@@ -104,11 +241,21 @@ func main() {
 
 		var params Credentials;
 		err := c.BindJSON(&params);
-		assertJSONSuccess(c, cancel, err);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		// new users default to UTC until they tell us otherwise
+		if (params.Timezone == "") {
+			params.Timezone = "UTC";
+		}
+		if (assertValidTimezone(c, cancel, params.Timezone) != nil) {
+			return;
+		}
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(params.Password), 8)
 
-		details, err := signUp(params.Username, hashedPassword, c, cancel)
+		details, err := signUp(params.Username, hashedPassword, params.Timezone, c, cancel)
 
 		if (err == nil) {
 			c.JSON(200, details);
@@ -121,9 +268,9 @@ func main() {
 
 		var params Credentials;
 		err := c.BindJSON(&params);
-		assertJSONSuccess(c, cancel, err);
-
-		fmt.Println(params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
 
 		details, err := logIn(params.Username, params.Password, c, cancel)
 
@@ -136,120 +283,2431 @@ func main() {
 	r.POST("/alltasks", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var taskList []Task = getAllTasks(c, cancel);
-		c.JSON(200, taskList)
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = getAllTasks(user.Id, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
 	})
 
 	// get all completed tasks
 	r.GET("/completedtasks", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var taskList []Task = getCompletedTasks(c, cancel);
-		c.JSON(200, taskList)
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = getCompletedTasks(user.Id, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
 	})
 
 	// get all incomplete tasks
 	r.GET("/incompletetasks", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var taskList []Task = getIncompleteTasks(c, cancel);
-		c.JSON(200, taskList)
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = getIncompleteTasks(user.Id, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
+	})
+
+	// get incomplete tasks that are due today or overdue, in the user's timezone
+	r.GET("/todaytasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = localiseTasks(getIncompleteTasks(user.Id, c, cancel), loc);
+		c.JSON(200, todayView(taskList, time.Now(), loc))
+	})
+
+	// get incomplete tasks due over the next few days, grouped by day
+	r.POST("/upcomingtasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetUpcomingTasksParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (params.Days <= 0) {
+			params.Days = defaultUpcomingDays;
+		} else if (params.Days > maxUpcomingDays) {
+			params.Days = maxUpcomingDays;
+		}
+
+		var taskList []Task = localiseTasks(getIncompleteTasks(user.Id, c, cancel), loc);
+		c.JSON(200, upcomingView(taskList, params.Days, time.Now(), loc))
+	})
+
+	// get incomplete tasks whose deadline has passed
+	r.GET("/overduetasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = localiseTasks(getIncompleteTasks(user.Id, c, cancel), loc);
+		c.JSON(200, overdueView(taskList, time.Now()))
+	})
+
+	// get incomplete tasks that have no deadline
+	r.GET("/unscheduledtasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = localiseTasks(getIncompleteTasks(user.Id, c, cancel), loc);
+		c.JSON(200, unscheduledView(taskList))
+	})
+
+	// get the number of tasks in each of the smart views above, for badges
+	r.GET("/smartviewcounts", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = localiseTasks(getIncompleteTasks(user.Id, c, cancel), loc);
+		c.JSON(200, smartViewCounts(taskList, time.Now(), loc))
 	})
 
 	// get a specific task by id
 	r.POST("/gettask", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
 		var params GetTaskByIdParams;
-		err := c.BindJSON(&params);
-		assertJSONSuccess(c, cancel, err);
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
 
-		var t Task = getTask(params.Id, c, cancel);
+		t, err := getTask(params.Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		c.JSON(200, t)
+		c.JSON(200, localiseTask(t, loc))
 	})
 
 	// get tasks by category id
 	r.POST("/gettaskbycategoryid", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
 		var params GetTaskByCategoryIdParams
-		err := c.BindJSON(&params);
-		assertJSONSuccess(c, cancel, err);
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleViewer, c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		var taskList []Task = getTaskByCategoryId(params.Category_Id, c, cancel);
+		var taskList []Task;
+		if (params.Include_Descendants) {
+			taskList = getTasksInCategoryTree(params.Category_Id, user.Id, c, cancel);
+		} else {
+			taskList = getTaskByCategoryId(params.Category_Id, c, cancel);
+		}
 
-		c.JSON(200, taskList)
+		c.JSON(200, localiseTasks(taskList, loc))
 	})
 
 	// update a specific task by id
 	r.POST("/updatetask", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
 		var params UpdateTaskParams
-		err := c.BindJSON(&params);
-		assertJSONSuccess(c, cancel, err);
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertSingleDeadline(c, cancel, params.Deadline, params.Deadline_Date) != nil) {
+			return;
+		}
+		if (assertValidPriority(c, cancel, params.Priority) != nil) {
+			return;
+		}
+		if (assertValidRecurrence(c, cancel, params.Recurrence) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleEditor, c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		updateTask(params, c, cancel)
+		if (updateTask(params, user.Id, c, cancel) != nil) {
+			return;
+		}
 
 		c.JSON(200, fmt.Sprintf("Successfully updated task with id: %v", params.Id))
 	})
 
-	// mark a task as completed by id
-	r.POST("/completetask", func(c *gin.Context) {
+	// get all tasks assigned to the logged-in user, across every category
+	r.GET("/assignedtome", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = getTasksByAssignee(user.Id, user.Id, 0, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
+	})
+
+	// get the tasks assigned to a user, optionally only within one category
+	r.POST("/tasksbyassignee", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetTasksByAssigneeParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		var taskList []Task = getTasksByAssignee(params.User_Id, user.Id, params.Category_Id, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
+	})
+
+	// assigns a task to one or more members of its category
+	r.POST("/assigntask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AssignTaskParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (assignTask(params, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully assigned task with id: %v to users with ids: %v", params.Id, params.User_Ids))
+	})
+
+	// removes a user from the assignees of a task; anyone can also use this to unassign themselves
+	r.POST("/unassigntask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params UnassignTaskParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		minimum := roleEditor;
+		if (params.User_Id == user.Id) {
+			minimum = roleViewer;
+		}
+		if (authorizeTask(user.Id, params.Id, minimum, c, cancel) != nil) {
+			return;
+		}
+
+		if (unassignTask(params.Id, params.User_Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully unassigned user with id: %v from task with id: %v", params.User_Id, params.Id))
+	})
+
+	// get the comments on a task, oldest first
+	r.POST("/taskcomments", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetCommentsParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		var commentList []Comment = getComments(params.Task_Id, c, cancel);
+		c.JSON(200, localiseComments(commentList, loc))
+	})
+
+	// adds a comment to a task
+	r.POST("/addcomment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AddCommentParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertCommentBody(c, cancel, params.Body) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		id, err := addComment(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// changes the body of a comment the logged-in user wrote
+	r.POST("/editcomment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params EditCommentParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertCommentBody(c, cancel, params.Body) != nil) {
+			return;
+		}
+
+		// the author needs to still have access to the task to change what they wrote about it
+		taskId, err := commentTaskId(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, taskId, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		if (editComment(params, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully edited comment with id: %v", params.Id))
+	})
+
+	// deletes a comment
+	r.POST("/deletecomment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteCommentParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		taskId, err := commentTaskId(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, taskId, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		if (deleteComment(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted comment with id: %v", params.Id))
+	})
+
+	// get the files attached to a task
+	r.POST("/taskattachments", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetTaskAttachmentsParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		var attachmentList []Attachment = getAttachments(params.Task_Id, c, cancel);
+		c.JSON(200, localiseAttachments(attachmentList, loc))
+	})
+
+	// attaches a file to a task; unlike the other endpoints, this one takes a multipart form with the fields
+	//		"task_id", "file" and optionally "sha256", the checksum of the file as the client sent it
+	r.POST("/uploadattachment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		header, err := attachmentFormFile(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		taskId, err := strconv.Atoi(c.PostForm("task_id"));
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, taskId, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		upload, err := readAttachment(header, c.PostForm("sha256"), c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		attachment, err := addAttachment(taskId, upload, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, localiseAttachments([]Attachment{attachment}, loc)[0])
+	})
+
+	// downloads a file attached to a task
+	r.POST("/downloadattachment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetAttachmentParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		attachment, key, err := getAttachment(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, attachment.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		serveAttachment(attachment, key, c, cancel);
+	})
+
+	// removes a file from a task
+	r.POST("/deleteattachment", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetAttachmentParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		attachment, _, err := getAttachment(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, attachment.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (deleteAttachment(params.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted attachment with id: %v", params.Id))
+	})
+
+	// get the incomplete tasks that are not waiting on any other task
+	r.GET("/readytasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []Task = getReadyTasks(user.Id, c, cancel);
+		c.JSON(200, localiseTasks(taskList, loc))
+	})
+
+	// get what a task is blocked by and what it blocks
+	r.POST("/taskdependencies", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskDependenciesParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		dependencies, err := getTaskDependencies(params.Task_Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, dependencies)
+	})
+
+	// makes a task blocked by another task
+	r.POST("/adddependency", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DependencyParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		// the blocked task is the one being changed, the blocker only needs to be visible
+		if (authorizeTask(user.Id, params.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Blocked_By_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		if (addDependency(params, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Task with id: %v is now blocked by task with id: %v", params.Task_Id, params.Blocked_By_Id))
+	})
+
+	// stops a task from being blocked by another task
+	r.POST("/removedependency", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DependencyParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (removeDependency(params, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Task with id: %v is no longer blocked by task with id: %v", params.Task_Id, params.Blocked_By_Id))
+	})
+
+	// get the statuses of a category's workflow
+	r.POST("/workflow", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetWorkflowParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleViewer, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, getWorkflow(params.Category_Id, c, cancel))
+	})
+
+	// replaces the statuses of a category's workflow
+	r.POST("/updateworkflow", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params UpdateWorkflowParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		if (updateWorkflow(params, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, getWorkflow(params.Category_Id, c, cancel))
+	})
+
+	// get the tasks of a category grouped by status, as the columns of a board
+	r.POST("/board", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetWorkflowParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleViewer, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		board := getBoard(params.Category_Id, c, cancel);
+		for i := range board.Columns {
+			board.Columns[i].Tasks = localiseTasks(board.Columns[i].Tasks, loc);
+		}
+
+		c.JSON(200, board)
+	})
+
+	// moves a task to another column of its category's board
+	r.POST("/settaskstatus", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SetTaskStatusParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		unblocked, err := setTaskStatus(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{
+			"message": fmt.Sprintf("Successfully moved task with id: %v to status with id: %v", params.Id, params.Status_Id),
+			"unblocked": unblocked,
+		})
+	})
+
+	// get the workspaces the logged-in user owns or has categories shared from
+	r.GET("/allworkspaces", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var workspaceList []Workspace = getWorkspaces(user.Id, c, cancel);
+		for i := range workspaceList {
+			workspaceList[i].Created_at.Time.Time = workspaceList[i].Created_at.Time.Time.In(loc);
+		}
+
+		c.JSON(200, workspaceList)
+	})
+
+	// adds a workspace
+	r.POST("/addworkspace", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateWorkspaceParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		workspace, err := addWorkspace(params.Title, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, workspace)
+	})
+
+	// renames a workspace
+	r.POST("/renameworkspace", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params RenameWorkspaceParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (renameWorkspace(params, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully renamed workspace with id: %v", params.Id))
+	})
+
+	// permanently deletes a workspace, with every category and task in it
+	r.POST("/deleteworkspace", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteWorkspaceParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		count, err := deleteWorkspace(params.Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted workspace with id: %v and %v categories in it", params.Id, count))
+	})
+
+	// moves a category under another category, or to the top level of a workspace
+	r.POST("/movecategory", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params MoveCategoryParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		role, err := authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (params.Parent_Id != 0) {
+			_, err = authorizeCategory(user.Id, params.Parent_Id, roleAdmin, c, cancel);
+		} else if (params.Workspace_Id != 0) {
+			err = authorizeWorkspace(user.Id, params.Workspace_Id, c, cancel);
+		}
+		if (err != nil) {
+			return;
+		}
+
+		if (moveCategory(params, role, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully moved category with id: %v", params.Category_Id))
+	})
+
+	// adds an item to the end of a task's checklist
+	r.POST("/addchecklistitem", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AddChecklistItemParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		id, err := addChecklistItem(params, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// renames a checklist item, or ticks it off
+	r.POST("/updatechecklistitem", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params UpdateChecklistItemParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		taskId, err := checklistItemTaskId(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, taskId, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (updateChecklistItem(params, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully updated checklist item with id: %v", params.Id))
+	})
+
+	// removes an item from a task's checklist
+	r.POST("/deletechecklistitem", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteChecklistItemParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		taskId, err := checklistItemTaskId(params.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, taskId, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (deleteChecklistItem(params.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted checklist item with id: %v", params.Id))
+	})
+
+	// get the templates the logged-in user has saved
+	r.GET("/alltemplates", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var templateList []Template = getTemplates(user.Id, c, cancel);
+		for i := range templateList {
+			templateList[i].Created_at.Time.Time = templateList[i].Created_at.Time.Time.In(loc);
+		}
+
+		c.JSON(200, templateList)
+	})
+
+	// saves a template
+	r.POST("/addtemplate", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateTemplateParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		id, err := addTemplate(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// saves the tasks in a category as a template
+	r.POST("/savecategoryastemplate", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SaveCategoryAsTemplateParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleViewer, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		id, err := saveCategoryAsTemplate(params, user.Id, locationOf(user), c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// deletes a template
+	r.POST("/deletetemplate", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteTemplateParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (deleteTemplate(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted template with id: %v", params.Id))
+	})
+
+	// creates every task of a template in a category
+	r.POST("/instantiatetemplate", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params InstantiateTemplateParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleEditor, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		ids, err := instantiateTemplate(params, user.Id, locationOf(user), c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"ids": ids})
+	})
+
+	// sets how long a task is expected to take, in minutes or pomodoros
+	r.POST("/setestimate", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SetEstimateParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		minutes, err := estimateMinutes(params);
+		if (err != nil) {
+			assertValidTimeEntry(c, cancel, err);
+			return;
+		}
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (setEstimate(params.Id, minutes, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully set the estimate of task with id: %v", params.Id))
+	})
+
+	// starts timing the logged-in user's work on a task, stopping any timer they already had running
+	r.POST("/starttimer", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params StartTimerParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		id, err := startTimer(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// stops the logged-in user's running timer
+	r.POST("/stoptimer", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		id, err := stopTimer(user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// adds time spent on a task by hand
+	r.POST("/addtimeentry", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AddTimeEntryParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		id, err := addTimeEntry(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": id})
+	})
+
+	// removes one of the logged-in user's time entries
+	r.POST("/deletetimeentry", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteTimeEntryParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (deleteTimeEntry(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted time entry with id: %v", params.Id))
+	})
+
+	// get the time tracked on a task, newest first
+	r.POST("/tasktimeentries", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTimeEntriesParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Task_Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		var entryList []TimeEntry = getTimeEntries(params.Task_Id, c, cancel);
+
+		c.JSON(200, localiseTimeEntries(entryList, locationOf(user)))
+	})
+
+	// get the estimated and tracked time of a category's open and completed tasks
+	r.POST("/categorytime", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CategoryTimeParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleViewer, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, getCategoryTime(params, user.Id, c, cancel))
+	})
+
+	// moves a task to a new position within its category
+	r.POST("/movetask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params MoveTaskParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		rank, err := moveTask(params, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{"id": params.Id, "rank": rank})
+	})
+
+	// mark a task as completed by id
+	r.POST("/completetask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskByIdParams;
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		unblocked, err := completeTask(params.Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, gin.H{
+			"message": fmt.Sprintf("Successfully completed task with id: %v", params.Id),
+			// tasks that were only waiting on this one, and can now be worked on
+			"unblocked": unblocked,
+		})
+	})
+
+	// mark a task as incomplete by id
+	r.POST("/incompletetask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskByIdParams;
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (incompleteTask(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully marked task as incomplete with id: %v", params.Id))
+	})
+
+	// deletes a task by id
+	r.POST("/deletetask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskByIdParams;
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (deleteTask(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.String(200, fmt.Sprintf("Successfully moved task with id: %v to the trash", params.Id))
+	})
+
+	// get all tasks in the trash
+	r.GET("/trashedtasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var taskList []TrashedTask = getTrashedTasks(user.Id, c, cancel);
+		for i := range taskList {
+			taskList[i] = localiseTrashedTask(taskList[i], loc);
+		}
+		c.JSON(200, taskList)
+	})
+
+	// restores a task from the trash by id
+	r.POST("/restoretask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskByIdParams;
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (restoreTask(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.String(200, fmt.Sprintf("Successfully restored task with id: %v", params.Id))
+	})
+
+	// permanently deletes a task in the trash by id
+	r.POST("/purgetask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetTaskByIdParams;
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (purgeTask(params.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.String(200, fmt.Sprintf("Successfully permanently deleted task with id: %v", params.Id))
+	})
+
+	// permanently deletes every task in the trash
+	r.POST("/emptytrash", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		count, err := emptyTrash(user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.String(200, fmt.Sprintf("Successfully permanently deleted %v tasks", count))
+	})
+
+	// adds a task
+	r.POST("/addtask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateTaskParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertSingleDeadline(c, cancel, params.Deadline, params.Deadline_Date) != nil) {
+			return;
+		}
+		if (assertValidPriority(c, cancel, params.Priority) != nil) {
+			return;
+		}
+		if (assertValidRecurrence(c, cancel, params.Recurrence) != nil) {
+			return;
+		}
+
+		categoryId, err := strconv.Atoi(params.Category_Id);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, categoryId, roleEditor, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		addTask(params, user.Id, c, cancel)
+	})
+
+	// create a task from a line of text such as "buy milk tomorrow 5pm #CCA !high",
+	//		or with dry_run, only return what the text was understood as
+	r.POST("/quickadd", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params QuickAddParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		result := previewQuickAdd(params, user, c, cancel);
+		if (params.Dry_Run) {
+			c.JSON(200, result)
+			return;
+		}
+		if (assertQuickAddComplete(c, cancel, result) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, result.Category_Id, roleEditor, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		t, err := addQuickAddTask(result, user, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		result.Task = &t;
+
+		c.JSON(200, result)
+	})
+
+	// get a page of the change history of a task, newest change first
+	r.POST("/taskhistory", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetTaskHistoryParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleViewer, c, cancel) != nil) {
+			return;
+		}
+
+		if (params.Limit <= 0) {
+			params.Limit = defaultHistoryPageSize;
+		} else if (params.Limit > maxHistoryPageSize) {
+			params.Limit = maxHistoryPageSize;
+		}
+
+		c.JSON(200, localiseHistory(getTaskHistory(params, c, cancel), loc))
+	})
+
+	// reverts a task to how it was at an earlier revision
+	r.POST("/reverttask", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params RevertTaskParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		if (authorizeTask(user.Id, params.Id, roleEditor, c, cancel) != nil) {
+			return;
+		}
+
+		if (revertTask(params.Id, params.Revision, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully reverted task with id: %v to revision: %v", params.Id, params.Revision))
+	})
+
+	// gets a list of all categories
+	r.GET("/allcategories", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var categoryList []Category = getAllCategories(user.Id, c, cancel);
+
+		// "/allcategories?tree=true" returns the categories nested inside their workspaces and parents instead of as a flat list
+		if (c.Query("tree") == "true") {
+			c.JSON(200, buildCategoryTree(getWorkspaces(user.Id, c, cancel), categoryList))
+			return;
+		}
+
+		c.JSON(200, categoryList)
+	})
+
+	// sets the timezone that deadlines and timestamps are shown in for the logged-in user
+	r.POST("/settimezone", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SetTimezoneParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidTimezone(c, cancel, params.Timezone) != nil) {
+			return;
+		}
+
+		setTimezone(user.Id, params.Timezone, c, cancel);
+
+		c.JSON(200, fmt.Sprintf("Successfully set timezone to: %v", params.Timezone))
+	})
+
+	// creates a new category owned by the logged-in user
+	r.POST("/addcategory", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateCategoryParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		// a category can only be added under a category the user can manage, or to a workspace the user owns
+		if (params.Parent_Id != 0) {
+			_, err = authorizeCategory(user.Id, params.Parent_Id, roleAdmin, c, cancel);
+		} else if (params.Workspace_Id != 0) {
+			err = authorizeWorkspace(user.Id, params.Workspace_Id, c, cancel);
+		}
+		if (err != nil) {
+			return;
+		}
+
+		category, err := addCategory(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, category)
+	})
+
+	// lists who a category is shared with, and their roles
+	r.POST("/categorymembers", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params GetCategoryMembersParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		_, err = authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var memberList []Membership = getCategoryMembers(params.Category_Id, c, cancel);
+		for i := range memberList {
+			memberList[i].Created_at.Time.Time = memberList[i].Created_at.Time.Time.In(loc);
+		}
+		c.JSON(200, memberList)
+	})
+
+	// shares a category with another user by their username
+	r.POST("/sharecategory", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params ShareCategoryParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidRole(c, cancel, params.Role) != nil) {
+			return;
+		}
+		role, err := authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (assertCanManage(c, cancel, role, params.Role) != nil) {
+			return;
+		}
+
+		if (shareCategory(params, role, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully shared category with id: %v with %v as %v", params.Category_Id, params.Username, params.Role))
+	})
+
+	// creates an invitation token that lets anyone who has it join a category
+	r.POST("/createinvitation", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		loc := locationOf(user);
+
+		var params CreateInvitationParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidRole(c, cancel, params.Role) != nil) {
+			return;
+		}
+		role, err := authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (assertCanManage(c, cancel, role, params.Role) != nil) {
+			return;
+		}
+
+		invitation, err := createInvitation(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		invitation.Expires_at.Time.Time = invitation.Expires_at.Time.Time.In(loc);
+		c.JSON(200, invitation)
+	})
+
+	// joins the category an invitation token is for
+	r.POST("/acceptinvitation", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AcceptInvitationParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		category, err := acceptInvitation(params.Token, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, category)
+	})
+
+	// changes the role of a member of a category
+	r.POST("/updatemembership", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params UpdateMembershipParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidRole(c, cancel, params.Role) != nil) {
+			return;
+		}
+		role, err := authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		currentRole, err := memberRole(params.Category_Id, params.User_Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (assertCanManage(c, cancel, role, currentRole, params.Role) != nil) {
+			return;
+		}
+
+		if (updateMembership(params, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully changed the role of user with id: %v to %v", params.User_Id, params.Role))
+	})
+
+	// takes away a user's access to a category; members can also use this to leave a category themselves
+	r.POST("/revokemembership", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params RevokeMembershipParams
+		err = c.BindJSON(&params)
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (params.User_Id != user.Id) {
+			role, err := authorizeCategory(user.Id, params.Category_Id, roleAdmin, c, cancel);
+			if (err != nil) {
+				return;
+			}
+			currentRole, err := memberRole(params.Category_Id, params.User_Id, c, cancel);
+			if (err != nil) {
+				return;
+			}
+			if (assertCanManage(c, cancel, role, currentRole) != nil) {
+				return;
+			}
+		}
+
+		if (revokeMembership(params.Category_Id, params.User_Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully removed user with id: %v from category with id: %v", params.User_Id, params.Category_Id))
+	})
+
+	// stream changes to the logged-in user's tasks and categories as Server-Sent Events; a reconnecting client sends
+	//		the id of the last event it got as the Last-Event-ID header (or ?last_event_id=) to get the events it missed
+	r.GET("/events", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		// browsers cannot set headers on an EventSource, so the session token may also be given as ?token=
+		if (c.GetHeader("Authorization") == "" && c.Query("token") != "") {
+			c.Request.Header.Set("Authorization", "Bearer " + c.Query("token"));
+		}
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		lastEventId := c.GetHeader("Last-Event-ID");
+		if (lastEventId == "") {
+			lastEventId = c.DefaultQuery("last_event_id", "0");
+		}
+		after, err := strconv.ParseInt(lastEventId, 10, 64);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		streamEvents(user, after, c, cancel);
+	})
+
+	// get what changed since the last sync, for clients that keep their own copy of the user's tasks and categories
+	r.POST("/syncpull", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SyncPullParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		after, err := decodeSyncCursor(params.Cursor);
+		if (err != nil) {
+			assertValidSync(c, cancel, err);
+			return;
+		}
+
+		result, err := syncPull(after, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		result.Tasks = localiseTasks(result.Tasks, locationOf(user));
+
+		c.JSON(200, result)
+	})
+
+	// apply the changes a client made to tasks while it was offline
+	r.POST("/syncpush", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params SyncPushParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (len(params.Mutations) > maxSyncBatchSize) {
+			assertValidSync(c, cancel, fmt.Errorf("at most %v mutations can be pushed at once", maxSyncBatchSize));
+			return;
+		}
+
+		c.JSON(200, gin.H{"results": syncPush(params.Mutations, user.Id, c, cancel)})
+	})
+
+	// register a URL to be sent change events; the response holds the secret deliveries are signed with, which is not shown again
+	r.POST("/addwebhook", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateWebhookParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidWebhook(c, cancel, params.Url, params.Event_Types) != nil) {
+			return;
+		}
+		if (params.Category_Id.Valid) {
+			_, err = authorizeCategory(user.Id, int(params.Category_Id.Int64), roleViewer, c, cancel);
+			if (err != nil) {
+				return;
+			}
+		}
+
+		webhook, err := addWebhook(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		webhook.Created_at.Time.Time = webhook.Created_at.Time.Time.In(locationOf(user));
+
+		c.JSON(200, webhook)
+	})
+
+	// get the user's webhooks
+	r.GET("/getwebhooks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		webhooks := getWebhooks(user.Id, c, cancel);
+		for i := range webhooks {
+			webhooks[i].Created_at.Time.Time = webhooks[i].Created_at.Time.Time.In(locationOf(user));
+		}
+
+		c.JSON(200, webhooks)
+	})
+
+	// change the URL or filters of a webhook, or pause and resume it
+	r.POST("/updatewebhook", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params UpdateWebhookParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidWebhook(c, cancel, params.Url, params.Event_Types) != nil) {
+			return;
+		}
+		if (params.Category_Id.Valid) {
+			_, err = authorizeCategory(user.Id, int(params.Category_Id.Int64), roleViewer, c, cancel);
+			if (err != nil) {
+				return;
+			}
+		}
+
+		webhook, err := updateWebhook(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		webhook.Created_at.Time.Time = webhook.Created_at.Time.Time.In(locationOf(user));
+
+		c.JSON(200, webhook)
+	})
+
+	// delete a webhook along with its delivery log
+	r.POST("/deletewebhook", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params WebhookIdParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (deleteWebhook(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
+
+		c.JSON(200, fmt.Sprintf("Successfully deleted webhook with id: %v", params.Id))
+	})
+
+	// send a "ping" event to a webhook, to check that its receiver works; the result shows up in the delivery log
+	r.POST("/testwebhook", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params WebhookIdParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		delivery, err := testWebhook(params.Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, localiseDelivery(delivery, locationOf(user)))
+	})
+
+	// get the newest deliveries of a webhook, newest first
+	r.POST("/webhookdeliveries", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params GetWebhookDeliveriesParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (assertValidDeliveryStatus(c, cancel, params.Status) != nil) {
+			return;
+		}
+
+		deliveries, err := getWebhookDeliveries(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, localiseDeliveries(deliveries, locationOf(user)))
+	})
+
+	// send a delivery again, e.g. a dead one once its receiver is fixed
+	r.POST("/redeliverwebhook", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params RedeliverWebhookParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		delivery, err := redeliverWebhook(params.Delivery_Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, localiseDelivery(delivery, locationOf(user)))
+	})
+
+	// get the address of the user's calendar feed, which calendar apps can subscribe to
+	r.GET("/calendarfeed", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		feed, err := getCalendarFeed(user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		feed.Created_at.Time.Time = feed.Created_at.Time.Time.In(locationOf(user));
+
+		c.JSON(200, feed)
+	})
+
+	// give the user's calendar feed a new address, so that whoever had the old one can no longer read it
+	r.POST("/rotatecalendarfeed", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		feed, err := rotateCalendarFeed(user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		feed.Created_at.Time.Time = feed.Created_at.Time.Time.In(locationOf(user));
+
+		c.JSON(200, feed)
+	})
+
+	// the calendar feed itself, read by calendar apps; the token in the address takes the place of logging in
+	r.GET(calendarFeedPath + ":file", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := calendarFeedUser(strings.TrimSuffix(c.Param("file"), ".ics"), c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		tasks := getAllTasks(user.Id, c, cancel);
+		if (c.IsAborted() || c.Writer.Written()) {
+			return;
+		}
+
+		c.Header("Content-Type", "text/calendar; charset=utf-8");
+		c.Header("Content-Disposition", "inline; filename=\"tasks.ics\"");
+		c.Status(200);
+		err = writeTaskCalendar(c.Writer, user.Username + "'s tasks", tasks, locationOf(user), calendarFeedOptions(c));
+		if (err != nil) {
+			fmt.Fprintf(os.Stderr, "Unable to write calendar feed: %v\n", err);
+		}
+	})
+
+	// creates tasks from an uploaded iCalendar or CSV file (see import.go); like /uploadattachment, this takes a multipart form,
+	//		with the fields "file", and optionally "format", "category_id" and "dry_run"
+	r.POST("/importtasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		data, filename, err := importFormFile(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		format, err := importFormat(c.PostForm("format"), filename, data);
+		if (err != nil) {
+			assertValidImport(c, cancel, err);
+			return;
+		}
+		categoryId := 0;
+		if (c.PostForm("category_id") != "") {
+			categoryId, err = strconv.Atoi(c.PostForm("category_id"));
+			if (assertJSONSuccess(c, cancel, err) != nil) {
+				return;
+			}
+			_, err = authorizeCategory(user.Id, categoryId, roleEditor, c, cancel);
+			if (err != nil) {
+				return;
+			}
+		}
+		dryRun, _ := strconv.ParseBool(c.PostForm("dry_run"));
+
+		file, err := readImportFile(format, data, locationOf(user));
+		if (err != nil) {
+			assertValidImport(c, cancel, err);
+			return;
+		}
+
+		result, err := importTasks(file, format, categoryId, dryRun, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, result)
+	})
+
+	r.POST("/importtodoist", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		data, _, err := importFormFile(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		export, skipped, err := readSourceExport(sourceTodoist, data, locationOf(user));
+		if (err != nil) {
+			assertValidImport(c, cancel, err);
+			return;
+		}
+
+		result, err := importFromSource(sourceTodoist, export, skipped, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, result)
+	})
+
+	r.POST("/importtrello", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		data, _, err := importFormFile(c, cancel);
+		if (err != nil) {
+			return;
+		}
+		export, skipped, err := readSourceExport(sourceTrello, data, locationOf(user));
+		if (err != nil) {
+			assertValidImport(c, cancel, err);
+			return;
+		}
+
+		result, err := importFromSource(sourceTrello, export, skipped, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, result)
+	})
+
+	// asks for an archive of everything the logged-in user has access to, which is put together in the background
+	r.POST("/exportaccount", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		export, err := requestAccountExport(user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, localiseAccountExport(export, locationOf(user)))
+	})
+
+	// returns the logged-in user's exports and how far along they are
+	r.GET("/accountexports", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		exports := getAccountExports(user.Id, c, cancel);
+		c.JSON(200, localiseAccountExports(exports, locationOf(user)))
+	})
+
+	// downloads the archive of an export once it is ready
+	r.POST("/downloadaccountexport", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params AccountExportIdParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		export, key, err := getAccountExport(params.Id, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		serveAccountExport(export, key, user.Username, c, cancel);
+	})
+
+	// deletes the logged-in user's account, once they have given their password again
+	r.POST("/deleteaccount", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params DeleteAccountParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+
+		result, err := deleteAccount(user.Id, params.Password, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		c.JSON(200, result)
+	})
+
+	// export a category, or any other filtered list of tasks, as a Markdown, plain text or HTML checklist (see textexport.go)
+	r.POST("/exporttasks", func(c *gin.Context) {
+		_, cancel := context.WithCancel(context.Background());
+
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params ExportTaskListParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (params.Format == "") {
+			params.Format = "markdown";
+		}
+		if (assertValidTaskList(c, cancel, params.TaskListFilter, params.Format) != nil) {
+			return;
+		}
+
+		list, err := getTaskList(normaliseTaskListFilter(params.TaskListFilter), user, c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		serveTaskList(list, params.Format, false, locationOf(user), c);
+	})
+
+	// create a read-only link to a filtered list of tasks, which anyone can open without logging in until it expires
+	r.POST("/createsharelink", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var params GetTaskByIdParams;
-		err := c.BindJSON(&params)
-		assertJSONSuccess(c, cancel, err);
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
+
+		var params CreateShareLinkParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (params.Format == "") {
+			params.Format = "html";
+		}
+		if (assertValidTaskList(c, cancel, params.TaskListFilter, params.Format) != nil) {
+			return;
+		}
+		if (assertValidShareExpiry(c, cancel, params.Expires_at) != nil) {
+			return;
+		}
+		if (params.Category_Id.Valid) {
+			_, err = authorizeCategory(user.Id, int(params.Category_Id.Int64), roleViewer, c, cancel);
+			if (err != nil) {
+				return;
+			}
+		}
 
-		completeTask(params.Id, c, cancel);
+		link, err := createShareLink(params, user.Id, c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		c.JSON(200, fmt.Sprintf("Successfully completed task with id: %v", params.Id))
+		c.JSON(200, localiseShareLinks([]ShareLink{link}, locationOf(user))[0])
 	})
 
-	// mark a task as incomplete by id
-	r.POST("/incompletetask", func(c *gin.Context) {
+	// get the logged-in user's share links
+	r.GET("/sharelinks", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var params GetTaskByIdParams;
-		err := c.BindJSON(&params)
-		assertJSONSuccess(c, cancel, err);
-
-		incompleteTask(params.Id, c, cancel);
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		c.JSON(200, fmt.Sprintf("Successfully marked task as incomplete with id: %v", params.Id))
+		c.JSON(200, localiseShareLinks(getShareLinks(user.Id, c, cancel), locationOf(user)))
 	})
 
-	// deletes a task by id
-	r.POST("/deletetask", func(c *gin.Context) {
+	// revoke a share link, so that its address stops working before it expires
+	r.POST("/revokesharelink", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var params GetTaskByIdParams;
-		err := c.BindJSON(&params)
-		assertJSONSuccess(c, cancel, err);
+		user, err := authenticate(c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		deleteTask(params.Id, c, cancel);
+		var params ShareLinkIdParams
+		err = c.BindJSON(&params);
+		if (assertJSONSuccess(c, cancel, err) != nil) {
+			return;
+		}
+		if (revokeShareLink(params.Id, user.Id, c, cancel) != nil) {
+			return;
+		}
 
-		c.String(200, fmt.Sprintf("Successfully deleted task with id: %v", params.Id))
+		c.JSON(200, fmt.Sprintf("Successfully revoked share link with id: %v", params.Id))
 	})
 
-	// adds a task
-	r.POST("/addtask", func(c *gin.Context) {
+	// the shared list itself, as it is now; the token in the address takes the place of logging in
+	r.GET(sharedListPath + ":file", func(c *gin.Context) {
 		_, cancel := context.WithCancel(context.Background());
 
-		var params CreateTaskParams
-		err := c.BindJSON(&params)
-		assertJSONSuccess(c, cancel, err);
+		token, format := parseShareLinkFile(c.Param("file"));
+		link, owner, err := openShareLink(token, c, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (format == "") {
+			format = link.Format;
+		}
+
+		list, err := getTaskList(link.Filter, owner, c, cancel);
+		if (err != nil) {
+			return;
+		}
 
-		addTask(params, c, cancel)		
+		// the address is the only thing keeping the list private, so it should not be indexed or passed on to other sites
+		c.Header("X-Robots-Tag", "noindex, nofollow");
+		c.Header("Referrer-Policy", "no-referrer");
+		c.Header("Cache-Control", "no-store");
+		serveTaskList(list, format, true, locationOf(owner), c);
 	})
 
-	// gets a list of all categories
-	r.GET("/allcategories", func(c *gin.Context) {
-		_, cancel := context.WithCancel(context.Background());
-		var categoryList []Category = getAllCategories(c, cancel);
-		c.JSON(200, categoryList)
+	// the CalDAV server, which task apps log in to with the user's username and password (see caldav.go)
+	for _, method := range davMethods {
+		r.Handle(method, "/dav/*path", serveCalDAV);
+	}
+
+	// where CalDAV apps look for the server when given only the host name
+	r.Any("/.well-known/caldav", func(c *gin.Context) {
+		c.Redirect(301, "/dav/")
 	})
 
 	// start the server
@@ -271,11 +2729,11 @@ func connectDB(client *gin.Context, cancel context.CancelFunc) (c *pgx.Conn) {
 }
 
 /* Creates an account for a new user and returns the details of the user */
-func signUp(username string, password []byte, client *gin.Context, cancel context.CancelFunc) (User, error) {
+func signUp(username string, password []byte, timezone string, client *gin.Context, cancel context.CancelFunc) (User, error) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	_, err := c.Exec(context.Background(), "INSERT INTO users (username, password) VALUES ($1, $2);", username, password);
+	_, err := c.Exec(context.Background(), "INSERT INTO users (username, password, timezone) VALUES ($1, $2, $3);", username, password, timezone);
 
 	var user User
 
@@ -291,11 +2749,19 @@ func signUp(username string, password []byte, client *gin.Context, cancel contex
 		return user, err;
 	}
 
-	err = c.QueryRow(context.Background(), "SELECT id, username FROM users WHERE username=$1", username).Scan(
+	err = c.QueryRow(context.Background(), "SELECT id, username, timezone FROM users WHERE username=$1", username).Scan(
 		&user.Id,
 		&user.Username,
+		&user.Timezone,
 	)
-	assertDBOperationSuccess(client, cancel, err);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
+
+	user.Token, err = createSession(c, user.Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
 
 	return user, nil;
 }
@@ -335,38 +2801,132 @@ func logIn(username string, password string, client *gin.Context, cancel context
 	}
 
 	// if credentials given are correct, return the user object
-	err = c.QueryRow(context.Background(), "SELECT id, username FROM users WHERE username=$1", username).Scan(
+	err = c.QueryRow(context.Background(), "SELECT id, username, timezone FROM users WHERE username=$1", username).Scan(
 		&user.Id,
 		&user.Username,
+		&user.Timezone,
 	)
-	assertDBOperationSuccess(client, cancel, err);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
+
+	user.Token, err = createSession(c, user.Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
+
+	return user, nil;
+}
+
+/* Starts a new session for a user and returns the token that identifies it */
+func createSession(c *pgx.Conn, userId int) (string, error) {
+	b := make([]byte, 32);
+	_, err := rand.Read(b);
+	if (err != nil) {
+		return "", err;
+	}
+
+	token := hex.EncodeToString(b);
+	_, err = c.Exec(context.Background(), "INSERT INTO sessions (token, user_id) VALUES ($1, $2);", token, userId);
+
+	return token, err;
+}
+
+/* Returns the user that the session token in the "Authorization: Bearer <token>" header belongs to */
+func authenticate(client *gin.Context, cancel context.CancelFunc) (User, error) {
+	var user User;
+
+	token := strings.TrimSpace(strings.TrimPrefix(client.GetHeader("Authorization"), "Bearer "));
+	if (token == "") {
+		err := errors.New("missing session token");
+		assertAuthorised(client, cancel, err);
+
+		return user, err;
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	err := c.QueryRow(context.Background(), "SELECT users.id, users.username, users.timezone FROM sessions INNER JOIN users ON sessions.user_id=users.id WHERE sessions.token=$1;", token).Scan(
+		&user.Id,
+		&user.Username,
+		&user.Timezone,
+	)
+	if (err == pgx.ErrNoRows) {
+		err = errors.New("invalid session token");
+	}
+	if (assertAuthorised(client, cancel, err) != nil) {
+		return user, err;
+	}
 
 	return user, nil;
 }
 
-/* Returns an array of all Tasks stored in the database */
-func getAllTasks(client *gin.Context, cancel context.CancelFunc) ([]Task) {
+/* Returns the timezone of a user, or UTC if their timezone is not one we know of */
+func locationOf(user User) *time.Location {
+	loc, err := time.LoadLocation(user.Timezone);
+	if (err != nil) {
+		return time.UTC;
+	}
+
+	return loc;
+}
+
+/* Updates the timezone of a user */
+func setTimezone(userId int, timezone string, client *gin.Context, cancel context.CancelFunc) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	_, err := c.Exec(context.Background(), "UPDATE users SET timezone=$1 WHERE id=$2;", timezone, userId);
+	assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Reads a row returned by one of the task functions (e.g. public.get_all_tasks) into a Task,
+		any columns that come after the task's own columns are read into extra */
+func scanTask(row pgx.Row, t *Task, extra ...interface{}) error {
+	dest := []interface{}{
+		&t.Id,
+		&t.Title,
+		&t.Description,
+		&t.Category_Id,
+		&t.Category,
+		&t.Deadline,
+		&t.Deadline_Date,
+		&t.Completed,
+		&t.Created_at,
+		&t.Updated_at,
+		&t.Rank,
+		&t.Assignees,
+		&t.Comment_Count,
+		&t.Blocked,
+		&t.Status_Id,
+		&t.Status,
+		&t.Checklist,
+		&t.Priority,
+		&t.Tags,
+		&t.Recurrence,
+		&t.Estimate_Minutes,
+		&t.Tracked_Minutes,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	t.All_Day = t.Deadline_Date.Valid;
+
+	return err;
+}
+
+/* Returns an array of all Tasks in the categories a user has access to */
+func getAllTasks(userId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	tasks, err := c.Query(context.Background(), "SELECT * from public.get_all_tasks();")
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_all_tasks($1);", userId)
 	assertDBOperationSuccess(client, cancel, err);
 	defer tasks.Close();
 
 	var taskSlice []Task
 	for tasks.Next() {
 		var t Task
-		err = tasks.Scan(
-			&t.Id, 
-			&t.Title,
-			&t.Description,
-			&t.Category_Id,
-			&t.Category,
-			&t.Deadline,
-			&t.Completed,
-			&t.Created_at,
-			&t.Updated_at,	
-		)
+		err = scanTask(tasks, &t)
 		assertDBOperationSuccess(client, cancel, err);
 		taskSlice = append(taskSlice, t)
 	}
@@ -386,17 +2946,7 @@ func getTaskByCategoryId(category_id int, client *gin.Context, cancel context.Ca
 	var taskSlice []Task
 	for tasks.Next() {
 		var t Task
-		err = tasks.Scan(
-			&t.Id, 
-			&t.Title,
-			&t.Description,
-			&t.Category_Id,
-			&t.Category,
-			&t.Deadline,
-			&t.Completed,
-			&t.Created_at,
-			&t.Updated_at,	
-		)
+		err = scanTask(tasks, &t)
 		assertDBOperationSuccess(client, cancel, err);
 		taskSlice = append(taskSlice, t)
 	}
@@ -404,28 +2954,18 @@ func getTaskByCategoryId(category_id int, client *gin.Context, cancel context.Ca
 	return taskSlice;
 }
 
-func getCompletedTasks(client *gin.Context, cancel context.CancelFunc) ([]Task) {
+func getCompletedTasks(userId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	tasks, err := c.Query(context.Background(), "SELECT * from public.get_completed_tasks();")
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_completed_tasks($1);", userId)
 	assertDBOperationSuccess(client, cancel, err);
 	defer tasks.Close();
 
 	var taskSlice []Task
 	for tasks.Next() {
 		var t Task
-		err = tasks.Scan(
-			&t.Id, 
-			&t.Title,
-			&t.Description,
-			&t.Category_Id,
-			&t.Category,
-			&t.Deadline,
-			&t.Completed,
-			&t.Created_at,
-			&t.Updated_at,	
-		)
+		err = scanTask(tasks, &t)
 		assertDBOperationSuccess(client, cancel, err);
 		taskSlice = append(taskSlice, t)
 	}
@@ -433,28 +2973,18 @@ func getCompletedTasks(client *gin.Context, cancel context.CancelFunc) ([]Task)
 	return taskSlice;
 }
 
-func getIncompleteTasks(client *gin.Context, cancel context.CancelFunc) ([]Task) {
+func getIncompleteTasks(userId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	tasks, err := c.Query(context.Background(), "SELECT * from public.get_incomplete_tasks();")
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_incomplete_tasks($1);", userId)
 	assertDBOperationSuccess(client, cancel, err);
 	defer tasks.Close();
 
 	var taskSlice []Task
 	for tasks.Next() {
 		var t Task
-		err = tasks.Scan(
-			&t.Id, 
-			&t.Title,
-			&t.Description,
-			&t.Category_Id,
-			&t.Category,
-			&t.Deadline,
-			&t.Completed,
-			&t.Created_at,
-			&t.Updated_at,	
-		)
+		err = scanTask(tasks, &t)
 		assertDBOperationSuccess(client, cancel, err);
 		taskSlice = append(taskSlice, t)
 	}
@@ -462,90 +2992,183 @@ func getIncompleteTasks(client *gin.Context, cancel context.CancelFunc) ([]Task)
 	return taskSlice;
 }
 
-/* Return a Task by its id */
-func getTask(id int, client *gin.Context, cancel context.CancelFunc) (Task) {
+/* Return a Task by its id, if it is in a category the user has access to */
+func getTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) (Task, error) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
 	var t Task
 
-	err := c.QueryRow(context.Background(), "SELECT * from public.get_all_tasks() WHERE id=$1;", id).Scan(
-		&t.Id, 
-		&t.Title,
-		&t.Description,
-		&t.Category,
-		&t.Deadline,
-		&t.Completed,
-		&t.Created_at,
-		&t.Updated_at,		
-	)
-	assertDBOperationSuccess(client, cancel, err);
+	err := scanTask(c.QueryRow(context.Background(), "SELECT * from public.get_all_tasks($1) WHERE id=$2;", userId, id), &t)
+	if (err == pgx.ErrNoRows) {
+		return t, assertTaskFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return t, err;
+	}
 
-	return t;
+	return t, nil;
 }
 
 /* Update a Task by its id */
-func updateTask(t UpdateTaskParams, client *gin.Context, cancel context.CancelFunc) {
+func updateTask(t UpdateTaskParams, userId int, client *gin.Context, cancel context.CancelFunc) error {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	_, err := c.Exec(context.Background(), "UPDATE tasks SET category_id=$1, title=$2, description=$3, deadline=$4 WHERE id=$5;", t.Category_Id, t.Title, t.Description, t.Deadline, t.Id)
-	assertDBOperationSuccess(client, cancel, err);
+	err := changeTaskWith(c, t.Id, userId, actionUpdate, func(tx pgx.Tx) error {
+		return updateTaskFields(tx, t);
+	})
+	return assertTaskChanged(client, cancel, t.Id, err);
+}
+
+/* Writes the fields of a task, as part of a larger transaction; returns pgx.ErrNoRows if the task does not exist or is in the trash */
+func updateTaskFields(tx pgx.Tx, t UpdateTaskParams) error {
+	return writeTaskFields(tx, t, false, "");
+}
+
+// writes the fields of /updatetask to a task along with the assignments in extra, whose arguments are numbered from $11,
+//		all in one UPDATE so that the change is reported once; tasks in the trash are only written if includeTrashed is set
+func writeTaskFields(tx pgx.Tx, t UpdateTaskParams, includeTrashed bool, extra string, extraArgs ...interface{}) error {
+	// a task that is moved to another category goes to the end of that category
+	var rank null.String;
+	err := tx.QueryRow(context.Background(), "SELECT rank FROM tasks WHERE id=$1 AND category_id=$2;", t.Id, t.Category_Id).Scan(&rank);
+	if (err == pgx.ErrNoRows) {
+		err = lockCategory(tx, t.Category_Id);
+		if (err == nil) {
+			rank.String, err = rankAtEndOfCategory(tx, t.Category_Id);
+		}
+	}
+	if (err != nil) {
+		return err;
+	}
+
+	query := "UPDATE tasks SET category_id=$1, title=$2, description=$3, deadline=$4, deadline_date=$5, rank=$6, priority=$8, tags=COALESCE($9, '{}'::TEXT[]), recurrence=$10, updated_at=CURRENT_TIMESTAMP" + extra + " WHERE id=$7";
+	if (!includeTrashed) {
+		query += " AND deleted_at IS NULL";
+	}
+	args := append([]interface{}{t.Category_Id, t.Title, t.Description, t.Deadline, t.Deadline_Date, rank.String, t.Id, t.Priority, t.Tags, t.Recurrence}, extraArgs...);
+	commandTag, err := tx.Exec(context.Background(), query + ";", args...)
+	if (err == nil && commandTag.RowsAffected() != 1) {
+		err = pgx.ErrNoRows;
+	}
+	if (err != nil) {
+		return err;
+	}
+
+	// assignees who cannot see the category the task was moved to are no longer assigned to it
+	return removeStrayAssignees(tx, t.Category_Id);
 }
 
 /* Mark a Task as completed by its id */
-func completeTask(id int, client *gin.Context, cancel context.CancelFunc) {
+func completeTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) ([]DependencyTask, error) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	_, err := c.Exec(context.Background(), "UPDATE tasks SET completed='t' WHERE id=$1;", id);
-	assertDBOperationSuccess(client, cancel, err);
+	var unblocked []DependencyTask;
+	err := changeTaskWith(c, id, userId, actionComplete, func(tx pgx.Tx) error {
+		var wasCompleted bool;
+		err := tx.QueryRow(context.Background(), "UPDATE tasks SET completed='t', updated_at=CURRENT_TIMESTAMP FROM (SELECT completed FROM tasks WHERE id=$1) AS before WHERE id=$1 AND deleted_at IS NULL RETURNING before.completed;", id).Scan(&wasCompleted);
+		if (err != nil) {
+			return err;
+		}
+
+		unblocked, err = unblockedDependents(tx, id, userId, wasCompleted);
+		return err;
+	})
+	return unblocked, assertTaskChanged(client, cancel, id, err);
 }
 
 /* Mark a previously completed task as incomplete by its id */
-func incompleteTask(id int, client *gin.Context, cancel context.CancelFunc) {
+func incompleteTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	_, err := c.Exec(context.Background(), "UPDATE tasks SET completed='f' WHERE id=$1;", id);
-	assertDBOperationSuccess(client, cancel, err);
+	err := changeTask(c, id, userId, actionUncomplete, "UPDATE tasks SET completed='f', updated_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL;", id);
+	return assertTaskChanged(client, cancel, id, err);
 }
 
-/* Deletes a Task in the database with the corresponding id */
-func deleteTask(id int, client *gin.Context, cancel context.CancelFunc) {
+/* Moves a Task in the database with the corresponding id to the trash,
+		it stays there until it is restored or purged (see trash.go) */
+func deleteTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	// use Exec to execute a query that does not return a result set
-	commandTag, err := c.Exec(context.Background(), "DELETE FROM tasks where id=$1;", id)
-	assertDBOperationSuccess(client, cancel, err);
-	if commandTag.RowsAffected() != 1 {
-		fmt.Fprintf(os.Stderr, "No row found to delete\n")
-		client.JSON(500, gin.H{"error": err.Error()})
-		return;
-	}
+	err := changeTask(c, id, userId, actionDelete, "UPDATE tasks SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL;", id)
+	return assertTaskChanged(client, cancel, id, err);
 }
 
-/* Adds a Task to the database */
-func addTask(params CreateTaskParams, client *gin.Context, cancel context.CancelFunc) {
+/* Adds a Task to the database and returns its id */
+func addTask(params CreateTaskParams, userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	commandTag, err := c.Exec(context.Background(), "INSERT INTO tasks (category_id, title, description, deadline) VALUES ($1, $2, $3, $4);", params.Category_Id, params.Title, params.Description, params.Deadline)
-	assertDBOperationSuccess(client, cancel, err);
-	if commandTag.RowsAffected() != 1 {
-		fmt.Fprintf(os.Stderr, "Task not added to db\n")
-		client.JSON(500, gin.H{"error": err.Error()})
-		return;
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	id, err := insertTask(tx, params, userId);
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Inserts a task at the end of its category and records its creation in its history, as part of a larger transaction */
+func insertTask(tx pgx.Tx, params CreateTaskParams, userId int) (int, error) {
+	// new tasks go to the end of their category
+	var rank string;
+	err := lockCategory(tx, params.Category_Id);
+	if (err == nil) {
+		rank, err = rankAtEndOfCategory(tx, params.Category_Id);
+	}
+	if (err != nil) {
+		return 0, err;
+	}
+
+	var id int;
+	err = tx.QueryRow(context.Background(), "INSERT INTO tasks (category_id, title, description, deadline, deadline_date, rank, priority, tags, recurrence) VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, '{}'::TEXT[]), $9) RETURNING id;", params.Category_Id, params.Title, params.Description, params.Deadline, params.Deadline_Date, rank, params.Priority, params.Tags, params.Recurrence).Scan(&id)
+	if (err != nil) {
+		return 0, err;
+	}
+
+	after, err := loadTaskSnapshot(tx, id, false);
+	if (err == nil) {
+		err = insertRevision(tx, id, userId, actionCreate, nil, after);
+	}
+
+	return id, err;
+}
+
+/* Marks a task that was just created in the transaction as completed, recording it in the task's history as /completetask would */
+func completeNewTask(tx pgx.Tx, id int, userId int) error {
+	before, err := loadTaskSnapshot(tx, id, true);
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "UPDATE tasks SET completed='t' WHERE id=$1;", id);
+	}
+	if (err != nil) {
+		return err;
+	}
+
+	after, err := loadTaskSnapshot(tx, id, false);
+	if (err == nil) {
+		err = insertRevision(tx, id, userId, actionComplete, &before, after);
 	}
+
+	return err;
 }
 
-/* Returns a list of categories with their associated primary-keys */
-func getAllCategories(client *gin.Context, cancel context.CancelFunc) ([]Category) {
+/* Returns a list of categories that a user owns or that are shared with them, with their associated primary-keys */
+func getAllCategories(userId int, client *gin.Context, cancel context.CancelFunc) ([]Category) {
 	c := connectDB(client, cancel)
 	defer c.Close(context.Background())
 
-	categories, err := c.Query(context.Background(), "SELECT * from categories;")
+	categories, err := c.Query(context.Background(), "SELECT categories.id, categories.title, accessible.role, categories.workspace_id, categories.parent_id from categories INNER JOIN public.get_accessible_categories($1) AS accessible ON categories.id=accessible.category_id ORDER BY categories.id;", userId)
 	assertDBOperationSuccess(client, cancel, err);
 	defer categories.Close();
 
@@ -555,6 +3178,9 @@ func getAllCategories(client *gin.Context, cancel context.CancelFunc) ([]Categor
 		err = categories.Scan(
 			&cat.Id,
 			&cat.Title,
+			&cat.Role,
+			&cat.Workspace_Id,
+			&cat.Parent_Id,
 		)
 		assertDBOperationSuccess(client, cancel, err);
 		categorySlice = append(categorySlice, cat)
@@ -566,7 +3192,7 @@ func getAllCategories(client *gin.Context, cancel context.CancelFunc) ([]Categor
 /* ------------------------------------------------------------ HELPER FUNCTIONS --------------------- */
 // checks if there is an error connecting to the database,
 //		if so, returns an error message to the client and cancels the context of the caller
-func assertDBSuccess(client *gin.Context, cancel context.CancelFunc, e error) {
+func assertDBSuccess(client *gin.Context, cancel context.CancelFunc, e error) error {
 	if (e != nil) {
 		// print error message on server side so that its visible in the server logs
 		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", e);
@@ -577,11 +3203,13 @@ func assertDBSuccess(client *gin.Context, cancel context.CancelFunc, e error) {
 		// halts execution of remaining functions to not do unnecessary work
 		cancel();
 	}
+
+	return e;
 }
 
 // checks if there is an error performing the specified request on the database,
 //		if so, returns an error message to the client and cancels the context of the caller
-func assertDBOperationSuccess(client *gin.Context, cancel context.CancelFunc, e error) {
+func assertDBOperationSuccess(client *gin.Context, cancel context.CancelFunc, e error) error {
 	if (e != nil) {
 		// print error message on server side so that its visible in the server logs
 		fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
@@ -592,11 +3220,13 @@ func assertDBOperationSuccess(client *gin.Context, cancel context.CancelFunc, e
 		// halts execution of remaining functions to not do unnecessary work
 		cancel();
 	}
+
+	return e;
 }
 
 // checks if there is an error connecting to the parsing JSON body,
 //		if so, returns an error message to the client and stops execution of any remaining function-calls
-func assertJSONSuccess(client *gin.Context, cancel context.CancelFunc, e error) {
+func assertJSONSuccess(client *gin.Context, cancel context.CancelFunc, e error) error {
 	if (e != nil) {
 		// print error message on server side so that its visible in the server logs
 		fmt.Fprintf(os.Stderr, "Unable to parse JSON body: %v\n", e);
@@ -607,9 +3237,201 @@ func assertJSONSuccess(client *gin.Context, cancel context.CancelFunc, e error)
 		// halts execution of remaining functions to not do unnecessary work
 		cancel();
 	}
+
+	return e;
+}
+
+// checks if the request could not be tied to a logged-in user,
+//		if so, returns an error message to the client and stops execution of any remaining function-calls
+func assertAuthorised(client *gin.Context, cancel context.CancelFunc, e error) error {
+	if (e != nil) {
+		// print error message on server side so that its visible in the server logs
+		fmt.Fprintf(os.Stderr, "Unable to authenticate user: %v\n", e);
+
+		// return http code of 401 to the client, which stands for "Unauthorized"
+		client.JSON(401, gin.H{"error": e.Error()});
+
+		// halts execution of remaining functions to not do unnecessary work
+		cancel();
+	}
+
+	return e;
+}
+
+// reports to the client that there is no task with the given id that the requested action can be performed on,
+//		and stops execution of any remaining function-calls
+func assertTaskFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no task found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks if a change to a task failed, either because there is no task with the given id that the change applies to,
+//		or because of an error in the database; if so, reports it to the client and stops execution of any remaining function-calls
+func assertTaskChanged(client *gin.Context, cancel context.CancelFunc, id int, e error) error {
+	if (e == pgx.ErrNoRows) {
+		return assertTaskFound(client, cancel, id);
+	}
+
+	return assertDBOperationSuccess(client, cancel, e);
+}
+
+// reports to the client that a task does not have the given revision,
+//		and stops execution of any remaining function-calls
+func assertRevisionFound(client *gin.Context, cancel context.CancelFunc, id int, revision int) error {
+	e := fmt.Errorf("task with id: %v has no revision: %v", id, revision);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks if the given timezone is a valid IANA timezone name (e.g. "Asia/Singapore"),
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidTimezone(client *gin.Context, cancel context.CancelFunc, timezone string) error {
+	_, e := time.LoadLocation(timezone);
+	if (e == nil && timezone == "") {
+		// LoadLocation treats an empty name as UTC, but we want it spelled out
+		e = errors.New("timezone must not be empty");
+	}
+
+	if (e != nil) {
+		fmt.Fprintf(os.Stderr, "Invalid timezone: %v\n", e);
+
+		// return http code of 400 to the client, which stands for "Bad Request"
+		client.JSON(400, gin.H{"error": e.Error()});
+
+		cancel();
+	}
+
+	return e;
+}
+
+// checks that a task is given at most one of a timed deadline or an all-day deadline date,
+//		if both are given, returns an error message to the client and stops execution of any remaining function-calls
+func assertSingleDeadline(client *gin.Context, cancel context.CancelFunc, deadline null.Time, deadlineDate Date) error {
+	if (!deadline.Valid || !deadlineDate.Valid) {
+		return nil;
+	}
+
+	e := errors.New("a task can have either a deadline or a deadline_date, but not both");
+	fmt.Fprintf(os.Stderr, "Invalid deadline: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks that a task's priority, if it has one, is "low", "medium" or "high",
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidPriority(client *gin.Context, cancel context.CancelFunc, priority null.String) error {
+	if (!priority.Valid || priority.String == "low" || priority.String == "medium" || priority.String == "high") {
+		return nil;
+	}
+
+	e := fmt.Errorf("priority must be one of low, medium or high, not: %v", priority.String);
+	fmt.Fprintf(os.Stderr, "Invalid priority: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks that a task's recurrence, if it has one, is an iCalendar RRULE value such as "FREQ=WEEKLY;BYDAY=MO",
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidRecurrence(client *gin.Context, cancel context.CancelFunc, recurrence null.String) error {
+	if (!recurrence.Valid || isRecurrenceRule(recurrence.String)) {
+		return nil;
+	}
+
+	e := fmt.Errorf("%q is not an iCalendar RRULE, like \"FREQ=WEEKLY;BYDAY=MO\"", recurrence.String);
+	fmt.Fprintf(os.Stderr, "Invalid recurrence: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// whether a rule is made of NAME=VALUE parts separated by semicolons, one of which gives how often it repeats
+func isRecurrenceRule(rule string) bool {
+	frequencies := map[string]bool{"SECONDLY": true, "MINUTELY": true, "HOURLY": true, "DAILY": true, "WEEKLY": true, "MONTHLY": true, "YEARLY": true};
+
+	hasFrequency := false;
+	for _, part := range strings.Split(rule, ";") {
+		pair := strings.SplitN(part, "=", 2);
+		if (len(pair) != 2) {
+			return false;
+		}
+		name, value := pair[0], pair[1];
+		if (name == "" || value == "" || strings.ContainsAny(part, " \t\r\n:")) {
+			return false;
+		}
+		if (strings.EqualFold(name, "FREQ")) {
+			if (hasFrequency || !frequencies[strings.ToUpper(value)]) {
+				return false;
+			}
+			hasFrequency = true;
+		}
+	}
+
+	return hasFrequency;
+}
+
+// converts every timestamp of a Task into the given timezone,
+//		and fills in the Deadline of all-day tasks as the last second of their day in that timezone
+func localiseTask(t Task, loc *time.Location) Task {
+	if (t.Deadline_Date.Valid) {
+		d := t.Deadline_Date.Time.Time;
+		t.Deadline.SetValid(time.Date(d.Year(), d.Month(), d.Day(), 23, 59, 59, 0, loc));
+	} else if (t.Deadline.Valid) {
+		t.Deadline.Time.Time = t.Deadline.Time.Time.In(loc);
+	}
+
+	if (t.Created_at.Valid) {
+		t.Created_at.Time.Time = t.Created_at.Time.Time.In(loc);
+	}
+	if (t.Updated_at.Valid) {
+		t.Updated_at.Time.Time = t.Updated_at.Time.Time.In(loc);
+	}
+	for i := range t.Assignees {
+		t.Assignees[i].Assigned_at.Time.Time = t.Assignees[i].Assigned_at.Time.Time.In(loc);
+	}
+
+	return t;
+}
+
+// converts every Task in a list into the given timezone (see localiseTask)
+func localiseTasks(tasks []Task, loc *time.Location) []Task {
+	for i := range tasks {
+		tasks[i] = localiseTask(tasks[i], loc);
+	}
+
+	return tasks;
 }
 
 /* ------ test-commands ------ */
+// note: apart from /ping, /signup and /login, every endpoint needs the session token returned by /login or /signup,
+//		sent as a header: -H "Authorization: Bearer <token>"
+
 // test if server is still up
 // 		curl -X GET 0.0.0.0:8080/ping
 //		curl -X GET https://tomato-backend-api.herokuapp.com/ping
@@ -618,10 +3440,17 @@ func assertJSONSuccess(client *gin.Context, cancel context.CancelFunc, e error)
 //		curl -X GET 0.0.0.0:8080/alltasks
 //		curl -X GET https://tomato-backend-api.herokuapp.com/alltasks
 
+// get tasks due today (including overdue ones), and the upcoming tasks for the next 3 days
+//		curl -X GET 0.0.0.0:8080/todaytasks -H "Authorization: Bearer <token>"
+//		curl -X POST 0.0.0.0:8080/upcomingtasks -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"days":3}'
+
 // get a task where id=1
 //		curl -X POST 0.0.0.0:8080/gettask -H "Content-Type: application/json" -d '2'
 //		curl -X POST https://tomato-backend-api.herokuapp.com/gettask -H "Content-Type: application/json" -d '2'
 
+// move a task so that it comes right after the task with id=3 in its category
+//		curl -X POST 0.0.0.0:8080/movetask -H "Content-Type: application/json" -d '{"id":2, "before_id":3}'
+
 // mark a task as complete with id
 //		curl -X POST 0.0.0.0:8080/completetask -H "Content-Type: application/json" -d '2'
 
@@ -632,24 +3461,129 @@ func assertJSONSuccess(client *gin.Context, cancel context.CancelFunc, e error)
 // 		curl -X POST 0.0.0.0:8080/deletetask -H "Content-Type: application/json" -d '2'
 // 		curl -X POST https://tomato-backend-api.herokuapp.com/deletetask -H "Content-Type: application/json" -d '2'
 
+// list, restore and permanently delete tasks in the trash
+//		curl -X GET 0.0.0.0:8080/trashedtasks
+//		curl -X POST 0.0.0.0:8080/restoretask -H "Content-Type: application/json" -d '{"id":2}'
+//		curl -X POST 0.0.0.0:8080/purgetask -H "Content-Type: application/json" -d '{"id":2}'
+
+// page through the history of a task, and revert it to an earlier revision
+//		curl -X POST 0.0.0.0:8080/taskhistory -H "Content-Type: application/json" -d '{"id":2, "limit":10}'
+//		curl -X POST 0.0.0.0:8080/reverttask -H "Content-Type: application/json" -d '{"id":2, "revision":1}'
+
 // add a task
 //		curl -X POST 0.0.0.0:8080/addtask -H "Content-Type: application/json" -d '{"category_id":"1", "title":"buy milk", "description":"muz be lactose-free lolz", "deadline": "2018-04-13T19:24:00+08:00"}'
 //		curl -X POST https://tomato-backend-api.herokuapp.com/addtask -H "Content-Type: application/json" -d '{"category_id":"1", "title":"buy milk", "description":"muz be lactose-free lolz", "deadline": "2018-04-13T19:24:00+08:00"}'
 //		curl -X POST 0.0.0.0:8080/addtask -H "Content-Type: application/json" -d '{"category_id":"1", "title":"buy milk", "description":"muz be lactose-free lolz", "deadline": null}'
 
-// update a task
-//		curl -X POST 0.0.0.0:8080/updatetask -H "Content-Type: application/json" -d '{"id":8, "category_id":"1", "title":"updated", "description":"this is an updated description", "deadline": "2018-04-13T19:24:00+08:00"}'
-
-
-
-
-
-
-
-
-
-
-
+// add an all-day task, due at the end of the day in the user's timezone
+//		curl -X POST 0.0.0.0:8080/addtask -H "Content-Type: application/json" -d '{"category_id":"1", "title":"buy milk", "description":"muz be lactose-free lolz", "deadline_date": "2018-04-13"}'
 
+// add a task by typing it out: dates and times are read in the user's timezone, a hashtag naming a category puts the task there,
+//		other hashtags become tags, and "!high" or "every monday" set its priority and recurrence; dry_run only returns the preview
+//		curl -X POST 0.0.0.0:8080/quickadd -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"text":"buy milk tomorrow 5pm #CCA !high"}'
+//		curl -X POST 0.0.0.0:8080/quickadd -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"text":"standup every weekday at 9:30am #work", "category_id":1, "dry_run":true}'
 
+// set the timezone of the logged-in user (the token is returned by /login and /signup)
+//		curl -X POST 0.0.0.0:8080/settimezone -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"timezone":"Asia/Singapore"}'
 
+// update a task
+//		curl -X POST 0.0.0.0:8080/updatetask -H "Content-Type: application/json" -d '{"id":8, "category_id":"1", "title":"updated", "description":"this is an updated description", "deadline": "2018-04-13T19:24:00+08:00"}'
+//		curl -X POST 0.0.0.0:8080/updatetask -H "Content-Type: application/json" -d '{"id":8, "category_id":1, "title":"standup", "priority":"high", "tags":["work"], "recurrence":"FREQ=WEEKLY;BYDAY=MO,WE,FR"}'
+
+// share a category with another user, or create an invitation token that anyone can use to join it
+//		curl -X POST 0.0.0.0:8080/sharecategory -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1, "username":"janedoe", "role":"editor"}'
+//		curl -X POST 0.0.0.0:8080/createinvitation -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1, "role":"viewer"}'
+//		curl -X POST 0.0.0.0:8080/acceptinvitation -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"token":"<invitation token>"}'
+
+// assign a task to two members of its category, and list the tasks assigned to you
+//		curl -X POST 0.0.0.0:8080/assigntask -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":2, "user_ids":[1, 3]}'
+//		curl -X GET 0.0.0.0:8080/assignedtome -H "Authorization: Bearer <token>"
+
+// comment on a task, mentioning another member of its category
+//		curl -X POST 0.0.0.0:8080/addcomment -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"task_id":2, "body":"@janedoe can you bring the **slides**?"}'
+
+// attach a file to a task, then download it again
+//		curl -X POST 0.0.0.0:8080/uploadattachment -H "Authorization: Bearer <token>" -F "task_id=2" -F "file=@lab3.pdf" -F "sha256=$(sha256sum lab3.pdf | cut -d' ' -f1)"
+//		curl -X POST 0.0.0.0:8080/downloadattachment -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":1}' -o lab3.pdf
+
+// make "Revise for Midterms" (id 3) wait on "Do Lab 3" (id 2), then list what can be worked on
+//		curl -X POST 0.0.0.0:8080/adddependency -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"task_id":3, "blocked_by_id":2}'
+//		curl 0.0.0.0:8080/readytasks -H "Authorization: Bearer <token>"
+
+// add a "Review" column before "Done" in category 0, then move a task into it
+//		curl -X POST 0.0.0.0:8080/updateworkflow -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":0, "statuses":[{"id":1, "name":"To Do"}, {"id":2, "name":"In Progress"}, {"name":"Review"}, {"id":3, "name":"Done", "is_done":true}]}'
+//		curl -X POST 0.0.0.0:8080/settaskstatus -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":0, "status_id":7}'
+
+// put category 1 inside category 0, then list category 0's tasks along with those of everything inside it
+//		curl -X POST 0.0.0.0:8080/movecategory -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1, "parent_id":0}'
+//		curl -X POST 0.0.0.0:8080/gettaskbycategoryid -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":0, "include_descendants":true}'
+//		curl "0.0.0.0:8080/allcategories?tree=true" -H "Authorization: Bearer <token>"
+
+// save a template for a module, then create its tasks in category 0 for a semester starting on 12 January
+//		curl -X POST 0.0.0.0:8080/addtemplate -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"title":"Module", "tasks":[{"title":"Lab 1", "deadline":"+7d@23:59", "checklist":["read the lab sheet", "submit"]}, {"title":"Midterms", "deadline":"+6w"}]}'
+//		curl -X POST 0.0.0.0:8080/instantiatetemplate -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"template_id":1, "category_id":0, "anchor_date":"2026-01-12"}'
+
+// estimate a task at 3 pomodoros, time some work on it, add an hour done earlier, then compare the category's estimates with the time tracked
+//		curl -X POST 0.0.0.0:8080/setestimate -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":2, "pomodoros":3}'
+//		curl -X POST 0.0.0.0:8080/starttimer -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"task_id":2}'
+//		curl -X POST 0.0.0.0:8080/stoptimer -H "Authorization: Bearer <token>"
+//		curl -X POST 0.0.0.0:8080/addtimeentry -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"task_id":2, "started_at":"2026-10-18T14:00:00+08:00", "minutes":60, "note":"first draft"}'
+//		curl -X POST 0.0.0.0:8080/categorytime -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1, "include_descendants":true}'
+
+// follow changes as they happen, then pick up from event 42 after losing the connection
+//		curl -N 0.0.0.0:8080/events -H "Authorization: Bearer <token>"
+//		curl -N 0.0.0.0:8080/events -H "Authorization: Bearer <token>" -H "Last-Event-ID: 42"
+
+// sync an offline client: pull everything, push a task created offline and an edit made offline, then pull what changed since
+//		curl -X POST 0.0.0.0:8080/syncpull -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"cursor":""}'
+//		curl -X POST 0.0.0.0:8080/syncpush -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"mutations":[{"id":"m1", "action":"create", "client_task_id":"6f1c2a", "fields":{"title":"buy milk", "category_id":1}, "changed_at":"2026-10-19T08:00:00Z"}, {"id":"m2", "action":"update", "task_id":2, "fields":{"title":"Do Lab 3 and 4"}, "base":{"title":"Do Lab 3"}, "changed_at":"2026-10-19T08:05:00Z"}]}'
+//		curl -X POST 0.0.0.0:8080/syncpull -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"cursor":"<cursor from the last pull>"}'
+
+// register a webhook for new and completed tasks in category 1, send it a test event, and look at its dead deliveries
+//		curl -X POST 0.0.0.0:8080/addwebhook -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"url":"https://example.com/hooks/todo", "event_types":["task.created", "task.completed"], "category_id":1}'
+//		curl -X POST 0.0.0.0:8080/testwebhook -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":1}'
+//		curl -X POST 0.0.0.0:8080/webhookdeliveries -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"webhook_id":1, "status":"dead"}'
+//		curl -X POST 0.0.0.0:8080/redeliverwebhook -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"delivery_id":42}'
+//		curl -X POST 0.0.0.0:8080/updatewebhook -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":1, "url":"https://example.com/hooks/todo", "event_types":[], "category_id":null, "active":false}'
+
+// get the address of the calendar feed, read it with events for calendar apps that do not show to-dos, then rotate it
+//		curl 0.0.0.0:8080/calendarfeed -H "Authorization: Bearer <token>"
+//		curl "0.0.0.0:8080/calendar/<feed token>.ics?events=true&completed=false"
+//		curl -X POST 0.0.0.0:8080/rotatecalendarfeed -H "Authorization: Bearer <token>"
+
+// check what importing a CSV file would do, then import it, putting rows without a category into category 1
+//		curl -X POST 0.0.0.0:8080/importtasks -H "Authorization: Bearer <token>" -F "file=@tasks.csv" -F "category_id=1" -F "dry_run=true"
+//		curl -X POST 0.0.0.0:8080/importtasks -H "Authorization: Bearer <token>" -F "file=@tasks.csv" -F "category_id=1"
+//		curl -X POST 0.0.0.0:8080/importtasks -H "Authorization: Bearer <token>" -F "file=@calendar.ics"
+
+// import a Todoist export and a Trello board; importing a newer export of either later updates the same tasks
+//		curl -X POST 0.0.0.0:8080/importtodoist -H "Authorization: Bearer <token>" -F "file=@todoist.json"
+//		curl -X POST 0.0.0.0:8080/importtrello -H "Authorization: Bearer <token>" -F "file=@board.json"
+
+// ask for a copy of everything, check on it, and download it once it is ready
+//		curl -X POST 0.0.0.0:8080/exportaccount -H "Authorization: Bearer <token>"
+//		curl 0.0.0.0:8080/accountexports -H "Authorization: Bearer <token>"
+//		curl -X POST 0.0.0.0:8080/downloadaccountexport -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":1}' -o export.zip
+
+// delete the account, handing shared categories over to their members
+//		curl -X POST 0.0.0.0:8080/deleteaccount -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"password":"johnspassword"}'
+
+// find the user's calendars, then fetch the tasks in one, all of them or those changed since a sync token
+//		curl -X PROPFIND 0.0.0.0:8080/dav/calendars/john/ -u john:johnspassword -H "Depth: 1"
+//		curl -X REPORT 0.0.0.0:8080/dav/calendars/john/1/ -u john:johnspassword -H "Depth: 1" -H "Content-Type: application/xml" -d '<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/><C:calendar-data/></D:prop><C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"/></C:comp-filter></C:filter></C:calendar-query>'
+//		curl -X REPORT 0.0.0.0:8080/dav/calendars/john/1/ -u john:johnspassword -H "Content-Type: application/xml" -d '<D:sync-collection xmlns:D="DAV:"><D:sync-token/><D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop></D:sync-collection>'
+
+// create or change a task, then move it to the trash
+//		curl -X PUT 0.0.0.0:8080/dav/calendars/john/1/groceries.ics -u john:johnspassword -H "Content-Type: text/calendar" -H "If-None-Match: *" --data-binary $'BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//curl//EN\r\nBEGIN:VTODO\r\nUID:groceries@example.com\r\nSUMMARY:Buy groceries\r\nDUE:20261030T170000Z\r\nEND:VTODO\r\nEND:VCALENDAR\r\n'
+//		curl 0.0.0.0:8080/dav/calendars/john/1/groceries.ics -u john:johnspassword -i
+//		curl -X DELETE 0.0.0.0:8080/dav/calendars/john/1/groceries.ics -u john:johnspassword -H 'If-Match: "<etag>"'
+
+// export a category as a Markdown checklist, or the overdue tasks tagged "home" as plain text
+//		curl -X POST 0.0.0.0:8080/exporttasks -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1}'
+//		curl -X POST 0.0.0.0:8080/exporttasks -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"view":"overdue", "tags":["home"], "format":"text"}'
+
+// share a category as a web page until the end of the year, open it as Markdown, then revoke the link
+//		curl -X POST 0.0.0.0:8080/createsharelink -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"category_id":1, "hide_completed":true, "expires_at":"2026-12-31T23:59:59Z"}'
+//		curl 0.0.0.0:8080/sharelinks -H "Authorization: Bearer <token>"
+//		curl 0.0.0.0:8080/shared/<share token>.md
+//		curl -X POST 0.0.0.0:8080/revokesharelink -H "Content-Type: application/json" -H "Authorization: Bearer <token>" -d '{"id":1}'
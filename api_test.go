@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLogFormatter(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		secret string
+	}{
+		{"/gettasks", `"/gettasks"`, ""},
+		{"/events?token=s3cr3t&last_event_id=4", `"/events?last_event_id=4&token=REDACTED"`, "s3cr3t"},
+		{"/events?last_event_id=4", `"/events?last_event_id=4"`, ""},
+		{calendarFeedPath + "s3cr3t.ics", `"/calendar/REDACTED"`, "s3cr3t"},
+		{calendarFeedPath + "s3cr3t.ics?refresh=1", `"/calendar/REDACTED"`, "s3cr3t"},
+		{sharedListPath + "s3cr3t.html", `"/shared/REDACTED"`, "s3cr3t"},
+		{sharedListPath + "s3cr3t.md?token=other", `"/shared/REDACTED"`, "other"},
+	}
+	for _, test := range tests {
+		line := logFormatter(gin.LogFormatterParams{TimeStamp: time.Now(), StatusCode: 200, Method: "GET", Path: test.path});
+		if (!strings.Contains(line, test.want)) {
+			t.Errorf("the log line for %v is %q, want it to contain %v", test.path, line, test.want);
+		}
+		if (test.secret != "" && strings.Contains(line, test.secret)) {
+			t.Errorf("the log line for %v holds the token: %q", test.path, line);
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type Assignee struct {
+	User_Id int `json:"user_id"`
+	Username string `json:"username"`
+	Assigned_By null.Int64 `json:"assigned_by"`
+	Assigned_at Timestamp `json:"assigned_at"`
+}
+
+type AssignTaskParams struct {
+	Id int `json:"id"`
+	User_Ids []int `json:"user_ids"`
+}
+
+type UnassignTaskParams struct {
+	Id int `json:"id"`
+	User_Id int `json:"user_id"`
+}
+
+type GetTasksByAssigneeParams struct {
+	User_Id int `json:"user_id"`
+	// only return tasks in this category, or in every category the user has access to if 0
+	Category_Id int `json:"category_id"`
+}
+
+/* ------------------------------------------------------------ ASSIGNMENTS --------------------- */
+/* Assigns a task to one or more users, every one of whom must have access to the task's category */
+func assignTask(params AssignTaskParams, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	// find anyone who cannot see the task, so that it is not assigned to them
+	rows, err := c.Query(context.Background(), `
+		SELECT assignee FROM unnest($1::int[]) AS assignee
+		WHERE NOT EXISTS (
+			SELECT 1 FROM public.get_accessible_categories(assignee) AS accessible
+			WHERE accessible.category_id=(SELECT category_id FROM tasks WHERE id=$2)
+		);`, params.User_Ids, params.Id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	var outsiders []int;
+	for rows.Next() {
+		var id int;
+		err = rows.Scan(&id);
+		if (err != nil) {
+			break;
+		}
+		outsiders = append(outsiders, id);
+	}
+	rows.Close();
+	if (err == nil) {
+		err = rows.Err();
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (len(outsiders) > 0) {
+		return assertAssignable(client, cancel, fmt.Errorf("users with ids: %v do not have access to the category of task with id: %v", outsiders, params.Id));
+	}
+
+	// assigning someone who is already assigned leaves their original assignment as it is
+	_, err = c.Exec(context.Background(), `
+		INSERT INTO task_assignees (task_id, user_id, assigned_by)
+		SELECT $1, assignee, $2 FROM unnest($3::int[]) AS assignee
+		ON CONFLICT (task_id, user_id) DO NOTHING;`, params.Id, userId, params.User_Ids)
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Removes a user from the assignees of a task */
+func unassignTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "DELETE FROM task_assignees WHERE task_id=$1 AND user_id=$2;", id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertAssignable(client, cancel, fmt.Errorf("task with id: %v is not assigned to user with id: %v", id, userId));
+	}
+
+	return nil;
+}
+
+/* Returns the tasks assigned to a user that another user (the viewer) has access to,
+		optionally only those in one category */
+func getTasksByAssignee(assigneeId int, viewerId int, categoryId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_all_tasks($1) WHERE id IN (SELECT task_id FROM task_assignees WHERE user_id=$2) AND ($3=0 OR category_id=$3);", viewerId, assigneeId, categoryId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer tasks.Close();
+
+	var taskSlice []Task
+	for tasks.Next() {
+		var t Task
+		err = scanTask(tasks, &t)
+		assertDBOperationSuccess(client, cancel, err);
+		taskSlice = append(taskSlice, t)
+	}
+
+	return taskSlice;
+}
+
+/* Removes the assignments of tasks in a category from users who no longer have access to it,
+		e.g. after they were removed from the category or a task was moved out of their reach */
+func removeStrayAssignees(tx pgx.Tx, categoryId int) error {
+	_, err := tx.Exec(context.Background(), `
+		DELETE FROM task_assignees USING tasks
+		WHERE task_assignees.task_id=tasks.id AND tasks.category_id=$1
+			AND NOT EXISTS (
+				SELECT 1 FROM public.get_accessible_categories(task_assignees.user_id) AS accessible
+				WHERE accessible.category_id=tasks.category_id
+			);`, categoryId)
+
+	return err;
+}
+
+// reports to the client that the requested change to who a task is assigned to cannot be made,
+//		and stops execution of any remaining function-calls
+func assertAssignable(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to change task assignment: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type Attachment struct {
+	Id int `json:"id"`
+	Task_Id int `json:"task_id"`
+	Uploader_Id int `json:"uploader_id"`
+	Uploader string `json:"uploader"`
+	Filename string `json:"filename"`
+	Content_Type string `json:"content_type"`
+	Size int64 `json:"size"`
+	// hex SHA-256 of the file's contents
+	Checksum string `json:"checksum"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+type GetAttachmentParams struct {
+	Id int `json:"id"`
+}
+
+type GetTaskAttachmentsParams struct {
+	Task_Id int `json:"task_id"`
+}
+
+// a file that has been read from an upload and checked, but not stored yet
+type attachmentUpload struct {
+	filename string
+	contentType string
+	data []byte
+	checksum string
+}
+
+// the largest file that can be attached, and how much a single user can upload in total, in megabytes;
+//		unless overridden by the MAX_ATTACHMENT_MB and ATTACHMENT_QUOTA_MB environment variables
+const defaultMaxAttachmentMB = 10
+const defaultAttachmentQuotaMB = 100
+
+// the types of file that can be attached, as worked out from the file's contents rather than what the client claims;
+//		anything a browser might run (e.g. HTML or SVG) is left out on purpose
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf": true,
+	"application/zip": true,
+	"image/bmp": true,
+	"image/gif": true,
+	"image/jpeg": true,
+	"image/png": true,
+	"image/webp": true,
+	"text/plain; charset=utf-8": true,
+	"text/plain; charset=utf-16be": true,
+	"text/plain; charset=utf-16le": true,
+}
+
+const maxFilenameLength = 255
+
+/* ------------------------------------------------------------ ATTACHMENTS --------------------- */
+// returns a limit in bytes from an environment variable given in megabytes
+func megabytesFromEnv(name string, fallback int) int64 {
+	mb, err := strconv.Atoi(os.Getenv(name));
+	if (err != nil || mb <= 0) {
+		mb = fallback;
+	}
+
+	return int64(mb) << 20;
+}
+
+// returns the largest file that can be attached, in bytes
+func maxAttachmentSize() int64 {
+	return megabytesFromEnv("MAX_ATTACHMENT_MB", defaultMaxAttachmentMB);
+}
+
+// returns how much a single user can upload across every task, in bytes
+func attachmentQuota() int64 {
+	return megabytesFromEnv("ATTACHMENT_QUOTA_MB", defaultAttachmentQuotaMB);
+}
+
+// returns the file in a multipart upload, refusing to read more of the request than the largest file allowed plus room for the other fields
+func attachmentFormFile(client *gin.Context, cancel context.CancelFunc) (*multipart.FileHeader, error) {
+	client.Request.Body = http.MaxBytesReader(client.Writer, client.Request.Body, maxAttachmentSize() + 1 << 20);
+
+	header, err := client.FormFile("file");
+	if (err != nil && strings.Contains(err.Error(), "request body too large")) {
+		return nil, assertAttachmentSize(client, cancel, fmt.Errorf("files can be at most %v MB", maxAttachmentSize() >> 20));
+	}
+	if (assertJSONSuccess(client, cancel, err) != nil) {
+		return nil, err;
+	}
+
+	return header, nil;
+}
+
+// reads an uploaded file, checks its size, works out its type from its contents and computes its checksum;
+//		if the client sent its own checksum, the file is rejected unless it matches, as the upload was corrupted on the way
+func readAttachment(header *multipart.FileHeader, expectedChecksum string, client *gin.Context, cancel context.CancelFunc) (attachmentUpload, error) {
+	var upload attachmentUpload;
+	limit := maxAttachmentSize();
+
+	if (header.Size > limit) {
+		return upload, assertAttachmentSize(client, cancel, fmt.Errorf("files can be at most %v MB", limit >> 20));
+	}
+
+	f, err := header.Open();
+	if (err != nil) {
+		return upload, assertJSONSuccess(client, cancel, err);
+	}
+	defer f.Close();
+
+	upload.data, err = ioutil.ReadAll(io.LimitReader(f, limit + 1));
+	if (err != nil) {
+		return upload, assertJSONSuccess(client, cancel, err);
+	}
+	if (int64(len(upload.data)) > limit) {
+		return upload, assertAttachmentSize(client, cancel, fmt.Errorf("files can be at most %v MB", limit >> 20));
+	}
+	if (len(upload.data) == 0) {
+		return upload, assertAttachmentType(client, cancel, errors.New("an attachment cannot be empty"));
+	}
+
+	upload.contentType = http.DetectContentType(upload.data);
+	if (!allowedAttachmentTypes[upload.contentType]) {
+		return upload, assertAttachmentType(client, cancel, fmt.Errorf("files of type %v cannot be attached", upload.contentType));
+	}
+
+	upload.checksum = hex.EncodeToString(sha256Sum(upload.data));
+	if (expectedChecksum != "" && !strings.EqualFold(expectedChecksum, upload.checksum)) {
+		return upload, assertJSONSuccess(client, cancel, fmt.Errorf("the file received has checksum %v, not %v", upload.checksum, expectedChecksum));
+	}
+
+	upload.filename = cleanFilename(header.Filename);
+
+	return upload, nil;
+}
+
+// strips any directories and control characters from the name a client gave a file, and shortens it if needed
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"));
+	name = strings.Map(func(r rune) rune {
+		if (unicode.IsControl(r)) {
+			return -1;
+		}
+		return r;
+	}, name);
+
+	if (name == "." || name == "/" || name == "") {
+		name = "attachment";
+	}
+	if (len(name) > maxFilenameLength) {
+		// keep the extension, so the file still opens with the right program once downloaded
+		ext := filepath.Ext(name);
+		if (len(ext) > 16) {
+			ext = "";
+		}
+		name = strings.ToValidUTF8(name[:maxFilenameLength - len(ext)], "") + ext;
+	}
+
+	return name;
+}
+
+// returns a new random key to keep a blob under
+func newBlobKey() (string, error) {
+	key := make([]byte, 16);
+	_, err := rand.Read(key);
+	if (err != nil) {
+		return "", err;
+	}
+
+	return hex.EncodeToString(key), nil;
+}
+
+/* Attaches a file to a task on behalf of a user, as long as it fits in what is left of their quota, and returns the attachment */
+func addAttachment(taskId int, upload attachmentUpload, userId int, client *gin.Context, cancel context.CancelFunc) (Attachment, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var a Attachment;
+
+	store, err := openBlobStore();
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, err;
+	}
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// lock the user, so that two uploads at once cannot both squeeze into the same bit of quota
+	var used int64;
+	err = tx.QueryRow(context.Background(), "SELECT id FROM users WHERE id=$1 FOR UPDATE;", userId).Scan(&a.Uploader_Id);
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "SELECT COALESCE(SUM(size), 0)::BIGINT FROM task_attachments WHERE uploader_id=$1;", userId).Scan(&used);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, err;
+	}
+
+	quota := attachmentQuota();
+	if (used + int64(len(upload.data)) > quota) {
+		return a, assertAttachmentSize(client, cancel, fmt.Errorf("this file would take you over your storage quota of %v MB, you have %v bytes left", quota >> 20, quota - used));
+	}
+
+	key, err := newBlobKey();
+	if (err == nil) {
+		err = store.Put(key, bytes.NewReader(upload.data), int64(len(upload.data)), upload.checksum);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, err;
+	}
+
+	err = tx.QueryRow(context.Background(), `
+		INSERT INTO task_attachments (task_id, uploader_id, filename, content_type, size, checksum, blob_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, (SELECT username FROM users WHERE id=$2);`,
+		taskId, userId, upload.filename, upload.contentType, len(upload.data), upload.checksum, key).Scan(&a.Id, &a.Created_at, &a.Uploader);
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (err != nil) {
+		// nothing points at the blob, so it would never be cleaned up otherwise
+		deleteBlobs([]string{key});
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, err;
+	}
+
+	a.Task_Id = taskId;
+	a.Filename = upload.filename;
+	a.Content_Type = upload.contentType;
+	a.Size = int64(len(upload.data));
+	a.Checksum = upload.checksum;
+
+	return a, nil;
+}
+
+/* Returns the files attached to a task, oldest first */
+func getAttachments(taskId int, client *gin.Context, cancel context.CancelFunc) ([]Attachment) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	attachments, err := c.Query(context.Background(), `
+		SELECT task_attachments.id, task_attachments.task_id, task_attachments.uploader_id, users.username, task_attachments.filename,
+			task_attachments.content_type, task_attachments.size, task_attachments.checksum, task_attachments.created_at
+		FROM task_attachments
+			INNER JOIN users ON task_attachments.uploader_id=users.id
+		WHERE task_attachments.task_id=$1
+		ORDER BY task_attachments.created_at, task_attachments.id;`, taskId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer attachments.Close();
+
+	attachmentSlice := []Attachment{}
+	for attachments.Next() {
+		var a Attachment
+		err = scanAttachment(attachments, &a)
+		assertDBOperationSuccess(client, cancel, err);
+		attachmentSlice = append(attachmentSlice, a)
+	}
+
+	return attachmentSlice;
+}
+
+/* Returns an attachment and the key its contents are kept under */
+func getAttachment(id int, client *gin.Context, cancel context.CancelFunc) (Attachment, string, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var a Attachment;
+	var key string;
+	row := c.QueryRow(context.Background(), `
+		SELECT task_attachments.id, task_attachments.task_id, task_attachments.uploader_id, users.username, task_attachments.filename,
+			task_attachments.content_type, task_attachments.size, task_attachments.checksum, task_attachments.created_at, task_attachments.blob_key
+		FROM task_attachments
+			INNER JOIN users ON task_attachments.uploader_id=users.id
+		WHERE task_attachments.id=$1;`, id)
+	err := scanAttachment(row, &a, &key);
+	if (err == pgx.ErrNoRows) {
+		return a, "", assertAttachmentFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return a, "", err;
+	}
+
+	return a, key, nil;
+}
+
+/* Removes a file from a task, along with its contents */
+func deleteAttachment(id int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var key string;
+	err := c.QueryRow(context.Background(), "DELETE FROM task_attachments WHERE id=$1 RETURNING blob_key;", id).Scan(&key);
+	if (err == pgx.ErrNoRows) {
+		return assertAttachmentFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	deleteBlobs([]string{key});
+
+	return nil;
+}
+
+// scans a row of attachment columns, in the order every attachment query selects them, into a, followed by any extra columns
+func scanAttachment(row pgx.Row, a *Attachment, extra ...interface{}) error {
+	dest := []interface{}{
+		&a.Id,
+		&a.Task_Id,
+		&a.Uploader_Id,
+		&a.Uploader,
+		&a.Filename,
+		&a.Content_Type,
+		&a.Size,
+		&a.Checksum,
+		&a.Created_at,
+	}
+
+	return row.Scan(append(dest, extra...)...);
+}
+
+// sends the contents of an attachment to the client as a download
+func serveAttachment(a Attachment, key string, client *gin.Context, cancel context.CancelFunc) error {
+	store, err := openBlobStore();
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	contents, err := store.Get(key);
+	if (err == errBlobNotFound) {
+		return assertAttachmentFound(client, cancel, a.Id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer contents.Close();
+
+	client.DataFromReader(200, a.Size, a.Content_Type, contents, map[string]string{
+		// always download rather than display, and never let the browser guess a different type
+		"Content-Disposition": fmt.Sprintf("attachment; filename*=UTF-8''%v", url.PathEscape(a.Filename)),
+		"X-Content-Type-Options": "nosniff",
+		"ETag": fmt.Sprintf(`"%v"`, a.Checksum),
+		"X-Checksum-Sha256": a.Checksum,
+	});
+
+	return nil;
+}
+
+// converts the timestamps of every attachment into the given timezone
+func localiseAttachments(attachments []Attachment, loc *time.Location) []Attachment {
+	for i := range attachments {
+		if (attachments[i].Created_at.Valid) {
+			attachments[i].Created_at.Time.Time = attachments[i].Created_at.Time.Time.In(loc);
+		}
+	}
+
+	return attachments;
+}
+
+// reports to the client that an upload is too large, either on its own or for what is left of the uploader's quota,
+//		and stops execution of any remaining function-calls
+func assertAttachmentSize(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to attach file: %v\n", e);
+
+	// return http code of 413 to the client, which stands for "Payload Too Large"
+	client.JSON(413, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that an upload is not a kind of file that can be attached,
+//		and stops execution of any remaining function-calls
+func assertAttachmentType(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to attach file: %v\n", e);
+
+	// return http code of 415 to the client, which stands for "Unsupported Media Type"
+	client.JSON(415, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that there is no attachment with the given id,
+//		and stops execution of any remaining function-calls
+func assertAttachmentFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no attachment found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,1286 @@
+package main
+
+import (
+	"api/ical"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// structs
+
+// note: /dav is a CalDAV server (RFC 4791) for task apps such as Apple Reminders, Thunderbird and DAVx5, which log in
+//		with their username and password (HTTP Basic auth) and find everything from /.well-known/caldav:
+//			/dav/principals/<username>/					the user
+//			/dav/calendars/<username>/					their calendars, one for every category they have access to
+//			/dav/calendars/<username>/<category id>/	a category, as a calendar of VTODOs
+//			.../<category id>/<name>.ics				a task; tasks created through CalDAV keep the name and UID the app gave them,
+//															and every other task is task-<id>.ics with the UID its calendar feed has
+//
+//		Tasks are read and written as VTODOs in the same way as by the calendar feed and /importtasks, and changes are written
+//		in the same way as by /updatetask, /completetask and /deletetask, so they show up in the task's history and /events.
+//		Deleting a task moves it to the trash. Checklists, assignees and other things a VTODO cannot hold are left as they are.
+//
+//		ETags are taken from the contents of each task's VTODO. Sync tokens (and CTags) point into the change log (see events.go),
+//		so a sync-collection REPORT returns the tasks that changed since the token, along with tasks that are gone from the calendar;
+//		a token older than the change log gets the app to sync the whole calendar again
+type davRequest struct {
+	client *gin.Context
+	cancel context.CancelFunc
+	c *pgx.Conn
+	user User
+	loc *time.Location
+	// the sync token of every calendar, read when it is first needed
+	syncToken string
+}
+
+// a resource on the server, found from its path
+type davResource struct {
+	kind int
+	href string
+	// set for calendars and the tasks in them
+	category Category
+	object davObject
+}
+
+// a task as a calendar object resource
+type davObject struct {
+	task Task
+	name string
+	uid string
+	data []byte
+	etag string
+}
+
+// an element of an XML request body, with everything inside it
+type davNode struct {
+	XMLName xml.Name
+	Attrs []xml.Attr `xml:",any,attr"`
+	Children []davNode `xml:",any"`
+	Text string `xml:",chardata"`
+}
+
+const (
+	davRoot = iota
+	davPrincipal
+	davHome
+	davCalendar
+	davTask
+)
+
+const (
+	davNamespace = "DAV:"
+	calDAVNamespace = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+// the methods /dav answers to
+var davMethods = []string{"OPTIONS", "PROPFIND", "REPORT", "GET", "HEAD", "PUT", "DELETE"}
+
+// the largest request body that is read, in bytes
+const maxDAVRequestSize = 1 << 20
+
+// sync tokens are URIs, e.g. "urn:doom-and-gloom:sync:42" for the change log up to event 42
+const davSyncTokenPrefix = "urn:doom-and-gloom:sync:"
+
+// the properties returned for <allprop/>
+var davAllProps = []xml.Name{
+	{Space: davNamespace, Local: "resourcetype"},
+	{Space: davNamespace, Local: "displayname"},
+	{Space: davNamespace, Local: "getetag"},
+	{Space: davNamespace, Local: "getcontenttype"},
+	{Space: davNamespace, Local: "getlastmodified"},
+	{Space: davNamespace, Local: "current-user-principal"},
+	{Space: davNamespace, Local: "sync-token"},
+	{Space: calDAVNamespace, Local: "supported-calendar-component-set"},
+	{Space: calendarServerNamespace, Local: "getctag"},
+}
+
+/* ------------------------------------------------------------ REQUESTS --------------------- */
+// answers a request to /dav
+func serveCalDAV(client *gin.Context) {
+	_, cancel := context.WithCancel(context.Background());
+
+	// apps only look at these to find out what the server can do
+	client.Header("DAV", "1, 3, calendar-access");
+	client.Header("Allow", strings.Join(davMethods, ", "));
+	if (client.Request.Method == "OPTIONS") {
+		client.Status(200);
+		cancel();
+		return;
+	}
+
+	user, err := davAuthenticate(client, cancel);
+	if (err != nil) {
+		return;
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	r := &davRequest{client: client, cancel: cancel, c: c, user: user, loc: locationOf(user)};
+	resource, err := r.find(client.Param("path"));
+	if (err != nil) {
+		return;
+	}
+
+	switch (client.Request.Method) {
+	case "PROPFIND":
+		r.propfind(resource);
+	case "REPORT":
+		r.report(resource);
+	case "GET", "HEAD":
+		r.get(resource);
+	case "PUT":
+		r.put(resource);
+	case "DELETE":
+		r.delete(resource);
+	}
+}
+
+/* Returns the user whose username and password are in the "Authorization: Basic" header */
+func davAuthenticate(client *gin.Context, cancel context.CancelFunc) (User, error) {
+	var user User;
+
+	username, password, ok := client.Request.BasicAuth();
+	if (!ok) {
+		return user, assertDAVAuthorised(client, cancel, errors.New("missing username and password"));
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var storedPassword string;
+	err := c.QueryRow(context.Background(), "SELECT id, username, timezone, password FROM users WHERE username=$1;", username).Scan(
+		&user.Id,
+		&user.Username,
+		&user.Timezone,
+		&storedPassword,
+	)
+	if (err == pgx.ErrNoRows) {
+		return user, assertDAVAuthorised(client, cancel, errors.New("incorrect username or password"));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
+	if (bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password)) != nil) {
+		return user, assertDAVAuthorised(client, cancel, errors.New("incorrect username or password"));
+	}
+
+	return user, nil;
+}
+
+// returns the resource at a path under /dav; a task that does not exist yet is returned with no task, so that it can be PUT
+func (r *davRequest) find(path string) (davResource, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/");
+	if (len(parts) == 1 && parts[0] == "") {
+		parts = nil;
+	}
+
+	// a user only ever sees their own principal and calendars
+	if (len(parts) >= 2 && parts[1] != r.user.Username) {
+		return davResource{}, assertDAVFound(r.client, r.cancel, path);
+	}
+
+	switch {
+	case (len(parts) == 0):
+		return davResource{kind: davRoot, href: "/dav/"}, nil;
+	case (len(parts) == 2 && parts[0] == "principals"):
+		return davResource{kind: davPrincipal, href: r.principalHref()}, nil;
+	case (len(parts) == 2 && parts[0] == "calendars"):
+		return davResource{kind: davHome, href: r.homeHref()}, nil;
+	case (len(parts) == 3 || len(parts) == 4) && parts[0] == "calendars":
+	default:
+		return davResource{}, assertDAVFound(r.client, r.cancel, path);
+	}
+
+	categoryId, err := strconv.Atoi(parts[2]);
+	if (err != nil) {
+		return davResource{}, assertDAVFound(r.client, r.cancel, path);
+	}
+	category, err := r.category(categoryId);
+	if (err == pgx.ErrNoRows) {
+		return davResource{}, assertDAVFound(r.client, r.cancel, path);
+	}
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return davResource{}, err;
+	}
+	calendar := davResource{kind: davCalendar, href: r.calendarHref(category.Id), category: category};
+	if (len(parts) == 3) {
+		return calendar, nil;
+	}
+
+	object, err := r.objectNamed(category, parts[3]);
+	if (err == pgx.ErrNoRows) {
+		object = davObject{name: parts[3]};
+		err = nil;
+	}
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return davResource{}, err;
+	}
+
+	return davResource{kind: davTask, href: r.objectHref(category.Id, object.name), category: category, object: object}, nil;
+}
+
+func (r *davRequest) principalHref() string {
+	return "/dav/principals/" + url.PathEscape(r.user.Username) + "/";
+}
+
+func (r *davRequest) homeHref() string {
+	return "/dav/calendars/" + url.PathEscape(r.user.Username) + "/";
+}
+
+func (r *davRequest) calendarHref(categoryId int) string {
+	return r.homeHref() + strconv.Itoa(categoryId) + "/";
+}
+
+func (r *davRequest) objectHref(categoryId int, name string) string {
+	return r.calendarHref(categoryId) + url.PathEscape(name);
+}
+
+/* ------------------------------------------------------------ PROPFIND --------------------- */
+// answers a PROPFIND with the properties asked for, of the resource and, unless the Depth is 0, of what is in it
+func (r *davRequest) propfind(resource davResource) {
+	body, err := r.readBody();
+	if (err != nil) {
+		return;
+	}
+
+	// an empty body asks for every property
+	var props []xml.Name;
+	if (body != nil) {
+		if prop, ok := body.child(davNamespace, "prop"); (ok) {
+			props = prop.names();
+		}
+	}
+
+	resources := []davResource{resource};
+	if (r.client.GetHeader("Depth") != "0") {
+		switch (resource.kind) {
+		case davHome:
+			categories, err := accessibleCategories(r.c, r.user.Id);
+			if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+				return;
+			}
+			for _, category := range categories {
+				resources = append(resources, davResource{kind: davCalendar, href: r.calendarHref(category.Id), category: category});
+			}
+		case davCalendar:
+			objects, err := r.objects(resource.category, nil);
+			if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+				return;
+			}
+			for _, object := range objects {
+				resources = append(resources, davResource{kind: davTask, href: r.objectHref(resource.category.Id, object.name), category: resource.category, object: object});
+			}
+		}
+	}
+	if (resource.kind == davTask && resource.object.task.Id == 0) {
+		assertDAVFound(r.client, r.cancel, resource.href);
+		return;
+	}
+
+	var b strings.Builder;
+	for _, res := range resources {
+		err = r.writeResponse(&b, res, props);
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+	}
+	r.writeMultistatus(b.String(), "");
+}
+
+// writes the <response> for a resource with the properties asked for, or with every property if props is nil
+func (r *davRequest) writeResponse(b *strings.Builder, resource davResource, props []xml.Name) error {
+	allProps := props == nil;
+	if (allProps) {
+		props = davAllProps;
+	}
+
+	var found, missing strings.Builder;
+	for _, name := range props {
+		value, ok, err := r.prop(resource, name);
+		if (err != nil) {
+			return err;
+		}
+		if (ok) {
+			fmt.Fprintf(&found, "<%v xmlns=\"%v\">%v</%v>", name.Local, name.Space, value, name.Local);
+		} else if (!allProps) {
+			fmt.Fprintf(&missing, "<%v xmlns=\"%v\"/>", name.Local, name.Space);
+		}
+	}
+
+	b.WriteString("<D:response><D:href>" + davEscape(resource.href) + "</D:href>");
+	if (found.Len() > 0) {
+		b.WriteString("<D:propstat><D:prop>" + found.String() + "</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>");
+	}
+	if (missing.Len() > 0) {
+		b.WriteString("<D:propstat><D:prop>" + missing.String() + "</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>");
+	}
+	b.WriteString("</D:response>");
+
+	return nil;
+}
+
+// returns the value of a property of a resource as XML, or false if the resource does not have it
+func (r *davRequest) prop(resource davResource, name xml.Name) (string, bool, error) {
+	href := func(h string) string {
+		return `<href xmlns="DAV:">` + davEscape(h) + `</href>`;
+	};
+
+	switch (name) {
+	case xml.Name{Space: davNamespace, Local: "current-user-principal"}:
+		return href(r.principalHref()), true, nil;
+	case xml.Name{Space: davNamespace, Local: "principal-URL"}:
+		return href(r.principalHref()), resource.kind == davPrincipal, nil;
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-home-set"}:
+		return href(r.homeHref()), resource.kind == davPrincipal, nil;
+	case xml.Name{Space: davNamespace, Local: "owner"}:
+		return href(r.principalHref()), resource.kind == davHome, nil;
+
+	case xml.Name{Space: davNamespace, Local: "resourcetype"}:
+		switch (resource.kind) {
+		case davPrincipal:
+			return `<collection xmlns="DAV:"/><principal xmlns="DAV:"/>`, true, nil;
+		case davCalendar:
+			return `<collection xmlns="DAV:"/><calendar xmlns="urn:ietf:params:xml:ns:caldav"/>`, true, nil;
+		case davTask:
+			return "", true, nil;
+		}
+		return `<collection xmlns="DAV:"/>`, true, nil;
+
+	case xml.Name{Space: davNamespace, Local: "displayname"}:
+		switch (resource.kind) {
+		case davPrincipal:
+			return davEscape(r.user.Username), true, nil;
+		case davCalendar:
+			return davEscape(resource.category.Title), true, nil;
+		}
+		return "", false, nil;
+
+	case xml.Name{Space: calDAVNamespace, Local: "supported-calendar-component-set"}:
+		return `<comp xmlns="urn:ietf:params:xml:ns:caldav" name="VTODO"/>`, resource.kind == davCalendar, nil;
+	case xml.Name{Space: calDAVNamespace, Local: "supported-calendar-data"}:
+		return `<calendar-data xmlns="urn:ietf:params:xml:ns:caldav" content-type="text/calendar" version="2.0"/>`, resource.kind == davCalendar, nil;
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-description"}:
+		return davEscape("Tasks in " + resource.category.Title), resource.kind == davCalendar, nil;
+	case xml.Name{Space: davNamespace, Local: "supported-report-set"}:
+		if (resource.kind != davCalendar) {
+			return "", false, nil;
+		}
+		var reports strings.Builder;
+		for _, report := range []xml.Name{{Space: calDAVNamespace, Local: "calendar-query"}, {Space: calDAVNamespace, Local: "calendar-multiget"}, {Space: davNamespace, Local: "sync-collection"}} {
+			fmt.Fprintf(&reports, `<supported-report xmlns="DAV:"><report><%v xmlns="%v"/></report></supported-report>`, report.Local, report.Space);
+		}
+		return reports.String(), true, nil;
+	case xml.Name{Space: davNamespace, Local: "current-user-privilege-set"}:
+		privileges := []string{"read", "read-current-user-privilege-set"};
+		if (resource.kind == davCalendar || resource.kind == davTask) && hasRole(resource.category.Role, roleEditor) {
+			privileges = append(privileges, "write", "write-content", "bind", "unbind");
+		}
+		var set strings.Builder;
+		for _, privilege := range privileges {
+			fmt.Fprintf(&set, `<privilege xmlns="DAV:"><%v/></privilege>`, privilege);
+		}
+		return set.String(), true, nil;
+
+	case xml.Name{Space: davNamespace, Local: "sync-token"}, xml.Name{Space: calendarServerNamespace, Local: "getctag"}:
+		if (resource.kind != davCalendar) {
+			return "", false, nil;
+		}
+		token, err := r.currentSyncToken();
+		return davEscape(token), err == nil, err;
+
+	case xml.Name{Space: davNamespace, Local: "getetag"}:
+		return davEscape(resource.object.etag), resource.kind == davTask, nil;
+	case xml.Name{Space: davNamespace, Local: "getcontenttype"}:
+		return "text/calendar; charset=utf-8; component=VTODO", resource.kind == davTask, nil;
+	case xml.Name{Space: davNamespace, Local: "getlastmodified"}:
+		return davEscape(davStamp(resource.object.task).Format(http.TimeFormat)), resource.kind == davTask, nil;
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-data"}:
+		return davEscape(string(resource.object.data)), resource.kind == davTask, nil;
+	}
+
+	return "", false, nil;
+}
+
+/* ------------------------------------------------------------ REPORT --------------------- */
+// answers a calendar-query, calendar-multiget or sync-collection REPORT on a calendar
+func (r *davRequest) report(resource davResource) {
+	body, err := r.readBody();
+	if (err != nil) {
+		return;
+	}
+	if (body == nil || resource.kind != davCalendar) {
+		assertDAVRequest(r.client, r.cancel, 403, errors.New("only calendar-query, calendar-multiget and sync-collection REPORTs on a calendar are supported"));
+		return;
+	}
+
+	var props []xml.Name;
+	if prop, ok := body.child(davNamespace, "prop"); (ok) {
+		props = prop.names();
+	}
+
+	switch (body.XMLName) {
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-query"}:
+		r.calendarQuery(resource, *body, props);
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-multiget"}:
+		r.calendarMultiget(resource, *body, props);
+	case xml.Name{Space: davNamespace, Local: "sync-collection"}:
+		r.syncCollection(resource, *body, props);
+	default:
+		assertDAVRequest(r.client, r.cancel, 403, fmt.Errorf("unsupported REPORT: %v", body.XMLName.Local));
+	}
+}
+
+// returns the tasks in a calendar that match the filter of a calendar-query
+func (r *davRequest) calendarQuery(calendar davResource, body davNode, props []xml.Name) {
+	objects, err := r.objects(calendar.category, nil);
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+
+	filter, hasFilter := body.child(calDAVNamespace, "filter");
+	var b strings.Builder;
+	for _, object := range objects {
+		if (hasFilter) {
+			matched, err := matchesFilter(object, filter, r.loc);
+			if (err != nil) {
+				assertDAVRequest(r.client, r.cancel, 400, err);
+				return;
+			}
+			if (!matched) {
+				continue;
+			}
+		}
+		err = r.writeResponse(&b, davResource{kind: davTask, href: r.objectHref(calendar.category.Id, object.name), category: calendar.category, object: object}, props);
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+	}
+	r.writeMultistatus(b.String(), "");
+}
+
+// returns the tasks at the hrefs of a calendar-multiget
+func (r *davRequest) calendarMultiget(calendar davResource, body davNode, props []xml.Name) {
+	var b strings.Builder;
+	for _, node := range body.Children {
+		if (node.XMLName != (xml.Name{Space: davNamespace, Local: "href"})) {
+			continue;
+		}
+		href := strings.TrimSpace(node.Text);
+
+		var object davObject;
+		err := pgx.ErrNoRows;
+		if u, parseErr := url.Parse(href); (parseErr == nil && strings.HasPrefix(u.Path, calendar.href)) {
+			object, err = r.objectNamed(calendar.category, strings.TrimPrefix(u.Path, calendar.href));
+		}
+		if (err == pgx.ErrNoRows) {
+			b.WriteString("<D:response><D:href>" + davEscape(href) + "</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>");
+			continue;
+		}
+		if (err == nil) {
+			err = r.writeResponse(&b, davResource{kind: davTask, href: href, category: calendar.category, object: object}, props);
+		}
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+	}
+	r.writeMultistatus(b.String(), "");
+}
+
+// returns the tasks that changed since a sync token, and the ones that are gone from the calendar since,
+//		or every task in the calendar if there is no token
+func (r *davRequest) syncCollection(calendar davResource, body davNode, props []xml.Name) {
+	tokenNode, _ := body.child(davNamespace, "sync-token");
+	token := strings.TrimSpace(tokenNode.Text);
+
+	var after int64;
+	var err error;
+	if (token != "") {
+		after, err = strconv.ParseInt(strings.TrimPrefix(token, davSyncTokenPrefix), 10, 64);
+		known := false;
+		if (err == nil && strings.HasPrefix(token, davSyncTokenPrefix)) {
+			// the events after the token have to still be in the change log
+			//		(a token of 0, given out while the change log was empty, only holds while the log still starts at its first event)
+			if (after == 0) {
+				err = r.c.QueryRow(context.Background(), "SELECT COALESCE(MIN(id), 1)=1 FROM change_events;").Scan(&known);
+			} else {
+				err = r.c.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM change_events WHERE id=$1);", after).Scan(&known);
+			}
+			if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+				return;
+			}
+		}
+		if (!known) {
+			assertDAVPrecondition(r.client, r.cancel, 403, `<D:valid-sync-token/>`, errors.New("the sync token is invalid or too old"));
+			return;
+		}
+	}
+
+	if (token == "") {
+		newToken, err := r.currentSyncToken();
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+		objects, err := r.objects(calendar.category, nil);
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+		var b strings.Builder;
+		for _, object := range objects {
+			err = r.writeResponse(&b, davResource{kind: davTask, href: r.objectHref(calendar.category.Id, object.name), category: calendar.category, object: object}, props);
+			if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+				return;
+			}
+		}
+		r.writeMultistatus(b.String(), newToken);
+		return;
+	}
+
+	log, err := queryEvents(r.c, "WHERE id > $1 ORDER BY id", after);
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+	upTo := syncPoint(log, after, false);
+
+	// renaming the category changes every task in it, as their CATEGORIES hold its title
+	changedIds := []int{};
+	everything := false;
+	for _, e := range log {
+		if (e.Id > upTo || !e.visibleTo(r.user.Id)) {
+			continue;
+		}
+		if (e.Task_Id.Valid) {
+			changedIds = append(changedIds, int(e.Task_Id.Int64));
+		} else if (e.Category_Id.Valid && int(e.Category_Id.Int64) == calendar.category.Id) {
+			everything = true;
+		}
+	}
+
+	var objects []davObject;
+	if (everything) {
+		objects, err = r.objects(calendar.category, nil);
+	} else if (len(changedIds) > 0) {
+		objects, err = r.objects(calendar.category, changedIds);
+	}
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+
+	var b strings.Builder;
+	present := map[int]bool{};
+	for _, object := range objects {
+		present[object.task.Id] = true;
+		err = r.writeResponse(&b, davResource{kind: davTask, href: r.objectHref(calendar.category.Id, object.name), category: calendar.category, object: object}, props);
+		if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+			return;
+		}
+	}
+
+	// tasks that changed but are not in the calendar were deleted, moved to the trash or moved to another category;
+	//		apps ignore the ones that were never in it
+	removedIds := []int{};
+	for _, id := range changedIds {
+		if (!present[id]) {
+			present[id] = true;
+			removedIds = append(removedIds, id);
+		}
+	}
+	names, err := r.objectNames(removedIds);
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+	for _, id := range removedIds {
+		b.WriteString("<D:response><D:href>" + davEscape(r.objectHref(calendar.category.Id, names[id][0])) + "</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>");
+	}
+
+	r.writeMultistatus(b.String(), davSyncTokenPrefix + strconv.FormatInt(upTo, 10));
+}
+
+// returns the sync token of the change log as it is now: up to the newest event, or to just before the first event
+//		that may still be committed (see syncPoint)
+func (r *davRequest) currentSyncToken() (string, error) {
+	if (r.syncToken != "") {
+		return r.syncToken, nil;
+	}
+
+	var settled int64;
+	err := r.c.QueryRow(context.Background(), "SELECT COALESCE(MAX(id), 0) FROM change_events WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1);", eventGapWait.Seconds()).Scan(&settled);
+	if (err != nil) {
+		return "", err;
+	}
+	log, err := queryEvents(r.c, "WHERE id > $1 ORDER BY id", settled);
+	if (err != nil) {
+		return "", err;
+	}
+
+	r.syncToken = davSyncTokenPrefix + strconv.FormatInt(syncPoint(log, settled, settled == 0), 10);
+	return r.syncToken, nil;
+}
+
+// writes a 207 Multi-Status response holding the given <response>s, followed by a sync token if there is one
+func (r *davRequest) writeMultistatus(responses string, syncToken string) {
+	var b strings.Builder;
+	b.WriteString(xml.Header);
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">`);
+	b.WriteString(responses);
+	if (syncToken != "") {
+		b.WriteString("<D:sync-token>" + davEscape(syncToken) + "</D:sync-token>");
+	}
+	b.WriteString("</D:multistatus>");
+
+	r.client.Data(207, "application/xml; charset=utf-8", []byte(b.String()));
+}
+
+/* ------------------------------------------------------------ CALENDAR OBJECTS --------------------- */
+// returns a task as an iCalendar object
+func (r *davRequest) get(resource davResource) {
+	if (resource.kind != davTask) {
+		assertDAVRequest(r.client, r.cancel, 405, errors.New("only tasks can be fetched with GET"));
+		return;
+	}
+	if (resource.object.task.Id == 0) {
+		assertDAVFound(r.client, r.cancel, resource.href);
+		return;
+	}
+
+	r.client.Header("ETag", resource.object.etag);
+	r.client.Header("Last-Modified", davStamp(resource.object.task).Format(http.TimeFormat));
+	r.client.Data(200, "text/calendar; charset=utf-8", resource.object.data);
+}
+
+// creates or changes a task from the VTODO in an iCalendar object
+func (r *davRequest) put(resource davResource) {
+	if (resource.kind != davTask) {
+		assertDAVRequest(r.client, r.cancel, 405, errors.New("only tasks can be written with PUT"));
+		return;
+	}
+	if (!hasRole(resource.category.Role, roleEditor)) {
+		assertDAVRequest(r.client, r.cancel, 403, fmt.Errorf("you need to be at least a %v of category with id: %v", roleEditor, resource.category.Id));
+		return;
+	}
+	if (r.assertPreconditions(resource.object) != nil) {
+		return;
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.client.Request.Body, maxDAVRequestSize + 1));
+	if (err == nil && len(data) > maxDAVRequestSize) {
+		err = fmt.Errorf("iCalendar objects can be at most %v bytes", maxDAVRequestSize);
+	}
+	if (err != nil) {
+		assertDAVRequest(r.client, r.cancel, 413, err);
+		return;
+	}
+	todo, err := davTodo(data);
+	if (err != nil) {
+		assertDAVPrecondition(r.client, r.cancel, 403, `<C:valid-calendar-data/>`, err);
+		return;
+	}
+	uid, _ := todo.Get("UID");
+	if (strings.TrimSpace(uid.Value) == "") {
+		assertDAVPrecondition(r.client, r.cancel, 403, `<C:valid-calendar-object-resource/>`, errors.New("the VTODO has no UID"));
+		return;
+	}
+
+	t := icsTask(todo, 1, r.loc);
+	if (t.skip != "") {
+		t.err = errors.New(t.skip);
+	}
+	if (t.err != nil) {
+		assertDAVPrecondition(r.client, r.cancel, 403, `<C:valid-calendar-object-resource/>`, t.err);
+		return;
+	}
+	// every CATEGORIES value is a tag, other than the title of the category, which taskTodo writes first
+	if (t.category != "" && !strings.EqualFold(t.category, resource.category.Title)) {
+		t.params.Tags = append([]string{t.category}, t.params.Tags...);
+	}
+	t.params.Category_Id = strconv.Itoa(resource.category.Id);
+
+	if (resource.object.task.Id == 0) {
+		r.createTask(resource, t, strings.TrimSpace(uid.Value));
+	} else {
+		r.changeTask(resource, t);
+	}
+}
+
+// creates a task PUT at a new name in a calendar
+func (r *davRequest) createTask(resource davResource, t importedTask, uid string) {
+	// a calendar cannot hold two objects with the same UID
+	objects, err := r.objects(resource.category, nil);
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+	for _, object := range objects {
+		if (object.uid == uid) {
+			assertDAVPrecondition(r.client, r.cancel, 403, `<C:no-uid-conflict><D:href>` + davEscape(r.objectHref(resource.category.Id, object.name)) + `</D:href></C:no-uid-conflict>`, fmt.Errorf("the calendar already has a task with UID: %v", uid));
+			return;
+		}
+	}
+
+	tx, err := r.c.Begin(context.Background())
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+	defer tx.Rollback(context.Background())
+
+	id, err := insertTask(tx, t.params, r.user.Id);
+	if (err == nil && t.completed) {
+		err = completeNewTask(tx, id, r.user.Id);
+	}
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "INSERT INTO caldav_resources (task_id, name, uid) VALUES ($1, $2, $3);", id, resource.object.name, uid)
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(r.client, r.cancel, err) != nil) {
+		return;
+	}
+
+	r.client.Status(201);
+}
+
+// applies a VTODO PUT over an existing task, with the same checks as /updatetask, /completetask and /incompletetask;
+//		the fields, the priority, tags and recurrence, and whether the task is completed are all changed in one transaction,
+//		in which the preconditions are checked again once the task is locked, so that two PUTs cannot overwrite each other
+func (r *davRequest) changeTask(resource davResource, t importedTask) {
+	id := resource.object.task.Id;
+
+	fields := UpdateTaskParams{
+		Id: id,
+		Title: t.params.Title,
+		Description: t.params.Description,
+		Category_Id: resource.category.Id,
+		Deadline: t.params.Deadline,
+		Deadline_Date: t.params.Deadline_Date,
+		Priority: t.params.Priority,
+		Tags: t.params.Tags,
+		Recurrence: t.params.Recurrence,
+	};
+
+	// a PUT that only ticks a task off is recorded in its history the same way as /completetask
+	action := actionUpdate;
+	if (!davFieldsChanged(resource.object.task, fields) && t.completed != resource.object.task.Completed) {
+		action = actionUncomplete;
+		if (t.completed) {
+			action = actionComplete;
+		}
+	}
+
+	var failed error;
+	err := changeTaskWith(r.c, id, r.user.Id, action, func(tx pgx.Tx) error {
+		// the transaction runs on r.c, so the task is read as it is now that changeTaskWith has locked it
+		objects, err := r.objects(resource.category, []int{id});
+		if (err == nil && len(objects) == 0) {
+			err = pgx.ErrNoRows;
+		}
+		if (err != nil) {
+			return err;
+		}
+		failed = r.preconditionError(objects[0]);
+		if (failed != nil) {
+			return failed;
+		}
+
+		task := objects[0].task;
+		if (!davFieldsChanged(task, fields) && task.Completed == t.completed) {
+			return nil;
+		}
+
+		return writeTaskFields(tx, fields, false, ", completed=$11", t.completed);
+	})
+	if (failed != nil) {
+		assertDAVRequest(r.client, r.cancel, 412, failed);
+		return;
+	}
+	if (assertTaskChanged(r.client, r.cancel, id, err) != nil) {
+		return;
+	}
+
+	// the task is stored differently from how it was sent, so no ETag is given and the app fetches it again
+	r.client.Status(204);
+}
+
+// whether a VTODO PUT over a task changes anything other than whether it is completed
+func davFieldsChanged(task Task, fields UpdateTaskParams) bool {
+	// all-day tasks come back from the database with their Deadline filled in (see Task)
+	currentDeadline := task.Deadline.Time;
+	if (task.Deadline_Date.Valid) {
+		currentDeadline.SetNil();
+	}
+
+	return task.Title != fields.Title || task.Description != fields.Description ||
+		!sameTime(currentDeadline, fields.Deadline) || !sameTime(task.Deadline_Date.Time, fields.Deadline_Date.Time) ||
+		task.Priority != fields.Priority || task.Recurrence != fields.Recurrence || !sameStrings(task.Tags, fields.Tags);
+}
+
+// moves a task to the trash, as /deletetask does
+func (r *davRequest) delete(resource davResource) {
+	if (resource.kind != davTask) {
+		assertDAVRequest(r.client, r.cancel, 403, errors.New("only tasks can be deleted over CalDAV"));
+		return;
+	}
+	if (resource.object.task.Id == 0) {
+		assertDAVFound(r.client, r.cancel, resource.href);
+		return;
+	}
+	if (!hasRole(resource.category.Role, roleEditor)) {
+		assertDAVRequest(r.client, r.cancel, 403, fmt.Errorf("you need to be at least a %v of category with id: %v", roleEditor, resource.category.Id));
+		return;
+	}
+	if (r.assertPreconditions(resource.object) != nil) {
+		return;
+	}
+
+	if (deleteTask(resource.object.task.Id, r.user.Id, r.client, r.cancel) != nil) {
+		return;
+	}
+
+	r.client.Status(204);
+}
+
+// returns the VTODO in an iCalendar object; other components, and VTODOs that change one occurrence of a recurring task, are left out
+func davTodo(data []byte) (*ical.Component, error) {
+	components, err := ical.Decode(bytes.NewReader(data));
+	if (err != nil) {
+		return nil, err;
+	}
+	for _, calendar := range components {
+		if (calendar.Name != "VCALENDAR") {
+			continue;
+		}
+		for _, component := range calendar.Components {
+			if _, override := component.Get("RECURRENCE-ID"); (component.Name == "VTODO" && !override) {
+				return component, nil;
+			}
+		}
+	}
+
+	return nil, errors.New("the object has no VTODO, this server only keeps tasks");
+}
+
+/* ------------------------------------------------------------ DATABASE --------------------- */
+// returns a category the user has access to, or pgx.ErrNoRows
+func (r *davRequest) category(id int) (Category, error) {
+	var category Category;
+	err := r.c.QueryRow(context.Background(), `
+		SELECT categories.id, categories.title, accessible.role, categories.workspace_id, categories.parent_id
+		FROM categories
+			INNER JOIN public.get_accessible_categories($1) AS accessible ON categories.id=accessible.category_id
+		WHERE categories.id=$2;`, r.user.Id, id).Scan(&category.Id, &category.Title, &category.Role, &category.Workspace_Id, &category.Parent_Id);
+
+	return category, err;
+}
+
+// returns the tasks in a calendar that are not in the trash, or only those with the given ids if ids is not nil
+func (r *davRequest) objects(category Category, ids []int) ([]davObject, error) {
+	rows, err := r.c.Query(context.Background(), "SELECT * FROM public.get_all_tasks($1) WHERE category_id=$2 AND ($3::int[] IS NULL OR id = ANY($3));", r.user.Id, category.Id, ids)
+	if (err != nil) {
+		return nil, err;
+	}
+	var tasks []Task;
+	for rows.Next() {
+		var t Task
+		err = scanTask(rows, &t)
+		if (err != nil) {
+			rows.Close();
+			return nil, err;
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close();
+	if (rows.Err() != nil) {
+		return nil, rows.Err();
+	}
+
+	taskIds := []int{};
+	for _, t := range tasks {
+		taskIds = append(taskIds, t.Id);
+	}
+	names, err := r.objectNames(taskIds);
+	if (err != nil) {
+		return nil, err;
+	}
+
+	objects := []davObject{};
+	for _, t := range tasks {
+		object := davObject{task: t, name: names[t.Id][0], uid: names[t.Id][1]};
+		object.data, object.etag = davCalendarObject(object, r.loc);
+		objects = append(objects, object);
+	}
+
+	return objects, nil;
+}
+
+// returns the name and UID of each of the given tasks
+func (r *davRequest) objectNames(taskIds []int) (map[int][2]string, error) {
+	names := map[int][2]string{};
+	for _, id := range taskIds {
+		names[id] = [2]string{fmt.Sprintf("task-%v.ics", id), taskUid(Task{Id: id}, "task")};
+	}
+	if (len(taskIds) == 0) {
+		return names, nil;
+	}
+
+	rows, err := r.c.Query(context.Background(), "SELECT task_id, name, uid FROM caldav_resources WHERE task_id = ANY($1);", taskIds)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+	for rows.Next() {
+		var id int;
+		var name, uid string;
+		err = rows.Scan(&id, &name, &uid);
+		if (err != nil) {
+			return nil, err;
+		}
+		names[id] = [2]string{name, uid};
+	}
+
+	return names, rows.Err();
+}
+
+// returns the task with the given name in a calendar, or pgx.ErrNoRows
+func (r *davRequest) objectNamed(category Category, name string) (davObject, error) {
+	var id int;
+	err := r.c.QueryRow(context.Background(), `
+		SELECT tasks.id FROM caldav_resources INNER JOIN tasks ON tasks.id=caldav_resources.task_id
+		WHERE caldav_resources.name=$1 AND tasks.category_id=$2 AND tasks.deleted_at IS NULL;`, name, category.Id).Scan(&id);
+	if (err == pgx.ErrNoRows) {
+		// tasks that were not created through CalDAV are named after their id
+		id, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "task-"), ".ics"));
+		if (err != nil || fmt.Sprintf("task-%v.ics", id) != name) {
+			return davObject{}, pgx.ErrNoRows;
+		}
+		var named bool;
+		err = r.c.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM caldav_resources WHERE task_id=$1);", id).Scan(&named);
+		if (err == nil && named) {
+			err = pgx.ErrNoRows;
+		}
+	}
+	if (err != nil) {
+		return davObject{}, err;
+	}
+
+	objects, err := r.objects(category, []int{id});
+	if (err == nil && len(objects) == 0) {
+		err = pgx.ErrNoRows;
+	}
+	if (err != nil) {
+		return davObject{}, err;
+	}
+
+	return objects[0], nil;
+}
+
+// returns a task as an iCalendar object, along with its ETag; the object only changes when the task does,
+//		so its DTSTAMP is when the task was last changed and its VTIMEZONE only covers the time around the deadline
+func davCalendarObject(object davObject, loc *time.Location) ([]byte, string) {
+	cal := ical.NewComponent("VCALENDAR");
+	cal.Add("VERSION", "2.0");
+	cal.AddText("PRODID", calendarProductId);
+
+	t := object.task;
+	if (loc != time.UTC && t.Deadline.Valid && !t.Deadline_Date.Valid) {
+		due := t.Deadline.Time.Time;
+		cal.AddComponent(ical.Timezone(loc, due.AddDate(0, 0, -1), due.AddDate(2, 0, 0)));
+	}
+	todo := taskTodo(t, loc, davStamp(t));
+	todo.Set("UID", object.uid);
+	cal.AddComponent(todo);
+
+	var b bytes.Buffer;
+	cal.Encode(&b);
+	sum := sha256.Sum256(b.Bytes());
+
+	return b.Bytes(), `"` + hex.EncodeToString(sum[:16]) + `"`;
+}
+
+// returns when a task was last changed, in UTC
+func davStamp(t Task) time.Time {
+	if (t.Updated_at.Valid) {
+		return t.Updated_at.Time.Time.UTC();
+	}
+	if (t.Created_at.Valid) {
+		return t.Created_at.Time.Time.UTC();
+	}
+
+	return time.Unix(0, 0).UTC();
+}
+
+/* ------------------------------------------------------------ FILTERS --------------------- */
+// whether a task matches the <filter> of a calendar-query, which starts with a comp-filter for VCALENDAR
+func matchesFilter(object davObject, filter davNode, loc *time.Location) (bool, error) {
+	components, err := ical.Decode(bytes.NewReader(object.data));
+	if (err != nil || len(components) != 1) {
+		return false, err;
+	}
+
+	for _, node := range filter.Children {
+		if (node.XMLName == (xml.Name{Space: calDAVNamespace, Local: "comp-filter"})) {
+			matched, err := matchesCompFilter([]*ical.Component{components[0]}, node, loc);
+			if (err != nil || !matched) {
+				return false, err;
+			}
+		}
+	}
+
+	return true, nil;
+}
+
+// whether any of the given components matches a comp-filter, or, for a comp-filter with is-not-defined, whether none of them are named in it
+func matchesCompFilter(components []*ical.Component, filter davNode, loc *time.Location) (bool, error) {
+	name := filter.attr("name");
+	var named []*ical.Component;
+	for _, component := range components {
+		if (strings.EqualFold(component.Name, name)) {
+			named = append(named, component);
+		}
+	}
+	if _, ok := filter.child(calDAVNamespace, "is-not-defined"); (ok) {
+		return len(named) == 0, nil;
+	}
+
+	for _, component := range named {
+		matched := true;
+		for _, node := range filter.Children {
+			var err error;
+			switch (node.XMLName) {
+			case xml.Name{Space: calDAVNamespace, Local: "time-range"}:
+				matched, err = matchesTimeRange(component, node, loc);
+			case xml.Name{Space: calDAVNamespace, Local: "prop-filter"}:
+				matched, err = matchesPropFilter(component, node);
+			case xml.Name{Space: calDAVNamespace, Local: "comp-filter"}:
+				matched, err = matchesCompFilter(component.Components, node, loc);
+			}
+			if (err != nil) {
+				return false, err;
+			}
+			if (!matched) {
+				break;
+			}
+		}
+		if (matched) {
+			return true, nil;
+		}
+	}
+
+	return false, nil;
+}
+
+// whether a component matches a prop-filter: that it has the property, or with is-not-defined that it does not,
+//		and that the property's value contains the text of a text-match, if there is one
+func matchesPropFilter(component *ical.Component, filter davNode) (bool, error) {
+	props := component.GetAll(filter.attr("name"));
+	if _, ok := filter.child(calDAVNamespace, "is-not-defined"); (ok) {
+		return len(props) == 0, nil;
+	}
+	if (len(props) == 0) {
+		return false, nil;
+	}
+
+	match, ok := filter.child(calDAVNamespace, "text-match");
+	if (!ok) {
+		return true, nil;
+	}
+	text := strings.ToLower(strings.TrimSpace(match.Text));
+	negate := match.attr("negate-condition") == "yes";
+	for _, p := range props {
+		if (strings.Contains(strings.ToLower(p.Text()), text) != negate) {
+			return true, nil;
+		}
+	}
+
+	return false, nil;
+}
+
+// whether a VTODO overlaps a time-range, as worked out in RFC 4791 section 9.9 from its DTSTART and DUE;
+//		recurring tasks and tasks without either always match, as do components other than VTODOs
+func matchesTimeRange(component *ical.Component, filter davNode, loc *time.Location) (bool, error) {
+	start, err := davRangeTime(filter.attr("start"), time.Time{});
+	if (err != nil) {
+		return false, err;
+	}
+	end, err := davRangeTime(filter.attr("end"), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC));
+	if (err != nil) {
+		return false, err;
+	}
+
+	_, recurring := component.Get("RRULE");
+	dueProp, hasDue := component.Get("DUE");
+	startProp, hasStart := component.Get("DTSTART");
+	if (component.Name != "VTODO" || recurring || (!hasDue && !hasStart)) {
+		return true, nil;
+	}
+
+	var due, dtstart time.Time;
+	if (hasDue) {
+		due, _, err = dueProp.Time(loc);
+	}
+	if (err == nil && hasStart) {
+		dtstart, _, err = startProp.Time(loc);
+	}
+	if (err != nil) {
+		return false, err;
+	}
+
+	switch {
+	case (hasStart && hasDue):
+		return (start.Before(due) || !dtstart.Before(start)) && (end.After(dtstart) || !end.Before(due)), nil;
+	case (hasDue):
+		return start.Before(due) && !end.Before(due), nil;
+	default:
+		return !start.After(dtstart) && end.After(dtstart), nil;
+	}
+}
+
+// reads a time of a time-range, e.g. "20260301T000000Z", or returns fallback if there is none
+func davRangeTime(value string, fallback time.Time) (time.Time, error) {
+	if (value == "") {
+		return fallback, nil;
+	}
+	t, err := time.Parse("20060102T150405Z", value);
+	if (err != nil) {
+		return t, fmt.Errorf("%q is not a UTC time", value);
+	}
+
+	return t, nil;
+}
+
+/* ------------------------------------------------------------ HELPER FUNCTIONS --------------------- */
+// reads an XML request body, or returns nil if it is empty
+func (r *davRequest) readBody() (*davNode, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r.client.Request.Body, maxDAVRequestSize));
+	if (err != nil || len(bytes.TrimSpace(data)) == 0) {
+		return nil, err;
+	}
+
+	var node davNode;
+	err = xml.Unmarshal(data, &node);
+	if (err != nil) {
+		return nil, assertDAVRequest(r.client, r.cancel, 400, err);
+	}
+
+	return &node, nil;
+}
+
+// returns the first element inside a node with the given name
+func (n davNode) child(space string, local string) (davNode, bool) {
+	for _, child := range n.Children {
+		if (child.XMLName.Space == space && child.XMLName.Local == local) {
+			return child, true;
+		}
+	}
+
+	return davNode{}, false;
+}
+
+// returns the names of the elements inside a node, e.g. of the properties inside a <prop>
+func (n davNode) names() []xml.Name {
+	names := []xml.Name{};
+	for _, child := range n.Children {
+		names = append(names, child.XMLName);
+	}
+
+	return names;
+}
+
+// returns the value of an attribute of a node, or "" if it does not have it
+func (n davNode) attr(local string) string {
+	for _, a := range n.Attrs {
+		if (a.Name.Local == local) {
+			return a.Value;
+		}
+	}
+
+	return "";
+}
+
+// escapes text to go inside an XML element
+func davEscape(text string) string {
+	var b strings.Builder;
+	xml.EscapeText(&b, []byte(text));
+	return b.String();
+}
+
+// checks the If-Match and If-None-Match headers of a PUT or DELETE against the ETag the task has now,
+//		if they do not hold, returns an error message to the client and stops execution of any remaining function-calls
+func (r *davRequest) assertPreconditions(object davObject) error {
+	e := r.preconditionError(object);
+	if (e == nil) {
+		return nil;
+	}
+
+	return assertDAVRequest(r.client, r.cancel, 412, e);
+}
+
+// returns why the If-Match and If-None-Match headers do not hold for the task, or nil if they do
+func (r *davRequest) preconditionError(object davObject) error {
+	ifMatch := r.client.GetHeader("If-Match");
+	ifNoneMatch := r.client.GetHeader("If-None-Match");
+
+	var e error;
+	switch {
+	case (ifMatch == "*" && object.task.Id == 0):
+		e = errors.New("the task does not exist");
+	case (ifMatch != "" && ifMatch != "*" && (object.task.Id == 0 || !strings.Contains(ifMatch, object.etag))):
+		e = errors.New("the task has changed since it was fetched");
+	case (ifNoneMatch == "*" && object.task.Id != 0):
+		e = errors.New("the task already exists");
+	}
+
+	return e;
+}
+
+// reports to the client that it has to log in, and stops execution of any remaining function-calls
+func assertDAVAuthorised(client *gin.Context, cancel context.CancelFunc, e error) error {
+	client.Header("WWW-Authenticate", `Basic realm="Doom and Gloom", charset="UTF-8"`);
+
+	return assertDAVRequest(client, cancel, 401, e);
+}
+
+// reports to the client that there is nothing at a path, and stops execution of any remaining function-calls
+func assertDAVFound(client *gin.Context, cancel context.CancelFunc, path string) error {
+	return assertDAVRequest(client, cancel, 404, fmt.Errorf("nothing found at: %v", path));
+}
+
+// reports to the client that a precondition of RFC 4791 or RFC 6578 does not hold, naming it in a DAV:error body,
+//		and stops execution of any remaining function-calls
+func assertDAVPrecondition(client *gin.Context, cancel context.CancelFunc, code int, condition string, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to answer CalDAV request: %v\n", e);
+
+	body := xml.Header + `<D:error xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` + condition + `<D:responsedescription>` + davEscape(e.Error()) + `</D:responsedescription></D:error>`;
+	client.Data(code, "application/xml; charset=utf-8", []byte(body));
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that its CalDAV request failed with the given http code, in plain text as CalDAV clients expect,
+//		and stops execution of any remaining function-calls
+func assertDAVRequest(client *gin.Context, cancel context.CancelFunc, code int, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to answer CalDAV request: %v\n", e);
+
+	client.String(code, e.Error());
+
+	cancel();
+
+	return e;
+}
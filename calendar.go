@@ -0,0 +1,324 @@
+package main
+
+import (
+	"api/ical"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// note: every user can have a calendar feed, an iCalendar file of their tasks' deadlines that calendar apps subscribe to
+//		by its URL. Calendar apps cannot log in, so the URL holds a secret token instead, which the user can rotate
+//		to cut off everyone who had the old URL. Each task with a deadline is a VTODO, and with ?events=true also a VEVENT
+//		(as many calendar apps do not show VTODOs); ?completed=false leaves completed tasks out.
+//		Timed deadlines are written in the user's timezone, and all-day deadlines as dates
+type CalendarFeed struct {
+	Token string `json:"token"`
+	Url string `json:"url"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+type CalendarFeedOptions struct {
+	Events bool
+	Completed bool
+}
+
+// the PRODID of the calendars the server writes
+const calendarProductId = "-//Doom and Gloom//Tasks//EN"
+
+// where calendar feeds are served from; the token that follows it is kept out of the request log (see logFormatter)
+const calendarFeedPath = "/calendar/"
+
+// how often calendar apps are asked to fetch the feed again
+const calendarRefreshInterval = "PT1H"
+
+/* ------------------------------------------------------------ CALENDAR FEED --------------------- */
+/* Returns a user's calendar feed, creating it if they do not have one yet */
+func getCalendarFeed(userId int, client *gin.Context, cancel context.CancelFunc) (CalendarFeed, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var feed CalendarFeed;
+	err := c.QueryRow(context.Background(), "SELECT token, created_at FROM calendar_feeds WHERE user_id=$1;", userId).Scan(&feed.Token, &feed.Created_at);
+	if (err == pgx.ErrNoRows) {
+		return saveCalendarFeed(c, userId, false, client, cancel);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return feed, err;
+	}
+	feed.Url = calendarFeedUrl(client, feed.Token);
+
+	return feed, nil;
+}
+
+/* Gives a user's calendar feed a new token, after which the old URL no longer works */
+func rotateCalendarFeed(userId int, client *gin.Context, cancel context.CancelFunc) (CalendarFeed, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	return saveCalendarFeed(c, userId, true, client, cancel);
+}
+
+// stores a new token for a user's calendar feed; unless replace is true, a token created in the meantime is kept instead
+func saveCalendarFeed(c *pgx.Conn, userId int, replace bool, client *gin.Context, cancel context.CancelFunc) (CalendarFeed, error) {
+	var feed CalendarFeed;
+
+	b := make([]byte, 24);
+	_, err := rand.Read(b);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return feed, err;
+	}
+
+	conflict := "UPDATE SET user_id=calendar_feeds.user_id";
+	if (replace) {
+		conflict = "UPDATE SET token=EXCLUDED.token, created_at=CURRENT_TIMESTAMP";
+	}
+	err = c.QueryRow(context.Background(), `
+		INSERT INTO calendar_feeds (user_id, token) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO ` + conflict + `
+		RETURNING token, created_at;`, userId, hex.EncodeToString(b)).Scan(&feed.Token, &feed.Created_at);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return feed, err;
+	}
+	feed.Url = calendarFeedUrl(client, feed.Token);
+
+	return feed, nil;
+}
+
+/* Returns the user whose calendar feed has the given token */
+func calendarFeedUser(token string, client *gin.Context, cancel context.CancelFunc) (User, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var user User;
+	err := c.QueryRow(context.Background(), "SELECT users.id, users.username, users.timezone FROM calendar_feeds INNER JOIN users ON calendar_feeds.user_id=users.id WHERE calendar_feeds.token=$1;", token).Scan(
+		&user.Id,
+		&user.Username,
+		&user.Timezone,
+	)
+	if (err == pgx.ErrNoRows) {
+		return user, assertCalendarFeedFound(client, cancel, errors.New("there is no calendar feed at this address, its token may have been rotated"));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return user, err;
+	}
+
+	return user, nil;
+}
+
+// returns the address calendar apps fetch a feed from
+func calendarFeedUrl(client *gin.Context, token string) string {
+	return serverUrl(client, calendarFeedPath + token + ".ics");
+}
+
+// returns the full address of a path on this server, on the host the request came in on
+func serverUrl(client *gin.Context, path string) string {
+	scheme := "http";
+	if (client.Request.TLS != nil || client.GetHeader("X-Forwarded-Proto") == "https") {
+		scheme = "https";
+	}
+
+	return scheme + "://" + client.Request.Host + path;
+}
+
+// reads the options of a calendar feed from its query string, e.g. ?events=true&completed=false
+func calendarFeedOptions(client *gin.Context) CalendarFeedOptions {
+	options := CalendarFeedOptions{Completed: true};
+	if b, err := strconv.ParseBool(client.Query("events")); (err == nil) {
+		options.Events = b;
+	}
+	if b, err := strconv.ParseBool(client.Query("completed")); (err == nil) {
+		options.Completed = b;
+	}
+
+	return options;
+}
+
+/* ------------------------------------------------------------ ICALENDAR --------------------- */
+// writes the tasks that have deadlines as an iCalendar file, with timed deadlines in the given timezone
+func writeTaskCalendar(w io.Writer, name string, tasks []Task, loc *time.Location, options CalendarFeedOptions) error {
+	cal := ical.NewComponent("VCALENDAR");
+	cal.Add("VERSION", "2.0");
+	cal.AddText("PRODID", calendarProductId);
+	cal.Add("CALSCALE", "GREGORIAN");
+	cal.Add("METHOD", "PUBLISH");
+	cal.AddText("X-WR-CALNAME", name);
+	cal.AddText("X-WR-TIMEZONE", loc.String());
+	cal.Add("REFRESH-INTERVAL", calendarRefreshInterval, ical.Param{Name: "VALUE", Value: "DURATION"});
+	cal.Add("X-PUBLISHED-TTL", calendarRefreshInterval);
+
+	now := time.Now().UTC();
+	var components []*ical.Component;
+	// the span the timezone has to cover
+	var earliest, latest time.Time;
+	for _, t := range tasks {
+		if ((!t.Deadline.Valid && !t.Deadline_Date.Valid) || (t.Completed && !options.Completed)) {
+			continue;
+		}
+		if (t.Deadline.Valid && !t.Deadline_Date.Valid) {
+			due := t.Deadline.Time.Time;
+			if (earliest.IsZero() || due.Before(earliest)) {
+				earliest = due;
+			}
+			if (due.After(latest)) {
+				latest = due;
+			}
+		}
+
+		components = append(components, taskTodo(t, loc, now));
+		if (options.Events) {
+			components = append(components, taskEvent(t, loc, now));
+		}
+	}
+
+	if (loc != time.UTC && !earliest.IsZero()) {
+		// recurring tasks carry on past their first deadline, so the timezone is described for a while after the last one too
+		if (latest.Before(now)) {
+			latest = now;
+		}
+		cal.AddComponent(ical.Timezone(loc, earliest.AddDate(0, 0, -1), latest.AddDate(2, 0, 0)));
+	}
+	for _, component := range components {
+		cal.AddComponent(component);
+	}
+
+	return cal.Encode(w);
+}
+
+// returns the VTODO for a task with a deadline
+func taskTodo(t Task, loc *time.Location, now time.Time) *ical.Component {
+	todo := ical.NewComponent("VTODO");
+	todo.Add("UID", taskUid(t, "task"));
+	addTaskProperties(todo, t, now);
+
+	if (t.Deadline_Date.Valid) {
+		day := t.Deadline_Date.Time.Time;
+		if (t.Recurrence.Valid) {
+			// a recurring to-do needs a start for its recurrence to count from, and its due date has to come after it;
+			//		an all-day task is due at the end of its day, which is the start of the next
+			todo.AddDate("DTSTART", day);
+			todo.AddDate("DUE", day.AddDate(0, 0, 1));
+		} else {
+			todo.AddDate("DUE", day);
+		}
+	} else {
+		due := t.Deadline.Time.Time.In(loc);
+		if (t.Recurrence.Valid) {
+			todo.AddTime("DTSTART", taskStart(t, due));
+		}
+		todo.AddTime("DUE", due);
+	}
+
+	if (t.Completed) {
+		todo.Add("STATUS", "COMPLETED");
+		todo.Add("PERCENT-COMPLETE", "100");
+		if (t.Updated_at.Valid) {
+			todo.AddTime("COMPLETED", t.Updated_at.Time.Time.UTC());
+		}
+	} else {
+		todo.Add("STATUS", "NEEDS-ACTION");
+	}
+	if (t.Recurrence.Valid) {
+		todo.Add("RRULE", t.Recurrence.String);
+	}
+
+	return todo;
+}
+
+// returns the VEVENT for a task with a deadline: a whole-day event for an all-day task, and otherwise an event that ends
+//		at the deadline and takes as long as the task is estimated to, or no time at all if it has no estimate
+func taskEvent(t Task, loc *time.Location, now time.Time) *ical.Component {
+	event := ical.NewComponent("VEVENT");
+	event.Add("UID", taskUid(t, "event"));
+	addTaskProperties(event, t, now);
+
+	if (t.Deadline_Date.Valid) {
+		day := t.Deadline_Date.Time.Time;
+		event.AddDate("DTSTART", day);
+		event.AddDate("DTEND", day.AddDate(0, 0, 1));
+	} else {
+		due := t.Deadline.Time.Time.In(loc);
+		if (t.Estimate_Minutes.Valid) {
+			event.AddTime("DTSTART", due.Add(-time.Duration(t.Estimate_Minutes.Int64) * time.Minute));
+			event.AddTime("DTEND", due);
+		} else {
+			event.AddTime("DTSTART", due);
+		}
+	}
+
+	// deadlines do not make the user busy
+	event.Add("TRANSP", "TRANSPARENT");
+	if (t.Recurrence.Valid) {
+		event.Add("RRULE", t.Recurrence.String);
+	}
+
+	return event;
+}
+
+// adds what the VTODO and VEVENT of a task have in common
+func addTaskProperties(component *ical.Component, t Task, now time.Time) {
+	component.AddTime("DTSTAMP", now);
+	if (t.Created_at.Valid) {
+		component.AddTime("CREATED", t.Created_at.Time.Time.UTC());
+	}
+	if (t.Updated_at.Valid) {
+		component.AddTime("LAST-MODIFIED", t.Updated_at.Time.Time.UTC());
+	}
+	component.AddText("SUMMARY", t.Title);
+	if (strings.TrimSpace(t.Description) != "") {
+		component.AddText("DESCRIPTION", t.Description);
+	}
+	component.AddTextList("CATEGORIES", append([]string{t.Category}, t.Tags...));
+
+	switch (t.Priority.String) {
+	case "high":
+		component.Add("PRIORITY", "1");
+	case "medium":
+		component.Add("PRIORITY", "5");
+	case "low":
+		component.Add("PRIORITY", "9");
+	}
+}
+
+// returns when a recurring task with a timed deadline starts: its estimate before the deadline,
+//		or else the start of the day it is due, or the day before if it is due at midnight
+func taskStart(t Task, due time.Time) time.Time {
+	if (t.Estimate_Minutes.Valid) {
+		return due.Add(-time.Duration(t.Estimate_Minutes.Int64) * time.Minute);
+	}
+
+	start := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, due.Location());
+	if (!start.Before(due)) {
+		start = start.AddDate(0, 0, -1);
+	}
+	return start;
+}
+
+// returns the UID of a task's VTODO or VEVENT, which stays the same for as long as the task exists
+func taskUid(t Task, kind string) string {
+	return fmt.Sprintf("%v-%v@doom-and-gloom", kind, t.Id);
+}
+
+// reports to the client that there is no calendar feed with the given token,
+//		and stops execution of any remaining function-calls
+func assertCalendarFeedFound(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to serve calendar feed: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
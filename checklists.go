@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type ChecklistItem struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+	Done bool `json:"done"`
+}
+
+type AddChecklistItemParams struct {
+	Task_Id int `json:"task_id"`
+	Title string `json:"title"`
+}
+
+type UpdateChecklistItemParams struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+	Done bool `json:"done"`
+}
+
+type DeleteChecklistItemParams struct {
+	Id int `json:"id"`
+}
+
+/* ------------------------------------------------------------ CHECKLISTS --------------------- */
+/* Adds an item to the end of a task's checklist and returns its id */
+func addChecklistItem(params AddChecklistItemParams, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	id, err := insertChecklistItems(tx, params.Task_Id, []string{params.Title});
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Changes the title of a checklist item, and whether it is done */
+func updateChecklistItem(params UpdateChecklistItemParams, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "UPDATE task_checklist_items SET title=$1, done=$2 WHERE id=$3;", params.Title, params.Done, params.Id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertChecklistItemFound(client, cancel, params.Id);
+	}
+
+	return nil;
+}
+
+/* Removes an item from a task's checklist */
+func deleteChecklistItem(id int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "DELETE FROM task_checklist_items WHERE id=$1;", id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertChecklistItemFound(client, cancel, id);
+	}
+
+	return nil;
+}
+
+/* Returns the id of the task a checklist item is on, so that access to the item can be checked against the task */
+func checklistItemTaskId(id int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var taskId int;
+	err := c.QueryRow(context.Background(), "SELECT task_id FROM task_checklist_items WHERE id=$1;", id).Scan(&taskId);
+	if (err == pgx.ErrNoRows) {
+		return 0, assertChecklistItemFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return taskId, nil;
+}
+
+/* Locks a task until the end of the transaction, so that checklist positions within it are handed out one at a time */
+func lockTask(tx pgx.Tx, taskId int) error {
+	var id int;
+	return tx.QueryRow(context.Background(), "SELECT id FROM tasks WHERE id=$1 FOR UPDATE;", taskId).Scan(&id);
+}
+
+/* Adds items to the end of a task's checklist, in order, and returns the id of the last one */
+func insertChecklistItems(tx pgx.Tx, taskId int, titles []string) (int, error) {
+	err := lockTask(tx, taskId);
+	if (err != nil) {
+		return 0, err;
+	}
+
+	var id int;
+	for _, title := range titles {
+		err = tx.QueryRow(context.Background(), `
+			INSERT INTO task_checklist_items (task_id, title, position)
+			VALUES ($1, $2, (SELECT COALESCE(MAX(position) + 1, 0) FROM task_checklist_items WHERE task_id=$1))
+			RETURNING id;`, taskId, title).Scan(&id);
+		if (err != nil) {
+			return 0, err;
+		}
+	}
+
+	return id, nil;
+}
+
+// reports to the client that there is no checklist item with the given id,
+//		and stops execution of any remaining function-calls
+func assertChecklistItemFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no checklist item found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type Mention struct {
+	User_Id int `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// note: Body is markdown, and is stored and returned exactly as it was written;
+//		it is up to the client to render it
+type Comment struct {
+	Id int `json:"id"`
+	Task_Id int `json:"task_id"`
+	Author_Id int `json:"author_id"`
+	Author string `json:"author"`
+	Body string `json:"body"`
+	Mentions []Mention `json:"mentions"`
+	Created_at Timestamp `json:"created_at"`
+	Edited_at Timestamp `json:"edited_at"`
+}
+
+type GetCommentsParams struct {
+	Task_Id int `json:"task_id"`
+}
+
+type AddCommentParams struct {
+	Task_Id int `json:"task_id"`
+	Body string `json:"body"`
+}
+
+type EditCommentParams struct {
+	Id int `json:"id"`
+	Body string `json:"body"`
+}
+
+type DeleteCommentParams struct {
+	Id int `json:"id"`
+}
+
+// matches "@username" anywhere in a comment, as long as the "@" does not follow a word character (e.g. in an email address)
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+/* ------------------------------------------------------------ COMMENTS --------------------- */
+// returns every distinct username mentioned in a comment, in the order they first appear
+func parseMentions(body string) []string {
+	var usernames []string;
+	seen := map[string]bool{};
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// a mention at the end of a sentence should not take the full stop with it
+		username := strings.TrimRight(match[1], ".-");
+		if (username != "" && !seen[username]) {
+			seen[username] = true;
+			usernames = append(usernames, username);
+		}
+	}
+
+	return usernames;
+}
+
+/* Returns the comments on a task that have not been deleted, oldest first */
+func getComments(taskId int, client *gin.Context, cancel context.CancelFunc) ([]Comment) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	comments, err := c.Query(context.Background(), `
+		SELECT task_comments.id, task_comments.task_id, task_comments.author_id, users.username, task_comments.body, task_comments.created_at, task_comments.edited_at,
+			COALESCE(
+				(SELECT json_agg(json_build_object('user_id', mentioned.id, 'username', mentioned.username) ORDER BY mentioned.username)
+				FROM comment_mentions INNER JOIN users AS mentioned ON comment_mentions.user_id=mentioned.id
+				WHERE comment_mentions.comment_id=task_comments.id),
+				'[]'::JSON)
+		FROM task_comments
+			INNER JOIN users ON task_comments.author_id=users.id
+		WHERE task_comments.task_id=$1 AND task_comments.deleted_at IS NULL
+		ORDER BY task_comments.created_at, task_comments.id;`, taskId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer comments.Close();
+
+	commentSlice := []Comment{}
+	for comments.Next() {
+		var cm Comment
+		err = comments.Scan(
+			&cm.Id,
+			&cm.Task_Id,
+			&cm.Author_Id,
+			&cm.Author,
+			&cm.Body,
+			&cm.Created_at,
+			&cm.Edited_at,
+			&cm.Mentions,
+		)
+		assertDBOperationSuccess(client, cancel, err);
+		commentSlice = append(commentSlice, cm)
+	}
+
+	return commentSlice;
+}
+
+/* Adds a comment to a task on behalf of a user, and returns the id of the new comment */
+func addComment(params AddCommentParams, userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	var id int;
+	err = tx.QueryRow(context.Background(), "INSERT INTO task_comments (task_id, author_id, body) VALUES ($1, $2, $3) RETURNING id;", params.Task_Id, userId, params.Body).Scan(&id);
+	if (err == nil) {
+		err = storeMentions(tx, id, params.Body);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Changes the body of a comment, only its author can do this */
+func editComment(params EditCommentParams, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	commandTag, err := tx.Exec(context.Background(), "UPDATE task_comments SET body=$1, edited_at=CURRENT_TIMESTAMP WHERE id=$2 AND author_id=$3 AND deleted_at IS NULL;", params.Body, params.Id, userId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertCommentFound(client, cancel, params.Id);
+	}
+
+	// mentions are worked out again from scratch, as the edit may have added or removed some
+	_, err = tx.Exec(context.Background(), "DELETE FROM comment_mentions WHERE comment_id=$1;", params.Id);
+	if (err == nil) {
+		err = storeMentions(tx, params.Id, params.Body);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Deletes a comment; its author, and admins of the task's category, can do this.
+		The comment is kept in the database, but is no longer shown or counted */
+func deleteComment(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), `
+		UPDATE task_comments SET deleted_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND deleted_at IS NULL AND (
+			author_id=$2
+			OR EXISTS (
+				SELECT 1 FROM tasks INNER JOIN public.get_accessible_categories($2) AS accessible ON tasks.category_id=accessible.category_id
+				WHERE tasks.id=task_comments.task_id AND accessible.role IN ($3, $4)
+			)
+		);`, id, userId, roleAdmin, roleOwner);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertCommentFound(client, cancel, id);
+	}
+
+	return nil;
+}
+
+/* Returns the id of the task a comment is on, so that access to the comment can be checked against the task */
+func commentTaskId(id int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var taskId int;
+	err := c.QueryRow(context.Background(), "SELECT task_id FROM task_comments WHERE id=$1 AND deleted_at IS NULL;", id).Scan(&taskId);
+	if (err == pgx.ErrNoRows) {
+		return 0, assertCommentFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return taskId, nil;
+}
+
+/* Stores which users a comment mentions; only usernames of users who can see the comment's task are kept */
+func storeMentions(tx pgx.Tx, commentId int, body string) error {
+	usernames := parseMentions(body);
+	if (len(usernames) == 0) {
+		return nil;
+	}
+
+	_, err := tx.Exec(context.Background(), `
+		INSERT INTO comment_mentions (comment_id, user_id)
+		SELECT $1, users.id FROM users
+		WHERE users.username = ANY($2::text[])
+			AND EXISTS (
+				SELECT 1 FROM task_comments INNER JOIN tasks ON task_comments.task_id=tasks.id
+					INNER JOIN public.get_accessible_categories(users.id) AS accessible ON tasks.category_id=accessible.category_id
+				WHERE task_comments.id=$1
+			)
+		ON CONFLICT DO NOTHING;`, commentId, usernames);
+
+	return err;
+}
+
+// converts the timestamps of every comment into the given timezone
+func localiseComments(comments []Comment, loc *time.Location) []Comment {
+	for i := range comments {
+		if (comments[i].Created_at.Valid) {
+			comments[i].Created_at.Time.Time = comments[i].Created_at.Time.Time.In(loc);
+		}
+		if (comments[i].Edited_at.Valid) {
+			comments[i].Edited_at.Time.Time = comments[i].Edited_at.Time.Time.In(loc);
+		}
+	}
+
+	return comments;
+}
+
+// checks that a comment has something in it,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertCommentBody(client *gin.Context, cancel context.CancelFunc, body string) error {
+	if (body != "") {
+		return nil;
+	}
+
+	e := errors.New("a comment cannot be empty");
+	fmt.Fprintf(os.Stderr, "Invalid comment: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that there is no comment with the given id that it can perform the requested action on,
+//		and stops execution of any remaining function-calls
+func assertCommentFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no comment found with id: %v that you can change", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -1,8 +1,46 @@
--- the database will have 2 tables
+-- the database will have 27 tables
 
+CREATE TABLE public.users (
+	id SERIAL PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT,
+	-- IANA timezone name, e.g. 'Asia/Singapore'
+	timezone TEXT NOT NULL DEFAULT 'UTC'
+);
+
+-- groups of categories, e.g. "School" and "Personal"
+CREATE TABLE public.workspaces (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a category belongs to the user who created it, and can be shared with other users (see category_members)
 CREATE TABLE public.categories (
 	id SERIAL PRIMARY KEY,
-	title TEXT NOT NULL
+	title TEXT NOT NULL,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	-- NULL for categories that are not in a workspace; a category is always in the same workspace as its parent
+	workspace_id INT REFERENCES workspaces(id) ON DELETE CASCADE,
+	-- NULL for categories at the top level of their workspace
+	parent_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	CHECK (parent_id <> id)
+);
+
+CREATE INDEX categories_parent_id_idx ON public.categories (parent_id);
+CREATE INDEX categories_workspace_id_idx ON public.categories (workspace_id);
+
+-- the columns of a category's board, in order; a task is completed exactly when its status is a done state
+CREATE TABLE public.workflow_statuses (
+	id SERIAL PRIMARY KEY,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	position INT NOT NULL,
+	is_done BOOLEAN NOT NULL,
+	-- checked at the end of the transaction, so that two statuses can swap names
+	UNIQUE (category_id, name) DEFERRABLE INITIALLY DEFERRED
 );
 
 CREATE TABLE public.tasks (
@@ -10,16 +48,300 @@ CREATE TABLE public.tasks (
 	category_id INT REFERENCES categories(id),
 	title VARCHAR(255) NOT NULL,
 	description TEXT,
-	deadline TIMESTAMP,
+	-- a task has either a timed deadline, or an all-day deadline_date that is due at the end of that day in the user's timezone
+	deadline TIMESTAMPTZ,
+	deadline_date DATE,
+	-- kept in step with status_id by the sync_task_status trigger (see functions.sql)
 	completed BOOLEAN,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	status_id INT REFERENCES workflow_statuses(id),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	-- set when the task is moved to the trash, NULL otherwise
+	deleted_at TIMESTAMPTZ,
+	-- position of the task within its category, compared byte by byte (see ranking.go)
+	rank TEXT COLLATE "C" NOT NULL,
+	priority TEXT CHECK (priority IN ('low', 'medium', 'high')),
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	-- how often the task repeats, as an iCalendar RRULE value (e.g. 'FREQ=WEEKLY;BYDAY=MO'), NULL if it does not
+	recurrence TEXT,
+	-- how long the task is expected to take, in minutes (see timetracking.go)
+	estimate_minutes INT CHECK (estimate_minutes > 0),
+	CHECK (deadline IS NULL OR deadline_date IS NULL)
 );
 
-CREATE TABLE public.users (
+CREATE INDEX tasks_category_id_rank_idx ON public.tasks (category_id, rank);
+
+-- every change made to a task, in order; changes holds the before/after values of each field that changed,
+-- and snapshot holds all tracked fields of the task right after the change, so that it can be reverted to
+CREATE TABLE public.task_revisions (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	revision INT NOT NULL,
+	action TEXT NOT NULL,
+	user_id INT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	changes JSONB NOT NULL,
+	snapshot JSONB NOT NULL,
+	PRIMARY KEY (task_id, revision)
+);
+
+-- users other than the owner that a category is shared with; role is one of 'viewer', 'editor' or 'admin'
+CREATE TABLE public.category_members (
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (category_id, user_id)
+);
+
+-- the members of a category that a task in it is assigned to
+CREATE TABLE public.task_assignees (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	assigned_by INT REFERENCES users(id) ON DELETE SET NULL,
+	assigned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (task_id, user_id)
+);
+
+CREATE INDEX task_assignees_user_id_idx ON public.task_assignees (user_id);
+
+-- comments on a task; body is markdown, and deleted comments are kept but no longer shown
+CREATE TABLE public.task_comments (
 	id SERIAL PRIMARY KEY,
-	username TEXT UNIQUE NOT NULL,
-	password TEXT
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	edited_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX task_comments_task_id_idx ON public.task_comments (task_id);
+
+-- the users mentioned with @username in a comment
+CREATE TABLE public.comment_mentions (
+	comment_id INT NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (comment_id, user_id)
+);
+
+-- files attached to a task; their contents are kept in a blob store, not in the database
+CREATE TABLE public.task_attachments (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	-- uploads count towards the storage quota of whoever uploaded them
+	uploader_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	filename TEXT NOT NULL,
+	-- worked out from the file's contents when it was uploaded
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	-- hex SHA-256 of the file's contents
+	checksum TEXT NOT NULL,
+	-- where the contents are kept in the blob store
+	blob_key TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX task_attachments_task_id_idx ON public.task_attachments (task_id);
+CREATE INDEX task_attachments_uploader_id_idx ON public.task_attachments (uploader_id);
+
+-- task_id cannot be started until blocked_by_id is completed; the server never lets these form a cycle
+CREATE TABLE public.task_dependencies (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	blocked_by_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	PRIMARY KEY (task_id, blocked_by_id),
+	CHECK (task_id <> blocked_by_id)
+);
+
+CREATE INDEX task_dependencies_blocked_by_id_idx ON public.task_dependencies (blocked_by_id);
+
+-- the items of a task's checklist, in order
+CREATE TABLE public.task_checklist_items (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	done BOOLEAN NOT NULL DEFAULT FALSE,
+	position INT NOT NULL
+);
+
+CREATE INDEX task_checklist_items_task_id_idx ON public.task_checklist_items (task_id);
+
+-- time spent on tasks, either timed with a start/stop timer or added by hand; stopped_at is NULL while the timer runs
+CREATE TABLE public.task_time_entries (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	started_at TIMESTAMPTZ NOT NULL,
+	stopped_at TIMESTAMPTZ,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	CHECK (stopped_at IS NULL OR stopped_at >= started_at)
+);
+
+CREATE INDEX task_time_entries_task_id_idx ON public.task_time_entries (task_id);
+-- a user has at most one timer running at a time
+CREATE UNIQUE INDEX task_time_entries_running_idx ON public.task_time_entries (user_id) WHERE stopped_at IS NULL;
+
+-- reusable sets of tasks that can be created in a category in one go
+CREATE TABLE public.task_templates (
+	id SERIAL PRIMARY KEY,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE public.template_tasks (
+	template_id INT NOT NULL REFERENCES task_templates(id) ON DELETE CASCADE,
+	position INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	-- relative to the date the template is instantiated at, e.g. '+7d' or '+3d@17:00' (see templates.go); '' for no deadline
+	deadline TEXT NOT NULL DEFAULT '',
+	checklist TEXT[] NOT NULL DEFAULT '{}',
+	PRIMARY KEY (template_id, position)
+);
+
+-- single-use tokens that let whoever has them join a category with the given role
+CREATE TABLE public.category_invitations (
+	token TEXT PRIMARY KEY,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+	created_by INT REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- the latest changes to tasks and categories, for the clients following /events (see events.go);
+--		audience is everyone who could see the change when it was made, and only the newest events are kept
+CREATE TABLE public.change_events (
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	task_id INT,
+	category_id INT,
+	audience INT[] NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the ids that offline clients gave the tasks they created, so that pushing the same task twice only creates it once (see sync.go)
+CREATE TABLE public.sync_client_ids (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id TEXT NOT NULL,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, client_id)
+);
+
+-- the URLs a user has asked to be sent change events, with the secret their deliveries are signed with (see webhooks.go)
+CREATE TABLE public.webhooks (
+	id SERIAL PRIMARY KEY,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	-- the event types to send, empty for all of them
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	-- only send events about this category and its tasks, NULL for every category
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX webhooks_owner_id_idx ON public.webhooks (owner_id);
+
+-- the queue of webhook deliveries, which is also their log; status is 'pending' until the receiver accepts the delivery,
+--		then 'delivered', or 'dead' once it has failed too many times
+CREATE TABLE public.webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_attempt_at TIMESTAMPTZ,
+	response_status INT,
+	response_body TEXT,
+	last_error TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON public.webhook_deliveries (webhook_id, id);
+CREATE INDEX webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- the secret token in the address of a user's calendar feed (see calendar.go)
+CREATE TABLE public.calendar_feeds (
+	user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	token TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- which category, task or checklist item each entry of an imported export became, by its id in the other product,
+--		so that importing a newer export updates them instead of creating them again (see importers.go)
+CREATE TABLE public.imported_items (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	-- 'todoist' or 'trello'
+	source TEXT NOT NULL CHECK (source IN ('todoist', 'trello')),
+	-- 'category', 'task' or 'checklist_item'
+	kind TEXT NOT NULL CHECK (kind IN ('category', 'task', 'checklist_item')),
+	source_id TEXT NOT NULL,
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+	checklist_item_id INT REFERENCES task_checklist_items(id) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, source, kind, source_id)
+);
+
+-- the exports users have asked for, which are put together in the background (see account.go);
+--		blob_key and size are set once the archive is ready, and claimed_until while an instance is putting it together
+CREATE TABLE public.account_exports (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+	blob_key TEXT,
+	size BIGINT,
+	error TEXT,
+	claimed_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	finished_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX account_exports_user_id_idx ON public.account_exports (user_id);
+CREATE INDEX account_exports_waiting_idx ON public.account_exports (id) WHERE status IN ('pending', 'running');
+
+-- tasks created through /dav keep the name and UID the app gave them (see caldav.go);
+--		every other task is served as task-<id>.ics
+CREATE TABLE public.caldav_resources (
+	task_id INT PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	uid TEXT NOT NULL
+);
+
+CREATE INDEX caldav_resources_name_idx ON public.caldav_resources (name);
+
+-- an address anyone can open a list of tasks at, without logging in, until expires_at (see textexport.go);
+--		the columns after format are the TaskListFilter picking out the tasks
+CREATE TABLE public.share_links (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token TEXT UNIQUE NOT NULL,
+	-- 'markdown', 'text' or 'html'
+	format TEXT NOT NULL CHECK (format IN ('markdown', 'text', 'html')),
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	include_descendants BOOLEAN NOT NULL DEFAULT FALSE,
+	-- '' for every task, or one of the smart views: 'today', 'upcoming', 'overdue' or 'unscheduled'
+	view TEXT NOT NULL DEFAULT '' CHECK (view IN ('', 'today', 'upcoming', 'overdue', 'unscheduled')),
+	days INT NOT NULL DEFAULT 0,
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	priority TEXT CHECK (priority IN ('low', 'medium', 'high')),
+	hide_completed BOOLEAN NOT NULL DEFAULT FALSE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX share_links_user_id_idx ON public.share_links (user_id);
+
+CREATE TABLE public.sessions (
+	token TEXT PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
 -- creating a new user
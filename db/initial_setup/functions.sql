@@ -1,5 +1,143 @@
--- get all tasks
-CREATE OR REPLACE FUNCTION public.get_all_tasks()
+-- get the categories a user owns or that are shared with them, with the role they have in each
+CREATE OR REPLACE FUNCTION public.get_accessible_categories(Specified_User_Id INT)
+	RETURNS TABLE
+		(
+			category_id INT,
+			role TEXT
+		)
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN QUERY
+		SELECT
+			categories.id,
+			'owner'::TEXT
+		FROM
+			public.categories
+
+		WHERE
+			categories.owner_id = Specified_User_Id
+
+		UNION ALL
+
+		SELECT
+			category_members.category_id,
+			category_members.role
+		FROM
+			public.category_members
+
+		WHERE
+			category_members.user_id = Specified_User_Id;
+END
+$$;
+
+-- get the users a task is assigned to, as a JSON array
+CREATE OR REPLACE FUNCTION public.get_task_assignees(Specified_Task_Id INT)
+	RETURNS JSON
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN COALESCE(
+		(
+			SELECT
+				json_agg(
+					json_build_object(
+						'user_id', users.id,
+						'username', users.username,
+						'assigned_by', task_assignees.assigned_by,
+						'assigned_at', task_assignees.assigned_at
+					)
+					ORDER BY task_assignees.assigned_at
+				)
+			FROM
+				public.task_assignees
+					INNER JOIN public.users ON public.task_assignees.user_id=public.users.id
+
+			WHERE
+				task_assignees.task_id = Specified_Task_Id
+		),
+		'[]'::JSON
+	);
+END
+$$;
+
+-- get the checklist of a task, in order, as a JSON array
+CREATE OR REPLACE FUNCTION public.get_task_checklist(Specified_Task_Id INT)
+	RETURNS JSON
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN COALESCE(
+		(
+			SELECT
+				json_agg(
+					json_build_object(
+						'id', task_checklist_items.id,
+						'title', task_checklist_items.title,
+						'done', task_checklist_items.done
+					)
+					ORDER BY task_checklist_items.position, task_checklist_items.id
+				)
+			FROM
+				public.task_checklist_items
+
+			WHERE
+				task_checklist_items.task_id = Specified_Task_Id
+		),
+		'[]'::JSON
+	);
+END
+$$;
+
+-- the time tracked against a task in whole minutes, counting running timers up to now
+CREATE OR REPLACE FUNCTION public.get_task_tracked_minutes(Specified_Task_Id INT)
+	RETURNS INT
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN COALESCE(
+		(
+			SELECT
+				FLOOR(SUM(EXTRACT(EPOCH FROM COALESCE(task_time_entries.stopped_at, CURRENT_TIMESTAMP) - task_time_entries.started_at)) / 60)::INT
+			FROM
+				public.task_time_entries
+
+			WHERE
+				task_time_entries.task_id = Specified_Task_Id
+		),
+		0
+	);
+END
+$$;
+
+-- whether a task is waiting on a task that is incomplete and not in the trash
+CREATE OR REPLACE FUNCTION public.is_task_blocked(Specified_Task_Id INT)
+	RETURNS BOOLEAN
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN EXISTS (
+		SELECT 1
+		FROM
+			public.task_dependencies
+				INNER JOIN public.tasks ON public.task_dependencies.blocked_by_id=public.tasks.id
+
+		WHERE
+			task_dependencies.task_id = Specified_Task_Id
+			AND tasks.completed = 'f'
+			AND tasks.deleted_at IS NULL
+	);
+END
+$$;
+
+-- get all tasks in the categories a user has access to
+DROP FUNCTION IF EXISTS public.get_all_tasks(INT);
+CREATE OR REPLACE FUNCTION public.get_all_tasks(Specified_User_Id INT)
 	RETURNS TABLE 
 		(
 			id INT,
@@ -7,10 +145,23 @@ CREATE OR REPLACE FUNCTION public.get_all_tasks()
 			description TEXT,
 			category_id INT,
 			category TEXT,
-			deadline TIMESTAMP,
+			deadline TIMESTAMPTZ,
+			deadline_date DATE,
 			completed BOOLEAN,
-			created_at TIMESTAMP,
-			updated_at TIMESTAMP
+			created_at TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ,
+			rank TEXT,
+			assignees JSON,
+			comment_count INT,
+			blocked BOOLEAN,
+			status_id INT,
+			status TEXT,
+			checklist JSON,
+			priority TEXT,
+			tags TEXT[],
+			recurrence TEXT,
+			estimate_minutes INT,
+			tracked_minutes INT
 		)
 	language plpgsql
 AS
@@ -24,17 +175,39 @@ BEGIN
 			categories.id,
 			categories.title,
 			tasks.deadline,
+			tasks.deadline_date,
 			tasks.completed,
 			tasks.created_at,
-			tasks.updated_at
+			tasks.updated_at,
+			tasks.rank,
+			public.get_task_assignees(tasks.id),
+			(SELECT COUNT(*)::INT FROM public.task_comments WHERE task_comments.task_id=tasks.id AND task_comments.deleted_at IS NULL),
+			public.is_task_blocked(tasks.id),
+			tasks.status_id,
+			workflow_statuses.name,
+			public.get_task_checklist(tasks.id),
+			tasks.priority,
+			tasks.tags,
+			tasks.recurrence,
+			tasks.estimate_minutes,
+			public.get_task_tracked_minutes(tasks.id)
 		FROM
 			public.tasks
-				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id;
+				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id
+				LEFT JOIN public.workflow_statuses ON public.tasks.status_id=public.workflow_statuses.id
+
+		WHERE
+			categories.id IN (SELECT accessible.category_id FROM public.get_accessible_categories(Specified_User_Id) AS accessible)
+			AND tasks.deleted_at IS NULL
+
+		ORDER BY
+			categories.id, tasks.rank, tasks.id;
 END
 $$;
 
--- get all completed tasks
-CREATE OR REPLACE FUNCTION public.get_completed_tasks()
+-- get all completed tasks in the categories a user has access to
+DROP FUNCTION IF EXISTS public.get_completed_tasks(INT);
+CREATE OR REPLACE FUNCTION public.get_completed_tasks(Specified_User_Id INT)
 	RETURNS TABLE
 		(
 			id INT,
@@ -42,10 +215,23 @@ CREATE OR REPLACE FUNCTION public.get_completed_tasks()
 			description TEXT,
 			category_id INT,
 			category TEXT,
-			deadline TIMESTAMP,
+			deadline TIMESTAMPTZ,
+			deadline_date DATE,
 			completed BOOLEAN,
-			created_at TIMESTAMP,
-			updated_at TIMESTAMP
+			created_at TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ,
+			rank TEXT,
+			assignees JSON,
+			comment_count INT,
+			blocked BOOLEAN,
+			status_id INT,
+			status TEXT,
+			checklist JSON,
+			priority TEXT,
+			tags TEXT[],
+			recurrence TEXT,
+			estimate_minutes INT,
+			tracked_minutes INT
 		)
 	language plpgsql
 AS
@@ -59,20 +245,40 @@ BEGIN
 			categories.id,
 			categories.title,
 			tasks.deadline,
+			tasks.deadline_date,
 			tasks.completed,
 			tasks.created_at,
-			tasks.updated_at
+			tasks.updated_at,
+			tasks.rank,
+			public.get_task_assignees(tasks.id),
+			(SELECT COUNT(*)::INT FROM public.task_comments WHERE task_comments.task_id=tasks.id AND task_comments.deleted_at IS NULL),
+			public.is_task_blocked(tasks.id),
+			tasks.status_id,
+			workflow_statuses.name,
+			public.get_task_checklist(tasks.id),
+			tasks.priority,
+			tasks.tags,
+			tasks.recurrence,
+			tasks.estimate_minutes,
+			public.get_task_tracked_minutes(tasks.id)
 		FROM
 			public.tasks
 				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id
+				LEFT JOIN public.workflow_statuses ON public.tasks.status_id=public.workflow_statuses.id
 
 		WHERE
-			tasks.completed = 't';
+			categories.id IN (SELECT accessible.category_id FROM public.get_accessible_categories(Specified_User_Id) AS accessible)
+			AND tasks.completed = 't'
+			AND tasks.deleted_at IS NULL
+
+		ORDER BY
+			categories.id, tasks.rank, tasks.id;
 END
 $$;
 
--- get all outstanding tasks
-CREATE OR REPLACE FUNCTION public.get_incomplete_tasks()
+-- get all outstanding tasks in the categories a user has access to
+DROP FUNCTION IF EXISTS public.get_incomplete_tasks(INT);
+CREATE OR REPLACE FUNCTION public.get_incomplete_tasks(Specified_User_Id INT)
 	RETURNS TABLE
 		(
 			id INT,
@@ -80,10 +286,23 @@ CREATE OR REPLACE FUNCTION public.get_incomplete_tasks()
 			description TEXT,
 			category_id INT,
 			category TEXT,
-			deadline TIMESTAMP,
+			deadline TIMESTAMPTZ,
+			deadline_date DATE,
 			completed BOOLEAN,
-			created_at TIMESTAMP,
-			updated_at TIMESTAMP
+			created_at TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ,
+			rank TEXT,
+			assignees JSON,
+			comment_count INT,
+			blocked BOOLEAN,
+			status_id INT,
+			status TEXT,
+			checklist JSON,
+			priority TEXT,
+			tags TEXT[],
+			recurrence TEXT,
+			estimate_minutes INT,
+			tracked_minutes INT
 		)
 	language plpgsql
 AS
@@ -97,19 +316,39 @@ BEGIN
 			categories.id,
 			categories.title,
 			tasks.deadline,
+			tasks.deadline_date,
 			tasks.completed,
 			tasks.created_at,
-			tasks.updated_at
+			tasks.updated_at,
+			tasks.rank,
+			public.get_task_assignees(tasks.id),
+			(SELECT COUNT(*)::INT FROM public.task_comments WHERE task_comments.task_id=tasks.id AND task_comments.deleted_at IS NULL),
+			public.is_task_blocked(tasks.id),
+			tasks.status_id,
+			workflow_statuses.name,
+			public.get_task_checklist(tasks.id),
+			tasks.priority,
+			tasks.tags,
+			tasks.recurrence,
+			tasks.estimate_minutes,
+			public.get_task_tracked_minutes(tasks.id)
 		FROM
 			public.tasks
 				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id
+				LEFT JOIN public.workflow_statuses ON public.tasks.status_id=public.workflow_statuses.id
 
 		WHERE
-			tasks.completed = 'f';
+			categories.id IN (SELECT accessible.category_id FROM public.get_accessible_categories(Specified_User_Id) AS accessible)
+			AND tasks.completed = 'f'
+			AND tasks.deleted_at IS NULL
+
+		ORDER BY
+			categories.id, tasks.rank, tasks.id;
 END
 $$;
 
 -- get tasks by category id
+DROP FUNCTION IF EXISTS public.get_tasks_in_category(INT);
 CREATE OR REPLACE FUNCTION public.get_tasks_in_category(Specified_Category_Id INT)
 	RETURNS TABLE
 		(
@@ -118,10 +357,23 @@ CREATE OR REPLACE FUNCTION public.get_tasks_in_category(Specified_Category_Id IN
 			description TEXT,
 			category_id INT,
 			category TEXT,
-			deadline TIMESTAMP,
+			deadline TIMESTAMPTZ,
+			deadline_date DATE,
 			completed BOOLEAN,
-			created_at TIMESTAMP,
-			updated_at TIMESTAMP
+			created_at TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ,
+			rank TEXT,
+			assignees JSON,
+			comment_count INT,
+			blocked BOOLEAN,
+			status_id INT,
+			status TEXT,
+			checklist JSON,
+			priority TEXT,
+			tags TEXT[],
+			recurrence TEXT,
+			estimate_minutes INT,
+			tracked_minutes INT
 		)
 	language plpgsql
 AS
@@ -135,14 +387,354 @@ BEGIN
 			categories.id,
 			categories.title,
 			tasks.deadline,
+			tasks.deadline_date,
 			tasks.completed,
 			tasks.created_at,
-			tasks.updated_at
+			tasks.updated_at,
+			tasks.rank,
+			public.get_task_assignees(tasks.id),
+			(SELECT COUNT(*)::INT FROM public.task_comments WHERE task_comments.task_id=tasks.id AND task_comments.deleted_at IS NULL),
+			public.is_task_blocked(tasks.id),
+			tasks.status_id,
+			workflow_statuses.name,
+			public.get_task_checklist(tasks.id),
+			tasks.priority,
+			tasks.tags,
+			tasks.recurrence,
+			tasks.estimate_minutes,
+			public.get_task_tracked_minutes(tasks.id)
 		FROM
 			public.tasks
 				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id
+				LEFT JOIN public.workflow_statuses ON public.tasks.status_id=public.workflow_statuses.id
 
 		WHERE
-			categories.id = Specified_Category_Id;
+			categories.id = Specified_Category_Id
+			AND tasks.deleted_at IS NULL
+
+		ORDER BY
+			tasks.rank, tasks.id;
 END
 $$;
+
+-- get all tasks in the trash of the categories a user has access to, most recently deleted first
+DROP FUNCTION IF EXISTS public.get_trashed_tasks(INT);
+CREATE OR REPLACE FUNCTION public.get_trashed_tasks(Specified_User_Id INT)
+	RETURNS TABLE
+		(
+			id INT,
+			title VARCHAR(255),
+			description TEXT,
+			category_id INT,
+			category TEXT,
+			deadline TIMESTAMPTZ,
+			deadline_date DATE,
+			completed BOOLEAN,
+			created_at TIMESTAMPTZ,
+			updated_at TIMESTAMPTZ,
+			rank TEXT,
+			assignees JSON,
+			comment_count INT,
+			blocked BOOLEAN,
+			status_id INT,
+			status TEXT,
+			checklist JSON,
+			priority TEXT,
+			tags TEXT[],
+			recurrence TEXT,
+			estimate_minutes INT,
+			tracked_minutes INT,
+			deleted_at TIMESTAMPTZ
+		)
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN QUERY
+		SELECT 
+			tasks.id,
+			tasks.title,
+			tasks.description,
+			categories.id,
+			categories.title,
+			tasks.deadline,
+			tasks.deadline_date,
+			tasks.completed,
+			tasks.created_at,
+			tasks.updated_at,
+			tasks.rank,
+			public.get_task_assignees(tasks.id),
+			(SELECT COUNT(*)::INT FROM public.task_comments WHERE task_comments.task_id=tasks.id AND task_comments.deleted_at IS NULL),
+			public.is_task_blocked(tasks.id),
+			tasks.status_id,
+			workflow_statuses.name,
+			public.get_task_checklist(tasks.id),
+			tasks.priority,
+			tasks.tags,
+			tasks.recurrence,
+			tasks.estimate_minutes,
+			public.get_task_tracked_minutes(tasks.id),
+			tasks.deleted_at
+		FROM
+			public.tasks
+				INNER JOIN public.categories ON public.tasks.category_id=public.categories.id
+				LEFT JOIN public.workflow_statuses ON public.tasks.status_id=public.workflow_statuses.id
+
+		WHERE
+			categories.id IN (SELECT accessible.category_id FROM public.get_accessible_categories(Specified_User_Id) AS accessible)
+			AND tasks.deleted_at IS NOT NULL
+
+		ORDER BY
+			tasks.deleted_at DESC;
+END
+$$;
+
+-- every new category starts with a simple workflow, which its admins can change afterwards
+CREATE OR REPLACE FUNCTION public.create_default_workflow()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+BEGIN
+	INSERT INTO public.workflow_statuses (category_id, name, position, is_done)
+	VALUES (NEW.id, 'To Do', 0, 'f'), (NEW.id, 'In Progress', 1, 'f'), (NEW.id, 'Done', 2, 't');
+	RETURN NEW;
+END
+$$;
+
+DROP TRIGGER IF EXISTS create_default_workflow ON public.categories;
+CREATE TRIGGER create_default_workflow
+	AFTER INSERT ON public.categories
+	FOR EACH ROW EXECUTE FUNCTION public.create_default_workflow();
+
+-- keeps a task's status and its completed flag in step, so that completed is always whether the status is a done state:
+--		setting status_id also sets completed, while setting only completed (as /completetask and /incompletetask do)
+--		moves the task to the first status of its category that is done or open to match.
+--		A status from another category, e.g. after the task was moved, is swapped for the status there with the same name,
+--		or failing that for the first status that is done or open in the same way
+CREATE OR REPLACE FUNCTION public.sync_task_status()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+DECLARE
+	status_was_set BOOLEAN;
+	status_is_done BOOLEAN;
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		status_was_set := NEW.status_id IS NOT NULL;
+	ELSE
+		status_was_set := NEW.status_id IS DISTINCT FROM OLD.status_id;
+	END IF;
+
+	IF NEW.status_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM public.workflow_statuses WHERE id=NEW.status_id AND category_id=NEW.category_id) THEN
+		NEW.status_id := (
+			SELECT target.id
+			FROM public.workflow_statuses AS target, public.workflow_statuses AS current
+			WHERE current.id=NEW.status_id AND target.category_id=NEW.category_id
+			ORDER BY (target.name=current.name) DESC, (target.is_done=current.is_done) DESC, target.position
+			LIMIT 1
+		);
+	END IF;
+
+	status_is_done := (SELECT is_done FROM public.workflow_statuses WHERE id=NEW.status_id);
+	IF NEW.status_id IS NULL OR (NOT status_was_set AND status_is_done IS DISTINCT FROM COALESCE(NEW.completed, 'f')) THEN
+		NEW.status_id := (
+			SELECT id FROM public.workflow_statuses
+			WHERE category_id=NEW.category_id AND is_done=COALESCE(NEW.completed, 'f')
+			ORDER BY position
+			LIMIT 1
+		);
+		status_is_done := (SELECT is_done FROM public.workflow_statuses WHERE id=NEW.status_id);
+	END IF;
+
+	IF NEW.status_id IS NOT NULL THEN
+		NEW.completed := status_is_done;
+	END IF;
+	RETURN NEW;
+END
+$$;
+
+DROP TRIGGER IF EXISTS sync_task_status ON public.tasks;
+CREATE TRIGGER sync_task_status
+	BEFORE INSERT OR UPDATE ON public.tasks
+	FOR EACH ROW EXECUTE FUNCTION public.sync_task_status();
+
+-- the users who can see a category: its owner and its members
+CREATE OR REPLACE FUNCTION public.get_category_audience(Specified_Category_Id INT)
+	RETURNS INT[]
+	language plpgsql
+AS
+$$
+BEGIN
+	RETURN ARRAY(
+		SELECT categories.owner_id FROM public.categories WHERE categories.id = Specified_Category_Id
+		UNION
+		SELECT category_members.user_id FROM public.category_members WHERE category_members.category_id = Specified_Category_Id
+	);
+END
+$$;
+
+-- records every change to a task in change_events, for the clients following /events (see events.go);
+--		moving a task to the trash counts as deleting it, and restoring it as creating it again.
+--		A task moved to another category is reported to the users of both categories
+CREATE OR REPLACE FUNCTION public.record_task_event()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+DECLARE
+	event_type TEXT;
+	audience INT[];
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		event_type := 'task.created';
+	ELSIF TG_OP = 'DELETE' THEN
+		-- a task purged from the trash was already reported as deleted when it was moved there
+		IF OLD.deleted_at IS NOT NULL THEN
+			RETURN NULL;
+		END IF;
+		event_type := 'task.deleted';
+	ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NOT NULL THEN
+		RETURN NULL;
+	ELSIF NEW.deleted_at IS NOT NULL THEN
+		event_type := 'task.deleted';
+	ELSIF OLD.deleted_at IS NOT NULL THEN
+		event_type := 'task.created';
+	ELSIF NEW.completed AND NOT COALESCE(OLD.completed, 'f') THEN
+		event_type := 'task.completed';
+	ELSE
+		event_type := 'task.updated';
+	END IF;
+
+	IF TG_OP = 'DELETE' THEN
+		audience := public.get_category_audience(OLD.category_id);
+	ELSE
+		audience := public.get_category_audience(NEW.category_id);
+	END IF;
+	IF TG_OP = 'UPDATE' AND OLD.category_id IS DISTINCT FROM NEW.category_id THEN
+		audience := ARRAY(SELECT DISTINCT unnest(audience || public.get_category_audience(OLD.category_id)));
+	END IF;
+
+	IF TG_OP = 'DELETE' THEN
+		INSERT INTO public.change_events (type, task_id, category_id, audience) VALUES (event_type, OLD.id, OLD.category_id, audience);
+	ELSE
+		INSERT INTO public.change_events (type, task_id, category_id, audience) VALUES (event_type, NEW.id, NEW.category_id, audience);
+	END IF;
+	RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS record_task_event ON public.tasks;
+CREATE TRIGGER record_task_event
+	AFTER INSERT OR UPDATE OR DELETE ON public.tasks
+	FOR EACH ROW EXECUTE FUNCTION public.record_task_event();
+
+-- records every change to a category in change_events; deletions are recorded before the row goes,
+--		while the category's members can still be looked up
+CREATE OR REPLACE FUNCTION public.record_category_event()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		INSERT INTO public.change_events (type, category_id, audience) VALUES ('category.deleted', OLD.id, public.get_category_audience(OLD.id));
+		RETURN OLD;
+	END IF;
+
+	INSERT INTO public.change_events (type, category_id, audience)
+	VALUES (CASE WHEN TG_OP = 'INSERT' THEN 'category.created' ELSE 'category.updated' END, NEW.id, public.get_category_audience(NEW.id));
+	RETURN NEW;
+END
+$$;
+
+DROP TRIGGER IF EXISTS record_category_event ON public.categories;
+CREATE TRIGGER record_category_event
+	AFTER INSERT OR UPDATE ON public.categories
+	FOR EACH ROW EXECUTE FUNCTION public.record_category_event();
+
+DROP TRIGGER IF EXISTS record_category_deletion_event ON public.categories;
+CREATE TRIGGER record_category_deletion_event
+	BEFORE DELETE ON public.categories
+	FOR EACH ROW EXECUTE FUNCTION public.record_category_event();
+
+-- a category that is shared with a user appears to them as created, and one they are removed from as deleted
+CREATE OR REPLACE FUNCTION public.record_membership_event()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		INSERT INTO public.change_events (type, category_id, audience) VALUES ('category.created', NEW.category_id, ARRAY[NEW.user_id]);
+	ELSIF TG_OP = 'UPDATE' THEN
+		INSERT INTO public.change_events (type, category_id, audience) VALUES ('category.updated', NEW.category_id, ARRAY[NEW.user_id]);
+	ELSE
+		INSERT INTO public.change_events (type, category_id, audience) VALUES ('category.deleted', OLD.category_id, ARRAY[OLD.user_id]);
+	END IF;
+	RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS record_membership_event ON public.category_members;
+CREATE TRIGGER record_membership_event
+	AFTER INSERT OR UPDATE OR DELETE ON public.category_members
+	FOR EACH ROW EXECUTE FUNCTION public.record_membership_event();
+
+-- wakes every instance of the API that is listening (see events.go) whenever a change is recorded;
+--		notifications are only sent once the transaction commits, so the event can be read as soon as it arrives
+CREATE OR REPLACE FUNCTION public.notify_change_event()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+BEGIN
+	PERFORM pg_notify('change_events', NEW.id::TEXT);
+	RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS notify_change_event ON public.change_events;
+CREATE TRIGGER notify_change_event
+	AFTER INSERT ON public.change_events
+	FOR EACH ROW EXECUTE FUNCTION public.notify_change_event();
+
+-- queues a delivery for every active webhook whose owner can see a change and whose filters match it (see webhooks.go);
+--		the payload holds the task or category as it is right after the change, NULL once it is gone
+CREATE OR REPLACE FUNCTION public.enqueue_webhook_deliveries()
+	RETURNS TRIGGER
+	language plpgsql
+AS
+$$
+BEGIN
+	INSERT INTO public.webhook_deliveries (webhook_id, event_type, payload)
+	SELECT webhooks.id, NEW.type, jsonb_build_object(
+		'event', NEW.type,
+		'event_id', NEW.id,
+		'created_at', NEW.created_at,
+		'task_id', NEW.task_id,
+		'category_id', NEW.category_id,
+		'task', (
+			SELECT jsonb_build_object(
+				'id', tasks.id, 'title', tasks.title, 'description', tasks.description, 'category_id', tasks.category_id,
+				'deadline', tasks.deadline, 'deadline_date', tasks.deadline_date, 'completed', tasks.completed,
+				'priority', tasks.priority, 'tags', tasks.tags, 'created_at', tasks.created_at, 'updated_at', tasks.updated_at
+			)
+			FROM public.tasks WHERE tasks.id = NEW.task_id
+		),
+		'category', (SELECT jsonb_build_object('id', categories.id, 'title', categories.title) FROM public.categories WHERE categories.id = NEW.category_id)
+	)
+	FROM public.webhooks
+	WHERE webhooks.active
+		AND webhooks.owner_id = ANY(NEW.audience)
+		AND (webhooks.event_types = '{}' OR NEW.type = ANY(webhooks.event_types))
+		AND (webhooks.category_id IS NULL OR webhooks.category_id = NEW.category_id);
+	RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS enqueue_webhook_deliveries ON public.change_events;
+CREATE TRIGGER enqueue_webhook_deliveries
+	AFTER INSERT ON public.change_events
+	FOR EACH ROW EXECUTE FUNCTION public.enqueue_webhook_deliveries();
@@ -1,17 +1,23 @@
 -- inserts some example data into the database
+-- run this after functions.sql, so that the categories get their default workflows
+
+-- create a user, who can log in with the password 'password'
+INSERT INTO users (id, username, password, timezone)
+VALUES
+	(0, 'johndoe', '$2a$08$Zw3Zkio8lgPrQ.N/LLJ2yOcmyD7gX00tx5kFjBRfStVef7DUGvkL2', 'Asia/Singapore');
 
 -- create 2 categories
-INSERT INTO categories (id, title)
+INSERT INTO categories (id, title, owner_id)
 VALUES
-	(0, 'Skool'),
-	(1, 'CCA');
+	(0, 'Skool', 0),
+	(1, 'CCA', 0);
 
 -- create 5 tasks
-INSERT INTO tasks (id, category_id, title, description, deadline)
+INSERT INTO tasks (id, category_id, title, description, deadline, completed, rank)
 VALUES
-	(0, 0, 'Do Lab 3', 'prolly would need 3 hours (ah who am I kidding make that 9).', NULL, FALSE),
-	(1, 0, 'Revise for Midterms', 'gg bellcurve-god save me.', NULL, FALSE),
-	(2, 1, 'Prepare for CCA meeting on Friday', 'best not to show up empty-handed.', CURRENT_TIMESTAMP + INTERVAL '5 days', FALSE);
+	(0, 0, 'Do Lab 3', 'prolly would need 3 hours (ah who am I kidding make that 9).', NULL, FALSE, 'V'),
+	(1, 0, 'Revise for Midterms', 'gg bellcurve-god save me.', NULL, FALSE, 'k'),
+	(2, 1, 'Prepare for CCA meeting on Friday', 'best not to show up empty-handed.', CURRENT_TIMESTAMP + INTERVAL '5 days', FALSE, 'V');
 
 
 
@@ -0,0 +1,27 @@
+-- moves an existing database over to timezone-aware timestamps and per-user timezones
+-- run this once with psql, naming the timezone existing deadlines were entered in, then re-run db/initial_setup/functions.sql:
+--		psql -v deadline_timezone=Asia/Singapore -f db/migrations/001_timezones.sql
+
+-- deadlines used to be stored as wall-clock times with their offset thrown away, so there is no telling from the data
+-- which timezone they were entered in; it has to be given, as an IANA timezone name, in the deadline_timezone variable
+\if :{?deadline_timezone}
+\else
+	\echo 'deadline_timezone is not set: run this with psql -v deadline_timezone=<IANA timezone name, e.g. Asia/Singapore>'
+	\quit
+\endif
+
+ALTER TABLE public.tasks
+	ALTER COLUMN deadline TYPE TIMESTAMPTZ USING deadline AT TIME ZONE :'deadline_timezone',
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC',
+	ADD COLUMN deadline_date DATE,
+	ADD CHECK (deadline IS NULL OR deadline_date IS NULL);
+
+ALTER TABLE public.users
+	ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+CREATE TABLE public.sessions (
+	token TEXT PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+-- lets tasks be moved to the trash instead of being deleted straight away
+-- run this once, then re-run db/initial_setup/functions.sql
+
+ALTER TABLE public.tasks
+	ADD COLUMN deleted_at TIMESTAMPTZ;
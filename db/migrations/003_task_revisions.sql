@@ -0,0 +1,12 @@
+-- keeps a history of every change made to a task
+
+CREATE TABLE public.task_revisions (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	revision INT NOT NULL,
+	action TEXT NOT NULL,
+	user_id INT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	changes JSONB NOT NULL,
+	snapshot JSONB NOT NULL,
+	PRIMARY KEY (task_id, revision)
+);
@@ -0,0 +1,20 @@
+-- lets users put the tasks in a category in their own order
+-- run this once, then re-run db/initial_setup/functions.sql
+
+ALTER TABLE public.tasks
+	ADD COLUMN rank TEXT COLLATE "C";
+
+-- existing tasks keep the order they were created in; the ranks are zero-padded numbers
+-- with a trailing 'V' so that, like every other rank, they never end in '0'
+UPDATE public.tasks
+	SET rank = ordered.rank
+	FROM (
+		SELECT id, lpad(row_number() OVER (PARTITION BY category_id ORDER BY created_at, id)::text, 10, '0') || 'V' AS rank
+		FROM public.tasks
+	) AS ordered
+	WHERE tasks.id = ordered.id;
+
+ALTER TABLE public.tasks
+	ALTER COLUMN rank SET NOT NULL;
+
+CREATE INDEX tasks_category_id_rank_idx ON public.tasks (category_id, rank);
@@ -0,0 +1,36 @@
+-- gives every category an owner, and lets owners share categories with other users
+-- run this once, then re-run db/initial_setup/functions.sql
+
+-- categories used to belong to nobody in particular; they are handed to the first user who signed up,
+-- who can then share them with everyone else
+ALTER TABLE public.categories
+	ADD COLUMN owner_id INT REFERENCES users(id) ON DELETE CASCADE,
+	ADD COLUMN created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE public.categories
+	SET owner_id = (SELECT MIN(id) FROM public.users);
+
+ALTER TABLE public.categories
+	ALTER COLUMN owner_id SET NOT NULL;
+
+CREATE TABLE public.category_members (
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (category_id, user_id)
+);
+
+CREATE TABLE public.category_invitations (
+	token TEXT PRIMARY KEY,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+	created_by INT REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- the old task functions took no arguments and are replaced by ones that take the id of the user asking
+DROP FUNCTION IF EXISTS public.get_all_tasks();
+DROP FUNCTION IF EXISTS public.get_completed_tasks();
+DROP FUNCTION IF EXISTS public.get_incomplete_tasks();
+DROP FUNCTION IF EXISTS public.get_trashed_tasks();
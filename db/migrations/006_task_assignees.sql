@@ -0,0 +1,12 @@
+-- lets tasks in shared categories be assigned to members
+-- run this once, then re-run db/initial_setup/functions.sql
+
+CREATE TABLE public.task_assignees (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	assigned_by INT REFERENCES users(id) ON DELETE SET NULL,
+	assigned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (task_id, user_id)
+);
+
+CREATE INDEX task_assignees_user_id_idx ON public.task_assignees (user_id);
@@ -0,0 +1,20 @@
+-- lets collaborators comment on tasks
+-- run this once, then re-run db/initial_setup/functions.sql
+
+CREATE TABLE public.task_comments (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	edited_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX task_comments_task_id_idx ON public.task_comments (task_id);
+
+CREATE TABLE public.comment_mentions (
+	comment_id INT NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (comment_id, user_id)
+);
@@ -0,0 +1,20 @@
+-- lets files be attached to tasks, the files themselves are kept in the blob store configured by BLOB_STORE
+
+CREATE TABLE public.task_attachments (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	-- uploads count towards the storage quota of whoever uploaded them
+	uploader_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	filename TEXT NOT NULL,
+	-- worked out from the file's contents when it was uploaded
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	-- hex SHA-256 of the file's contents
+	checksum TEXT NOT NULL,
+	-- where the contents are kept in the blob store
+	blob_key TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX task_attachments_task_id_idx ON public.task_attachments (task_id);
+CREATE INDEX task_attachments_uploader_id_idx ON public.task_attachments (uploader_id);
@@ -0,0 +1,11 @@
+-- lets a task be blocked by other tasks
+-- run this once, then re-run db/initial_setup/functions.sql
+
+CREATE TABLE public.task_dependencies (
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	blocked_by_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	PRIMARY KEY (task_id, blocked_by_id),
+	CHECK (task_id <> blocked_by_id)
+);
+
+CREATE INDEX task_dependencies_blocked_by_id_idx ON public.task_dependencies (blocked_by_id);
@@ -0,0 +1,30 @@
+-- gives every category a workflow of statuses that its tasks move through, shown as the columns of a board
+-- run this once, then re-run db/initial_setup/functions.sql
+
+-- the columns of a category's board, in order; a task is completed exactly when its status is a done state
+CREATE TABLE public.workflow_statuses (
+	id SERIAL PRIMARY KEY,
+	category_id INT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	position INT NOT NULL,
+	is_done BOOLEAN NOT NULL,
+	-- checked at the end of the transaction, so that two statuses can swap names
+	UNIQUE (category_id, name) DEFERRABLE INITIALLY DEFERRED
+);
+
+ALTER TABLE public.tasks
+	ADD COLUMN status_id INT REFERENCES workflow_statuses(id);
+
+-- existing categories get the same workflow new categories start with, and their tasks go to its first open or done status
+INSERT INTO public.workflow_statuses (category_id, name, position, is_done)
+	SELECT categories.id, defaults.name, defaults.position, defaults.is_done
+	FROM public.categories,
+		(VALUES ('To Do', 0, FALSE), ('In Progress', 1, FALSE), ('Done', 2, TRUE)) AS defaults (name, position, is_done);
+
+UPDATE public.tasks
+	SET status_id = (
+		SELECT id FROM public.workflow_statuses
+		WHERE workflow_statuses.category_id=tasks.category_id AND is_done=COALESCE(tasks.completed, FALSE)
+		ORDER BY position
+		LIMIT 1
+	);
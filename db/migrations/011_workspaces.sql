@@ -0,0 +1,17 @@
+-- adds workspaces that group categories, and lets categories nest inside each other
+
+CREATE TABLE public.workspaces (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- existing categories stay at the top level, outside of any workspace
+ALTER TABLE public.categories
+	ADD COLUMN workspace_id INT REFERENCES workspaces(id) ON DELETE CASCADE,
+	ADD COLUMN parent_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	ADD CHECK (parent_id <> id);
+
+CREATE INDEX categories_parent_id_idx ON public.categories (parent_id);
+CREATE INDEX categories_workspace_id_idx ON public.categories (workspace_id);
@@ -0,0 +1,31 @@
+-- adds checklists to tasks, and templates that tasks with checklists can be created from
+-- run this once, then re-run db/initial_setup/functions.sql
+
+CREATE TABLE public.task_checklist_items (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	done BOOLEAN NOT NULL DEFAULT FALSE,
+	position INT NOT NULL
+);
+
+CREATE INDEX task_checklist_items_task_id_idx ON public.task_checklist_items (task_id);
+
+CREATE TABLE public.task_templates (
+	id SERIAL PRIMARY KEY,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE public.template_tasks (
+	template_id INT NOT NULL REFERENCES task_templates(id) ON DELETE CASCADE,
+	position INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	-- relative to the date the template is instantiated at, e.g. '+7d' or '+3d@17:00' (see templates.go); '' for no deadline
+	deadline TEXT NOT NULL DEFAULT '',
+	checklist TEXT[] NOT NULL DEFAULT '{}',
+	PRIMARY KEY (template_id, position)
+);
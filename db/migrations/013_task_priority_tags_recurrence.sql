@@ -0,0 +1,6 @@
+-- adds a priority, tags and a recurrence rule to tasks, as filled in by /quickadd
+-- run this once, then re-run db/initial_setup/functions.sql
+
+ALTER TABLE public.tasks ADD COLUMN priority TEXT CHECK (priority IN ('low', 'medium', 'high'));
+ALTER TABLE public.tasks ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE public.tasks ADD COLUMN recurrence TEXT;
@@ -0,0 +1,18 @@
+-- adds time estimates to tasks, and the time tracked against them
+-- run this once, then re-run db/initial_setup/functions.sql
+
+ALTER TABLE public.tasks ADD COLUMN estimate_minutes INT CHECK (estimate_minutes > 0);
+
+CREATE TABLE public.task_time_entries (
+	id SERIAL PRIMARY KEY,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	started_at TIMESTAMPTZ NOT NULL,
+	stopped_at TIMESTAMPTZ,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	CHECK (stopped_at IS NULL OR stopped_at >= started_at)
+);
+
+CREATE INDEX task_time_entries_task_id_idx ON public.task_time_entries (task_id);
+CREATE UNIQUE INDEX task_time_entries_running_idx ON public.task_time_entries (user_id) WHERE stopped_at IS NULL;
@@ -0,0 +1,11 @@
+-- adds the log of changes that /events streams to clients
+-- run this once, then re-run db/initial_setup/functions.sql
+
+CREATE TABLE public.change_events (
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	task_id INT,
+	category_id INT,
+	audience INT[] NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- notifies every instance of the API when a change is recorded, so that each can pass it on to its own clients
+-- there is nothing to change in the tables, re-run db/initial_setup/functions.sql to add the notify_change_event trigger
@@ -0,0 +1,8 @@
+-- adds the table that remembers the ids offline clients gave the tasks they created (see sync.go)
+
+CREATE TABLE public.sync_client_ids (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id TEXT NOT NULL,
+	task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,39 @@
+-- adds webhooks and their delivery queue
+-- run this once, then re-run db/initial_setup/functions.sql to add the enqueue_webhook_deliveries trigger
+
+-- the URLs a user has asked to be sent change events, with the secret their deliveries are signed with (see webhooks.go)
+CREATE TABLE public.webhooks (
+	id SERIAL PRIMARY KEY,
+	owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	-- the event types to send, empty for all of them
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	-- only send events about this category and its tasks, NULL for every category
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX webhooks_owner_id_idx ON public.webhooks (owner_id);
+
+-- the queue of webhook deliveries, which is also their log; status is 'pending' until the receiver accepts the delivery,
+--		then 'delivered', or 'dead' once it has failed too many times
+CREATE TABLE public.webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_attempt_at TIMESTAMPTZ,
+	response_status INT,
+	response_body TEXT,
+	last_error TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON public.webhook_deliveries (webhook_id, id);
+CREATE INDEX webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,8 @@
+-- adds the tokens of users' calendar feeds
+
+-- the secret token in the address of a user's calendar feed (see calendar.go)
+CREATE TABLE public.calendar_feeds (
+	user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	token TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,16 @@
+-- adds the record of what was imported from Todoist and Trello
+
+-- which category, task or checklist item each entry of an imported export became, by its id in the other product,
+--		so that importing a newer export updates them instead of creating them again (see importers.go)
+CREATE TABLE public.imported_items (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	-- 'todoist' or 'trello'
+	source TEXT NOT NULL CHECK (source IN ('todoist', 'trello')),
+	-- 'category', 'task' or 'checklist_item'
+	kind TEXT NOT NULL CHECK (kind IN ('category', 'task', 'checklist_item')),
+	source_id TEXT NOT NULL,
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+	checklist_item_id INT REFERENCES task_checklist_items(id) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, source, kind, source_id)
+);
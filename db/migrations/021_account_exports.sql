@@ -0,0 +1,19 @@
+-- adds the exports of users' data
+
+-- the exports users have asked for, which are put together in the background (see account.go);
+--		blob_key and size are set once the archive is ready, and claimed_until while an instance is putting it together
+CREATE TABLE public.account_exports (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+	blob_key TEXT,
+	size BIGINT,
+	error TEXT,
+	claimed_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	finished_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX account_exports_user_id_idx ON public.account_exports (user_id);
+CREATE INDEX account_exports_waiting_idx ON public.account_exports (id) WHERE status IN ('pending', 'running');
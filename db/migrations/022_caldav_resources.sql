@@ -0,0 +1,11 @@
+-- adds the names and UIDs of tasks created over CalDAV
+
+-- tasks created through /dav keep the name and UID the app gave them (see caldav.go);
+--		every other task is served as task-<id>.ics
+CREATE TABLE public.caldav_resources (
+	task_id INT PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	uid TEXT NOT NULL
+);
+
+CREATE INDEX caldav_resources_name_idx ON public.caldav_resources (name);
@@ -0,0 +1,23 @@
+-- adds read-only share links to lists of tasks
+
+-- an address anyone can open a list of tasks at, without logging in, until expires_at (see textexport.go);
+--		the columns after format are the TaskListFilter picking out the tasks
+CREATE TABLE public.share_links (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token TEXT UNIQUE NOT NULL,
+	-- 'markdown', 'text' or 'html'
+	format TEXT NOT NULL CHECK (format IN ('markdown', 'text', 'html')),
+	category_id INT REFERENCES categories(id) ON DELETE CASCADE,
+	include_descendants BOOLEAN NOT NULL DEFAULT FALSE,
+	-- '' for every task, or one of the smart views: 'today', 'upcoming', 'overdue' or 'unscheduled'
+	view TEXT NOT NULL DEFAULT '' CHECK (view IN ('', 'today', 'upcoming', 'overdue', 'unscheduled')),
+	days INT NOT NULL DEFAULT 0,
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	priority TEXT CHECK (priority IN ('low', 'medium', 'high')),
+	hide_completed BOOLEAN NOT NULL DEFAULT FALSE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX share_links_user_id_idx ON public.share_links (user_id);
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// just enough of a task to show what it is blocked by, or what it blocks
+type DependencyTask struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+	Category_Id int `json:"category_id"`
+	Completed bool `json:"completed"`
+}
+
+type TaskDependencies struct {
+	// the tasks that need to be completed before this one can be started
+	Blocked_By []DependencyTask `json:"blocked_by"`
+	// the tasks that are waiting for this one to be completed
+	Blocks []DependencyTask `json:"blocks"`
+}
+
+type DependencyParams struct {
+	Task_Id int `json:"task_id"`
+	Blocked_By_Id int `json:"blocked_by_id"`
+}
+
+type GetTaskDependenciesParams struct {
+	Task_Id int `json:"task_id"`
+}
+
+// note: a task is blocked while any task it is blocked by is incomplete and not in the trash
+
+/* ------------------------------------------------------------ DEPENDENCIES --------------------- */
+/* Makes a task blocked by another, unless that would make a task (indirectly) wait on itself */
+func addDependency(params DependencyParams, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// only one dependency is added at a time, otherwise two additions that are fine on their own could together close a cycle
+	_, err = tx.Exec(context.Background(), "SELECT pg_advisory_xact_lock(hashtext('task_dependencies'));");
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	// the new dependency closes a cycle if the task is already somewhere among what its new blocker waits on
+	var cycle bool;
+	err = tx.QueryRow(context.Background(), `
+		WITH RECURSIVE waits_on(id) AS (
+			SELECT $1::int
+			UNION
+			SELECT task_dependencies.blocked_by_id FROM task_dependencies INNER JOIN waits_on ON task_dependencies.task_id=waits_on.id
+		)
+		SELECT EXISTS (SELECT 1 FROM waits_on WHERE id=$2);`, params.Blocked_By_Id, params.Task_Id).Scan(&cycle);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (cycle) {
+		if (params.Task_Id == params.Blocked_By_Id) {
+			return assertValidDependency(client, cancel, errors.New("a task cannot be blocked by itself"));
+		}
+		return assertValidDependency(client, cancel, fmt.Errorf("task with id: %v already waits on task with id: %v, so it cannot also block it", params.Blocked_By_Id, params.Task_Id));
+	}
+
+	_, err = tx.Exec(context.Background(), "INSERT INTO task_dependencies (task_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;", params.Task_Id, params.Blocked_By_Id);
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Stops a task from being blocked by another */
+func removeDependency(params DependencyParams, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "DELETE FROM task_dependencies WHERE task_id=$1 AND blocked_by_id=$2;", params.Task_Id, params.Blocked_By_Id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertValidDependency(client, cancel, fmt.Errorf("task with id: %v is not blocked by task with id: %v", params.Task_Id, params.Blocked_By_Id));
+	}
+
+	return nil;
+}
+
+/* Returns what a task is blocked by and what it blocks, leaving out tasks in categories the user has no access to */
+func getTaskDependencies(taskId int, userId int, client *gin.Context, cancel context.CancelFunc) (TaskDependencies, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var dependencies TaskDependencies;
+	var err error;
+
+	dependencies.Blocked_By, err = queryDependencyTasks(c, "SELECT blocked_by_id FROM task_dependencies WHERE task_id=$2", userId, taskId);
+	if (err == nil) {
+		dependencies.Blocks, err = queryDependencyTasks(c, "SELECT task_id FROM task_dependencies WHERE blocked_by_id=$2", userId, taskId);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return dependencies, err;
+	}
+
+	return dependencies, nil;
+}
+
+/* Returns the incomplete tasks a user has access to that are not blocked by anything, in the same order as the other task lists */
+func getReadyTasks(userId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_incomplete_tasks($1) WHERE NOT blocked;", userId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer tasks.Close();
+
+	var taskSlice []Task
+	for tasks.Next() {
+		var t Task
+		err = scanTask(tasks, &t)
+		assertDBOperationSuccess(client, cancel, err);
+		taskSlice = append(taskSlice, t)
+	}
+
+	return taskSlice;
+}
+
+/* Returns the tasks that completing a task has just unblocked, out of the ones the user has access to;
+		must be called in the same transaction as the change, with whether the task was already complete beforehand */
+func unblockedDependents(tx pgx.Tx, id int, userId int, wasCompleted bool) ([]DependencyTask, error) {
+	unblocked := []DependencyTask{};
+	if (wasCompleted) {
+		return unblocked, nil;
+	}
+
+	rows, err := tx.Query(context.Background(), `
+		SELECT tasks.id, tasks.title, tasks.category_id, tasks.completed
+		FROM task_dependencies
+			INNER JOIN tasks ON task_dependencies.task_id=tasks.id
+		WHERE task_dependencies.blocked_by_id=$1
+			AND tasks.completed='f' AND tasks.deleted_at IS NULL
+			AND NOT public.is_task_blocked(tasks.id)
+			AND tasks.category_id IN (SELECT category_id FROM public.get_accessible_categories($2))
+		ORDER BY tasks.id;`, id, userId)
+	if (err != nil) {
+		return unblocked, err;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		var t DependencyTask;
+		err = rows.Scan(&t.Id, &t.Title, &t.Category_Id, &t.Completed);
+		if (err != nil) {
+			return unblocked, err;
+		}
+		unblocked = append(unblocked, t);
+	}
+
+	return unblocked, rows.Err();
+}
+
+// returns the tasks whose ids are selected by idQuery, which is given the task's id as $2,
+//		leaving out tasks that are in the trash or in categories the user ($1) has no access to
+func queryDependencyTasks(c *pgx.Conn, idQuery string, userId int, taskId int) ([]DependencyTask, error) {
+	dependencyTasks := []DependencyTask{};
+
+	rows, err := c.Query(context.Background(), `
+		SELECT tasks.id, tasks.title, tasks.category_id, tasks.completed
+		FROM tasks
+		WHERE tasks.id IN (` + idQuery + `)
+			AND tasks.deleted_at IS NULL
+			AND tasks.category_id IN (SELECT category_id FROM public.get_accessible_categories($1))
+		ORDER BY tasks.completed, tasks.id;`, userId, taskId)
+	if (err != nil) {
+		return dependencyTasks, err;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		var t DependencyTask;
+		err = rows.Scan(&t.Id, &t.Title, &t.Category_Id, &t.Completed);
+		if (err != nil) {
+			return dependencyTasks, err;
+		}
+		dependencyTasks = append(dependencyTasks, t);
+	}
+
+	return dependencyTasks, rows.Err();
+}
+
+// reports to the client that the requested dependency between two tasks cannot be added or removed,
+//		and stops execution of any remaining function-calls
+func assertValidDependency(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to change task dependency: %v\n", e);
+
+	// return http code of 409 to the client, which stands for "Conflict"
+	client.JSON(409, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
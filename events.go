@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+	"github.com/joho/godotenv"
+)
+
+// structs
+
+// a change to a task or category, as recorded by the triggers on those tables (see record_task_event in functions.sql);
+//		Type is one of task.created, task.updated, task.completed, task.deleted, category.created, category.updated or category.deleted.
+//		Events only say what changed, clients fetch the task or category again to see how
+type ChangeEvent struct {
+	Id int64 `json:"id"`
+	Type string `json:"type"`
+	Task_Id null.Int64 `json:"task_id"`
+	Category_Id null.Int64 `json:"category_id"`
+	Created_at Timestamp `json:"created_at"`
+	// the users who could see the change when it was made
+	audience []int32
+}
+
+// passes the events in change_events on to the clients of this instance that are following /events;
+//		every instance has its own hub, woken by a Postgres NOTIFY whenever an event is recorded on any instance
+type eventHub struct {
+	mutex sync.Mutex
+	// whether cursor has been read from the database yet
+	ready bool
+	// the newest event passed on to subscribers; every event up to it has been passed on, or was never committed
+	cursor int64
+	// when poll first found an event missing right after cursor, see poll
+	gapSince time.Time
+	subscribers map[*eventSubscriber]bool
+}
+
+type eventSubscriber struct {
+	userId int
+	// closed when the subscriber falls too far behind, after which its client has to reconnect
+	events chan ChangeEvent
+}
+
+// a connection or transaction to read rows with
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// how often the change log is checked while an event is missing from it (see poll)
+const eventPollInterval = time.Second
+
+// how long to wait for a notification before checking the change log anyway, which also finds out whether the connection still works
+const eventListenTimeout = 30 * time.Second
+
+// the number of events read from the change log at a time
+const eventBatchSize = 1000
+
+// how long an event that is missing from the middle of the change log is waited for, as its transaction may not have committed yet;
+//		after this it is taken to have been rolled back
+const eventGapWait = 5 * time.Second
+
+// how often a comment is sent on an idle stream, so that proxies do not close it (Heroku closes connections idle for 55 seconds)
+const eventHeartbeatInterval = 20 * time.Second
+
+// how often the change log is trimmed down to EVENT_LOG_SIZE events
+const eventTrimInterval = time.Minute
+
+// how many events a subscriber can fall behind by before it is dropped
+const eventBufferSize = 256
+
+const defaultEventLogSize = 10000
+
+var events = &eventHub{subscribers: map[*eventSubscriber]bool{}}
+
+/* ------------------------------------------------------------ EVENTS --------------------- */
+/* Follows the change log for as long as the server runs, reconnecting to the database whenever the connection is lost */
+func (h *eventHub) run() {
+	for {
+		err := h.follow();
+		fmt.Fprintf(os.Stderr, "Stopped following change events, reconnecting: %v\n", err);
+		time.Sleep(5 * eventPollInterval);
+	}
+}
+
+/* Listens for the notifications sent whenever an event is recorded (see notify_change_event in functions.sql),
+		and passes on the new events after each one, until something goes wrong. Events are always read from the change log
+		rather than from the notifications, so anything that happened while the connection was down is caught up on after reconnecting */
+func (h *eventHub) follow() error {
+	godotenv.Load(".env")
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return err;
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Exec(context.Background(), "LISTEN change_events;")
+	if (err != nil) {
+		return err;
+	}
+
+	h.mutex.Lock();
+	if (!h.ready) {
+		// clients that connect from now on resume from the log in the database, so the hub only has to pass on newer events
+		err = c.QueryRow(context.Background(), "SELECT COALESCE(MAX(id), 0) FROM change_events;").Scan(&h.cursor);
+		h.ready = err == nil;
+	}
+	h.mutex.Unlock();
+	if (err != nil) {
+		return err;
+	}
+
+	lastTrim := time.Now();
+	for {
+		// keep reading until caught up, e.g. after the connection was down for a while
+		more := true;
+		for (more && err == nil) {
+			more, err = h.poll(c);
+		}
+		if (err == nil && time.Since(lastTrim) > eventTrimInterval) {
+			err = trimEvents(c);
+			lastTrim = time.Now();
+		}
+		if (err != nil) {
+			return err;
+		}
+
+		wait := eventListenTimeout;
+		if (!h.gapSince.IsZero()) {
+			wait = eventPollInterval;
+		}
+		ctx, stop := context.WithTimeout(context.Background(), wait);
+		_, err = c.WaitForNotification(ctx);
+		stop();
+		if (err != nil && !errors.Is(err, context.DeadlineExceeded)) {
+			return err;
+		}
+	}
+}
+
+/* Passes on the events after the cursor, and returns whether there may be more to read. An event missing from the middle of the log
+		may belong to a transaction that has not committed yet, so nothing after it is passed on until it turns up,
+		or until eventGapWait has gone by */
+func (h *eventHub) poll(c *pgx.Conn) (bool, error) {
+	newEvents, err := queryEvents(c, "WHERE id > $1 ORDER BY id LIMIT $2", h.cursor, eventBatchSize);
+	if (err != nil) {
+		return false, err;
+	}
+
+	next := h.cursor + 1;
+	var ready []ChangeEvent;
+	for _, e := range newEvents {
+		if (e.Id != next) {
+			if (h.gapSince.IsZero()) {
+				h.gapSince = time.Now();
+			}
+			if (time.Since(h.gapSince) < eventGapWait) {
+				break;
+			}
+		}
+		h.gapSince = time.Time{};
+		ready = append(ready, e);
+		next = e.Id + 1;
+	}
+
+	h.publish(ready);
+	return len(ready) == eventBatchSize, nil;
+}
+
+/* Hands events to every subscriber that can see them, and moves the cursor past them */
+func (h *eventHub) publish(ready []ChangeEvent) {
+	if (len(ready) == 0) {
+		return;
+	}
+
+	h.mutex.Lock();
+	defer h.mutex.Unlock();
+
+	for s := range h.subscribers {
+		for _, e := range ready {
+			if (!e.visibleTo(s.userId)) {
+				continue;
+			}
+			select {
+			case s.events <- e:
+			default:
+				// the client is not keeping up; it resumes from the change log when it reconnects
+				delete(h.subscribers, s);
+				close(s.events);
+			}
+			if (!h.subscribers[s]) {
+				break;
+			}
+		}
+	}
+	h.cursor = ready[len(ready) - 1].Id;
+}
+
+/* Starts passing a user's events to a new subscriber, and returns the cursor it starts from:
+		the subscriber only gets events after the cursor, and has to read the ones up to it from the change log */
+func (h *eventHub) subscribe(userId int) (*eventSubscriber, int64, error) {
+	h.mutex.Lock();
+	defer h.mutex.Unlock();
+
+	if (!h.ready) {
+		return nil, 0, errors.New("change events are not available right now, please try again later");
+	}
+
+	s := &eventSubscriber{userId: userId, events: make(chan ChangeEvent, eventBufferSize)};
+	h.subscribers[s] = true;
+
+	return s, h.cursor, nil;
+}
+
+/* Stops passing events to a subscriber */
+func (h *eventHub) unsubscribe(s *eventSubscriber) {
+	h.mutex.Lock();
+	defer h.mutex.Unlock();
+
+	if (h.subscribers[s]) {
+		delete(h.subscribers, s);
+		close(s.events);
+	}
+}
+
+/* Returns the events a user can see after one event and up to another, read from the change log;
+		returns false if the first event is no longer in the log, in which case there may be events missing */
+func getEventsSince(userId int, after int64, upTo int64, client *gin.Context, cancel context.CancelFunc) ([]ChangeEvent, bool, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	complete := true;
+	if (after > 0) {
+		err := c.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM change_events WHERE id=$1);", after).Scan(&complete);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return nil, false, err;
+		}
+	}
+
+	backlog, err := queryEvents(c, "WHERE id > $1 AND id <= $2 AND $3 = ANY(audience) ORDER BY id", after, upTo, userId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return nil, false, err;
+	}
+
+	return backlog, complete, nil;
+}
+
+/* Streams a user's events to the client as Server-Sent Events, starting after the event with the given id (0 for only new events),
+		until the client goes away. If events after that id may have been trimmed from the log, a "reset" event comes first,
+		telling the client to fetch everything again */
+func streamEvents(user User, after int64, client *gin.Context, cancel context.CancelFunc) {
+	s, upTo, err := events.subscribe(user.Id);
+	if (err != nil) {
+		assertEventsAvailable(client, cancel, err);
+		return;
+	}
+	defer events.unsubscribe(s);
+
+	var backlog []ChangeEvent;
+	complete := true;
+	if (after > 0) {
+		backlog, complete, err = getEventsSince(user.Id, after, upTo, client, cancel);
+		if (err != nil) {
+			return;
+		}
+		if (!complete) {
+			backlog = nil;
+		}
+	}
+
+	loc := locationOf(user);
+	client.Header("Content-Type", sse.ContentType);
+	client.Header("Cache-Control", "no-cache");
+	// stop nginx and the like from holding back events until a buffer fills up
+	client.Header("X-Accel-Buffering", "no");
+	client.Status(200);
+
+	// a new client resumes from here if the stream drops, while a resuming client keeps the id of the last event it got;
+	//		either way the client is told how soon to reconnect
+	ready := sse.Event{Event: "ready", Retry: 3000, Data: gin.H{"resumed": after > 0 && complete}};
+	if (after == 0 || !complete) {
+		ready.Id = strconv.FormatInt(upTo, 10);
+	}
+	sse.Encode(client.Writer, ready);
+	if (!complete) {
+		sse.Encode(client.Writer, sse.Event{Event: "reset", Data: gin.H{"message": "some changes are no longer available, please fetch everything again"}});
+	}
+	for _, e := range backlog {
+		writeEvent(client, e, loc);
+	}
+	client.Writer.Flush();
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval);
+	defer heartbeat.Stop();
+
+	for {
+		select {
+		case e, ok := <-s.events:
+			if (!ok) {
+				return;
+			}
+			// the client may already have this event, from an instance that had read further along the log
+			if (e.Id <= after) {
+				continue;
+			}
+			writeEvent(client, e, loc);
+		case <-heartbeat.C:
+			// lines starting with ":" are comments, which clients ignore
+			client.Writer.WriteString(": heartbeat\n\n");
+		case <-client.Request.Context().Done():
+			return;
+		}
+		client.Writer.Flush();
+	}
+}
+
+/* Reads the events in the change log that match the given condition */
+func queryEvents(c rowsQuerier, condition string, args ...interface{}) ([]ChangeEvent, error) {
+	rows, err := c.Query(context.Background(), "SELECT id, type, task_id, category_id, audience, created_at FROM change_events " + condition + ";", args...)
+	if (err != nil) {
+		return nil, err;
+	}
+	defer rows.Close();
+
+	var eventList []ChangeEvent;
+	for rows.Next() {
+		var e ChangeEvent
+		err = rows.Scan(&e.Id, &e.Type, &e.Task_Id, &e.Category_Id, &e.audience, &e.Created_at)
+		if (err != nil) {
+			return nil, err;
+		}
+		eventList = append(eventList, e)
+	}
+
+	return eventList, rows.Err();
+}
+
+/* Deletes all but the newest EVENT_LOG_SIZE events from the change log */
+func trimEvents(c *pgx.Conn) error {
+	size := defaultEventLogSize;
+	if n, err := strconv.Atoi(os.Getenv("EVENT_LOG_SIZE")); (err == nil && n > 0) {
+		size = n;
+	}
+
+	_, err := c.Exec(context.Background(), "DELETE FROM change_events WHERE id <= (SELECT MAX(id) FROM change_events) - $1;", size)
+	return err;
+}
+
+// whether a user could see the change an event is about
+func (e ChangeEvent) visibleTo(userId int) bool {
+	for _, id := range e.audience {
+		if (int(id) == userId) {
+			return true;
+		}
+	}
+
+	return false;
+}
+
+// sends an event to the client, with its id so that the client can resume after it
+func writeEvent(client *gin.Context, e ChangeEvent, loc *time.Location) {
+	if (e.Created_at.Valid) {
+		e.Created_at.Time.Time = e.Created_at.Time.Time.In(loc);
+	}
+
+	sse.Encode(client.Writer, sse.Event{Event: e.Type, Id: strconv.FormatInt(e.Id, 10), Data: e});
+}
+
+// reports to the client that events cannot be streamed yet, as the server has not been able to read the change log,
+//		and stops execution of any remaining function-calls
+func assertEventsAvailable(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to stream events: %v\n", e);
+
+	// return http code of 503 to the client, which stands for "Service Unavailable"
+	client.JSON(503, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// the fields of a task that are tracked in its history
+type TaskSnapshot struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Category_Id int `json:"category_id"`
+	Deadline Timestamp `json:"deadline"`
+	Deadline_Date Date `json:"deadline_date"`
+	Completed bool `json:"completed"`
+	Status_Id null.Int64 `json:"status_id"`
+	Estimate_Minutes null.Int64 `json:"estimate_minutes"`
+	Priority null.String `json:"priority"`
+	Tags []string `json:"tags"`
+	Recurrence null.String `json:"recurrence"`
+	Deleted bool `json:"deleted"`
+}
+
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After json.RawMessage `json:"after"`
+}
+
+type TaskRevision struct {
+	Revision int `json:"revision"`
+	Action string `json:"action"`
+	User_Id null.Int64 `json:"user_id"`
+	Username null.String `json:"username"`
+	Created_at Timestamp `json:"created_at"`
+	Changes map[string]FieldChange `json:"changes"`
+}
+
+type TaskHistory struct {
+	Revisions []TaskRevision `json:"revisions"`
+	// pass this as before_revision to get the next page, null when there are no older revisions
+	Next_Before_Revision null.Int64 `json:"next_before_revision"`
+}
+
+type GetTaskHistoryParams struct {
+	Id int `json:"id"`
+	Before_Revision int `json:"before_revision"`
+	Limit int `json:"limit"`
+}
+
+type RevertTaskParams struct {
+	Id int `json:"id"`
+	Revision int `json:"revision"`
+}
+
+// the kinds of changes that are recorded in a task's history
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionMove = "move"
+	actionComplete = "complete"
+	actionUncomplete = "uncomplete"
+	actionStatus = "status"
+	actionEstimate = "estimate"
+	actionDelete = "delete"
+	actionRestore = "restore"
+	actionRevert = "revert"
+)
+
+// number of revisions in a page of a task's history when the client does not ask for a specific number
+const defaultHistoryPageSize = 20
+
+const maxHistoryPageSize = 100
+
+/* ------------------------------------------------------------ TASK HISTORY --------------------- */
+/* Applies a change to a task inside a transaction, and records the change as a new revision of the task;
+		returns pgx.ErrNoRows if the change did not apply to exactly one task */
+func changeTask(c *pgx.Conn, id int, userId int, action string, query string, args ...interface{}) error {
+	return changeTaskWith(c, id, userId, action, func(tx pgx.Tx) error {
+		commandTag, err := tx.Exec(context.Background(), query, args...)
+		if (err == nil && commandTag.RowsAffected() != 1) {
+			err = pgx.ErrNoRows;
+		}
+		return err;
+	})
+}
+
+/* Same as changeTask, for changes that need more than a single query to apply */
+func changeTaskWith(c *pgx.Conn, id int, userId int, action string, apply func(tx pgx.Tx) error) error {
+	tx, err := c.Begin(context.Background())
+	if (err != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	err = changeTaskInTx(tx, id, userId, action, apply);
+	if (err != nil) {
+		return err;
+	}
+
+	return tx.Commit(context.Background());
+}
+
+/* Same as changeTaskWith, as part of a transaction that is already open */
+func changeTaskInTx(tx pgx.Tx, id int, userId int, action string, apply func(tx pgx.Tx) error) error {
+	// lock the task so that concurrent changes get recorded one after another
+	before, err := loadTaskSnapshot(tx, id, true);
+	if (err != nil) {
+		return err;
+	}
+
+	err = apply(tx);
+	if (err != nil) {
+		return err;
+	}
+
+	after, err := loadTaskSnapshot(tx, id, false);
+	if (err != nil) {
+		return err;
+	}
+
+	if (action == actionUpdate && before.Category_Id != after.Category_Id) {
+		action = actionMove;
+	}
+
+	return insertRevision(tx, id, userId, action, &before, after);
+}
+
+/* Reads the tracked fields of a task, optionally locking its row until the end of the transaction */
+func loadTaskSnapshot(tx pgx.Tx, id int, lock bool) (TaskSnapshot, error) {
+	var s TaskSnapshot;
+
+	query := "SELECT title, COALESCE(description, ''), category_id, deadline, deadline_date, COALESCE(completed, 'f'), status_id, estimate_minutes, priority, tags, recurrence, deleted_at IS NOT NULL FROM tasks WHERE id=$1";
+	if (lock) {
+		query += " FOR UPDATE";
+	}
+
+	err := tx.QueryRow(context.Background(), query, id).Scan(
+		&s.Title,
+		&s.Description,
+		&s.Category_Id,
+		&s.Deadline,
+		&s.Deadline_Date,
+		&s.Completed,
+		&s.Status_Id,
+		&s.Estimate_Minutes,
+		&s.Priority,
+		&s.Tags,
+		&s.Recurrence,
+		&s.Deleted,
+	)
+
+	// store every deadline in UTC so that the same moment always looks the same in the history
+	if (s.Deadline.Valid) {
+		s.Deadline.Time.Time = s.Deadline.Time.Time.UTC();
+	}
+
+	return s, err;
+}
+
+/* Stores a new revision of a task, with a field-by-field diff of its state before and after the change;
+		before is nil for a newly created task. Nothing is stored if no tracked field changed */
+func insertRevision(tx pgx.Tx, id int, userId int, action string, before *TaskSnapshot, after TaskSnapshot) error {
+	changes, err := diffSnapshots(before, after);
+	if (err != nil || len(changes) == 0) {
+		return err;
+	}
+
+	changesJSON, err := json.Marshal(changes);
+	if (err != nil) {
+		return err;
+	}
+	snapshotJSON, err := json.Marshal(after);
+	if (err != nil) {
+		return err;
+	}
+
+	var actor interface{};
+	if (userId != 0) {
+		actor = userId;
+	}
+
+	_, err = tx.Exec(context.Background(), `
+		INSERT INTO task_revisions (task_id, revision, action, user_id, changes, snapshot)
+		SELECT $1::int, COALESCE(MAX(revision), 0) + 1, $2::text, $3::int, $4::jsonb, $5::jsonb FROM task_revisions WHERE task_id=$1;`,
+		id, action, actor, changesJSON, snapshotJSON)
+
+	return err;
+}
+
+// compares two states of a task and returns the before/after values of every field that differs,
+//		keyed by the field's JSON name
+func diffSnapshots(before *TaskSnapshot, after TaskSnapshot) (map[string]FieldChange, error) {
+	beforeFields := map[string]json.RawMessage{};
+	if (before != nil) {
+		b, err := json.Marshal(before);
+		if (err != nil) {
+			return nil, err;
+		}
+		json.Unmarshal(b, &beforeFields);
+	}
+
+	b, err := json.Marshal(after);
+	if (err != nil) {
+		return nil, err;
+	}
+	afterFields := map[string]json.RawMessage{};
+	json.Unmarshal(b, &afterFields);
+
+	changes := map[string]FieldChange{};
+	for field, value := range afterFields {
+		old, ok := beforeFields[field];
+		if (!ok) {
+			old = json.RawMessage("null");
+		}
+		if (!bytes.Equal(old, value)) {
+			changes[field] = FieldChange{Before: old, After: value};
+		}
+	}
+
+	return changes, nil;
+}
+
+/* Returns a page of a task's revisions, newest first, starting just before the given revision (or at the newest if 0) */
+func getTaskHistory(params GetTaskHistoryParams, client *gin.Context, cancel context.CancelFunc) (TaskHistory) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	history := TaskHistory{Revisions: []TaskRevision{}};
+
+	// fetch one more than asked for, to find out whether there is another page
+	rows, err := c.Query(context.Background(), `
+		SELECT task_revisions.revision, task_revisions.action, task_revisions.user_id, users.username, task_revisions.created_at, task_revisions.changes
+		FROM task_revisions
+			LEFT JOIN users ON task_revisions.user_id=users.id
+		WHERE task_revisions.task_id=$1 AND ($2=0 OR task_revisions.revision < $2)
+		ORDER BY task_revisions.revision DESC
+		LIMIT $3;`,
+		params.Id, params.Before_Revision, params.Limit + 1)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return history;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		var rev TaskRevision
+		var changes []byte
+		err = rows.Scan(
+			&rev.Revision,
+			&rev.Action,
+			&rev.User_Id,
+			&rev.Username,
+			&rev.Created_at,
+			&changes,
+		)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return history;
+		}
+		json.Unmarshal(changes, &rev.Changes);
+		history.Revisions = append(history.Revisions, rev)
+	}
+
+	if (len(history.Revisions) > params.Limit) {
+		history.Revisions = history.Revisions[:params.Limit];
+		history.Next_Before_Revision = null.NewInt64(int64(history.Revisions[params.Limit - 1].Revision), true);
+	}
+
+	return history;
+}
+
+/* Puts a task back into the state it was in right after the given revision,
+		the revert itself is recorded as a new revision so no history is lost */
+func revertTask(id int, revision int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var snapshotJSON []byte;
+	err := c.QueryRow(context.Background(), "SELECT snapshot FROM task_revisions WHERE task_id=$1 AND revision=$2;", id, revision).Scan(&snapshotJSON);
+	if (err == pgx.ErrNoRows) {
+		return assertRevisionFound(client, cancel, id, revision);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	// revisions from before the priority, tags and recurrence were tracked leave them as they are now
+	var s TaskSnapshot;
+	var currentCategoryId int;
+	err = c.QueryRow(context.Background(), "SELECT category_id, priority, tags, recurrence FROM tasks WHERE id=$1;", id).Scan(&currentCategoryId, &s.Priority, &s.Tags, &s.Recurrence);
+	if (err == pgx.ErrNoRows) {
+		return assertTaskFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	err = json.Unmarshal(snapshotJSON, &s);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	// the route only checks the category the task is in now, so going back to another category needs the same right there
+	//		as moving the task would (a category that has since been deleted is reported as missing)
+	if (s.Category_Id != currentCategoryId) {
+		_, err = authorizeCategory(userId, s.Category_Id, roleEditor, client, cancel);
+		if (err != nil) {
+			return err;
+		}
+	}
+
+	err = changeTaskWith(c, id, userId, actionRevert, func(tx pgx.Tx) error {
+		// every field is written in a single UPDATE, so that the revert is reported as one change (see record_task_event in functions.sql);
+		//		a status that has since been removed from the workflow, or a revision from before workflows existed, leaves the status
+		//		to be picked from whether the task was completed (see sync_task_status in functions.sql), and a task that stays in the trash
+		//		keeps the time it was put there
+		fields := UpdateTaskParams{
+			Id: id,
+			Title: s.Title,
+			Description: s.Description,
+			Category_Id: s.Category_Id,
+			Deadline: s.Deadline.Time,
+			Deadline_Date: s.Deadline_Date,
+			Priority: s.Priority,
+			Tags: s.Tags,
+			Recurrence: s.Recurrence,
+		};
+		return writeTaskFields(tx, fields, true, `,
+			completed=$11,
+			status_id=(SELECT id FROM workflow_statuses WHERE id=$12 AND is_done=$11),
+			estimate_minutes=$13,
+			deleted_at=CASE WHEN $14 THEN COALESCE(deleted_at, CURRENT_TIMESTAMP) ELSE NULL END`,
+			s.Completed, s.Status_Id, s.Estimate_Minutes, s.Deleted);
+	})
+
+	return assertTaskChanged(client, cancel, id, err);
+}
+
+// converts the timestamp of every revision into the given timezone
+func localiseHistory(h TaskHistory, loc *time.Location) TaskHistory {
+	for i := range h.Revisions {
+		if (h.Revisions[i].Created_at.Valid) {
+			h.Revisions[i].Created_at.Time.Time = h.Revisions[i].Created_at.Time.Time.In(loc);
+		}
+	}
+
+	return h;
+}
@@ -0,0 +1,471 @@
+// Package ical reads and writes iCalendar (RFC 5545) data: components made of properties, which are encoded with their text escaped,
+// their lines folded at 75 octets and ended with CRLF, and their times either in UTC or in a named timezone that is described
+// by a VTIMEZONE component built from the Go time zone database. Reading undoes all of this, and understands times in any
+// timezone the Go time zone database knows by name.
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// a property parameter, e.g. TZID=Asia/Singapore
+type Param struct {
+	Name string
+	Value string
+}
+
+// a property, e.g. SUMMARY:Do Lab 3; Value is written as it is, so text values have to be escaped first (see AddText)
+type Property struct {
+	Name string
+	Params []Param
+	Value string
+}
+
+// a component, e.g. a VCALENDAR holding VTODOs
+type Component struct {
+	Name string
+	Properties []Property
+	Components []*Component
+}
+
+// the longest a line may be, in octets, not counting the CRLF that ends it
+const maxLineLength = 75
+
+const (
+	dateFormat = "20060102"
+	localTimeFormat = "20060102T150405"
+	utcTimeFormat = "20060102T150405Z"
+)
+
+func NewComponent(name string) *Component {
+	return &Component{Name: name};
+}
+
+// adds a property with a value that is already in iCalendar format
+func (c *Component) Add(name string, value string, params ...Param) {
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Value: value});
+}
+
+// adds a property with a TEXT value, escaping it
+func (c *Component) AddText(name string, text string, params ...Param) {
+	c.Add(name, EscapeText(text), params...);
+}
+
+// adds a property with a list of TEXT values, e.g. CATEGORIES
+func (c *Component) AddTextList(name string, texts []string, params ...Param) {
+	escaped := make([]string, len(texts));
+	for i, text := range texts {
+		escaped[i] = EscapeText(text);
+	}
+	c.Add(name, strings.Join(escaped, ","), params...);
+}
+
+// adds a property with a DATE-TIME value: in UTC if t is in UTC, otherwise as a local time with the TZID of t's location,
+//		which then needs a VTIMEZONE in the calendar (see Timezone)
+func (c *Component) AddTime(name string, t time.Time, params ...Param) {
+	if (t.Location() == time.UTC) {
+		c.Add(name, t.Format(utcTimeFormat), params...);
+		return;
+	}
+	c.Add(name, t.Format(localTimeFormat), append(params, Param{Name: "TZID", Value: t.Location().String()})...);
+}
+
+// adds a property with a DATE value, taken from t's year, month and day
+func (c *Component) AddDate(name string, t time.Time, params ...Param) {
+	c.Add(name, t.Format(dateFormat), append(params, Param{Name: "VALUE", Value: "DATE"})...);
+}
+
+// replaces every property with the given name by one with a value that is already in iCalendar format
+func (c *Component) Set(name string, value string, params ...Param) {
+	kept := c.Properties[:0];
+	for _, p := range c.Properties {
+		if (!strings.EqualFold(p.Name, name)) {
+			kept = append(kept, p);
+		}
+	}
+	c.Properties = kept;
+	c.Add(name, value, params...);
+}
+
+// adds a sub-component
+func (c *Component) AddComponent(sub *Component) {
+	c.Components = append(c.Components, sub);
+}
+
+// writes the component and everything in it
+func (c *Component) Encode(w io.Writer) error {
+	b := &strings.Builder{};
+	c.encode(b);
+	_, err := io.WriteString(w, b.String());
+	return err;
+}
+
+func (c *Component) encode(b *strings.Builder) {
+	writeLine(b, "BEGIN:" + c.Name);
+	for _, p := range c.Properties {
+		line := p.Name;
+		for _, param := range p.Params {
+			line += ";" + param.Name + "=" + quoteParam(param.Value);
+		}
+		// a raw line break would end the property early, so values can never hold one
+		line += ":" + strings.NewReplacer("\r", "", "\n", "").Replace(p.Value);
+		writeLine(b, line);
+	}
+	for _, sub := range c.Components {
+		sub.encode(b);
+	}
+	writeLine(b, "END:" + c.Name);
+}
+
+// writes a content line, folded so that no line is longer than maxLineLength octets: the line is broken before a character
+//		that would not fit, never inside one, and every line after the first starts with a space
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineLength;
+	for (len(line) > limit) {
+		cut := limit;
+		for (cut > 0 && !utf8.RuneStart(line[cut])) {
+			cut--;
+		}
+		b.WriteString(line[:cut]);
+		b.WriteString("\r\n ");
+		line = line[cut:];
+		// the space at the start of the next line counts towards its length
+		limit = maxLineLength - 1;
+	}
+	b.WriteString(line);
+	b.WriteString("\r\n");
+}
+
+// escapes a TEXT value: backslashes, semicolons and commas are escaped with a backslash, and line breaks become \n
+func EscapeText(text string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+		"\r", "\\n",
+	).Replace(text);
+}
+
+// quotes a parameter value if it holds a character that would otherwise end it; double quotes cannot be escaped, so they are dropped
+func quoteParam(value string) string {
+	value = strings.NewReplacer("\"", "", "\r", "", "\n", "").Replace(value);
+	if (strings.ContainsAny(value, ";:,")) {
+		return "\"" + value + "\"";
+	}
+	return value;
+}
+
+/* ------------------------------------------------------------ TIMEZONES --------------------- */
+// returns a VTIMEZONE describing loc from one moment to another: one STANDARD or DAYLIGHT observance for the offset in force
+//		at the start, and one for every change of offset after it. Times outside the span are taken by clients to keep
+//		the offset in force at whichever end of it they are nearest, so the span should cover every time written with loc
+func Timezone(loc *time.Location, from time.Time, to time.Time) *Component {
+	tz := NewComponent("VTIMEZONE");
+	tz.Add("TZID", loc.String());
+
+	from = from.Truncate(time.Second).In(loc);
+	_, offset := from.Zone();
+	tz.AddComponent(observance(from, offset));
+
+	// offsets never change more than once a day, so stepping by half a day finds every change
+	const step = 12 * time.Hour;
+	for t := from; t.Before(to); {
+		next := t.Add(step);
+		_, nextOffset := next.In(loc).Zone();
+		if (nextOffset == offset) {
+			t = next;
+			continue;
+		}
+
+		// narrow down to the second the offset changes at
+		before, after := t, next;
+		for (after.Sub(before) > time.Second) {
+			middle := before.Add(after.Sub(before) / 2).Truncate(time.Second);
+			if (middle.Equal(before)) {
+				middle = before.Add(time.Second);
+			}
+			if _, o := middle.In(loc).Zone(); (o == offset) {
+				before = middle;
+			} else {
+				after = middle;
+			}
+		}
+
+		tz.AddComponent(observance(after.In(loc), offset));
+		offset = nextOffset;
+		t = next;
+	}
+
+	return tz;
+}
+
+// returns the STANDARD or DAYLIGHT observance that starts at t, when the offset changes from the given one to t's;
+//		its start is written in local time before the change, as the standard asks
+func observance(t time.Time, offsetFrom int) *Component {
+	name, offsetTo := t.Zone();
+	kind := "STANDARD";
+	if (t.IsDST()) {
+		kind = "DAYLIGHT";
+	}
+
+	o := NewComponent(kind);
+	o.Add("DTSTART", t.UTC().Add(time.Duration(offsetFrom) * time.Second).Format(localTimeFormat));
+	o.Add("TZOFFSETFROM", formatOffset(offsetFrom));
+	o.Add("TZOFFSETTO", formatOffset(offsetTo));
+	o.AddText("TZNAME", name);
+
+	return o;
+}
+
+// formats an offset from UTC in seconds as a UTC-OFFSET value, e.g. +0800 or -0330
+func formatOffset(offset int) string {
+	sign := "+";
+	if (offset < 0) {
+		sign = "-";
+		offset = -offset;
+	}
+
+	s := fmt.Sprintf("%v%02d%02d", sign, offset / 3600, offset % 3600 / 60);
+	if (offset % 60 != 0) {
+		s += fmt.Sprintf("%02d", offset % 60);
+	}
+	return s;
+}
+
+/* ------------------------------------------------------------ READING --------------------- */
+// reads every component at the top level of an iCalendar stream, which is usually a single VCALENDAR;
+//		lines may end with CRLF or only LF, and folded lines are unfolded first
+func Decode(r io.Reader) ([]*Component, error) {
+	data, err := ioutil.ReadAll(r);
+	if (err != nil) {
+		return nil, err;
+	}
+	text := strings.TrimPrefix(string(data), "\uFEFF");
+	text = strings.ReplaceAll(text, "\r\n", "\n");
+
+	// unfold, remembering the line each content line started on for error messages
+	var lines []string;
+	var lineNumbers []int;
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r");
+		if ((strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0) {
+			lines[len(lines) - 1] += line[1:];
+			continue;
+		}
+		if (strings.TrimSpace(line) == "") {
+			continue;
+		}
+		lines = append(lines, line);
+		lineNumbers = append(lineNumbers, i + 1);
+	}
+
+	var top []*Component;
+	var open []*Component;
+	for i, line := range lines {
+		p, err := parseLine(line);
+		if (err != nil) {
+			return nil, fmt.Errorf("line %v: %v", lineNumbers[i], err);
+		}
+
+		switch (p.Name) {
+		case "BEGIN":
+			c := NewComponent(strings.ToUpper(p.Value));
+			if (len(open) > 0) {
+				open[len(open) - 1].AddComponent(c);
+			} else {
+				top = append(top, c);
+			}
+			open = append(open, c);
+		case "END":
+			if (len(open) == 0 || open[len(open) - 1].Name != strings.ToUpper(p.Value)) {
+				return nil, fmt.Errorf("line %v: END:%v without a matching BEGIN", lineNumbers[i], p.Value);
+			}
+			open = open[:len(open) - 1];
+		default:
+			if (len(open) == 0) {
+				return nil, fmt.Errorf("line %v: %v is outside of any component", lineNumbers[i], p.Name);
+			}
+			open[len(open) - 1].Properties = append(open[len(open) - 1].Properties, p);
+		}
+	}
+	if (len(open) > 0) {
+		return nil, fmt.Errorf("%v is never ended", open[len(open) - 1].Name);
+	}
+	if (len(top) == 0) {
+		return nil, errors.New("the file holds no calendar");
+	}
+
+	return top, nil;
+}
+
+// splits an unfolded content line into the name, parameters and value of a property
+func parseLine(line string) (Property, error) {
+	var p Property;
+
+	end := strings.IndexAny(line, ";:");
+	if (end <= 0) {
+		return p, fmt.Errorf("%q is not a property", line);
+	}
+	p.Name = strings.ToUpper(line[:end]);
+	rest := line[end:];
+
+	for (strings.HasPrefix(rest, ";")) {
+		rest = rest[1:];
+		eq := strings.Index(rest, "=");
+		if (eq <= 0) {
+			return p, fmt.Errorf("a parameter of %v has no value", p.Name);
+		}
+		param := Param{Name: strings.ToUpper(rest[:eq])};
+		rest = rest[eq + 1:];
+
+		// a parameter value runs up to the next unquoted ";" or ":", and may be a list separated by commas
+		var value strings.Builder;
+		quoted := false;
+		i := 0;
+		for ; i < len(rest); i++ {
+			ch := rest[i];
+			if (ch == '"') {
+				quoted = !quoted;
+				continue;
+			}
+			if (!quoted && (ch == ';' || ch == ':')) {
+				break;
+			}
+			value.WriteByte(ch);
+		}
+		if (quoted) {
+			return p, fmt.Errorf("a parameter of %v has an unclosed quote", p.Name);
+		}
+		param.Value = value.String();
+		p.Params = append(p.Params, param);
+		rest = rest[i:];
+	}
+
+	if (!strings.HasPrefix(rest, ":")) {
+		return p, fmt.Errorf("%v has no value", p.Name);
+	}
+	p.Value = rest[1:];
+
+	return p, nil;
+}
+
+// returns the first property with the given name, and whether there is one
+func (c *Component) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if (p.Name == name) {
+			return p, true;
+		}
+	}
+
+	return Property{}, false;
+}
+
+// returns every property with the given name, e.g. CATEGORIES, which may be given more than once
+func (c *Component) GetAll(name string) []Property {
+	var found []Property;
+	for _, p := range c.Properties {
+		if (p.Name == name) {
+			found = append(found, p);
+		}
+	}
+
+	return found;
+}
+
+// returns the value of the first parameter with the given name, "" if there is none
+func (p Property) Param(name string) string {
+	for _, param := range p.Params {
+		if (strings.EqualFold(param.Name, name)) {
+			return param.Value;
+		}
+	}
+
+	return "";
+}
+
+// returns the value of a TEXT property, unescaped
+func (p Property) Text() string {
+	return UnescapeText(p.Value);
+}
+
+// returns the values of a property holding a list of TEXT values, unescaped
+func (p Property) TextList() []string {
+	var texts []string;
+	start := 0;
+	for i := 0; i < len(p.Value); i++ {
+		if (p.Value[i] == '\\') {
+			i++;
+		} else if (p.Value[i] == ',') {
+			texts = append(texts, UnescapeText(p.Value[start:i]));
+			start = i + 1;
+		}
+	}
+
+	return append(texts, UnescapeText(p.Value[start:]));
+}
+
+// returns the DATE or DATE-TIME a property holds, and whether it is a DATE. A DATE is returned as midnight UTC on that date;
+//		a DATE-TIME is in UTC if it ends with Z, in its TZID if the Go time zone database knows that timezone,
+//		and otherwise, as well as when it has no TZID, in the given location
+func (p Property) Time(loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(p.Value);
+
+	if (strings.EqualFold(p.Param("VALUE"), "DATE") || len(value) == len(dateFormat)) {
+		t, err := time.ParseInLocation(dateFormat, value, time.UTC);
+		if (err != nil) {
+			return t, true, fmt.Errorf("%v has %q, which is not a date", p.Name, value);
+		}
+		return t, true, nil;
+	}
+
+	if (strings.HasSuffix(value, "Z")) {
+		t, err := time.ParseInLocation(utcTimeFormat, value, time.UTC);
+		if (err != nil) {
+			return t, false, fmt.Errorf("%v has %q, which is not a date and time", p.Name, value);
+		}
+		return t, false, nil;
+	}
+
+	if tzid := strings.TrimPrefix(p.Param("TZID"), "/"); (tzid != "") {
+		if named, err := time.LoadLocation(tzid); (err == nil) {
+			loc = named;
+		}
+	}
+	t, err := time.ParseInLocation(localTimeFormat, value, loc);
+	if (err != nil) {
+		return t, false, fmt.Errorf("%v has %q, which is not a date and time", p.Name, value);
+	}
+	return t, false, nil;
+}
+
+// undoes EscapeText; a backslash before any other character is dropped
+func UnescapeText(text string) string {
+	if (!strings.Contains(text, "\\")) {
+		return text;
+	}
+
+	var b strings.Builder;
+	for i := 0; i < len(text); i++ {
+		if (text[i] != '\\' || i == len(text) - 1) {
+			b.WriteByte(text[i]);
+			continue;
+		}
+		i++;
+		switch (text[i]) {
+		case 'n', 'N':
+			b.WriteByte('\n');
+		default:
+			b.WriteByte(text[i]);
+		}
+	}
+
+	return b.String();
+}
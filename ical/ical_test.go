@@ -0,0 +1,215 @@
+package ical
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	_ "time/tzdata"
+)
+
+func TestWriteLineFolding(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:buy milk"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"76 octets", "SUMMARY:" + strings.Repeat("a", 68)},
+		{"several lines", "DESCRIPTION:" + strings.Repeat("abcdefghij", 30)},
+		{"two-octet characters", "SUMMARY:" + strings.Repeat("é", 80)},
+		{"three-octet characters across the fold", "SUMMARY:" + strings.Repeat("a", 66) + strings.Repeat("€", 40)},
+		{"four-octet characters", "SUMMARY:" + strings.Repeat("😀", 50)},
+	}
+	for _, test := range tests {
+		var b strings.Builder;
+		writeLine(&b, test.line);
+		folded := b.String();
+
+		if (!strings.HasSuffix(folded, "\r\n")) {
+			t.Errorf("%v: %q does not end with CRLF", test.name, folded);
+			continue;
+		}
+		for i, line := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+			if (len(line) > maxLineLength) {
+				t.Errorf("%v: line %v is %v octets long", test.name, i + 1, len(line));
+			}
+			if (!utf8.ValidString(line)) {
+				t.Errorf("%v: line %v splits a character: %q", test.name, i + 1, line);
+			}
+			if (i > 0 && !strings.HasPrefix(line, " ")) {
+				t.Errorf("%v: line %v does not start with a space", test.name, i + 1);
+			}
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); (unfolded != test.line) {
+			t.Errorf("%v: unfolds to %q, want %q", test.name, unfolded, test.line);
+		}
+	}
+
+	var b strings.Builder;
+	writeLine(&b, "SUMMARY:" + strings.Repeat("a", 68));
+	if want := "SUMMARY:" + strings.Repeat("a", 67) + "\r\n a\r\n"; (b.String() != want) {
+		t.Errorf("a line of 76 octets is folded as %q, want %q", b.String(), want);
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		text string
+		escaped string
+		// what the escaped text reads back as, if it differs from the text
+		unescaped string
+	}{
+		{"buy milk", "buy milk", ""},
+		{"milk, eggs; bread", "milk\\, eggs\\; bread", ""},
+		{"C:\\Users\\me", "C:\\\\Users\\\\me", ""},
+		{"first line\nsecond line", "first line\\nsecond line", ""},
+		{"windows\r\nline", "windows\\nline", "windows\nline"},
+		{"old mac\rline", "old mac\\nline", "old mac\nline"},
+		{"a \\n that is not a line break", "a \\\\n that is not a line break", ""},
+		{"ends with a backslash\\", "ends with a backslash\\\\", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		escaped := EscapeText(test.text);
+		if (escaped != test.escaped) {
+			t.Errorf("EscapeText(%q) = %q, want %q", test.text, escaped, test.escaped);
+		}
+		want := test.unescaped;
+		if (want == "") {
+			want = test.text;
+		}
+		if got := UnescapeText(escaped); (got != want) {
+			t.Errorf("UnescapeText(%q) = %q, want %q", escaped, got, want);
+		}
+	}
+
+	// other programs sometimes escape characters that do not need it, or write \N
+	for escaped, want := range map[string]string{"\\:": ":", "line\\Nbreak": "line\nbreak", "dangling\\": "dangling\\"} {
+		if got := UnescapeText(escaped); (got != want) {
+			t.Errorf("UnescapeText(%q) = %q, want %q", escaped, got, want);
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	todo := NewComponent("VTODO");
+	todo.AddText("SUMMARY", "groceries: milk, eggs; bread");
+	todo.AddText("DESCRIPTION", strings.Repeat("lactose-free, ", 10) + "\nand café crème ☕");
+	todo.AddTextList("CATEGORIES", []string{"home", "a, b", "c;d"});
+	cal := NewComponent("VCALENDAR");
+	cal.AddComponent(todo);
+
+	var b strings.Builder;
+	err := cal.Encode(&b);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	components, err := Decode(strings.NewReader(b.String()));
+	if (err != nil) {
+		t.Fatalf("Decode: %v\n%v", err, b.String());
+	}
+	if (len(components) != 1 || len(components[0].Components) != 1) {
+		t.Fatalf("Decode returned %+v", components);
+	}
+
+	decoded := components[0].Components[0];
+	for _, name := range []string{"SUMMARY", "DESCRIPTION"} {
+		got, _ := decoded.Get(name);
+		want, _ := todo.Get(name);
+		if (got.Text() != want.Text()) {
+			t.Errorf("%v reads back as %q, want %q", name, got.Text(), want.Text());
+		}
+	}
+	categories, _ := decoded.Get("CATEGORIES");
+	if got := categories.TextList(); (!reflect.DeepEqual(got, []string{"home", "a, b", "c;d"})) {
+		t.Errorf("CATEGORIES reads back as %q", got);
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	type observance struct {
+		kind string
+		start string
+		from string
+		to string
+		name string
+	}
+	tests := []struct {
+		zone string
+		from time.Time
+		to time.Time
+		want []observance
+	}{
+		{
+			"Europe/Amsterdam", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+			[]observance{
+				{"STANDARD", "20260101T010000", "+0100", "+0100", "CET"},
+				{"DAYLIGHT", "20260329T020000", "+0100", "+0200", "CEST"},
+				{"STANDARD", "20261025T030000", "+0200", "+0100", "CET"},
+			},
+		},
+		{
+			// the seasons are the other way round in the southern hemisphere
+			"Australia/Sydney", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+			[]observance{
+				{"DAYLIGHT", "20260101T110000", "+1100", "+1100", "AEDT"},
+				{"STANDARD", "20260405T030000", "+1100", "+1000", "AEST"},
+				{"DAYLIGHT", "20261004T020000", "+1000", "+1100", "AEDT"},
+			},
+		},
+		{
+			"America/St_Johns", time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, time.December, 1, 0, 0, 0, 0, time.UTC),
+			[]observance{
+				{"DAYLIGHT", "20260531T213000", "-0230", "-0230", "NDT"},
+				{"STANDARD", "20261101T020000", "-0230", "-0330", "NST"},
+			},
+		},
+		{
+			"Asia/Singapore", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC),
+			[]observance{
+				{"STANDARD", "20260101T080000", "+0800", "+0800", "+08"},
+			},
+		},
+	}
+	for _, test := range tests {
+		loc, err := time.LoadLocation(test.zone);
+		if (err != nil) {
+			t.Fatal(err);
+		}
+
+		tz := Timezone(loc, test.from, test.to);
+		if tzid, _ := tz.Get("TZID"); (tzid.Value != test.zone) {
+			t.Errorf("%v: TZID is %q", test.zone, tzid.Value);
+		}
+		var got []observance;
+		for _, c := range tz.Components {
+			start, _ := c.Get("DTSTART");
+			from, _ := c.Get("TZOFFSETFROM");
+			to, _ := c.Get("TZOFFSETTO");
+			name, _ := c.Get("TZNAME");
+			got = append(got, observance{c.Name, start.Value, from.Value, to.Value, name.Text()});
+		}
+		if (!reflect.DeepEqual(got, test.want)) {
+			t.Errorf("%v: observances are\n\t%v\nwant\n\t%v", test.zone, got, test.want);
+		}
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := map[int]string{
+		0: "+0000",
+		8 * 3600: "+0800",
+		-5 * 3600: "-0500",
+		-(3 * 3600 + 30 * 60): "-0330",
+		5 * 3600 + 45 * 60: "+0545",
+		// Amsterdam before 1937
+		19 * 60 + 32: "+001932",
+	}
+	for offset, want := range tests {
+		if got := formatOffset(offset); (got != want) {
+			t.Errorf("formatOffset(%v) = %q, want %q", offset, got, want);
+		}
+	}
+}
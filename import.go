@@ -0,0 +1,583 @@
+package main
+
+import (
+	"api/ical"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"github.com/gin-gonic/gin"
+)
+
+// structs
+
+// note: /importtasks creates tasks from an iCalendar (.ics) or CSV file, uploaded as a multipart form with the fields
+//		"file", and optionally "format" ("ics" or "csv", otherwise worked out from the file), "category_id" and "dry_run".
+//
+//		In an iCalendar file, every VTODO and VEVENT is a row: SUMMARY is the title, DESCRIPTION the description,
+//		the DUE of a VTODO or the DTSTART of a VEVENT the deadline, PRIORITY the priority (1-4 high, 5 medium, 6-9 low),
+//		RRULE the recurrence, and a VTODO that is COMPLETED is completed. The first of its CATEGORIES is its category,
+//		and the rest become tags. Cancelled entries, and the exceptions to recurring ones (those with a RECURRENCE-ID), are skipped.
+//
+//		A CSV file needs a header row, whose columns are matched by name, ignoring case (see csvColumns); only a title is required.
+//		Deadlines are written as 2026-03-14 for an all-day deadline, or as 2026-03-14 17:00 or in RFC 3339 for a timed one.
+//
+//		Times without a timezone are taken to be in the user's. A row with no category goes into the category_id given,
+//		or else the category named after the calendar (X-WR-CALNAME). Categories are matched by name among those the user can edit,
+//		and created if there is none of that name. A dry run reports what would happen to every row without changing anything;
+//		otherwise every row that can be imported is, in a single transaction, and the rows that cannot are reported
+type ImportResult struct {
+	Dry_Run bool `json:"dry_run"`
+	// "ics" or "csv"
+	Format string `json:"format"`
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+	Failed int `json:"failed"`
+	// the categories that were created, or on a dry run would be
+	New_Categories []string `json:"new_categories"`
+	// the columns of a CSV file that were not understood, and so were left out
+	Ignored_Columns []string `json:"ignored_columns"`
+	Rows []ImportRow `json:"rows"`
+}
+
+type ImportRow struct {
+	// the line of a CSV file, or the position of the entry in an iCalendar file, counting from 1
+	Row int `json:"row"`
+	Title string `json:"title"`
+	Category string `json:"category"`
+	// "created", "skipped" or "failed"; on a dry run, "created" means the row would be created
+	Status string `json:"status"`
+	// 0 on a dry run
+	Task_Id int `json:"task_id"`
+	// why the row was skipped or failed
+	Reason string `json:"reason,omitempty"`
+}
+
+// a task read from an imported file, before it is created
+type importedTask struct {
+	row int
+	params CreateTaskParams
+	completed bool
+	// the name of the category the file puts the task in, "" if it does not
+	category string
+	// why the task is skipped or cannot be imported, if it is
+	skip string
+	err error
+}
+
+type importFile struct {
+	tasks []importedTask
+	// the name of the calendar, for tasks that are not in a category
+	calendarName string
+	ignoredColumns []string
+}
+
+const (
+	importCreated = "created"
+	importSkipped = "skipped"
+	importFailed = "failed"
+)
+
+// the largest file that can be imported, in bytes
+const maxImportSize = 5 << 20
+
+// the most rows that can be imported at once
+const maxImportRows = 5000
+
+// the longest a task's title can be, in characters (see the tasks table)
+const maxTitleLength = 255
+
+// the names a column of a CSV file can have, for each field it can fill in
+var csvColumns = map[string][]string{
+	"title": {"title", "name", "task", "summary", "subject", "content"},
+	"description": {"description", "notes", "note", "details", "body"},
+	"category": {"category", "list", "project", "folder"},
+	"deadline": {"deadline", "due", "due date", "due_date", "duedate", "date"},
+	"completed": {"completed", "done", "status", "is_completed"},
+	"priority": {"priority"},
+	"tags": {"tags", "tag", "labels", "label"},
+	"recurrence": {"recurrence", "rrule", "repeat"},
+}
+
+// the ways a deadline can be written in a CSV file, other than RFC 3339
+var csvDeadlineFormats = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+/* ------------------------------------------------------------ IMPORT --------------------- */
+/* Works out the category of every task read from a file, and creates the tasks along with any categories that are missing;
+		on a dry run, only reports what would happen */
+func importTasks(file importFile, format string, defaultCategoryId int, dryRun bool, userId int, client *gin.Context, cancel context.CancelFunc) (ImportResult, error) {
+	result := ImportResult{Dry_Run: dryRun, Format: format, New_Categories: []string{}, Ignored_Columns: file.ignoredColumns, Rows: []ImportRow{}};
+	if (result.Ignored_Columns == nil) {
+		result.Ignored_Columns = []string{};
+	}
+
+	// categories are matched by name, ignoring case, among those the user can add tasks to
+	categoryIds := map[string]int{};
+	categoryTitles := map[int]string{};
+	for _, cat := range getAllCategories(userId, client, cancel) {
+		categoryTitles[cat.Id] = cat.Title;
+		key := strings.ToLower(strings.TrimSpace(cat.Title));
+		if (hasRole(cat.Role, roleEditor) && categoryIds[key] == 0) {
+			categoryIds[key] = cat.Id;
+		}
+	}
+	if (client.Writer.Written()) {
+		return result, errors.New("unable to read categories");
+	}
+
+	// the categories to create, by the key they are matched with, in the order they first appear
+	newCategories := map[string]string{};
+	var newCategoryKeys []string;
+	for i := range file.tasks {
+		t := &file.tasks[i];
+		row := ImportRow{Row: t.row, Title: t.params.Title, Status: importCreated};
+
+		if (t.skip == "" && t.err == nil) {
+			name := strings.TrimSpace(t.category);
+			if (name == "" && defaultCategoryId != 0) {
+				name = categoryTitles[defaultCategoryId];
+				t.params.Category_Id = strconv.Itoa(defaultCategoryId);
+			} else if (name == "") {
+				name = strings.TrimSpace(file.calendarName);
+			}
+			key := strings.ToLower(name);
+			row.Category = name;
+
+			switch {
+			case (t.params.Category_Id != ""):
+				// the default category, which the caller has checked the user can edit
+			case (name == ""):
+				t.err = errors.New("the row names no category, and no category_id was given");
+			case (categoryIds[key] != 0):
+				t.params.Category_Id = strconv.Itoa(categoryIds[key]);
+			case (newCategories[key] == ""):
+				newCategories[key] = name;
+				newCategoryKeys = append(newCategoryKeys, key);
+			}
+		}
+
+		if (t.skip != "") {
+			row.Status, row.Reason = importSkipped, t.skip;
+			result.Skipped++;
+		} else if (t.err != nil) {
+			row.Status, row.Reason = importFailed, t.err.Error();
+			result.Failed++;
+		} else {
+			result.Created++;
+		}
+		result.Rows = append(result.Rows, row);
+	}
+	for _, key := range newCategoryKeys {
+		result.New_Categories = append(result.New_Categories, newCategories[key]);
+	}
+
+	if (dryRun || result.Created == 0) {
+		return result, nil;
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, key := range newCategoryKeys {
+		var id int;
+		err = tx.QueryRow(context.Background(), "INSERT INTO categories (title, owner_id) VALUES ($1, $2) RETURNING id;", newCategories[key], userId).Scan(&id);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		categoryIds[key] = id;
+	}
+
+	for i, t := range file.tasks {
+		if (result.Rows[i].Status != importCreated) {
+			continue;
+		}
+		if (t.params.Category_Id == "") {
+			t.params.Category_Id = strconv.Itoa(categoryIds[strings.ToLower(result.Rows[i].Category)]);
+		}
+
+		id, err := insertTask(tx, t.params, userId);
+		if (err == nil && t.completed) {
+			err = completeNewTask(tx, id, userId);
+		}
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		result.Rows[i].Task_Id = id;
+	}
+
+	err = tx.Commit(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	return result, nil;
+}
+
+// returns the file uploaded to /importtasks and its name, refusing to read more of the request than the largest file allowed
+func importFormFile(client *gin.Context, cancel context.CancelFunc) ([]byte, string, error) {
+	client.Request.Body = http.MaxBytesReader(client.Writer, client.Request.Body, maxImportSize + 1 << 20);
+
+	header, err := client.FormFile("file");
+	if (err != nil && strings.Contains(err.Error(), "request body too large")) {
+		return nil, "", assertAttachmentSize(client, cancel, fmt.Errorf("files can be at most %v MB", maxImportSize >> 20));
+	}
+	if (assertJSONSuccess(client, cancel, err) != nil) {
+		return nil, "", err;
+	}
+	if (header.Size > maxImportSize) {
+		return nil, "", assertAttachmentSize(client, cancel, fmt.Errorf("files can be at most %v MB", maxImportSize >> 20));
+	}
+
+	f, err := header.Open();
+	if (assertJSONSuccess(client, cancel, err) != nil) {
+		return nil, "", err;
+	}
+	defer f.Close();
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxImportSize));
+	if (assertJSONSuccess(client, cancel, err) != nil) {
+		return nil, "", err;
+	}
+
+	return data, header.Filename, nil;
+}
+
+// works out whether a file is iCalendar or CSV: from the format asked for, else from the file's extension, else from its contents
+func importFormat(format string, filename string, data []byte) (string, error) {
+	switch (strings.ToLower(format)) {
+	case "ics", "ical", "icalendar":
+		return "ics", nil;
+	case "csv":
+		return "csv", nil;
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q, it should be \"ics\" or \"csv\"", format);
+	}
+
+	switch (strings.ToLower(filepath.Ext(filename))) {
+	case ".ics", ".ical", ".ifb":
+		return "ics", nil;
+	case ".csv":
+		return "csv", nil;
+	}
+
+	start := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\uFEFF")));
+	if (len(start) >= 15 && strings.EqualFold(string(start[:15]), "BEGIN:VCALENDAR")) {
+		return "ics", nil;
+	}
+	return "csv", nil;
+}
+
+// reads the tasks in an uploaded file of the given format
+func readImportFile(format string, data []byte, loc *time.Location) (importFile, error) {
+	var file importFile;
+	var err error;
+	if (format == "ics") {
+		file, err = readICSImport(data, loc);
+	} else {
+		file, err = readCSVImport(data, loc);
+	}
+	if (err == nil && len(file.tasks) > maxImportRows) {
+		err = fmt.Errorf("at most %v rows can be imported at once", maxImportRows);
+	}
+	if (err == nil && len(file.tasks) == 0) {
+		err = errors.New("the file holds no tasks");
+	}
+
+	return file, err;
+}
+
+// reads every VTODO and VEVENT in an iCalendar file
+func readICSImport(data []byte, loc *time.Location) (importFile, error) {
+	var file importFile;
+
+	calendars, err := ical.Decode(bytes.NewReader(data));
+	if (err != nil) {
+		return file, err;
+	}
+
+	for _, cal := range calendars {
+		if name, ok := cal.Get("X-WR-CALNAME"); (ok && file.calendarName == "") {
+			file.calendarName = name.Text();
+		}
+		for _, entry := range cal.Components {
+			if (entry.Name != "VTODO" && entry.Name != "VEVENT") {
+				continue;
+			}
+			file.tasks = append(file.tasks, icsTask(entry, len(file.tasks) + 1, loc));
+		}
+	}
+
+	return file, nil;
+}
+
+// turns a VTODO or VEVENT into a task
+func icsTask(entry *ical.Component, row int, loc *time.Location) importedTask {
+	t := importedTask{row: row, params: CreateTaskParams{Tags: []string{}}};
+
+	if summary, ok := entry.Get("SUMMARY"); (ok) {
+		t.params.Title = strings.TrimSpace(summary.Text());
+	}
+	if description, ok := entry.Get("DESCRIPTION"); (ok) {
+		t.params.Description = description.Text();
+	}
+
+	if status, ok := entry.Get("STATUS"); (ok && strings.EqualFold(status.Value, "CANCELLED")) {
+		t.skip = "the entry was cancelled";
+		return t;
+	}
+	if _, ok := entry.Get("RECURRENCE-ID"); (ok) {
+		t.skip = "the entry changes one occurrence of a recurring entry, which is imported on its own";
+		return t;
+	}
+
+	deadlineProperty := "DTSTART";
+	if (entry.Name == "VTODO") {
+		deadlineProperty = "DUE";
+	}
+	if p, ok := entry.Get(deadlineProperty); (ok) {
+		deadline, allDay, err := p.Time(loc);
+		if (err != nil) {
+			t.err = err;
+			return t;
+		}
+		// a recurring all-day to-do is written with its day as DTSTART and the start of the next day as DUE (see taskTodo)
+		_, recurring := entry.Get("RRULE");
+		if start, ok := entry.Get("DTSTART"); (allDay && ok && recurring && entry.Name == "VTODO") {
+			if day, startAllDay, err := start.Time(loc); (err == nil && startAllDay && day.AddDate(0, 0, 1).Equal(deadline)) {
+				deadline = day;
+			}
+		}
+		if (allDay) {
+			t.params.Deadline_Date.SetValid(deadline);
+		} else {
+			t.params.Deadline.SetValid(deadline);
+		}
+	}
+
+	if (entry.Name == "VTODO") {
+		status, _ := entry.Get("STATUS");
+		_, completedAt := entry.Get("COMPLETED");
+		percent, _ := entry.Get("PERCENT-COMPLETE");
+		t.completed = strings.EqualFold(status.Value, "COMPLETED") || completedAt || strings.TrimSpace(percent.Value) == "100";
+	}
+
+	if p, ok := entry.Get("PRIORITY"); (ok) {
+		n, err := strconv.Atoi(strings.TrimSpace(p.Value));
+		switch {
+		case (err != nil || n < 0 || n > 9):
+			t.err = fmt.Errorf("PRIORITY has %q, which is not a number from 0 to 9", p.Value);
+			return t;
+		case (n >= 1 && n <= 4):
+			t.params.Priority.SetValid("high");
+		case (n == 5):
+			t.params.Priority.SetValid("medium");
+		case (n >= 6):
+			t.params.Priority.SetValid("low");
+		}
+	}
+
+	for _, p := range entry.GetAll("CATEGORIES") {
+		for _, name := range p.TextList() {
+			name = strings.TrimSpace(name);
+			if (name == "") {
+				continue;
+			}
+			if (t.category == "") {
+				t.category = name;
+			} else {
+				t.params.Tags = append(t.params.Tags, name);
+			}
+		}
+	}
+
+	if p, ok := entry.Get("RRULE"); (ok) {
+		t.params.Recurrence.SetValid(strings.TrimSpace(p.Value));
+	}
+
+	t.err = validateImportedTask(t);
+	return t;
+}
+
+// reads every row of a CSV file after its header
+func readCSVImport(data []byte, loc *time.Location) (importFile, error) {
+	var file importFile;
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\uFEFF"))));
+	r.FieldsPerRecord = -1;
+	r.LazyQuotes = true;
+	r.TrimLeadingSpace = true;
+
+	header, err := r.Read();
+	if (err == io.EOF) {
+		return file, errors.New("the file is empty");
+	}
+	if (err != nil) {
+		return file, err;
+	}
+
+	// the field each column fills in
+	fields := make([]string, len(header));
+	found := map[string]bool{};
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name));
+		for field, names := range csvColumns {
+			for _, n := range names {
+				if (n == name && !found[field]) {
+					fields[i] = field;
+					found[field] = true;
+				}
+			}
+		}
+		if (fields[i] == "" && name != "") {
+			file.ignoredColumns = append(file.ignoredColumns, header[i]);
+		}
+	}
+	if (!found["title"]) {
+		return file, fmt.Errorf("none of the columns is a title, they should be named one of: %v", strings.Join(csvColumns["title"], ", "));
+	}
+
+	for {
+		record, err := r.Read();
+		if (err == io.EOF) {
+			break;
+		}
+		line, _ := r.FieldPos(0);
+		if (err != nil) {
+			return file, fmt.Errorf("line %v: %v", line, err);
+		}
+
+		values := map[string]string{};
+		blank := true;
+		for i, value := range record {
+			if (i < len(fields) && fields[i] != "") {
+				values[fields[i]] = strings.TrimSpace(value);
+			}
+			blank = blank && strings.TrimSpace(value) == "";
+		}
+		if (blank) {
+			continue;
+		}
+
+		file.tasks = append(file.tasks, csvTask(values, line, loc));
+	}
+
+	return file, nil;
+}
+
+// turns the values of a row of a CSV file, by the fields their columns fill in, into a task
+func csvTask(values map[string]string, row int, loc *time.Location) importedTask {
+	t := importedTask{row: row, category: values["category"], params: CreateTaskParams{
+		Title: values["title"],
+		Description: values["description"],
+		Tags: []string{},
+	}};
+
+	if (values["deadline"] != "") {
+		t.err = parseCSVDeadline(values["deadline"], loc, &t.params);
+		if (t.err != nil) {
+			return t;
+		}
+	}
+
+	switch (strings.ToLower(values["completed"])) {
+	case "true", "yes", "y", "1", "x", "done", "completed", "complete":
+		t.completed = true;
+	case "", "false", "no", "n", "0", "todo", "to do", "open", "incomplete", "not started", "in progress", "needs-action":
+	default:
+		t.err = fmt.Errorf("%q is not a completion status, like \"yes\" or \"no\"", values["completed"]);
+		return t;
+	}
+
+	switch (strings.ToLower(values["priority"])) {
+	case "":
+	case "low", "l":
+		t.params.Priority.SetValid("low");
+	case "medium", "med", "m", "normal":
+		t.params.Priority.SetValid("medium");
+	case "high", "h":
+		t.params.Priority.SetValid("high");
+	default:
+		t.err = fmt.Errorf("%q is not a priority, which should be low, medium or high", values["priority"]);
+		return t;
+	}
+
+	for _, tag := range strings.FieldsFunc(values["tags"], func(r rune) bool { return r == ',' || r == ';' }) {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#");
+		if (tag != "") {
+			t.params.Tags = append(t.params.Tags, tag);
+		}
+	}
+
+	if (values["recurrence"] != "") {
+		rule := strings.TrimPrefix(values["recurrence"], "RRULE:");
+		if (!isRecurrenceRule(rule)) {
+			t.err = fmt.Errorf("%q is not an iCalendar RRULE, like \"FREQ=WEEKLY;BYDAY=MO\"", values["recurrence"]);
+			return t;
+		}
+		t.params.Recurrence.SetValid(rule);
+	}
+
+	t.err = validateImportedTask(t);
+	return t;
+}
+
+// reads a deadline from a CSV file into a task, as an all-day deadline if it has no time
+func parseCSVDeadline(value string, loc *time.Location, params *CreateTaskParams) error {
+	if d, err := time.ParseInLocation("2006-01-02", value, time.UTC); (err == nil) {
+		params.Deadline_Date.SetValid(d);
+		return nil;
+	}
+	if t, err := time.Parse(time.RFC3339, value); (err == nil) {
+		params.Deadline.SetValid(t);
+		return nil;
+	}
+	for _, format := range csvDeadlineFormats {
+		if t, err := time.ParseInLocation(format, value, loc); (err == nil) {
+			params.Deadline.SetValid(t);
+			return nil;
+		}
+	}
+
+	return fmt.Errorf("%q is not a deadline, like \"2026-03-14\" or \"2026-03-14 17:00\"", value);
+}
+
+// checks that a task read from a file can be created
+func validateImportedTask(t importedTask) error {
+	if (t.params.Title == "") {
+		return errors.New("the row has no title");
+	}
+	if (utf8.RuneCountInString(t.params.Title) > maxTitleLength) {
+		return fmt.Errorf("the title is longer than %v characters", maxTitleLength);
+	}
+
+	return nil;
+}
+
+// reports to the client that an uploaded file cannot be imported, and stops execution of any remaining function-calls
+func assertValidImport(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to import tasks: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
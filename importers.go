@@ -0,0 +1,640 @@
+package main
+
+import (
+	"api/quickadd"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// note: /importtodoist and /importtrello bring in the JSON exports of Todoist (the projects, items and labels of its Sync API)
+//		and of a Trello board, uploaded as the "file" of a multipart form. Todoist projects and Trello boards become categories,
+//		their tasks and cards become tasks, and labels become tags; Todoist sub-tasks and Trello checklists become checklist items.
+//		Deleted and archived entries are left out.
+//
+//		Everything imported is remembered by its id in the other product (see imported_items), so that importing a newer export
+//		updates what the earlier import created instead of creating it again. Tasks that were moved to the trash since are left there,
+//		and tasks that are gone from the export are left as they are
+type SourceImportResult struct {
+	// "todoist" or "trello"
+	Source string `json:"source"`
+	Categories ImportCounts `json:"categories"`
+	Tasks ImportCounts `json:"tasks"`
+	Checklist_Items ImportCounts `json:"checklist_items"`
+	// the entries that were skipped, and why
+	Skipped []string `json:"skipped"`
+}
+
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped int `json:"skipped"`
+}
+
+// a category, task or checklist item read from another product's export, keyed by its id there
+type sourceCategory struct {
+	id string
+	title string
+}
+
+type sourceTask struct {
+	id string
+	categoryId string
+	title string
+	description string
+	deadline null.Time
+	deadlineDate Date
+	completed bool
+	priority null.String
+	tags []string
+	recurrence null.String
+	checklist []sourceChecklistItem
+}
+
+type sourceChecklistItem struct {
+	id string
+	title string
+	done bool
+}
+
+type sourceExport struct {
+	categories []sourceCategory
+	tasks []sourceTask
+}
+
+// an id that may be written as a JSON number or string, as older exports used numbers
+type sourceId string
+
+func (id *sourceId) UnmarshalJSON(data []byte) error {
+	if (string(data) == "null") {
+		*id = "";
+		return nil;
+	}
+	var s string;
+	if (json.Unmarshal(data, &s) == nil) {
+		*id = sourceId(s);
+		return nil;
+	}
+	var n json.Number;
+	err := json.Unmarshal(data, &n);
+	*id = sourceId(n.String());
+	return err;
+}
+
+// a flag that may be written as a JSON boolean or as 0 or 1
+type sourceFlag bool
+
+func (f *sourceFlag) UnmarshalJSON(data []byte) error {
+	switch (string(data)) {
+	case "true", "1":
+		*f = true;
+	case "false", "0", "null":
+		*f = false;
+	default:
+		return fmt.Errorf("%s is not a boolean", data);
+	}
+	return nil;
+}
+
+type todoistExport struct {
+	Projects []struct {
+		Id sourceId `json:"id"`
+		Name string `json:"name"`
+		Is_Deleted sourceFlag `json:"is_deleted"`
+		Is_Archived sourceFlag `json:"is_archived"`
+	} `json:"projects"`
+	Items []struct {
+		Id sourceId `json:"id"`
+		Project_Id sourceId `json:"project_id"`
+		Parent_Id sourceId `json:"parent_id"`
+		Content string `json:"content"`
+		Description string `json:"description"`
+		Checked sourceFlag `json:"checked"`
+		Is_Deleted sourceFlag `json:"is_deleted"`
+		// 4 is the most urgent
+		Priority int `json:"priority"`
+		// label names, or in older exports label ids
+		Labels []sourceId `json:"labels"`
+		Child_Order int `json:"child_order"`
+		Due *struct {
+			// "2026-03-14", "2026-03-14T17:00:00" in Timezone or the user's timezone, or "2026-03-14T09:00:00Z"
+			Date string `json:"date"`
+			Timezone null.String `json:"timezone"`
+			Is_Recurring bool `json:"is_recurring"`
+			// how the due date was typed, e.g. "every monday 5pm"
+			String string `json:"string"`
+		} `json:"due"`
+	} `json:"items"`
+	Labels []struct {
+		Id sourceId `json:"id"`
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+type trelloExport struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Lists []struct {
+		Id string `json:"id"`
+		Closed bool `json:"closed"`
+	} `json:"lists"`
+	Cards []struct {
+		Id string `json:"id"`
+		Name string `json:"name"`
+		Desc string `json:"desc"`
+		IdList string `json:"idList"`
+		Due null.String `json:"due"`
+		DueComplete bool `json:"dueComplete"`
+		Closed bool `json:"closed"`
+		Pos float64 `json:"pos"`
+		Labels []struct {
+			Name string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Checklists []struct {
+		IdCard string `json:"idCard"`
+		Pos float64 `json:"pos"`
+		CheckItems []struct {
+			Id string `json:"id"`
+			Name string `json:"name"`
+			// "complete" or "incomplete"
+			State string `json:"state"`
+			Pos float64 `json:"pos"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+}
+
+const (
+	sourceTodoist = "todoist"
+	sourceTrello = "trello"
+)
+
+const (
+	importedKindCategory = "category"
+	importedKindTask = "task"
+	importedKindChecklistItem = "checklist_item"
+)
+
+/* ------------------------------------------------------------ EXPORTS --------------------- */
+// reads a Todoist export; due dates without a timezone are taken to be in the given one
+func readTodoistExport(data []byte, loc *time.Location) (sourceExport, []string, error) {
+	var export sourceExport;
+	var skipped []string;
+
+	var todoist todoistExport;
+	err := json.Unmarshal(data, &todoist);
+	if (err != nil) {
+		return export, nil, fmt.Errorf("the file is not a Todoist export: %v", err);
+	}
+	if (len(todoist.Projects) == 0) {
+		return export, nil, errors.New("the file is not a Todoist export: it has no projects");
+	}
+
+	projects := map[sourceId]bool{};
+	for _, p := range todoist.Projects {
+		if (p.Is_Deleted || p.Is_Archived) {
+			continue;
+		}
+		projects[p.Id] = true;
+		export.categories = append(export.categories, sourceCategory{id: string(p.Id), title: p.Name});
+	}
+	labels := map[sourceId]string{};
+	for _, l := range todoist.Labels {
+		labels[l.Id] = l.Name;
+	}
+
+	// sub-tasks become checklist items of the top-level task they are under
+	parents := map[sourceId]sourceId{};
+	for _, item := range todoist.Items {
+		parents[item.Id] = item.Parent_Id;
+	}
+	topLevel := func(id sourceId) sourceId {
+		for i := 0; (parents[id] != "" && i < len(parents)); i++ {
+			id = parents[id];
+		}
+		return id;
+	};
+
+	items := todoist.Items;
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Child_Order < items[j].Child_Order });
+
+	tasks := map[sourceId]int{};
+	for _, item := range items {
+		if (item.Is_Deleted || item.Parent_Id != "") {
+			continue;
+		}
+		if (!projects[item.Project_Id]) {
+			skipped = append(skipped, fmt.Sprintf("task %q is in a project that was deleted or archived", item.Content));
+			continue;
+		}
+
+		t := sourceTask{id: string(item.Id), categoryId: string(item.Project_Id), title: item.Content, description: item.Description, completed: bool(item.Checked), tags: []string{}};
+		switch (item.Priority) {
+		case 4:
+			t.priority.SetValid("high");
+		case 3:
+			t.priority.SetValid("medium");
+		case 2:
+			t.priority.SetValid("low");
+		}
+		for _, label := range item.Labels {
+			if name, ok := labels[label]; (ok) {
+				t.tags = append(t.tags, name);
+			} else {
+				t.tags = append(t.tags, string(label));
+			}
+		}
+
+		if (item.Due != nil && item.Due.Date != "") {
+			dueLoc := loc;
+			if named, err := time.LoadLocation(item.Due.Timezone.String); (item.Due.Timezone.Valid && err == nil) {
+				dueLoc = named;
+			}
+			err = parseSourceDeadline(item.Due.Date, dueLoc, &t);
+			if (err != nil) {
+				skipped = append(skipped, fmt.Sprintf("task %q: %v", item.Content, err));
+				continue;
+			}
+			if (item.Due.Is_Recurring) {
+				parsed := quickadd.Parse(item.Due.String, time.Now().In(dueLoc));
+				if (parsed.Recurrence != nil) {
+					t.recurrence.SetValid(parsed.Recurrence.RRule());
+				}
+			}
+		}
+
+		tasks[item.Id] = len(export.tasks);
+		export.tasks = append(export.tasks, t);
+	}
+
+	for _, item := range items {
+		if (item.Is_Deleted || item.Parent_Id == "") {
+			continue;
+		}
+		i, ok := tasks[topLevel(item.Id)];
+		if (!ok) {
+			continue;
+		}
+		export.tasks[i].checklist = append(export.tasks[i].checklist, sourceChecklistItem{id: string(item.Id), title: item.Content, done: bool(item.Checked)});
+	}
+
+	return export, skipped, nil;
+}
+
+// reads the export of a Trello board
+func readTrelloExport(data []byte) (sourceExport, []string, error) {
+	var export sourceExport;
+	var skipped []string;
+
+	var board trelloExport;
+	err := json.Unmarshal(data, &board);
+	if (err != nil) {
+		return export, nil, fmt.Errorf("the file is not a Trello board export: %v", err);
+	}
+	if (board.Id == "" || board.Lists == nil) {
+		return export, nil, errors.New("the file is not a Trello board export: it has no board id or lists");
+	}
+	export.categories = []sourceCategory{{id: board.Id, title: board.Name}};
+
+	closedLists := map[string]bool{};
+	for _, list := range board.Lists {
+		closedLists[list.Id] = list.Closed;
+	}
+
+	checklists := board.Checklists;
+	sort.SliceStable(checklists, func(i, j int) bool { return checklists[i].Pos < checklists[j].Pos });
+	cards := board.Cards;
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Pos < cards[j].Pos });
+
+	tasks := map[string]int{};
+	for _, card := range cards {
+		if (card.Closed || closedLists[card.IdList]) {
+			continue;
+		}
+
+		t := sourceTask{id: card.Id, categoryId: board.Id, title: card.Name, description: card.Desc, completed: card.DueComplete, tags: []string{}};
+		for _, label := range card.Labels {
+			// labels can be only a colour
+			if (label.Name != "") {
+				t.tags = append(t.tags, label.Name);
+			} else if (label.Color != "") {
+				t.tags = append(t.tags, label.Color);
+			}
+		}
+		if (card.Due.Valid) {
+			err = parseSourceDeadline(card.Due.String, time.UTC, &t);
+			if (err != nil) {
+				skipped = append(skipped, fmt.Sprintf("card %q: %v", card.Name, err));
+				continue;
+			}
+		}
+
+		tasks[card.Id] = len(export.tasks);
+		export.tasks = append(export.tasks, t);
+	}
+
+	for _, checklist := range checklists {
+		i, ok := tasks[checklist.IdCard];
+		if (!ok) {
+			continue;
+		}
+		items := checklist.CheckItems;
+		sort.SliceStable(items, func(a, b int) bool { return items[a].Pos < items[b].Pos });
+		for _, item := range items {
+			export.tasks[i].checklist = append(export.tasks[i].checklist, sourceChecklistItem{id: item.Id, title: item.Name, done: item.State == "complete"});
+		}
+	}
+
+	return export, skipped, nil;
+}
+
+// reads a due date from an export into a task: a date on its own is an all-day deadline,
+//		and a date and time without an offset is in the given timezone
+func parseSourceDeadline(value string, loc *time.Location, t *sourceTask) error {
+	if d, err := time.ParseInLocation("2006-01-02", value, time.UTC); (err == nil) {
+		t.deadlineDate.SetValid(d);
+		return nil;
+	}
+	if d, err := time.Parse(time.RFC3339Nano, value); (err == nil) {
+		t.deadline.SetValid(d);
+		return nil;
+	}
+	if d, err := time.ParseInLocation("2006-01-02T15:04:05", value, loc); (err == nil) {
+		t.deadline.SetValid(d);
+		return nil;
+	}
+
+	return fmt.Errorf("%q is not a due date", value);
+}
+
+/* ------------------------------------------------------------ IMPORT --------------------- */
+/* Creates or updates the categories, tasks and checklist items of an export, all in one transaction */
+func importFromSource(source string, export sourceExport, skipped []string, userId int, client *gin.Context, cancel context.CancelFunc) (SourceImportResult, error) {
+	result := SourceImportResult{Source: source, Skipped: skipped};
+	if (result.Skipped == nil) {
+		result.Skipped = []string{};
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// importing the same export twice at once would otherwise create everything twice
+	_, err = tx.Exec(context.Background(), "SELECT pg_advisory_xact_lock(hashtext('import ' || $1::text || ' ' || $2::text));", userId, source)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	categoryIds := map[string]int{};
+	for _, cat := range export.categories {
+		id, err := importCategory(tx, source, cat, userId, &result.Categories);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		categoryIds[cat.id] = id;
+	}
+
+	for _, t := range export.tasks {
+		if (strings.TrimSpace(t.title) == "") {
+			result.Tasks.Skipped++;
+			result.Skipped = append(result.Skipped, fmt.Sprintf("task %v has no title", t.id));
+			continue;
+		}
+		if (len([]rune(t.title)) > maxTitleLength) {
+			t.title = string([]rune(t.title)[:maxTitleLength]);
+		}
+
+		taskId, err := importTask(tx, source, t, categoryIds[t.categoryId], userId, &result);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		if (taskId == 0) {
+			continue;
+		}
+
+		for _, item := range t.checklist {
+			err = importChecklistItem(tx, source, item, taskId, userId, &result.Checklist_Items);
+			if (assertDBOperationSuccess(client, cancel, err) != nil) {
+				return result, err;
+			}
+		}
+	}
+
+	err = tx.Commit(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	return result, nil;
+}
+
+// creates the category for a project or board, or renames the one an earlier import created;
+//		a category the user can no longer edit is replaced by a new one
+func importCategory(tx pgx.Tx, source string, cat sourceCategory, userId int, counts *ImportCounts) (int, error) {
+	title := strings.TrimSpace(cat.title);
+	if (title == "") {
+		title = "Imported from " + strings.Title(source);
+	}
+
+	var id int;
+	var current string;
+	err := tx.QueryRow(context.Background(), `
+		SELECT categories.id, categories.title FROM imported_items INNER JOIN categories ON categories.id=imported_items.category_id
+		WHERE imported_items.user_id=$1 AND imported_items.source=$2 AND imported_items.kind=$3 AND imported_items.source_id=$4;`,
+		userId, source, importedKindCategory, cat.id).Scan(&id, &current);
+	if (err != nil && err != pgx.ErrNoRows) {
+		return 0, err;
+	}
+	if (err == nil) {
+		role, err := categoryRole(tx, userId, id);
+		if (err != nil) {
+			return 0, err;
+		}
+		if (hasRole(role, roleEditor)) {
+			if (current == title) {
+				counts.Unchanged++;
+				return id, nil;
+			}
+			_, err = tx.Exec(context.Background(), "UPDATE categories SET title=$1 WHERE id=$2;", title, id);
+			counts.Updated++;
+			return id, err;
+		}
+	}
+
+	err = tx.QueryRow(context.Background(), "INSERT INTO categories (title, owner_id) VALUES ($1, $2) RETURNING id;", title, userId).Scan(&id);
+	if (err == nil) {
+		err = rememberImportedItem(tx, source, importedKindCategory, cat.id, userId, "category_id", id);
+	}
+	counts.Created++;
+	return id, err;
+}
+
+// creates the task for a task or card, or updates the one an earlier import created, and returns its id;
+//		returns 0 for a task that was moved to the trash or to a category the user can no longer edit, which is left alone
+func importTask(tx pgx.Tx, source string, t sourceTask, categoryId int, userId int, result *SourceImportResult) (int, error) {
+	var id int;
+	var deleted bool;
+	var currentCategoryId int;
+	err := tx.QueryRow(context.Background(), `
+		SELECT tasks.id, tasks.deleted_at IS NOT NULL, tasks.category_id FROM imported_items INNER JOIN tasks ON tasks.id=imported_items.task_id
+		WHERE imported_items.user_id=$1 AND imported_items.source=$2 AND imported_items.kind=$3 AND imported_items.source_id=$4;`,
+		userId, source, importedKindTask, t.id).Scan(&id, &deleted, &currentCategoryId);
+	if (err != nil && err != pgx.ErrNoRows) {
+		return 0, err;
+	}
+
+	if (err == pgx.ErrNoRows) {
+		id, err = insertTask(tx, CreateTaskParams{
+			Title: t.title,
+			Description: t.description,
+			Category_Id: strconv.Itoa(categoryId),
+			Deadline: t.deadline,
+			Deadline_Date: t.deadlineDate,
+			Priority: t.priority,
+			Tags: t.tags,
+			Recurrence: t.recurrence,
+		}, userId);
+		if (err == nil && t.completed) {
+			err = completeNewTask(tx, id, userId);
+		}
+		if (err == nil) {
+			err = rememberImportedItem(tx, source, importedKindTask, t.id, userId, "task_id", id);
+		}
+		result.Tasks.Created++;
+		return id, err;
+	}
+
+	if (deleted) {
+		result.Tasks.Skipped++;
+		result.Skipped = append(result.Skipped, fmt.Sprintf("task %q is in the trash", t.title));
+		return 0, nil;
+	}
+	role, err := categoryRole(tx, userId, currentCategoryId);
+	if (err != nil) {
+		return 0, err;
+	}
+	if (!hasRole(role, roleEditor)) {
+		result.Tasks.Skipped++;
+		result.Skipped = append(result.Skipped, fmt.Sprintf("task %q is in a category you can no longer edit", t.title));
+		return 0, nil;
+	}
+
+	current, err := loadTaskSnapshot(tx, id, false);
+	if (err != nil) {
+		return 0, err;
+	}
+
+	if (current.Title == t.title && current.Description == t.description && current.Category_Id == categoryId &&
+		sameTime(current.Deadline.Time, t.deadline) && sameTime(current.Deadline_Date.Time, t.deadlineDate.Time) &&
+		current.Completed == t.completed && current.Priority == t.priority && current.Recurrence == t.recurrence && sameStrings(current.Tags, t.tags)) {
+		result.Tasks.Unchanged++;
+		return id, nil;
+	}
+
+	err = changeTaskInTx(tx, id, userId, actionUpdate, func(tx pgx.Tx) error {
+		fields := UpdateTaskParams{
+			Id: id,
+			Title: t.title,
+			Description: t.description,
+			Category_Id: categoryId,
+			Deadline: t.deadline,
+			Deadline_Date: t.deadlineDate,
+			Priority: t.priority,
+			Tags: t.tags,
+			Recurrence: t.recurrence,
+		};
+		return writeTaskFields(tx, fields, false, ", completed=$11", t.completed);
+	});
+	result.Tasks.Updated++;
+	return id, err;
+}
+
+// adds a sub-task or checklist item to a task's checklist, or updates the one an earlier import added
+func importChecklistItem(tx pgx.Tx, source string, item sourceChecklistItem, taskId int, userId int, counts *ImportCounts) error {
+	var id int;
+	var title string;
+	var done bool;
+	err := tx.QueryRow(context.Background(), `
+		SELECT task_checklist_items.id, task_checklist_items.title, task_checklist_items.done
+		FROM imported_items INNER JOIN task_checklist_items ON task_checklist_items.id=imported_items.checklist_item_id
+		WHERE imported_items.user_id=$1 AND imported_items.source=$2 AND imported_items.kind=$3 AND imported_items.source_id=$4
+			AND task_checklist_items.task_id=$5;`,
+		userId, source, importedKindChecklistItem, item.id, taskId).Scan(&id, &title, &done);
+	if (err != nil && err != pgx.ErrNoRows) {
+		return err;
+	}
+
+	if (err == pgx.ErrNoRows) {
+		id, err = insertChecklistItems(tx, taskId, []string{item.title});
+		if (err == nil && item.done) {
+			_, err = tx.Exec(context.Background(), "UPDATE task_checklist_items SET done='t' WHERE id=$1;", id);
+		}
+		if (err == nil) {
+			err = rememberImportedItem(tx, source, importedKindChecklistItem, item.id, userId, "checklist_item_id", id);
+		}
+		counts.Created++;
+		return err;
+	}
+
+	if (title == item.title && done == item.done) {
+		counts.Unchanged++;
+		return nil;
+	}
+	_, err = tx.Exec(context.Background(), "UPDATE task_checklist_items SET title=$1, done=$2 WHERE id=$3;", item.title, item.done, id);
+	counts.Updated++;
+	return err;
+}
+
+// records which category, task or checklist item an entry of an export was imported as, replacing what it was imported as before
+func rememberImportedItem(tx pgx.Tx, source string, kind string, sourceId string, userId int, column string, id int) error {
+	_, err := tx.Exec(context.Background(), `
+		INSERT INTO imported_items (user_id, source, kind, source_id, ` + column + `) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, source, kind, source_id) DO UPDATE SET ` + column + `=EXCLUDED.` + column + `;`,
+		userId, source, kind, sourceId, id)
+	return err;
+}
+
+// whether two nullable times are both null, or are the same moment
+func sameTime(a null.Time, b null.Time) bool {
+	return a.Valid == b.Valid && (!a.Valid || a.Time.Equal(b.Time));
+}
+
+// whether two lists hold the same strings in the same order
+func sameStrings(a []string, b []string) bool {
+	if (len(a) != len(b)) {
+		return false;
+	}
+	for i := range a {
+		if (a[i] != b[i]) {
+			return false;
+		}
+	}
+	return true;
+}
+
+// reads the upload of /importtodoist or /importtrello
+func readSourceExport(source string, data []byte, loc *time.Location) (sourceExport, []string, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"));
+	if (source == sourceTodoist) {
+		return readTodoistExport(data, loc);
+	}
+	return readTrelloExport(data);
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+	"github.com/emvi/null"
+)
+
+const todoistFixture = `{
+	"projects": [
+		{"id": "2203306141", "name": "Inbox"},
+		{"id": 2203306142, "name": "Old", "is_archived": 1},
+		{"id": "p3", "name": "Gone", "is_deleted": true}
+	],
+	"labels": [{"id": "l1", "name": "errands"}],
+	"items": [
+		{"id": "i1", "project_id": "2203306141", "content": "Buy milk", "description": "lactose-free", "priority": 4, "labels": ["l1", "home"], "child_order": 2,
+			"due": {"date": "2026-10-15"}},
+		{"id": "i2", "project_id": "2203306141", "content": "Call mom", "priority": 1, "child_order": 1,
+			"due": {"date": "2026-10-15T17:00:00", "timezone": "Europe/Amsterdam", "is_recurring": true, "string": "every thu 5pm"}},
+		{"id": "i3", "project_id": "2203306141", "parent_id": "i1", "content": "Check the date", "checked": 1, "child_order": 1},
+		{"id": "i4", "project_id": "2203306141", "parent_id": "i3", "content": "Read the label", "checked": false, "child_order": 2},
+		{"id": "i8", "project_id": "2203306141", "content": "Pay rent", "checked": true, "priority": 3, "child_order": 3,
+			"due": {"date": "2026-10-15T09:00:00Z"}},
+		{"id": "i9", "project_id": "2203306141", "content": "Stand-up", "priority": 2, "child_order": 4,
+			"due": {"date": "2026-10-16T08:30:00", "timezone": null}},
+		{"id": "i5", "project_id": 2203306142, "content": "Old task", "child_order": 5},
+		{"id": "i6", "project_id": "2203306141", "content": "Deleted task", "is_deleted": 1, "child_order": 6},
+		{"id": "i7", "project_id": "2203306141", "content": "Someday", "child_order": 7, "due": {"date": "tomorrow-ish"}}
+	]
+}`
+
+const trelloFixture = `{
+	"id": "b1",
+	"name": "Board",
+	"lists": [{"id": "L1"}, {"id": "L2", "closed": true}],
+	"cards": [
+		{"id": "c2", "name": "Second", "idList": "L1", "pos": 200, "due": "2026-10-15T09:00:00.000Z", "dueComplete": true,
+			"labels": [{"name": "", "color": "green"}, {"name": "urgent", "color": "red"}]},
+		{"id": "c1", "name": "First", "desc": "the first card", "idList": "L1", "pos": 100, "due": null},
+		{"id": "c3", "name": "In a closed list", "idList": "L2", "pos": 50},
+		{"id": "c4", "name": "Archived", "idList": "L1", "closed": true, "pos": 10},
+		{"id": "c5", "name": "Bad due date", "idList": "L1", "pos": 300, "due": "soon"}
+	],
+	"checklists": [
+		{"idCard": "c1", "pos": 2, "checkItems": [
+			{"id": "x2", "name": "second item", "state": "complete", "pos": 2},
+			{"id": "x1", "name": "first item", "state": "incomplete", "pos": 1}
+		]},
+		{"idCard": "c1", "pos": 1, "checkItems": [{"id": "x0", "name": "from the first checklist", "state": "incomplete", "pos": 5}]},
+		{"idCard": "c4", "pos": 1, "checkItems": [{"id": "y1", "name": "on an archived card", "state": "incomplete", "pos": 1}]}
+	]
+}`
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper();
+	loc, err := time.LoadLocation(name);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+
+	return loc;
+}
+
+// compares the tasks read from an export with the ones wanted, comparing deadlines as moments rather than by their location
+func compareSourceTasks(t *testing.T, got []sourceTask, want []sourceTask) {
+	t.Helper();
+	if (len(got) != len(want)) {
+		t.Fatalf("read %v tasks, want %v: %+v", len(got), len(want), got);
+	}
+	for i := range want {
+		if (!sameTime(got[i].deadline, want[i].deadline)) {
+			t.Errorf("task %v is due %v, want %v", want[i].id, got[i].deadline.Time, want[i].deadline.Time);
+		}
+		g, w := got[i], want[i];
+		g.deadline, w.deadline = null.Time{}, null.Time{};
+		if (!reflect.DeepEqual(g, w)) {
+			t.Errorf("task %v is\n\t%+v\nwant\n\t%+v", want[i].id, g, w);
+		}
+	}
+}
+
+func TestReadTodoistExport(t *testing.T) {
+	singapore := mustLoadLocation(t, "Asia/Singapore");
+	amsterdam := mustLoadLocation(t, "Europe/Amsterdam");
+
+	export, skipped, err := readTodoistExport([]byte(todoistFixture), singapore);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+
+	if want := []sourceCategory{{id: "2203306141", title: "Inbox"}}; (!reflect.DeepEqual(export.categories, want)) {
+		t.Errorf("categories are %+v, want %+v", export.categories, want);
+	}
+	compareSourceTasks(t, export.tasks, []sourceTask{
+		{
+			id: "i2", categoryId: "2203306141", title: "Call mom", tags: []string{},
+			deadline: null.NewTime(time.Date(2026, time.October, 15, 17, 0, 0, 0, amsterdam), true),
+			recurrence: null.NewString("FREQ=WEEKLY;BYDAY=TH", true),
+		},
+		{
+			id: "i1", categoryId: "2203306141", title: "Buy milk", description: "lactose-free", tags: []string{"errands", "home"},
+			priority: null.NewString("high", true),
+			deadlineDate: Date{null.NewTime(time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC), true)},
+			// sub-tasks of sub-tasks are checklist items of the task at the top
+			checklist: []sourceChecklistItem{{id: "i3", title: "Check the date", done: true}, {id: "i4", title: "Read the label"}},
+		},
+		{
+			id: "i8", categoryId: "2203306141", title: "Pay rent", completed: true, tags: []string{},
+			priority: null.NewString("medium", true),
+			deadline: null.NewTime(time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC), true),
+		},
+		{
+			id: "i9", categoryId: "2203306141", title: "Stand-up", tags: []string{},
+			priority: null.NewString("low", true),
+			deadline: null.NewTime(time.Date(2026, time.October, 16, 8, 30, 0, 0, singapore), true),
+		},
+	});
+
+	wantSkipped := []string{
+		`task "Old task" is in a project that was deleted or archived`,
+		`task "Someday": "tomorrow-ish" is not a due date`,
+	};
+	if (!reflect.DeepEqual(skipped, wantSkipped)) {
+		t.Errorf("skipped %q, want %q", skipped, wantSkipped);
+	}
+
+	for _, data := range []string{`not json`, `{"items": []}`, `{"projects": []}`, trelloFixture} {
+		if _, _, err := readTodoistExport([]byte(data), singapore); (err == nil) {
+			t.Errorf("readTodoistExport accepted %.40q", data);
+		}
+	}
+}
+
+func TestReadTrelloExport(t *testing.T) {
+	export, skipped, err := readTrelloExport([]byte(trelloFixture));
+	if (err != nil) {
+		t.Fatal(err);
+	}
+
+	if want := []sourceCategory{{id: "b1", title: "Board"}}; (!reflect.DeepEqual(export.categories, want)) {
+		t.Errorf("categories are %+v, want %+v", export.categories, want);
+	}
+	compareSourceTasks(t, export.tasks, []sourceTask{
+		{
+			id: "c1", categoryId: "b1", title: "First", description: "the first card", tags: []string{},
+			// checklists in order, and the items of each in order
+			checklist: []sourceChecklistItem{
+				{id: "x0", title: "from the first checklist"},
+				{id: "x1", title: "first item"},
+				{id: "x2", title: "second item", done: true},
+			},
+		},
+		{
+			id: "c2", categoryId: "b1", title: "Second", completed: true, tags: []string{"green", "urgent"},
+			deadline: null.NewTime(time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC), true),
+		},
+	});
+
+	if want := []string{`card "Bad due date": "soon" is not a due date`}; (!reflect.DeepEqual(skipped, want)) {
+		t.Errorf("skipped %q, want %q", skipped, want);
+	}
+
+	for _, data := range []string{`not json`, `[]`, `{"name": "Board", "lists": []}`, `{"id": "b1"}`, todoistFixture} {
+		if _, _, err := readTrelloExport([]byte(data)); (err == nil) {
+			t.Errorf("readTrelloExport accepted %.40q", data);
+		}
+	}
+}
+
+func TestSourceIdAndFlag(t *testing.T) {
+	var ids []sourceId;
+	err := json.Unmarshal([]byte(`["abc", 2203306141, null, "12"]`), &ids);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	if want := []sourceId{"abc", "2203306141", "", "12"}; (!reflect.DeepEqual(ids, want)) {
+		t.Errorf("ids read as %q, want %q", ids, want);
+	}
+
+	var flags []sourceFlag;
+	err = json.Unmarshal([]byte(`[true, 1, false, 0, null]`), &flags);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	if want := []sourceFlag{true, true, false, false, false}; (!reflect.DeepEqual(flags, want)) {
+		t.Errorf("flags read as %v, want %v", flags, want);
+	}
+	if err := json.Unmarshal([]byte(`"yes"`), new(sourceFlag)); (err == nil) {
+		t.Errorf("a flag of \"yes\" was accepted");
+	}
+}
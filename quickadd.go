@@ -0,0 +1,127 @@
+package main
+
+import (
+	"api/quickadd"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+)
+
+// structs
+
+type QuickAddParams struct {
+	// e.g. "buy milk tomorrow 5pm #CCA !high" (see the quickadd package for everything that is understood)
+	Text string `json:"text"`
+	// the category the task goes into when none of its hashtags name a category the user can edit; 0 for none
+	Category_Id int `json:"category_id"`
+	// when true, the text is only parsed, and no task is created
+	Dry_Run bool `json:"dry_run"`
+}
+
+// what a line of quick-add text was understood as, and the task created from it
+type QuickAddResult struct {
+	Parsed quickadd.Parsed `json:"parsed"`
+	// the category the task goes into, 0 if there is none yet
+	Category_Id int `json:"category_id"`
+	Category string `json:"category"`
+	// the hashtags that did not name the category, which become the task's tags
+	Tags []string `json:"tags"`
+	// the recurrence as an iCalendar RRULE value, "" if the task does not repeat
+	Recurrence string `json:"recurrence"`
+	// null on a dry run
+	Task *Task `json:"task"`
+}
+
+/* ------------------------------------------------------------ QUICK ADD --------------------- */
+/* Parses a line of quick-add text in the user's timezone, and works out which category the task goes into:
+		the first hashtag that names a category the user can edit (ignoring case, with "_" and "-" read as spaces),
+		or else the category given in the params */
+func previewQuickAdd(params QuickAddParams, user User, client *gin.Context, cancel context.CancelFunc) (QuickAddResult) {
+	parsed := quickadd.Parse(params.Text, time.Now().In(locationOf(user)));
+	result := QuickAddResult{Parsed: parsed, Category_Id: params.Category_Id, Tags: []string{}};
+	if (parsed.Recurrence != nil) {
+		result.Recurrence = parsed.Recurrence.RRule();
+	}
+
+	categories := getAllCategories(user.Id, client, cancel);
+	named := false;
+	for _, tag := range parsed.Hashtags {
+		if (!named) {
+			name := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(tag));
+			for _, cat := range categories {
+				if (hasRole(cat.Role, roleEditor) && strings.ToLower(cat.Title) == name) {
+					result.Category_Id = cat.Id;
+					named = true;
+					break;
+				}
+			}
+			if (named) {
+				continue;
+			}
+		}
+		result.Tags = append(result.Tags, tag);
+	}
+
+	for _, cat := range categories {
+		if (cat.Id == result.Category_Id) {
+			result.Category = cat.Title;
+		}
+	}
+
+	return result;
+}
+
+/* Creates the task a quick-add preview describes, and returns it */
+func addQuickAddTask(result QuickAddResult, user User, client *gin.Context, cancel context.CancelFunc) (Task, error) {
+	params := CreateTaskParams{
+		Title: result.Parsed.Title,
+		Category_Id: fmt.Sprint(result.Category_Id),
+		Tags: result.Tags,
+	};
+	if (result.Parsed.Deadline != nil && result.Parsed.All_Day) {
+		params.Deadline_Date.SetValid(*result.Parsed.Deadline);
+	} else if (result.Parsed.Deadline != nil) {
+		params.Deadline.SetValid(*result.Parsed.Deadline);
+	}
+	if (result.Parsed.Priority != "") {
+		params.Priority.SetValid(result.Parsed.Priority);
+	}
+	if (result.Recurrence != "") {
+		params.Recurrence.SetValid(result.Recurrence);
+	}
+
+	id, err := addTask(params, user.Id, client, cancel);
+	if (err != nil) {
+		return Task{}, err;
+	}
+
+	t, err := getTask(id, user.Id, client, cancel);
+	return localiseTask(t, locationOf(user)), err;
+}
+
+// checks that a quick-add preview has everything a task needs, i.e. a title and a category,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertQuickAddComplete(client *gin.Context, cancel context.CancelFunc, result QuickAddResult) error {
+	var e error;
+	if (strings.TrimSpace(result.Parsed.Title) == "") {
+		e = errors.New("the text needs a title besides its dates, hashtags and priority");
+	} else if (result.Category_Id == 0) {
+		e = errors.New("none of the hashtags name a category you can edit, and no category_id was given");
+	}
+	if (e == nil) {
+		return nil;
+	}
+
+	fmt.Fprintf(os.Stderr, "Unable to quick-add task: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,643 @@
+// Package quickadd turns a line typed into the quick-add box, such as "buy milk tomorrow 5pm #CCA !high",
+// into the fields of a task: its title, when it is due, its hashtags, its priority and how often it repeats.
+//
+// Dates and times are understood relative to a given moment, in that moment's timezone:
+//		today, tonight, tomorrow (tmr, tmrw), day after tomorrow, monday (on mon, by fri), next friday (friday of next week),
+//		next week, next month, this weekend, in 3 days, in 2 weeks, in an hour, in 30 minutes,
+//		2026-03-14, 14/3, 14/3/2026, 14 mar, march 14th 2027, 5pm, 5:30pm, 17:00, noon, midnight, at 7
+// Hashtags are returned as written, priorities are !high (!h, !3, !!!), !medium (!med, !m, !2, !!) and !low (!l, !1),
+// and recurrence phrases are daily, weekly, monthly, yearly, fortnightly, every day, every weekday,
+// every other week, every 3 months, every monday and every mon, wed and fri.
+// Single words that are also ordinary words in a title, such as "weekly" in "write weekly report" or "weekend",
+// are only understood at the end of the text, after everything but other dates, times, hashtags and priorities.
+// Whatever is not understood is left in the title.
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the fields pulled out of a line of quick-add text
+type Parsed struct {
+	Title string `json:"title"`
+	// when the task is due, in the timezone of the moment the text was parsed at; nil if no date or time was given
+	Deadline *time.Time `json:"deadline"`
+	// whether only a date was given, in which case Deadline is the last second of that date, as the API shows all-day tasks
+	All_Day bool `json:"all_day"`
+	// every hashtag, without the "#", in the order they were written
+	Hashtags []string `json:"hashtags"`
+	// "low", "medium", "high", or "" if no priority was given
+	Priority string `json:"priority"`
+	Recurrence *Recurrence `json:"recurrence"`
+}
+
+type Recurrence struct {
+	// "daily", "weekly", "monthly" or "yearly"
+	Frequency string `json:"frequency"`
+	// e.g. 2 for every other week
+	Interval int `json:"interval"`
+	// the days a weekly recurrence falls on, e.g. ["monday", "wednesday"]; empty for any day
+	Weekdays []string `json:"weekdays,omitempty"`
+	// the phrase as it was written
+	Text string `json:"text"`
+}
+
+// a calendar date, before it is combined with a time
+type date struct {
+	year int
+	month time.Month
+	day int
+}
+
+// a time of day, before it is combined with a date
+type clock struct {
+	hour int
+	minute int
+}
+
+type parser struct {
+	now time.Time
+	// the words of the text as written, and in lower case without surrounding punctuation, for matching
+	words []string
+	lower []string
+	// which words have been understood, and so are left out of the title
+	used []bool
+
+	date *date
+	clock *clock
+	// an exact moment, from e.g. "in 2 hours"; takes precedence over date and clock
+	moment *time.Time
+	parsed Parsed
+}
+
+// a matcher looks for something it understands starting at word i, and returns how many words it used, or 0
+type matcher func(p *parser, i int) int
+
+// words that can come right before a date or time, and are dropped along with it, e.g. "by" in "by friday"
+var prepositions = map[string]bool{"on": true, "by": true, "at": true, "due": true, "before": true, "until": true}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+// recurrences that are written as a single word
+var recurrenceWords = map[string]Recurrence{
+	"daily": {Frequency: "daily", Interval: 1},
+	"weekly": {Frequency: "weekly", Interval: 1},
+	"fortnightly": {Frequency: "weekly", Interval: 2},
+	"monthly": {Frequency: "monthly", Interval: 1},
+	"yearly": {Frequency: "yearly", Interval: 1},
+	"annually": {Frequency: "yearly", Interval: 1},
+}
+
+var priorities = map[string]string{
+	"!high": "high", "!h": "high", "!3": "high", "!!!": "high",
+	"!medium": "medium", "!med": "medium", "!m": "medium", "!2": "medium", "!!": "medium",
+	"!low": "low", "!l": "low", "!1": "low",
+}
+
+var (
+	isoDatePattern = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	slashDatePattern = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})(?:/(\d{2}|\d{4}))?$`)
+	dayOfMonthPattern = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+	yearPattern = regexp.MustCompile(`^\d{4}$`)
+	meridiemTimePattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	twentyFourHourPattern = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+)
+
+// returns the recurrence as an iCalendar RRULE value, e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"
+func (r Recurrence) RRule() string {
+	rule := "FREQ=" + strings.ToUpper(r.Frequency);
+	if (r.Interval > 1) {
+		rule += ";INTERVAL=" + strconv.Itoa(r.Interval);
+	}
+	if (len(r.Weekdays) > 0) {
+		var days []string;
+		for _, day := range r.Weekdays {
+			days = append(days, strings.ToUpper(day[:2]));
+		}
+		rule += ";BYDAY=" + strings.Join(days, ",");
+	}
+
+	return rule;
+}
+
+/* ------------------------------------------------------------ PARSING --------------------- */
+// Parse pulls the fields of a task out of a line of quick-add text, with dates and times relative to now, in now's timezone
+func Parse(text string, now time.Time) Parsed {
+	p := &parser{now: now, words: strings.Fields(text)};
+	for _, word := range p.words {
+		p.lower = append(p.lower, strings.Trim(strings.ToLower(word), ",.;"));
+	}
+	p.used = make([]bool, len(p.words));
+	p.parsed.Hashtags = []string{};
+
+	// order matters: recurrence phrases contain weekdays, and dates contain numbers that could be read as times
+	matchers := []matcher{matchHashtag, matchPriority, matchRecurrence, matchRelativeDate, matchRelativeMoment, matchAbsoluteDate, matchTime};
+	for i := 0; i < len(p.words); i++ {
+		if (p.used[i]) {
+			continue;
+		}
+		for _, match := range matchers {
+			n := match(p, i);
+			if (n > 0) {
+				p.use(i, n);
+				i += n - 1;
+				break;
+			}
+		}
+	}
+
+	// words that can be ordinary words too are only understood at the end of the text
+	trailing := []matcher{matchRecurrenceWord, matchWeekend};
+	for i := len(p.words) - 1; i >= 0; i-- {
+		if (p.used[i]) {
+			continue;
+		}
+		matched := false;
+		for _, match := range trailing {
+			n := match(p, i);
+			if (n > 0) {
+				p.use(i, n);
+				matched = true;
+				break;
+			}
+		}
+		if (!matched) {
+			break;
+		}
+	}
+
+	p.resolve();
+
+	var title []string;
+	for i, word := range p.words {
+		if (!p.used[i]) {
+			title = append(title, word);
+		}
+	}
+	p.parsed.Title = strings.Join(title, " ");
+
+	return p.parsed;
+}
+
+// marks n words starting at i as understood, along with a preposition right before them
+func (p *parser) use(i int, n int) {
+	for j := i; j < i + n; j++ {
+		p.used[j] = true;
+	}
+	if (i > 0 && !p.used[i - 1] && prepositions[p.lower[i - 1]] && !strings.HasPrefix(p.lower[i], "#") && !strings.HasPrefix(p.lower[i], "!")) {
+		p.used[i - 1] = true;
+	}
+}
+
+// returns the lower-case word at i, or "" past the end of the text
+func (p *parser) word(i int) string {
+	if (i < 0 || i >= len(p.lower) || p.used[i]) {
+		return "";
+	}
+
+	return p.lower[i];
+}
+
+// combines what was found into the deadline
+func (p *parser) resolve() {
+	if (p.moment != nil) {
+		p.parsed.Deadline = p.moment;
+		return;
+	}
+
+	// a recurrence on set weekdays starts on the first of them
+	if (p.date == nil && p.parsed.Recurrence != nil && len(p.parsed.Recurrence.Weekdays) > 0) {
+		p.date = p.firstOccurrence(p.parsed.Recurrence.Weekdays);
+	}
+	if (p.date == nil && p.clock == nil) {
+		return;
+	}
+	if (p.date == nil) {
+		// a time on its own is the next time it comes round
+		today := dateOf(p.now);
+		p.date = &today;
+		if (p.at(*p.date, *p.clock).Before(p.now)) {
+			tomorrow := today.add(0, 0, 1);
+			p.date = &tomorrow;
+		}
+	}
+
+	loc := p.now.Location();
+	var deadline time.Time;
+	if (p.clock == nil) {
+		deadline = time.Date(p.date.year, p.date.month, p.date.day, 23, 59, 59, 0, loc);
+		p.parsed.All_Day = true;
+	} else {
+		deadline = p.at(*p.date, *p.clock);
+	}
+	p.parsed.Deadline = &deadline;
+}
+
+// returns the first date, from today on, that falls on one of the weekdays and has not yet passed
+func (p *parser) firstOccurrence(days []string) *date {
+	for offset := 0; offset <= 7; offset++ {
+		d := dateOf(p.now).add(0, 0, offset);
+		for _, name := range days {
+			if (weekdays[name] != p.now.AddDate(0, 0, offset).Weekday()) {
+				continue;
+			}
+			if (p.clock == nil || !p.at(d, *p.clock).Before(p.now)) {
+				return &d;
+			}
+		}
+	}
+
+	return nil;
+}
+
+func (p *parser) at(d date, c clock) time.Time {
+	return time.Date(d.year, d.month, d.day, c.hour, c.minute, 0, 0, p.now.Location());
+}
+
+func dateOf(t time.Time) date {
+	year, month, day := t.Date();
+	return date{year, month, day};
+}
+
+// returns the date a number of years, months and days after d, normalising e.g. 31 April to 1 May
+func (d date) add(years int, months int, days int) date {
+	return dateOf(time.Date(d.year + years, d.month + time.Month(months), d.day + days, 0, 0, 0, 0, time.UTC));
+}
+
+// returns the first date on or after today that falls on the weekday
+func (p *parser) nextWeekday(day time.Weekday, includeToday bool) date {
+	days := (int(day) - int(p.now.Weekday()) + 7) % 7;
+	if (days == 0 && !includeToday) {
+		days = 7;
+	}
+
+	return dateOf(p.now).add(0, 0, days);
+}
+
+/* ------------------------------------------------------------ MATCHERS --------------------- */
+// "#CCA"
+func matchHashtag(p *parser, i int) int {
+	tag := strings.TrimRight(strings.TrimPrefix(p.words[i], "#"), ",.;");
+	if (!strings.HasPrefix(p.words[i], "#") || tag == "") {
+		return 0;
+	}
+
+	p.parsed.Hashtags = append(p.parsed.Hashtags, tag);
+	return 1;
+}
+
+// "!high"
+func matchPriority(p *parser, i int) int {
+	priority, ok := priorities[p.lower[i]];
+	if (!ok) {
+		return 0;
+	}
+
+	p.parsed.Priority = priority;
+	return 1;
+}
+
+// "daily", at the end of the text
+func matchRecurrenceWord(p *parser, i int) int {
+	r, ok := recurrenceWords[p.lower[i]];
+	if (!ok) {
+		return 0;
+	}
+
+	return p.recur(r, i, 1);
+}
+
+// "every other week", "every 3 months", "every weekday", "every mon, wed and fri"
+func matchRecurrence(p *parser, i int) int {
+	if (p.lower[i] != "every") {
+		return 0;
+	}
+
+	n := 1;
+	r := Recurrence{Interval: 1};
+	if (p.word(i + n) == "other") {
+		r.Interval = 2;
+		n++;
+	} else if count, err := strconv.Atoi(p.word(i + n)); (err == nil && count > 0) {
+		r.Interval = count;
+		n++;
+	}
+
+	unit := p.word(i + n);
+	switch (strings.TrimSuffix(unit, "s")) {
+	case "day":
+		r.Frequency = "daily";
+	case "week":
+		r.Frequency = "weekly";
+	case "month":
+		r.Frequency = "monthly";
+	case "year":
+		r.Frequency = "yearly";
+	case "weekday":
+		r.Frequency = "weekly";
+		r.Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday"};
+	default:
+		// a list of weekdays, joined by commas and "and"
+		for {
+			day, ok := weekdays[p.word(i + n)];
+			if (!ok) {
+				break;
+			}
+			r.Frequency = "weekly";
+			r.Weekdays = append(r.Weekdays, strings.ToLower(day.String()));
+			n++;
+			if (p.word(i + n) == "and") {
+				if _, ok := weekdays[p.word(i + n + 1)]; (ok) {
+					n++;
+				}
+			}
+		}
+		if (r.Frequency == "") {
+			return 0;
+		}
+		return p.recur(r, i, n);
+	}
+
+	return p.recur(r, i, n + 1);
+}
+
+// records a recurrence found in n words starting at i
+func (p *parser) recur(r Recurrence, i int, n int) int {
+	r.Text = strings.Join(p.words[i:i + n], " ");
+	p.parsed.Recurrence = &r;
+
+	return n;
+}
+
+// "today", "tonight", "tomorrow", "day after tomorrow", "friday", "next friday", "next week", "this weekend"
+func matchRelativeDate(p *parser, i int) int {
+	today := dateOf(p.now);
+	var d date;
+	n := 1;
+
+	switch (p.lower[i]) {
+	case "today", "tod":
+		d = today;
+	case "tonight":
+		d = today;
+		if (p.clock == nil) {
+			p.clock = &clock{20, 0};
+		}
+	case "tomorrow", "tmr", "tmrw", "tomorow":
+		d = today.add(0, 0, 1);
+	case "day":
+		if (p.word(i + 1) != "after" || p.word(i + 2) != "tomorrow") {
+			return 0;
+		}
+		d = today.add(0, 0, 2);
+		n = 3;
+	case "this":
+		if (p.word(i + 1) != "weekend") {
+			return 0;
+		}
+		d = p.nextWeekday(time.Saturday, true);
+		n = 2;
+	case "next":
+		next := p.word(i + 1);
+		n = 2;
+		switch (next) {
+		case "week":
+			d = p.nextWeekday(time.Monday, false);
+		case "month":
+			d = date{today.year, today.month, 1}.add(0, 1, 0);
+		case "year":
+			d = date{today.year + 1, time.January, 1};
+		default:
+			// the day in the week after this one, which starts on monday
+			day, ok := weekdays[next];
+			if (!ok) {
+				return 0;
+			}
+			d = p.nextWeekday(time.Monday, false).add(0, 0, (int(day) + 6) % 7);
+		}
+	default:
+		day, ok := weekdays[p.lower[i]];
+		// short names like "sat" are only read as days after e.g. "on", as they can be ordinary words too
+		if (!ok || (len(p.lower[i]) < 6 && !prepositions[p.word(i - 1)])) {
+			return 0;
+		}
+		d = p.nextWeekday(day, true);
+	}
+
+	p.date = &d;
+	return n;
+}
+
+// "weekend", at the end of the text
+func matchWeekend(p *parser, i int) int {
+	if (p.lower[i] != "weekend") {
+		return 0;
+	}
+
+	d := p.nextWeekday(time.Saturday, true);
+	p.date = &d;
+	return 1;
+}
+
+// "in 3 days", "in a week", "in 2 hours", "in 30 minutes"
+func matchRelativeMoment(p *parser, i int) int {
+	if (p.lower[i] != "in") {
+		return 0;
+	}
+
+	count := 1;
+	if (p.word(i + 1) != "a" && p.word(i + 1) != "an") {
+		var err error;
+		count, err = strconv.Atoi(p.word(i + 1));
+		if (err != nil || count < 0) {
+			return 0;
+		}
+	}
+
+	today := dateOf(p.now);
+	var d date;
+	switch (strings.TrimSuffix(p.word(i + 2), "s")) {
+	case "minute", "min":
+		moment := p.now.Add(time.Duration(count) * time.Minute).Truncate(time.Minute);
+		p.moment = &moment;
+		return 3;
+	case "hour", "hr":
+		moment := p.now.Add(time.Duration(count) * time.Hour).Truncate(time.Minute);
+		p.moment = &moment;
+		return 3;
+	case "day":
+		d = today.add(0, 0, count);
+	case "week":
+		d = today.add(0, 0, 7 * count);
+	case "month":
+		d = today.add(0, count, 0);
+	case "year":
+		d = today.add(count, 0, 0);
+	default:
+		return 0;
+	}
+
+	p.date = &d;
+	return 3;
+}
+
+// "2026-03-14", "14/3", "14/3/2026", "14 mar", "14th march 2027", "mar 14", "march 14th"
+func matchAbsoluteDate(p *parser, i int) int {
+	word := p.lower[i];
+
+	if m := isoDatePattern.FindStringSubmatch(word); (m != nil) {
+		year, _ := strconv.Atoi(m[1]);
+		month, _ := strconv.Atoi(m[2]);
+		day, _ := strconv.Atoi(m[3]);
+		return p.setDate(year, time.Month(month), day, 1);
+	}
+
+	if m := slashDatePattern.FindStringSubmatch(word); (m != nil) {
+		day, _ := strconv.Atoi(m[1]);
+		month, _ := strconv.Atoi(m[2]);
+		year := 0;
+		if (m[3] != "") {
+			year, _ = strconv.Atoi(m[3]);
+			if (year < 100) {
+				year += 2000;
+			}
+		}
+		return p.setDate(year, time.Month(month), day, 1);
+	}
+
+	// day then month
+	if m := dayOfMonthPattern.FindStringSubmatch(word); (m != nil) {
+		month, ok := months[p.word(i + 1)];
+		if (!ok) {
+			return 0;
+		}
+		day, _ := strconv.Atoi(m[1]);
+		year, n := p.yearAt(i + 2);
+		return p.setDate(year, month, day, 2 + n);
+	}
+
+	// month then day
+	if month, ok := months[word]; (ok) {
+		m := dayOfMonthPattern.FindStringSubmatch(p.word(i + 1));
+		if (m == nil) {
+			return 0;
+		}
+		day, _ := strconv.Atoi(m[1]);
+		year, n := p.yearAt(i + 2);
+		return p.setDate(year, month, day, 2 + n);
+	}
+
+	return 0;
+}
+
+// returns the year written at word i and 1, or 0 and 0 if there is none
+func (p *parser) yearAt(i int) (int, int) {
+	if (!yearPattern.MatchString(p.word(i))) {
+		return 0, 0;
+	}
+
+	year, _ := strconv.Atoi(p.word(i));
+	return year, 1;
+}
+
+// records a date written out in n words; a date without a year is the next time it comes round.
+//		A date that does not exist (e.g. 31/2) is not understood, and returns 0
+func (p *parser) setDate(year int, month time.Month, day int, n int) int {
+	if (month < time.January || month > time.December || day < 1 || day > 31) {
+		return 0;
+	}
+
+	guessYear := year == 0;
+	if (guessYear) {
+		year = p.now.Year();
+	}
+	d := date{year, month, day};
+	if (d.add(0, 0, 0) != d) {
+		return 0;
+	}
+	if (guessYear && time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Before(time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, time.UTC))) {
+		d.year++;
+	}
+
+	p.date = &d;
+	return n;
+}
+
+// "5pm", "5:30pm", "5 pm", "17:00", "noon", "midnight", "at 7"
+func matchTime(p *parser, i int) int {
+	word := p.lower[i];
+	n := 1;
+
+	switch (word) {
+	case "noon", "midday":
+		p.clock = &clock{12, 0};
+		return 1;
+	case "midnight":
+		// the last minute of the day, so that "friday midnight" is still on friday
+		p.clock = &clock{23, 59};
+		return 1;
+	}
+
+	if m := twentyFourHourPattern.FindStringSubmatch(word); (m != nil) {
+		hour, _ := strconv.Atoi(m[1]);
+		minute, _ := strconv.Atoi(m[2]);
+		p.clock = &clock{hour, minute};
+		return 1;
+	}
+
+	// "5 pm" is read the same as "5pm"
+	if (p.word(i + 1) == "am" || p.word(i + 1) == "pm") {
+		word += p.word(i + 1);
+		n = 2;
+	}
+	if m := meridiemTimePattern.FindStringSubmatch(word); (m != nil) {
+		hour, _ := strconv.Atoi(m[1]);
+		minute, _ := strconv.Atoi(m[2]);
+		if (hour < 1 || hour > 12 || minute > 59) {
+			return 0;
+		}
+		hour = hour % 12;
+		if (m[3] == "pm") {
+			hour += 12;
+		}
+		p.clock = &clock{hour, minute};
+		return n;
+	}
+
+	// a bare hour only counts as a time after "at"; hours up to 7 are taken to be in the evening, as few tasks are due before dawn
+	if hour, err := strconv.Atoi(word); (err == nil && p.word(i - 1) == "at" && hour >= 0 && hour <= 23) {
+		if (hour >= 1 && hour <= 7) {
+			hour += 12;
+		}
+		p.clock = &clock{hour, 0};
+		return 1;
+	}
+
+	return 0;
+}
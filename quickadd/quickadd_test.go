@@ -0,0 +1,201 @@
+package quickadd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// Wednesday 14 October 2026, 9:30 in Amsterdam, summer time; the clocks go back on Sunday the 25th
+func testNow(t *testing.T) time.Time {
+	t.Helper();
+	loc, err := time.LoadLocation("Europe/Amsterdam");
+	if (err != nil) {
+		t.Fatal(err);
+	}
+
+	return time.Date(2026, time.October, 14, 9, 30, 0, 0, loc);
+}
+
+func TestParse(t *testing.T) {
+	now := testNow(t);
+
+	tests := []struct {
+		text string
+		title string
+		// RFC 3339, so that the offset is checked too; "" for no deadline
+		deadline string
+		allDay bool
+	}{
+		// relative dates
+		{"pay rent today", "pay rent", "2026-10-14T23:59:59+02:00", true},
+		{"dinner tonight", "dinner", "2026-10-14T20:00:00+02:00", false},
+		{"buy milk tomorrow", "buy milk", "2026-10-15T23:59:59+02:00", true},
+		{"buy milk tmrw", "buy milk", "2026-10-15T23:59:59+02:00", true},
+		{"report day after tomorrow", "report", "2026-10-16T23:59:59+02:00", true},
+		{"gym monday", "gym", "2026-10-19T23:59:59+02:00", true},
+		{"review wednesday", "review", "2026-10-14T23:59:59+02:00", true},
+		// next with a weekday is that day in the week after this one
+		{"gym friday", "gym", "2026-10-16T23:59:59+02:00", true},
+		{"gym next friday", "gym", "2026-10-23T23:59:59+02:00", true},
+		{"gym next monday", "gym", "2026-10-19T23:59:59+02:00", true},
+		{"gym next wednesday", "gym", "2026-10-21T23:59:59+02:00", true},
+		{"gym next sunday", "gym", "2026-10-25T23:59:59+01:00", true},
+		{"plan next week", "plan", "2026-10-19T23:59:59+02:00", true},
+		{"invoice next month", "invoice", "2026-11-01T23:59:59+01:00", true},
+		{"hike this weekend", "hike", "2026-10-17T23:59:59+02:00", true},
+		{"hike on weekend", "hike", "2026-10-17T23:59:59+02:00", true},
+		{"hike weekend #outdoors", "hike", "2026-10-17T23:59:59+02:00", true},
+		{"plan weekend trip", "plan weekend trip", "", false},
+
+		// short weekday names need a preposition, as they can be ordinary words too
+		{"gym mon", "gym mon", "", false},
+		{"sat exam", "sat exam", "", false},
+		{"gym on mon", "gym", "2026-10-19T23:59:59+02:00", true},
+		{"report by fri", "report", "2026-10-16T23:59:59+02:00", true},
+
+		// relative moments, across the change back to winter time
+		{"stretch in 30 minutes", "stretch", "2026-10-14T10:00:00+02:00", false},
+		{"stretch in an hour", "stretch", "2026-10-14T10:30:00+02:00", false},
+		{"call in 3 days", "call", "2026-10-17T23:59:59+02:00", true},
+		{"call in 2 weeks", "call", "2026-10-28T23:59:59+01:00", true},
+		{"renew in a year", "renew", "2027-10-14T23:59:59+02:00", true},
+
+		// absolute dates; a date without a year that has passed is next year's
+		{"taxes 2026-03-14", "taxes", "2026-03-14T23:59:59+01:00", true},
+		{"taxes 14/3", "taxes", "2027-03-14T23:59:59+01:00", true},
+		{"taxes 14/3/2026", "taxes", "2026-03-14T23:59:59+01:00", true},
+		{"taxes 14 mar", "taxes", "2027-03-14T23:59:59+01:00", true},
+		{"taxes march 14th 2027", "taxes", "2027-03-14T23:59:59+01:00", true},
+		{"party 20 oct", "party", "2026-10-20T23:59:59+02:00", true},
+		{"party oct 14", "party", "2026-10-14T23:59:59+02:00", true},
+		{"answer 31/2", "answer 31/2", "", false},
+
+		// times; a time on its own is the next time it comes round
+		{"call 5pm", "call", "2026-10-14T17:00:00+02:00", false},
+		{"call 5:30pm", "call", "2026-10-14T17:30:00+02:00", false},
+		{"call 5 pm", "call", "2026-10-14T17:00:00+02:00", false},
+		{"call 17:00", "call", "2026-10-14T17:00:00+02:00", false},
+		{"call 8:15", "call", "2026-10-15T08:15:00+02:00", false},
+		{"lunch noon", "lunch", "2026-10-14T12:00:00+02:00", false},
+		{"deploy midnight", "deploy", "2026-10-14T23:59:00+02:00", false},
+		{"buy milk tomorrow 5pm", "buy milk", "2026-10-15T17:00:00+02:00", false},
+		{"review friday noon", "review", "2026-10-16T12:00:00+02:00", false},
+
+		// a bare hour only counts after "at", and hours up to 7 are in the evening
+		{"call mom at 7", "call mom", "2026-10-14T19:00:00+02:00", false},
+		{"call mom at 9", "call mom", "2026-10-15T09:00:00+02:00", false},
+		{"call mom at 11", "call mom", "2026-10-14T11:00:00+02:00", false},
+		{"read 7 chapters", "read 7 chapters", "", false},
+
+		// nothing understood
+		{"write the report", "write the report", "", false},
+	}
+	for _, test := range tests {
+		parsed := Parse(test.text, now);
+		deadline := "";
+		if (parsed.Deadline != nil) {
+			deadline = parsed.Deadline.Format(time.RFC3339);
+		}
+		if (parsed.Title != test.title || deadline != test.deadline || parsed.All_Day != test.allDay) {
+			t.Errorf("Parse(%q) = %q due %q (all day %v), want %q due %q (all day %v)", test.text, parsed.Title, deadline, parsed.All_Day, test.title, test.deadline, test.allDay);
+		}
+	}
+}
+
+func TestParseHashtagsAndPriority(t *testing.T) {
+	now := testNow(t);
+
+	tests := []struct {
+		text string
+		title string
+		hashtags []string
+		priority string
+	}{
+		{"buy milk tomorrow 5pm #CCA !high", "buy milk", []string{"CCA"}, "high"},
+		{"groceries #home, #errands.", "groceries", []string{"home", "errands"}, ""},
+		{"fix the build !!!", "fix the build", []string{}, "high"},
+		{"tidy up !!", "tidy up", []string{}, "medium"},
+		{"tidy up !med", "tidy up", []string{}, "medium"},
+		{"someday !l", "someday", []string{}, "low"},
+		{"c# is fun", "c# is fun", []string{}, ""},
+		{"wow!", "wow!", []string{}, ""},
+		// a preposition before a hashtag is part of the title
+		{"talk about #budget", "talk about", []string{"budget"}, ""},
+	}
+	for _, test := range tests {
+		parsed := Parse(test.text, now);
+		if (parsed.Title != test.title || !reflect.DeepEqual(parsed.Hashtags, test.hashtags) || parsed.Priority != test.priority) {
+			t.Errorf("Parse(%q) = %q %v %q, want %q %v %q", test.text, parsed.Title, parsed.Hashtags, parsed.Priority, test.title, test.hashtags, test.priority);
+		}
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	now := testNow(t);
+
+	tests := []struct {
+		text string
+		title string
+		rrule string
+		// the first occurrence, for recurrences on set weekdays; "" for no deadline
+		deadline string
+	}{
+		{"water plants daily", "water plants", "FREQ=DAILY", ""},
+		{"review weekly", "review", "FREQ=WEEKLY", ""},
+		{"payroll fortnightly", "payroll", "FREQ=WEEKLY;INTERVAL=2", ""},
+		{"rent monthly", "rent", "FREQ=MONTHLY", ""},
+		{"birthday yearly", "birthday", "FREQ=YEARLY", ""},
+		{"walk every day", "walk", "FREQ=DAILY", ""},
+		{"sync every other week", "sync", "FREQ=WEEKLY;INTERVAL=2", ""},
+		{"backup every 3 months", "backup", "FREQ=MONTHLY;INTERVAL=3", ""},
+		{"standup every weekday", "standup", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "2026-10-14T23:59:59+02:00"},
+		{"bins every monday", "bins", "FREQ=WEEKLY;BYDAY=MO", "2026-10-19T23:59:59+02:00"},
+		// today's 9:00 has passed, so the first one is on friday
+		{"standup every mon, wed and fri at 9", "standup", "FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-10-16T09:00:00+02:00"},
+		{"standup every mon, wed and fri at 10", "standup", "FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-10-14T10:00:00+02:00"},
+		{"every now and then", "every now and then", "", ""},
+		// single words are only a recurrence at the end, as they can be part of the title too
+		{"water plants daily !high", "water plants", "FREQ=DAILY", ""},
+		{"review weekly tomorrow", "review", "FREQ=WEEKLY", "2026-10-15T23:59:59+02:00"},
+		{"Write weekly report", "Write weekly report", "", ""},
+		{"daily standup", "daily standup", "", ""},
+		{"monthly review every week", "monthly review", "FREQ=WEEKLY", ""},
+	}
+	for _, test := range tests {
+		parsed := Parse(test.text, now);
+		rrule := "";
+		if (parsed.Recurrence != nil) {
+			rrule = parsed.Recurrence.RRule();
+		}
+		deadline := "";
+		if (parsed.Deadline != nil) {
+			deadline = parsed.Deadline.Format(time.RFC3339);
+		}
+		if (parsed.Title != test.title || rrule != test.rrule || deadline != test.deadline) {
+			t.Errorf("Parse(%q) = %q %q due %q, want %q %q due %q", test.text, parsed.Title, rrule, deadline, test.title, test.rrule, test.deadline);
+		}
+	}
+}
+
+// the Todoist importer reads the recurrence out of the due strings Todoist shows, and nothing else
+func TestParseTodoistDueStrings(t *testing.T) {
+	now := testNow(t);
+
+	tests := map[string]string{
+		"every day": "FREQ=DAILY",
+		"Every Day": "FREQ=DAILY",
+		"every 2 weeks": "FREQ=WEEKLY;INTERVAL=2",
+		"every weekday": "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+		"every mon, fri": "FREQ=WEEKLY;BYDAY=MO,FR",
+		"every tue and thu at 8pm": "FREQ=WEEKLY;BYDAY=TU,TH",
+		"every year": "FREQ=YEARLY",
+	}
+	for text, want := range tests {
+		parsed := Parse(text, now);
+		if (parsed.Recurrence == nil || parsed.Recurrence.RRule() != want) {
+			t.Errorf("Parse(%q) recurs %+v, want %v", text, parsed.Recurrence, want);
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"github.com/emvi/null"
+)
+
+// structs
+
+// note: a task is moved by naming the task that should end up directly before it, or directly after it;
+//		if both are given, Before_Id wins, as the list may have changed on another device since the client last saw it
+type MoveTaskParams struct {
+	Id int `json:"id"`
+	// the task that should come right before the moved task
+	Before_Id int `json:"before_id"`
+	// the task that should come right after the moved task
+	After_Id int `json:"after_id"`
+}
+
+// the digits that ranks are made of, in the same order as postgres' "C" collation sorts them
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+/* ------------------------------------------------------------ MANUAL ORDERING --------------------- */
+// note: tasks in a category are ordered by their rank, a string compared byte by byte;
+//		there is always room for another rank between any two ranks, so moving a task only rewrites that task's rank
+
+// returns a rank that sorts strictly between a and b, where a < b;
+//		a == "" stands for "before every rank" and b == "" for "after every rank".
+//		Ranks never end in the lowest digit, so that there is always room to put another rank before them
+func rankBetween(a string, b string) string {
+	if (b != "") {
+		// skip the digits a and b have in common, treating a as if it were padded with the lowest digit
+		n := 0;
+		for (n < len(b) && rankDigitAt(a, n) == b[n]) {
+			n++;
+		}
+		if (n > 0) {
+			if (n > len(a)) {
+				a = "";
+			} else {
+				a = a[n:];
+			}
+			return b[:n] + rankBetween(a, b[n:]);
+		}
+	}
+
+	lo := 0;
+	if (a != "") {
+		lo = strings.IndexByte(rankDigits, a[0]);
+	}
+	hi := len(rankDigits);
+	if (b != "") {
+		hi = strings.IndexByte(rankDigits, b[0]);
+	}
+
+	// there is a digit between the first digits of a and b
+	if (hi - lo > 1) {
+		return string(rankDigits[(lo + hi) / 2]);
+	}
+
+	// the first digits are next to each other; if b is longer, its first digit alone sorts between a and b
+	if (len(b) > 1) {
+		return b[:1];
+	}
+
+	// otherwise keep a's first digit and find a rank after the rest of a
+	rest := "";
+	if (len(a) > 1) {
+		rest = a[1:];
+	}
+	return string(rankDigits[lo]) + rankBetween(rest, "");
+}
+
+// returns the digit at position i of a rank, or the lowest digit if the rank is shorter than that
+func rankDigitAt(rank string, i int) byte {
+	if (i < len(rank)) {
+		return rank[i];
+	}
+
+	return rankDigits[0];
+}
+
+/* Locks a category until the end of the transaction, so that ranks within it are handed out one at a time */
+func lockCategory(tx pgx.Tx, categoryId interface{}) error {
+	var id int;
+	return tx.QueryRow(context.Background(), "SELECT id FROM categories WHERE id=$1 FOR UPDATE;", categoryId).Scan(&id);
+}
+
+/* Returns a rank that puts a task at the end of a category, the category must already be locked */
+func rankAtEndOfCategory(tx pgx.Tx, categoryId interface{}) (string, error) {
+	var last null.String;
+	err := tx.QueryRow(context.Background(), "SELECT MAX(rank) FROM tasks WHERE category_id=$1;", categoryId).Scan(&last);
+	if (err != nil) {
+		return "", err;
+	}
+
+	return rankBetween(last.String, ""), nil;
+}
+
+/* Moves a task to a new position within its category and returns its new rank */
+func moveTask(params MoveTaskParams, client *gin.Context, cancel context.CancelFunc) (string, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+	defer tx.Rollback(context.Background())
+
+	var categoryId int;
+	err = tx.QueryRow(context.Background(), "SELECT category_id FROM tasks WHERE id=$1 AND deleted_at IS NULL;", params.Id).Scan(&categoryId);
+	if (err == pgx.ErrNoRows) {
+		return "", assertTaskFound(client, cancel, params.Id);
+	}
+	if (err == nil) {
+		err = lockCategory(tx, categoryId);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	// find the ranks of the two tasks the moved task goes between, as they are now
+	var neighbourId int = params.Before_Id;
+	var neighbourRank string;
+	if (neighbourId == 0) {
+		neighbourId = params.After_Id;
+	}
+	if (neighbourId == 0) {
+		return "", assertValidMove(client, cancel, errors.New("either before_id or after_id must be given"));
+	}
+	if (neighbourId == params.Id) {
+		return "", assertValidMove(client, cancel, errors.New("a task cannot be moved next to itself"));
+	}
+
+	err = tx.QueryRow(context.Background(), "SELECT rank FROM tasks WHERE id=$1 AND category_id=$2 AND deleted_at IS NULL;", neighbourId, categoryId).Scan(&neighbourRank);
+	if (err == pgx.ErrNoRows) {
+		return "", assertValidMove(client, cancel, fmt.Errorf("no task with id: %v in the same category as task with id: %v", neighbourId, params.Id));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	// the other neighbour is looked up among trashed tasks too, so that they keep their place if they are restored
+	var lo, hi string;
+	var other null.String;
+	if (params.Before_Id != 0) {
+		lo = neighbourRank;
+		err = tx.QueryRow(context.Background(), "SELECT MIN(rank) FROM tasks WHERE category_id=$1 AND id<>$2 AND rank > $3;", categoryId, params.Id, lo).Scan(&other);
+		hi = other.String;
+	} else {
+		hi = neighbourRank;
+		err = tx.QueryRow(context.Background(), "SELECT MAX(rank) FROM tasks WHERE category_id=$1 AND id<>$2 AND rank < $3;", categoryId, params.Id, hi).Scan(&other);
+		lo = other.String;
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	rank := rankBetween(lo, hi);
+	_, err = tx.Exec(context.Background(), "UPDATE tasks SET rank=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2;", rank, params.Id)
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	return rank, nil;
+}
+
+// reports to the client that a task cannot be moved to where it was asked to be moved,
+//		and stops execution of any remaining function-calls
+func assertValidMove(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to move task: %v\n", e);
+
+	// return http code of 409 to the client, which stands for "Conflict"
+	client.JSON(409, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
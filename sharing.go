@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type Membership struct {
+	User_Id int `json:"user_id"`
+	Username string `json:"username"`
+	Role string `json:"role"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+type Invitation struct {
+	Token string `json:"token"`
+	Category_Id int `json:"category_id"`
+	Role string `json:"role"`
+	Expires_at Timestamp `json:"expires_at"`
+}
+
+type CreateCategoryParams struct {
+	Title string `json:"category_title"`
+	// optional; a category added under a parent goes into the parent's workspace (see workspaces.go)
+	Workspace_Id int `json:"workspace_id"`
+	Parent_Id int `json:"parent_id"`
+}
+
+type GetCategoryMembersParams struct {
+	Category_Id int `json:"category_id"`
+}
+
+type ShareCategoryParams struct {
+	Category_Id int `json:"category_id"`
+	Username string `json:"username"`
+	Role string `json:"role"`
+}
+
+type CreateInvitationParams struct {
+	Category_Id int `json:"category_id"`
+	Role string `json:"role"`
+}
+
+type AcceptInvitationParams struct {
+	Token string `json:"token"`
+}
+
+type UpdateMembershipParams struct {
+	Category_Id int `json:"category_id"`
+	User_Id int `json:"user_id"`
+	Role string `json:"role"`
+}
+
+type RevokeMembershipParams struct {
+	Category_Id int `json:"category_id"`
+	User_Id int `json:"user_id"`
+}
+
+// the roles a user can have in a category, from least to most access:
+//		viewers can see the category's tasks, editors can also change them,
+//		admins can also manage who the category is shared with,
+//		and the owner (who created the category) can do all of that and cannot be removed
+const (
+	roleViewer = "viewer"
+	roleEditor = "editor"
+	roleAdmin = "admin"
+	roleOwner = "owner"
+)
+
+var roleLevels = map[string]int{
+	roleViewer: 1,
+	roleEditor: 2,
+	roleAdmin: 3,
+	roleOwner: 4,
+}
+
+// how long an invitation token can be used for after it is created
+const invitationLifetime = 7 * 24 * time.Hour
+
+/* ------------------------------------------------------------ PERMISSIONS --------------------- */
+// checks if a role gives at least as much access as another
+func hasRole(role string, minimum string) bool {
+	return roleLevels[role] >= roleLevels[minimum];
+}
+
+/* Returns the role a user has in a category, or "" if the category is not shared with them */
+func categoryRole(c rowQuerier, userId int, categoryId int) (string, error) {
+	var role string;
+	err := c.QueryRow(context.Background(), "SELECT role FROM public.get_accessible_categories($1) WHERE category_id=$2;", userId, categoryId).Scan(&role);
+	if (err == pgx.ErrNoRows) {
+		return "", nil;
+	}
+
+	return role, err;
+}
+
+/* Checks that a user has at least the given role in a category,
+		if not, returns an error message to the client and stops execution of any remaining function-calls */
+func authorizeCategory(userId int, categoryId int, minimum string, client *gin.Context, cancel context.CancelFunc) (string, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	role, err := categoryRole(c, userId, categoryId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	// categories the user has no access to at all are reported as missing, so that their existence is not given away
+	if (role == "") {
+		return "", assertCategoryFound(client, cancel, categoryId);
+	}
+	if (!hasRole(role, minimum)) {
+		return role, assertPermitted(client, cancel, fmt.Errorf("you need to be at least a %v of category with id: %v", minimum, categoryId));
+	}
+
+	return role, nil;
+}
+
+/* Checks that a user has at least the given role in the category a task belongs to (including tasks in the trash),
+		if not, returns an error message to the client and stops execution of any remaining function-calls */
+func authorizeTask(userId int, taskId int, minimum string, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var role string;
+	err := c.QueryRow(context.Background(), `
+		SELECT accessible.role
+		FROM tasks
+			INNER JOIN public.get_accessible_categories($1) AS accessible ON tasks.category_id=accessible.category_id
+		WHERE tasks.id=$2;`, userId, taskId).Scan(&role);
+	if (err == pgx.ErrNoRows) {
+		return assertTaskFound(client, cancel, taskId);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	if (!hasRole(role, minimum)) {
+		return assertPermitted(client, cancel, fmt.Errorf("you need to be at least a %v of the category of task with id: %v", minimum, taskId));
+	}
+
+	return nil;
+}
+
+/* ------------------------------------------------------------ CATEGORIES & MEMBERSHIPS --------------------- */
+/* Creates a new category owned by the given user and returns it */
+func addCategory(params CreateCategoryParams, userId int, client *gin.Context, cancel context.CancelFunc) (Category, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	category := Category{
+		Title: params.Title,
+		Role: roleOwner,
+		Workspace_Id: null.NewInt64(int64(params.Workspace_Id), params.Workspace_Id != 0),
+		Parent_Id: null.NewInt64(int64(params.Parent_Id), params.Parent_Id != 0),
+	};
+	err := c.QueryRow(context.Background(), `
+		INSERT INTO categories (title, owner_id, parent_id, workspace_id)
+		VALUES ($1, $2, $3, CASE WHEN $3::int IS NULL THEN $4::int ELSE (SELECT workspace_id FROM categories WHERE id=$3) END)
+		RETURNING id, workspace_id;`, params.Title, userId, category.Parent_Id, category.Workspace_Id).Scan(&category.Id, &category.Workspace_Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return category, err;
+	}
+
+	return category, nil;
+}
+
+/* Returns the owner and every member of a category */
+func getCategoryMembers(categoryId int, client *gin.Context, cancel context.CancelFunc) ([]Membership) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	members, err := c.Query(context.Background(), `
+		SELECT users.id, users.username, 'owner', categories.created_at
+		FROM categories
+			INNER JOIN users ON categories.owner_id=users.id
+		WHERE categories.id=$1
+		UNION ALL
+		SELECT users.id, users.username, category_members.role, category_members.created_at
+		FROM category_members
+			INNER JOIN users ON category_members.user_id=users.id
+		WHERE category_members.category_id=$1;`, categoryId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return nil;
+	}
+	defer members.Close();
+
+	var memberSlice []Membership
+	for members.Next() {
+		var m Membership
+		err = members.Scan(
+			&m.User_Id,
+			&m.Username,
+			&m.Role,
+			&m.Created_at,
+		)
+		assertDBOperationSuccess(client, cancel, err);
+		memberSlice = append(memberSlice, m)
+	}
+
+	return memberSlice;
+}
+
+/* Shares a category with a user by their username, on behalf of a user with the given role in the category */
+func shareCategory(params ShareCategoryParams, actingRole string, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var userId int;
+	err := c.QueryRow(context.Background(), "SELECT id FROM users WHERE username=$1;", params.Username).Scan(&userId);
+	if (err == pgx.ErrNoRows) {
+		return assertMembershipChange(client, cancel, fmt.Errorf("no user with username: %v", params.Username));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// sharing with someone who already has access changes their role, so the acting user must be able to manage them
+	currentRole, err := categoryRole(tx, userId, params.Category_Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	err = assertCanManage(client, cancel, actingRole, currentRole);
+	if (err != nil) {
+		return err;
+	}
+
+	err = addMember(tx, params.Category_Id, userId, params.Role, client, cancel);
+	if (err != nil) {
+		return err;
+	}
+	err = tx.Commit(context.Background());
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Adds a user to a category with the given role, or changes their role if they are already a member,
+		as part of a transaction the caller commits */
+func addMember(tx pgx.Tx, categoryId int, userId int, role string, client *gin.Context, cancel context.CancelFunc) error {
+	owner, err := categoryRole(tx, userId, categoryId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (owner == roleOwner) {
+		return assertMembershipChange(client, cancel, errors.New("the owner of a category cannot be given another role"));
+	}
+
+	_, err = tx.Exec(context.Background(), `
+		INSERT INTO category_members (category_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (category_id, user_id) DO UPDATE SET role=EXCLUDED.role;`, categoryId, userId, role);
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Creates an invitation token that anyone can use to join a category with the given role */
+func createInvitation(params CreateInvitationParams, userId int, client *gin.Context, cancel context.CancelFunc) (Invitation, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	invitation := Invitation{Category_Id: params.Category_Id, Role: params.Role};
+
+	b := make([]byte, 16);
+	_, err := rand.Read(b);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return invitation, err;
+	}
+	invitation.Token = hex.EncodeToString(b);
+	invitation.Expires_at.SetValid(time.Now().Add(invitationLifetime).Truncate(time.Second));
+
+	_, err = c.Exec(context.Background(), "INSERT INTO category_invitations (token, category_id, role, created_by, expires_at) VALUES ($1, $2, $3, $4, $5);", invitation.Token, invitation.Category_Id, invitation.Role, userId, invitation.Expires_at);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return invitation, err;
+	}
+
+	return invitation, nil;
+}
+
+/* Adds the user to the category an invitation is for, each invitation can only be used once */
+func acceptInvitation(token string, userId int, client *gin.Context, cancel context.CancelFunc) (Category, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var category Category;
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return category, err;
+	}
+	// the invitation is only used up if the user is added too
+	defer tx.Rollback(context.Background())
+
+	err = tx.QueryRow(context.Background(), `
+		DELETE FROM category_invitations
+		USING categories
+		WHERE category_invitations.token=$1 AND category_invitations.expires_at > CURRENT_TIMESTAMP AND categories.id=category_invitations.category_id
+		RETURNING categories.id, categories.title, category_invitations.role;`, token).Scan(
+		&category.Id,
+		&category.Title,
+		&category.Role,
+	)
+	if (err == pgx.ErrNoRows) {
+		return category, assertMembershipChange(client, cancel, errors.New("the invitation does not exist, has expired or has already been used"));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return category, err;
+	}
+
+	// an invitation never takes access away from someone who already has more
+	role, err := categoryRole(tx, userId, category.Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return category, err;
+	}
+	if (hasRole(role, category.Role)) {
+		category.Role = role;
+	} else {
+		err = addMember(tx, category.Id, userId, category.Role, client, cancel);
+		if (err != nil) {
+			return category, err;
+		}
+	}
+	err = tx.Commit(context.Background());
+
+	return category, assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Changes the role of a member of a category */
+func updateMembership(params UpdateMembershipParams, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "UPDATE category_members SET role=$1 WHERE category_id=$2 AND user_id=$3;", params.Role, params.Category_Id, params.User_Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertMembershipChange(client, cancel, fmt.Errorf("user with id: %v is not a member of category with id: %v", params.User_Id, params.Category_Id));
+	}
+
+	return nil;
+}
+
+/* Takes away a user's access to a category, along with their assignments to tasks in it */
+func revokeMembership(categoryId int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	commandTag, err := tx.Exec(context.Background(), "DELETE FROM category_members WHERE category_id=$1 AND user_id=$2;", categoryId, userId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertMembershipChange(client, cancel, fmt.Errorf("user with id: %v is not a member of category with id: %v", userId, categoryId));
+	}
+
+	err = removeStrayAssignees(tx, categoryId);
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Returns the role of the member being changed, so that callers can check the acting user outranks them */
+func memberRole(categoryId int, userId int, client *gin.Context, cancel context.CancelFunc) (string, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	role, err := categoryRole(c, userId, categoryId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return "", err;
+	}
+
+	return role, nil;
+}
+
+/* ------------------------------------------------------------ HELPER FUNCTIONS --------------------- */
+// checks if a role is one that can be given to a member of a category
+func assertValidRole(client *gin.Context, cancel context.CancelFunc, role string) error {
+	if (role == roleViewer || role == roleEditor || role == roleAdmin) {
+		return nil;
+	}
+
+	return assertMembershipChange(client, cancel, fmt.Errorf("role must be one of %v, %v or %v", roleViewer, roleEditor, roleAdmin));
+}
+
+// checks if a user with the given role may give, change or take away another member's role;
+//		admins can manage viewers and editors, and only the owner can manage admins
+func assertCanManage(client *gin.Context, cancel context.CancelFunc, actingRole string, roles ...string) error {
+	for _, role := range roles {
+		if (role == roleOwner || (role == roleAdmin && actingRole != roleOwner)) {
+			return assertPermitted(client, cancel, fmt.Errorf("a %v cannot manage a %v", actingRole, role));
+		}
+	}
+
+	return nil;
+}
+
+// reports to the client that it is not allowed to perform the requested action,
+//		and stops execution of any remaining function-calls
+func assertPermitted(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Permission denied: %v\n", e);
+
+	// return http code of 403 to the client, which stands for "Forbidden"
+	client.JSON(403, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that there is no category with the given id that it has access to,
+//		and stops execution of any remaining function-calls
+func assertCategoryFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no category found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that the requested change to who a category is shared with cannot be made,
+//		and stops execution of any remaining function-calls
+func assertMembershipChange(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to change category membership: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
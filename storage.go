@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"github.com/joho/godotenv"
+)
+
+// note: attachments are kept out of postgres, in a blob store chosen with the BLOB_STORE environment variable:
+//		"local" (the default) keeps them in the directory named by BLOB_DIR,
+//		"s3" keeps them in the bucket S3_BUCKET of any S3-compatible service at S3_ENDPOINT (e.g. http://localhost:9000 for a local MinIO),
+//		signing requests with S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY for the region S3_REGION
+
+// a place to keep the contents of files, each under a key chosen by the caller
+type BlobStore interface {
+	// stores size bytes read from r under key; checksum is the hex SHA-256 of the bytes,
+	//		and the blob is not stored if what was read does not match it
+	Put(key string, r io.Reader, size int64, checksum string) error
+	// returns the contents of the blob stored under key, which the caller must close
+	Get(key string) (io.ReadCloser, error)
+	// removes the blob stored under key, removing a blob that does not exist is not an error
+	Delete(key string) error
+}
+
+const defaultBlobDir = "attachments"
+const defaultS3Region = "us-east-1"
+
+// the SHA-256 of an empty request body, which S3 expects to be signed for requests without one
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var errBlobNotFound = errors.New("blob not found")
+
+// how long a single request to S3 may take, including sending or receiving the blob
+var s3Client = &http.Client{Timeout: 2 * time.Minute}
+
+/* ------------------------------------------------------------ BLOB STORES --------------------- */
+// returns the blob store configured by the environment
+func openBlobStore() (BlobStore, error) {
+	// load the .env file that contains the blob store details
+	godotenv.Load(".env")
+
+	switch (os.Getenv("BLOB_STORE")) {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR");
+		if (dir == "") {
+			dir = defaultBlobDir;
+		}
+		return localBlobStore{dir: dir}, nil;
+	case "s3":
+		store := s3BlobStore{
+			endpoint: strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+			bucket: os.Getenv("S3_BUCKET"),
+			region: os.Getenv("S3_REGION"),
+			accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		if (store.region == "") {
+			store.region = defaultS3Region;
+		}
+		if (store.endpoint == "" || store.bucket == "") {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET must be set to keep attachments in S3");
+		}
+		return store, nil;
+	default:
+		return nil, fmt.Errorf("unknown blob store: %v", os.Getenv("BLOB_STORE"));
+	}
+}
+
+// removes blobs that are no longer needed, e.g. after the tasks they were attached to were purged;
+//		a blob that cannot be removed is only reported in the server logs, as the rows pointing to it are already gone
+func deleteBlobs(keys []string) {
+	if (len(keys) == 0) {
+		return;
+	}
+
+	store, err := openBlobStore();
+	if (err != nil) {
+		fmt.Fprintf(os.Stderr, "Unable to delete %v blobs: %v\n", len(keys), err);
+		return;
+	}
+
+	for _, key := range keys {
+		err = store.Delete(key);
+		if (err != nil) {
+			fmt.Fprintf(os.Stderr, "Unable to delete blob %v: %v\n", key, err);
+		}
+	}
+}
+
+/* ------------------------------------------------------------ LOCAL FILESYSTEM --------------------- */
+type localBlobStore struct {
+	dir string
+}
+
+// returns where the blob with the given key is kept; keys are generated by the server, but are cleaned anyway
+//		so that a key can never point outside of the store's directory
+func (s localBlobStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(filepath.Clean("/" + key)));
+}
+
+func (s localBlobStore) Put(key string, r io.Reader, size int64, checksum string) error {
+	err := os.MkdirAll(s.dir, 0700);
+	if (err != nil) {
+		return err;
+	}
+
+	// write to a temporary file first, so that a failed upload never leaves a partial blob under the key
+	tmp, err := ioutil.TempFile(s.dir, ".upload-*");
+	if (err != nil) {
+		return err;
+	}
+	defer os.Remove(tmp.Name());
+
+	sum := sha256.New();
+	written, err := io.Copy(io.MultiWriter(tmp, sum), r);
+	if (err == nil) {
+		err = tmp.Close();
+	} else {
+		tmp.Close();
+	}
+	if (err != nil) {
+		return err;
+	}
+	if (written != size || hex.EncodeToString(sum.Sum(nil)) != checksum) {
+		return errors.New("blob does not match its size or checksum");
+	}
+
+	return os.Rename(tmp.Name(), s.path(key));
+}
+
+func (s localBlobStore) Get(key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key));
+	if (os.IsNotExist(err)) {
+		return nil, errBlobNotFound;
+	}
+
+	return f, err;
+}
+
+func (s localBlobStore) Delete(key string) error {
+	err := os.Remove(s.path(key));
+	if (os.IsNotExist(err)) {
+		return nil;
+	}
+
+	return err;
+}
+
+/* ------------------------------------------------------------ S3 --------------------- */
+// note: requests are sent path-style (endpoint/bucket/key) and signed with AWS Signature Version 4,
+//		which is understood by AWS itself as well as by stand-ins such as MinIO
+type s3BlobStore struct {
+	endpoint string
+	bucket string
+	region string
+	accessKey string
+	secretKey string
+}
+
+func (s s3BlobStore) Put(key string, r io.Reader, size int64, checksum string) error {
+	// S3 rejects the upload itself if the body does not match the signed checksum
+	res, err := s.do("PUT", key, r, size, checksum);
+	if (err != nil) {
+		return err;
+	}
+	defer res.Body.Close();
+
+	return s3Error(res);
+}
+
+func (s s3BlobStore) Get(key string) (io.ReadCloser, error) {
+	res, err := s.do("GET", key, nil, 0, emptyPayloadHash);
+	if (err != nil) {
+		return nil, err;
+	}
+	if (res.StatusCode == http.StatusNotFound) {
+		res.Body.Close();
+		return nil, errBlobNotFound;
+	}
+	err = s3Error(res);
+	if (err != nil) {
+		res.Body.Close();
+		return nil, err;
+	}
+
+	return res.Body, nil;
+}
+
+func (s s3BlobStore) Delete(key string) error {
+	res, err := s.do("DELETE", key, nil, 0, emptyPayloadHash);
+	if (err != nil) {
+		return err;
+	}
+	defer res.Body.Close();
+
+	// S3 answers 204 whether or not the blob existed
+	return s3Error(res);
+}
+
+// sends a signed request for the object stored under key
+func (s s3BlobStore) do(method string, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint + "/" + url.PathEscape(s.bucket) + "/" + url.PathEscape(key));
+	if (err != nil) {
+		return nil, err;
+	}
+
+	req, err := http.NewRequest(method, u.String(), body);
+	if (err != nil) {
+		return nil, err;
+	}
+	if (body != nil) {
+		req.ContentLength = size;
+	}
+	s.sign(req, payloadHash, time.Now().UTC());
+
+	return s3Client.Do(req);
+}
+
+// adds the headers of AWS Signature Version 4 to a request
+func (s s3BlobStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z");
+	day := now.Format("20060102");
+	scope := day + "/" + s.region + "/s3/aws4_request";
+
+	req.Header.Set("X-Amz-Date", amzDate);
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash);
+
+	// every header that is sent, other than the ones go adds itself, is signed
+	headers := map[string]string{"host": req.URL.Host};
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","));
+	}
+	var names []string;
+	for name := range headers {
+		names = append(names, name);
+	}
+	sort.Strings(names);
+
+	var canonicalHeaders strings.Builder;
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n");
+	}
+	signedHeaders := strings.Join(names, ";");
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n");
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n");
+
+	key := hmacSum([]byte("AWS4" + s.secretKey), day);
+	key = hmacSum(key, s.region);
+	key = hmacSum(key, "s3");
+	key = hmacSum(key, "aws4_request");
+	signature := hex.EncodeToString(hmacSum(key, stringToSign));
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", s.accessKey, scope, signedHeaders, signature));
+}
+
+// turns an unsuccessful response from S3 into an error, including the XML error document it sent back
+func s3Error(res *http.Response) error {
+	if (res.StatusCode >= 200 && res.StatusCode < 300) {
+		return nil;
+	}
+
+	detail, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024));
+	return fmt.Errorf("s3 responded with %v: %s", res.Status, bytes.TrimSpace(detail));
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data);
+	return sum[:];
+}
+
+func hmacSum(key []byte, data string) []byte {
+	var mac hash.Hash = hmac.New(sha256.New, key);
+	mac.Write([]byte(data));
+	return mac.Sum(nil);
+}
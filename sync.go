@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// note: offline clients keep their own copy of the tasks and categories they can see, and sync it in two steps:
+//		/syncpull returns what changed since the cursor of the last pull, read from the change log (see events.go),
+//		and /syncpush applies the changes the client made to tasks while it was offline.
+//
+//		Conflicts are resolved field by field. A field the client changed is applied if the server still has the value
+//		the client based its change on (its "base"). Otherwise the field was changed on both sides, and the later change wins:
+//		the client's changed_at is compared with the time the field last changed on the server, from the task's history.
+//		Fields that lose are left as they are on the server and reported back, while the rest of the mutation still applies.
+//		Deleting a task loses to any change made to it on the server after changed_at, so that no edit is silently thrown away,
+//		and changing a task that was deleted on the server is rejected
+
+// structs
+
+type SyncPullParams struct {
+	// the cursor returned by the last pull, "" for everything
+	Cursor string `json:"cursor"`
+}
+
+type SyncPullResult struct {
+	// pass this to the next pull
+	Cursor string `json:"cursor"`
+	// true when Tasks and Categories are everything the user can see, rather than what changed since the cursor,
+	//		either because no cursor was given or because the changes since it are no longer in the change log;
+	//		the client should then drop anything it has that is not in them
+	Full bool `json:"full"`
+	Tasks []Task `json:"tasks"`
+	Categories []Category `json:"categories"`
+	// tombstones for tasks and categories the user can no longer see, because they were deleted, moved to the trash or unshared;
+	//		the tasks of a category go with it
+	Deleted_Task_Ids []int `json:"deleted_task_ids"`
+	Deleted_Category_Ids []int `json:"deleted_category_ids"`
+}
+
+// a change a client made to a task while offline
+type SyncMutation struct {
+	// chosen by the client, and given back in the mutation's result
+	Id string `json:"id"`
+	// "create", "update" or "delete"
+	Action string `json:"action"`
+	// the task the mutation is for: either the server's id, or the client_task_id the client gave it when creating it;
+	//		a create needs a client_task_id, so that pushing it again does not create the task twice
+	Task_Id int `json:"task_id"`
+	Client_Task_Id string `json:"client_task_id"`
+	// the fields the client changed, with their new values, and with the values they had before the client changed them;
+	//		these are title, description, category_id, deadline, deadline_date and completed, written as in a task's history
+	Fields map[string]json.RawMessage `json:"fields"`
+	Base map[string]json.RawMessage `json:"base"`
+	// when the client made the change
+	Changed_At time.Time `json:"changed_at"`
+}
+
+type SyncPushParams struct {
+	// applied in order, each on its own, so that one mutation failing does not stop the others
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+type SyncMutationResult struct {
+	Id string `json:"id"`
+	// "applied" if all of the mutation was applied, "merged" if only some of its fields were because others lost to
+	//		newer changes on the server, or "rejected" if none of it was
+	Status string `json:"status"`
+	// the server's id for the task, 0 if there is none
+	Task_Id int `json:"task_id"`
+	// the fields that lost to newer changes on the server, with the values the server kept
+	Rejected_Fields map[string]json.RawMessage `json:"rejected_fields"`
+	// why the mutation was rejected
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	syncApplied = "applied"
+	syncMerged = "merged"
+	syncRejected = "rejected"
+)
+
+// the most mutations that can be pushed at once
+const maxSyncBatchSize = 500
+
+// the fields of a task that clients can change through /syncpush, by their names in TaskSnapshot
+var syncFields = map[string]bool{"title": true, "description": true, "category_id": true, "deadline": true, "deadline_date": true, "completed": true}
+
+/* ------------------------------------------------------------ SYNC --------------------- */
+/* Returns the tasks and categories a user can see that changed after the given cursor, along with tombstones for those they can no
+		longer see, or everything they can see if the cursor is 0 or too old. Everything is read from a single snapshot of the database,
+		so the new cursor covers exactly what is returned */
+func syncPull(after int64, userId int, client *gin.Context, cancel context.CancelFunc) (SyncPullResult, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	result := SyncPullResult{Tasks: []Task{}, Categories: []Category{}, Deleted_Task_Ids: []int{}, Deleted_Category_Ids: []int{}};
+
+	tx, err := c.BeginTx(context.Background(), pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	result.Full = after == 0;
+	if (!result.Full) {
+		var known bool;
+		err = tx.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM change_events WHERE id=$1);", after).Scan(&known);
+		result.Full = !known;
+	}
+
+	var log []ChangeEvent;
+	if (err == nil) {
+		if (result.Full) {
+			log, err = queryEvents(tx, "ORDER BY id");
+		} else {
+			log, err = queryEvents(tx, "WHERE id > $1 ORDER BY id", after);
+		}
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+
+	upTo := syncPoint(log, after, result.Full);
+	result.Cursor = encodeSyncCursor(upTo);
+
+	// nil lists select everything
+	var taskIds, categoryIds, sharedCategoryIds []int;
+	if (!result.Full) {
+		taskIds, categoryIds, sharedCategoryIds = []int{}, []int{}, []int{};
+		for _, e := range log {
+			if (e.Id > upTo || !e.visibleTo(userId)) {
+				continue;
+			}
+			if (e.Task_Id.Valid) {
+				taskIds = append(taskIds, int(e.Task_Id.Int64));
+			} else if (e.Category_Id.Valid) {
+				categoryIds = append(categoryIds, int(e.Category_Id.Int64));
+				// the tasks of a category the user was just given are new to them too
+				if (e.Type == "category.created") {
+					sharedCategoryIds = append(sharedCategoryIds, int(e.Category_Id.Int64));
+				}
+			}
+		}
+	}
+
+	tasks, err := tx.Query(context.Background(), "SELECT * FROM public.get_all_tasks($1) WHERE $2::int[] IS NULL OR id = ANY($2) OR category_id = ANY($3);", userId, taskIds, sharedCategoryIds)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	for tasks.Next() {
+		var t Task
+		err = scanTask(tasks, &t)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		result.Tasks = append(result.Tasks, t)
+	}
+	tasks.Close();
+
+	categories, err := tx.Query(context.Background(), `
+		SELECT categories.id, categories.title, accessible.role, categories.workspace_id, categories.parent_id
+		FROM categories
+			INNER JOIN public.get_accessible_categories($1) AS accessible ON categories.id=accessible.category_id
+		WHERE $2::int[] IS NULL OR categories.id = ANY($2)
+		ORDER BY categories.id;`, userId, categoryIds)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return result, err;
+	}
+	for categories.Next() {
+		var cat Category
+		err = categories.Scan(&cat.Id, &cat.Title, &cat.Role, &cat.Workspace_Id, &cat.Parent_Id)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return result, err;
+		}
+		result.Categories = append(result.Categories, cat)
+	}
+	categories.Close();
+
+	// whatever changed but can no longer be seen is gone as far as the user is concerned
+	found := map[int]bool{};
+	for _, t := range result.Tasks {
+		found[t.Id] = true;
+	}
+	for _, id := range taskIds {
+		if (!found[id]) {
+			found[id] = true;
+			result.Deleted_Task_Ids = append(result.Deleted_Task_Ids, id);
+		}
+	}
+	found = map[int]bool{};
+	for _, cat := range result.Categories {
+		found[cat.Id] = true;
+	}
+	for _, id := range categoryIds {
+		if (!found[id]) {
+			found[id] = true;
+			result.Deleted_Category_Ids = append(result.Deleted_Category_Ids, id);
+		}
+	}
+
+	return result, nil;
+}
+
+/* Applies a batch of mutations made by a client while offline, each in its own transaction, and returns what became of each */
+func syncPush(mutations []SyncMutation, userId int, client *gin.Context, cancel context.CancelFunc) ([]SyncMutationResult) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	results := []SyncMutationResult{};
+	for _, m := range mutations {
+		var result SyncMutationResult;
+		switch (m.Action) {
+		case "create":
+			result = syncCreate(c, m, userId);
+		case "update":
+			result = syncUpdate(c, m, userId);
+		case "delete":
+			result = syncDelete(c, m, userId);
+		default:
+			result = rejectMutation(m, 0, fmt.Errorf("action must be one of create, update or delete, not: %v", m.Action));
+		}
+		results = append(results, result);
+	}
+
+	return results;
+}
+
+/* Creates a task a client created while offline, unless it was already created by an earlier push of the same mutation */
+func syncCreate(c *pgx.Conn, m SyncMutation, userId int) SyncMutationResult {
+	if (m.Client_Task_Id == "") {
+		return rejectMutation(m, 0, errors.New("a created task needs a client_task_id"));
+	}
+	s, err := applyFields(TaskSnapshot{}, m.Fields);
+	if (err == nil) {
+		err = validateSyncedTask(s);
+	}
+	if (err != nil) {
+		return rejectMutation(m, 0, err);
+	}
+
+	role, err := categoryRole(c, userId, s.Category_Id);
+	if (err == nil && !hasRole(role, roleEditor)) {
+		err = fmt.Errorf("you need to be at least a %v of category with id: %v", roleEditor, s.Category_Id);
+	}
+	if (err != nil) {
+		return rejectMutation(m, 0, err);
+	}
+
+	tx, err := c.Begin(context.Background())
+	if (err != nil) {
+		return rejectMutation(m, 0, err);
+	}
+	defer tx.Rollback(context.Background())
+
+	// pushes of the same mutation that arrive at the same time are applied one after another, so that only the first creates the task
+	var id int;
+	_, err = tx.Exec(context.Background(), "SELECT pg_advisory_xact_lock(hashtext('sync ' || $1::text || ' ' || $2::text));", userId, m.Client_Task_Id)
+	if (err == nil) {
+		id, err = clientTaskId(tx, userId, m.Client_Task_Id);
+	}
+	if (err == nil && id != 0) {
+		return SyncMutationResult{Id: m.Id, Status: syncApplied, Task_Id: id, Rejected_Fields: map[string]json.RawMessage{}};
+	}
+
+	if (err == nil) {
+		id, err = insertTask(tx, CreateTaskParams{
+			Title: s.Title,
+			Description: s.Description,
+			Category_Id: strconv.Itoa(s.Category_Id),
+			Deadline: s.Deadline.Time,
+			Deadline_Date: s.Deadline_Date,
+		}, userId);
+	}
+	if (err == nil && s.Completed) {
+		err = completeNewTask(tx, id, userId);
+	}
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "INSERT INTO sync_client_ids (user_id, client_id, task_id) VALUES ($1, $2, $3);", userId, m.Client_Task_Id, id)
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (err != nil) {
+		return rejectMutation(m, 0, err);
+	}
+
+	return SyncMutationResult{Id: m.Id, Status: syncApplied, Task_Id: id, Rejected_Fields: map[string]json.RawMessage{}};
+}
+
+/* Applies the fields a client changed on a task while offline, resolving conflicts with changes made on the server (see the note at the top) */
+func syncUpdate(c *pgx.Conn, m SyncMutation, userId int) SyncMutationResult {
+	id, err := syncTaskId(c, m, userId);
+	if (err != nil) {
+		return rejectMutation(m, id, err);
+	}
+	for field := range m.Fields {
+		if (!syncFields[field]) {
+			return rejectMutation(m, id, fmt.Errorf("unknown field: %v", field));
+		}
+	}
+
+	rejected := map[string]json.RawMessage{};
+	err = changeTaskWith(c, id, userId, actionUpdate, func(tx pgx.Tx) error {
+		current, err := loadTaskSnapshot(tx, id, false);
+		if (err == nil && current.Deleted) {
+			err = errors.New("the task was deleted");
+		}
+		if (err != nil) {
+			return err;
+		}
+
+		var accepted map[string]json.RawMessage;
+		accepted, rejected, err = resolveSyncFields(current, m, func(field string) (*time.Time, error) {
+			var changedAt *time.Time;
+			err := tx.QueryRow(context.Background(), "SELECT MAX(created_at) FROM task_revisions WHERE task_id=$1 AND changes ? $2;", id, field).Scan(&changedAt);
+			return changedAt, err;
+		});
+		if (err != nil) {
+			return err;
+		}
+
+		merged, err := applyFields(current, accepted);
+		if (err == nil) {
+			err = validateSyncedTask(merged);
+		}
+		if (err == nil && merged.Category_Id != current.Category_Id) {
+			var role string;
+			role, err = categoryRole(tx, userId, merged.Category_Id);
+			if (err == nil && !hasRole(role, roleEditor)) {
+				err = fmt.Errorf("you need to be at least a %v of category with id: %v", roleEditor, merged.Category_Id);
+			}
+		}
+		if (err != nil || len(accepted) == 0) {
+			return err;
+		}
+
+		err = updateTaskFields(tx, UpdateTaskParams{
+			Id: id,
+			Title: merged.Title,
+			Description: merged.Description,
+			Category_Id: merged.Category_Id,
+			Deadline: merged.Deadline.Time,
+			Deadline_Date: merged.Deadline_Date,
+			Priority: merged.Priority,
+			Tags: merged.Tags,
+			Recurrence: merged.Recurrence,
+		});
+		if (err == nil && merged.Completed != current.Completed) {
+			_, err = tx.Exec(context.Background(), "UPDATE tasks SET completed=$1 WHERE id=$2;", merged.Completed, id);
+		}
+		return err;
+	})
+	if (err != nil) {
+		return rejectMutation(m, id, err);
+	}
+
+	result := SyncMutationResult{Id: m.Id, Status: syncApplied, Task_Id: id, Rejected_Fields: rejected};
+	if (len(rejected) == len(m.Fields) && len(rejected) > 0) {
+		result.Status = syncRejected;
+		result.Error = "every field was changed on the server after the client changed it";
+	} else if (len(rejected) > 0) {
+		result.Status = syncMerged;
+	}
+
+	return result;
+}
+
+/* Moves a task a client deleted while offline to the trash, unless it has been changed on the server since */
+func syncDelete(c *pgx.Conn, m SyncMutation, userId int) SyncMutationResult {
+	id, err := syncTaskId(c, m, userId);
+	if (err != nil) {
+		return rejectMutation(m, id, err);
+	}
+
+	var changedSince bool;
+	err = changeTaskWith(c, id, userId, actionDelete, func(tx pgx.Tx) error {
+		var deleted bool;
+		err := tx.QueryRow(context.Background(), "SELECT deleted_at IS NOT NULL, updated_at > $2 FROM tasks WHERE id=$1;", id, m.Changed_At).Scan(&deleted, &changedSince);
+		// a task that is already in the trash has nothing left to do
+		if (err != nil || deleted || changedSince) {
+			return err;
+		}
+
+		_, err = tx.Exec(context.Background(), "UPDATE tasks SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1;", id);
+		return err;
+	})
+	if (err == nil && changedSince) {
+		err = errors.New("the task was changed on the server after the client deleted it");
+	}
+	if (err != nil) {
+		return rejectMutation(m, id, err);
+	}
+
+	return SyncMutationResult{Id: m.Id, Status: syncApplied, Task_Id: id, Rejected_Fields: map[string]json.RawMessage{}};
+}
+
+/* Returns the server's id for the task a mutation is for, checking that the user can edit it */
+func syncTaskId(c *pgx.Conn, m SyncMutation, userId int) (int, error) {
+	id := m.Task_Id;
+	var err error;
+	if (id == 0 && m.Client_Task_Id != "") {
+		id, err = clientTaskId(c, userId, m.Client_Task_Id);
+		if (err == nil && id == 0) {
+			err = fmt.Errorf("no task found with client_task_id: %v", m.Client_Task_Id);
+		}
+		if (err != nil) {
+			return 0, err;
+		}
+	}
+
+	var role string;
+	err = c.QueryRow(context.Background(), `
+		SELECT accessible.role
+		FROM tasks
+			INNER JOIN public.get_accessible_categories($1) AS accessible ON tasks.category_id=accessible.category_id
+		WHERE tasks.id=$2;`, userId, id).Scan(&role);
+	if (err == pgx.ErrNoRows) {
+		return id, fmt.Errorf("no task found with id: %v", id);
+	}
+	if (err == nil && !hasRole(role, roleEditor)) {
+		err = fmt.Errorf("you need to be at least a %v of the category of task with id: %v", roleEditor, id);
+	}
+
+	return id, err;
+}
+
+/* Returns the id of the task a user's client created with the given client-side id, or 0 if there is none */
+func clientTaskId(c rowQuerier, userId int, clientId string) (int, error) {
+	var id int;
+	err := c.QueryRow(context.Background(), "SELECT task_id FROM sync_client_ids WHERE user_id=$1 AND client_id=$2;", userId, clientId).Scan(&id);
+	if (err == pgx.ErrNoRows) {
+		return 0, nil;
+	}
+
+	return id, err;
+}
+
+// returns how far a pull can move the cursor: up to just before the first event missing from the log that may still be committed
+//		(see eventGapWait), so that the next pull does not skip it. The first event of a full pull has no event before it to follow on from
+func syncPoint(log []ChangeEvent, after int64, full bool) int64 {
+	upTo := after;
+	for i, e := range log {
+		gap := e.Id != upTo + 1 && !(full && i == 0);
+		if (gap && time.Since(e.Created_at.Time.Time) < eventGapWait) {
+			break;
+		}
+		upTo = e.Id;
+	}
+
+	return upTo;
+}
+
+// decides which of the fields a client changed are applied to a task as it is now, and returns them along with those that lost,
+//		with the values the server kept (see the note at the top); lastChanged returns when a field last changed on the server, nil if never
+func resolveSyncFields(current TaskSnapshot, m SyncMutation, lastChanged func(field string) (*time.Time, error)) (map[string]json.RawMessage, map[string]json.RawMessage, error) {
+	accepted, rejected := map[string]json.RawMessage{}, map[string]json.RawMessage{};
+
+	wanted, err := applyFields(current, m.Fields);
+	if (err != nil) {
+		return accepted, rejected, err;
+	}
+	base, err := applyFields(current, m.Base);
+	if (err != nil) {
+		return accepted, rejected, err;
+	}
+	currentFields, wantedFields, baseFields := snapshotFields(current), snapshotFields(wanted), snapshotFields(base);
+
+	for field, value := range m.Fields {
+		_, hasBase := m.Base[field];
+		if (bytes.Equal(wantedFields[field], currentFields[field])) {
+			continue;
+		}
+		if (hasBase && bytes.Equal(baseFields[field], currentFields[field])) {
+			accepted[field] = value;
+			continue;
+		}
+
+		// changed on both sides, so the later change wins
+		changedAt, err := lastChanged(field);
+		if (err != nil) {
+			return accepted, rejected, err;
+		}
+		if (changedAt == nil || m.Changed_At.After(*changedAt)) {
+			accepted[field] = value;
+		} else {
+			rejected[field] = currentFields[field];
+		}
+	}
+
+	return accepted, rejected, nil;
+}
+
+// reads a set of task fields, written as in a task's history, into a copy of a snapshot
+func applyFields(s TaskSnapshot, fields map[string]json.RawMessage) (TaskSnapshot, error) {
+	for field := range fields {
+		if (!syncFields[field]) {
+			return s, fmt.Errorf("unknown field: %v", field);
+		}
+	}
+
+	b, err := json.Marshal(fields);
+	if (err == nil) {
+		err = json.Unmarshal(b, &s);
+	}
+	// deadlines are stored in UTC, so that the same moment always compares equal
+	if (s.Deadline.Valid) {
+		s.Deadline.Time.Time = s.Deadline.Time.Time.UTC();
+	}
+
+	return s, err;
+}
+
+// returns the fields of a snapshot as JSON, keyed by their names, in the form diffSnapshots compares them in
+func snapshotFields(s TaskSnapshot) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{};
+	b, err := json.Marshal(s);
+	if (err == nil) {
+		json.Unmarshal(b, &fields);
+	}
+
+	return fields;
+}
+
+// returns why a task made or changed by a client cannot be saved, or nil if it can
+func validateSyncedTask(s TaskSnapshot) error {
+	if (strings.TrimSpace(s.Title) == "") {
+		return errors.New("a task needs a title");
+	}
+	if (s.Category_Id == 0) {
+		return errors.New("a task needs a category_id");
+	}
+	if (s.Deadline.Valid && s.Deadline_Date.Valid) {
+		return errors.New("a task can have either a deadline or a deadline_date, but not both");
+	}
+
+	return nil;
+}
+
+// the result of a mutation that could not be applied at all
+func rejectMutation(m SyncMutation, taskId int, e error) SyncMutationResult {
+	return SyncMutationResult{Id: m.Id, Status: syncRejected, Task_Id: taskId, Rejected_Fields: map[string]json.RawMessage{}, Error: e.Error()};
+}
+
+// cursors are opaque to clients, so that what they hold can change without breaking them
+func encodeSyncCursor(eventId int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("v1:" + strconv.FormatInt(eventId, 10)));
+}
+
+// returns the event a cursor points at, or 0 for no cursor
+func decodeSyncCursor(cursor string) (int64, error) {
+	if (cursor == "") {
+		return 0, nil;
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor);
+	if (err != nil || !strings.HasPrefix(string(b), "v1:")) {
+		return 0, errors.New("invalid sync cursor");
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(b), "v1:"), 10, 64);
+	if (err != nil || id < 0) {
+		return 0, errors.New("invalid sync cursor");
+	}
+
+	return id, nil;
+}
+
+// reports to the client that its sync request cannot be understood,
+//		and stops execution of any remaining function-calls
+func assertValidSync(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Invalid sync request: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"github.com/emvi/null"
+)
+
+// a task as it is on the server
+func syncedTask() TaskSnapshot {
+	return TaskSnapshot{
+		Title: "buy milk",
+		Description: "lactose-free",
+		Category_Id: 1,
+		Deadline: Timestamp{null.NewTime(time.Date(2026, time.October, 14, 8, 0, 0, 0, time.UTC), true)},
+		Tags: []string{},
+	};
+}
+
+// turns a map of fields written as JSON into the form SyncMutation holds them in
+func rawFields(t *testing.T, fields map[string]string) map[string]json.RawMessage {
+	t.Helper();
+	raw := map[string]json.RawMessage{};
+	for name, value := range fields {
+		if (!json.Valid([]byte(value))) {
+			t.Fatalf("%v is not JSON: %v", name, value);
+		}
+		raw[name] = json.RawMessage(value);
+	}
+
+	return raw;
+}
+
+func TestApplyFields(t *testing.T) {
+	s, err := applyFields(syncedTask(), rawFields(t, map[string]string{"title": `"buy oat milk"`, "deadline": `"2026-10-14T18:00:00+08:00"`, "completed": `true`}));
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	if (s.Title != "buy oat milk" || !s.Completed || s.Description != "lactose-free") {
+		t.Errorf("applyFields gave %+v", s);
+	}
+	// deadlines are kept in UTC, so that the same moment always compares equal
+	if (s.Deadline.Time.Time.Location() != time.UTC || !s.Deadline.Time.Time.Equal(time.Date(2026, time.October, 14, 10, 0, 0, 0, time.UTC))) {
+		t.Errorf("the deadline is %v, want 10:00 UTC", s.Deadline.Time.Time);
+	}
+
+	_, err = applyFields(syncedTask(), rawFields(t, map[string]string{"priority": `"high"`}));
+	if (err == nil) {
+		t.Errorf("applyFields accepted a field clients cannot change");
+	}
+	_, err = applyFields(syncedTask(), rawFields(t, map[string]string{"category_id": `"one"`}));
+	if (err == nil) {
+		t.Errorf("applyFields accepted a category_id that is not a number");
+	}
+}
+
+func TestSnapshotFields(t *testing.T) {
+	fields := snapshotFields(syncedTask());
+	for name, want := range map[string]string{"title": `"buy milk"`, "category_id": `1`, "deadline": `"2026-10-14T08:00:00Z"`, "deadline_date": `null`, "completed": `false`} {
+		if (string(fields[name]) != want) {
+			t.Errorf("%v is %s, want %v", name, fields[name], want);
+		}
+	}
+	for name := range syncFields {
+		if _, ok := fields[name]; (!ok) {
+			t.Errorf("the snapshot has no field %v, which clients can change", name);
+		}
+	}
+}
+
+func TestResolveSyncFields(t *testing.T) {
+	serverChange := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC);
+	before, after := serverChange.Add(-time.Hour), serverChange.Add(time.Hour);
+
+	tests := []struct {
+		name string
+		fields map[string]string
+		base map[string]string
+		changedAt time.Time
+		// when each field last changed on the server; fields that are not given never changed
+		lastChanged map[string]time.Time
+		accepted []string
+		rejected map[string]string
+	}{
+		{
+			name: "the server still has the base",
+			fields: map[string]string{"title": `"buy oat milk"`},
+			base: map[string]string{"title": `"buy milk"`},
+			changedAt: before,
+			lastChanged: map[string]time.Time{"title": serverChange},
+			accepted: []string{"title"},
+		},
+		{
+			name: "the client set what the server already has",
+			fields: map[string]string{"title": `"buy milk"`},
+			base: map[string]string{"title": `"milk"`},
+			changedAt: before,
+		},
+		{
+			name: "changed on both sides, later on the server",
+			fields: map[string]string{"title": `"buy oat milk"`, "description": `"any brand"`},
+			base: map[string]string{"title": `"milk"`, "description": `"lactose-free"`},
+			changedAt: before,
+			lastChanged: map[string]time.Time{"title": serverChange},
+			accepted: []string{"description"},
+			rejected: map[string]string{"title": `"buy milk"`},
+		},
+		{
+			name: "changed on both sides, later on the client",
+			fields: map[string]string{"title": `"buy oat milk"`},
+			base: map[string]string{"title": `"milk"`},
+			changedAt: after,
+			lastChanged: map[string]time.Time{"title": serverChange},
+			accepted: []string{"title"},
+		},
+		{
+			name: "no base, and never changed on the server",
+			fields: map[string]string{"completed": `true`},
+			changedAt: before,
+			accepted: []string{"completed"},
+		},
+		{
+			name: "no base, and changed on the server since",
+			fields: map[string]string{"completed": `true`},
+			changedAt: before,
+			lastChanged: map[string]time.Time{"completed": serverChange},
+			rejected: map[string]string{"completed": `false`},
+		},
+		{
+			// the same moment in another offset is not a change
+			name: "base deadline in another offset",
+			fields: map[string]string{"deadline": `"2026-10-15T09:00:00+02:00"`},
+			base: map[string]string{"deadline": `"2026-10-14T16:00:00+08:00"`},
+			changedAt: before,
+			lastChanged: map[string]time.Time{"deadline": serverChange},
+			accepted: []string{"deadline"},
+		},
+	}
+	for _, test := range tests {
+		m := SyncMutation{Fields: rawFields(t, test.fields), Base: rawFields(t, test.base), Changed_At: test.changedAt};
+		accepted, rejected, err := resolveSyncFields(syncedTask(), m, func(field string) (*time.Time, error) {
+			if changedAt, ok := test.lastChanged[field]; (ok) {
+				return &changedAt, nil;
+			}
+			return nil, nil;
+		});
+		if (err != nil) {
+			t.Errorf("%v: %v", test.name, err);
+			continue;
+		}
+
+		wantAccepted := map[string]json.RawMessage{};
+		for _, field := range test.accepted {
+			wantAccepted[field] = m.Fields[field];
+		}
+		wantRejected := rawFields(t, test.rejected);
+		if (!reflect.DeepEqual(accepted, wantAccepted) || !reflect.DeepEqual(rejected, wantRejected)) {
+			t.Errorf("%v: accepted %s and rejected %s, want %s and %s", test.name, accepted, rejected, wantAccepted, wantRejected);
+		}
+	}
+
+	m := SyncMutation{Fields: rawFields(t, map[string]string{"title": `"buy oat milk"`}), Changed_At: before};
+	failure := errors.New("the history could not be read");
+	_, _, err := resolveSyncFields(syncedTask(), m, func(field string) (*time.Time, error) {
+		return nil, failure;
+	});
+	if (err != failure) {
+		t.Errorf("resolveSyncFields returned %v, want the error reading the history", err);
+	}
+}
+
+func TestSyncPoint(t *testing.T) {
+	old := time.Now().Add(-time.Minute);
+	recent := time.Now();
+	events := func(ids []int64, createdAt time.Time) []ChangeEvent {
+		var log []ChangeEvent;
+		for _, id := range ids {
+			log = append(log, ChangeEvent{Id: id, Created_at: Timestamp{null.NewTime(createdAt, true)}});
+		}
+		return log;
+	};
+
+	tests := []struct {
+		name string
+		log []ChangeEvent
+		after int64
+		full bool
+		want int64
+	}{
+		{"nothing new", nil, 7, false, 7},
+		{"no gaps", events([]int64{8, 9, 10}, recent), 7, false, 10},
+		{"a gap that may still be committed", events([]int64{8, 10, 11}, recent), 7, false, 8},
+		{"a gap at the start that may still be committed", events([]int64{9, 10}, recent), 7, false, 7},
+		{"a gap that was rolled back", events([]int64{8, 10, 11}, old), 7, false, 11},
+		{"a full pull starts anywhere", events([]int64{42, 43}, recent), 0, true, 43},
+		{"a full pull still waits for later gaps", events([]int64{42, 44}, recent), 0, true, 42},
+	}
+	for _, test := range tests {
+		if got := syncPoint(test.log, test.after, test.full); (got != test.want) {
+			t.Errorf("%v: syncPoint = %v, want %v", test.name, got, test.want);
+		}
+	}
+}
+
+func TestSyncCursor(t *testing.T) {
+	for _, id := range []int64{0, 1, 1234567890123} {
+		got, err := decodeSyncCursor(encodeSyncCursor(id));
+		if (err != nil || got != id) {
+			t.Errorf("cursor for %v decodes to %v, %v", id, got, err);
+		}
+	}
+	if id, err := decodeSyncCursor(""); (id != 0 || err != nil) {
+		t.Errorf("an empty cursor decodes to %v, %v, want 0", id, err);
+	}
+	for _, cursor := range []string{"42", "djE6", "bm9wZQ", "!!!"} {
+		if _, err := decodeSyncCursor(cursor); (err == nil) {
+			t.Errorf("decodeSyncCursor(%q) accepted a cursor the server never gave out", cursor);
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// note: a template task's deadline is relative to the date the template is instantiated at (its anchor):
+//		"+7d" is an all-day deadline a week after the anchor, "+2w" two weeks after, "-1d" the day before,
+//		"+3d@17:00" 5pm three days after, and "+36h" 36 hours after the start of the anchor date;
+//		times are in the timezone of the user who instantiates the template, and "" means no deadline
+type TemplateTask struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Deadline string `json:"deadline"`
+	Checklist []string `json:"checklist"`
+}
+
+type Template struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Created_at Timestamp `json:"created_at"`
+	Tasks []TemplateTask `json:"tasks"`
+}
+
+type CreateTemplateParams struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Tasks []TemplateTask `json:"tasks"`
+}
+
+type DeleteTemplateParams struct {
+	Id int `json:"id"`
+}
+
+type InstantiateTemplateParams struct {
+	Template_Id int `json:"template_id"`
+	Category_Id int `json:"category_id"`
+	Anchor_Date Date `json:"anchor_date"`
+}
+
+// note: the deadlines of the category's tasks are stored relative to Anchor_Date, or to today if it is not given
+type SaveCategoryAsTemplateParams struct {
+	Category_Id int `json:"category_id"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Anchor_Date Date `json:"anchor_date"`
+}
+
+// matches a relative deadline, see TemplateTask
+var relativeDeadlinePattern = regexp.MustCompile(`^([+-])(\d{1,4})([hdw])(?:@([01]?\d|2[0-3]):([0-5]\d))?$`)
+
+/* ------------------------------------------------------------ TEMPLATES --------------------- */
+// works out the deadline of a template task instantiated at the anchor date in the given timezone,
+//		returning either a timed deadline or an all-day deadline date, or neither if offset is ""
+func resolveRelativeDeadline(offset string, anchor time.Time, loc *time.Location) (null.Time, Date, error) {
+	var deadline null.Time;
+	var deadlineDate Date;
+	if (offset == "") {
+		return deadline, deadlineDate, nil;
+	}
+
+	match := relativeDeadlinePattern.FindStringSubmatch(offset);
+	if (match == nil || (match[3] == "h" && match[4] != "")) {
+		return deadline, deadlineDate, fmt.Errorf("%q is not a relative deadline like \"+7d\", \"+2w\", \"+3d@17:00\" or \"+36h\"", offset);
+	}
+
+	n, _ := strconv.Atoi(match[2]);
+	if (match[1] == "-") {
+		n = -n;
+	}
+	year, month, day := anchor.Date();
+
+	switch (match[3]) {
+	case "h":
+		deadline = null.NewTime(time.Date(year, month, day, 0, 0, 0, 0, loc).Add(time.Duration(n) * time.Hour), true);
+		return deadline, deadlineDate, nil;
+	case "w":
+		n *= 7;
+	}
+
+	if (match[4] == "") {
+		deadlineDate.Time = null.NewTime(time.Date(year, month, day + n, 0, 0, 0, 0, time.UTC), true);
+		return deadline, deadlineDate, nil;
+	}
+
+	hour, _ := strconv.Atoi(match[4]);
+	minute, _ := strconv.Atoi(match[5]);
+	deadline = null.NewTime(time.Date(year, month, day + n, hour, minute, 0, 0, loc), true);
+
+	return deadline, deadlineDate, nil;
+}
+
+// the opposite of resolveRelativeDeadline: describes a task's deadline relative to the anchor date, in the given timezone
+func relativeDeadline(t Task, anchor time.Time, loc *time.Location) string {
+	var due time.Time;
+	switch {
+	case t.Deadline_Date.Valid:
+		due = t.Deadline_Date.Time.Time;
+	case t.Deadline.Valid:
+		due = t.Deadline.Time.Time.In(loc);
+	default:
+		return "";
+	}
+
+	// count whole days between the two dates, ignoring the time of day and any daylight saving changes in between
+	year, month, day := anchor.Date();
+	from := time.Date(year, month, day, 0, 0, 0, 0, time.UTC);
+	year, month, day = due.Date();
+	to := time.Date(year, month, day, 0, 0, 0, 0, time.UTC);
+	days := int(to.Sub(from).Hours() / 24);
+
+	offset := fmt.Sprintf("%+dd", days);
+	if (t.Deadline.Valid) {
+		offset += due.Format("@15:04");
+	}
+
+	return offset;
+}
+
+/* Returns the templates a user has saved, oldest first */
+func getTemplates(userId int, client *gin.Context, cancel context.CancelFunc) ([]Template) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	templateSlice := []Template{}
+
+	templates, err := c.Query(context.Background(), "SELECT id, title, description, created_at FROM task_templates WHERE owner_id=$1 ORDER BY id;", userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return templateSlice;
+	}
+
+	index := map[int]int{};
+	for templates.Next() {
+		var t Template
+		err = templates.Scan(&t.Id, &t.Title, &t.Description, &t.Created_at)
+		assertDBOperationSuccess(client, cancel, err);
+		t.Tasks = []TemplateTask{};
+		index[t.Id] = len(templateSlice);
+		templateSlice = append(templateSlice, t)
+	}
+	templates.Close();
+
+	tasks, err := c.Query(context.Background(), `
+		SELECT template_tasks.template_id, template_tasks.title, template_tasks.description, template_tasks.deadline, template_tasks.checklist
+		FROM template_tasks
+			INNER JOIN task_templates ON template_tasks.template_id=task_templates.id
+		WHERE task_templates.owner_id=$1
+		ORDER BY template_tasks.template_id, template_tasks.position;`, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return templateSlice;
+	}
+	defer tasks.Close();
+
+	for tasks.Next() {
+		var templateId int
+		var t TemplateTask
+		err = tasks.Scan(&templateId, &t.Title, &t.Description, &t.Deadline, &t.Checklist)
+		assertDBOperationSuccess(client, cancel, err);
+		i := index[templateId];
+		templateSlice[i].Tasks = append(templateSlice[i].Tasks, t)
+	}
+
+	return templateSlice;
+}
+
+/* Saves a new template for a user and returns its id */
+func addTemplate(params CreateTemplateParams, userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	err := validateTemplate(params);
+	if (err != nil) {
+		return 0, assertValidTemplate(client, cancel, err);
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	id, err := insertTemplate(tx, params, userId);
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Deletes one of a user's templates; tasks created from it are not affected */
+func deleteTemplate(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "DELETE FROM task_templates WHERE id=$1 AND owner_id=$2;", id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertTemplateFound(client, cancel, id);
+	}
+
+	return nil;
+}
+
+/* Creates every task of a template, with its checklist, at the end of a category, all in one transaction;
+		deadlines are worked out from the anchor date in the given timezone. Returns the ids of the new tasks, in order */
+func instantiateTemplate(params InstantiateTemplateParams, userId int, loc *time.Location, client *gin.Context, cancel context.CancelFunc) ([]int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	ids := []int{};
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return ids, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	var owned bool;
+	err = tx.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM task_templates WHERE id=$1 AND owner_id=$2);", params.Template_Id, userId).Scan(&owned);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return ids, err;
+	}
+	if (!owned) {
+		return ids, assertTemplateFound(client, cancel, params.Template_Id);
+	}
+
+	rows, err := tx.Query(context.Background(), "SELECT title, description, deadline, checklist FROM template_tasks WHERE template_id=$1 ORDER BY position;", params.Template_Id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return ids, err;
+	}
+	var templateTasks []TemplateTask;
+	for rows.Next() {
+		var t TemplateTask;
+		err = rows.Scan(&t.Title, &t.Description, &t.Deadline, &t.Checklist);
+		if (err != nil) {
+			break;
+		}
+		templateTasks = append(templateTasks, t);
+	}
+	rows.Close();
+	if (err == nil) {
+		err = rows.Err();
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return ids, err;
+	}
+
+	anchor := params.Anchor_Date.Time.Time;
+	if (!params.Anchor_Date.Valid) {
+		anchor = time.Now().In(loc);
+	}
+
+	for _, t := range templateTasks {
+		task := CreateTaskParams{Title: t.Title, Description: t.Description, Category_Id: strconv.Itoa(params.Category_Id)};
+		task.Deadline, task.Deadline_Date, err = resolveRelativeDeadline(t.Deadline, anchor, loc);
+		if (err != nil) {
+			return ids, assertValidTemplate(client, cancel, err);
+		}
+
+		id, err := insertTask(tx, task, userId);
+		if (err == nil) {
+			_, err = insertChecklistItems(tx, id, t.Checklist);
+		}
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return []int{}, err;
+		}
+		ids = append(ids, id);
+	}
+
+	err = tx.Commit(context.Background());
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return []int{}, err;
+	}
+
+	return ids, nil;
+}
+
+/* Saves the tasks in a category, in their manual order and with their checklists, as a new template of the user's;
+		deadlines are stored relative to the anchor date in the given timezone. Returns the id of the template */
+func saveCategoryAsTemplate(params SaveCategoryAsTemplateParams, userId int, loc *time.Location, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	anchor := params.Anchor_Date.Time.Time;
+	if (!params.Anchor_Date.Valid) {
+		anchor = time.Now().In(loc);
+	}
+
+	template := CreateTemplateParams{Title: params.Title, Description: params.Description, Tasks: []TemplateTask{}};
+	for _, t := range getTaskByCategoryId(params.Category_Id, client, cancel) {
+		checklist := []string{};
+		for _, item := range t.Checklist {
+			checklist = append(checklist, item.Title);
+		}
+		template.Tasks = append(template.Tasks, TemplateTask{
+			Title: t.Title,
+			Description: t.Description,
+			Deadline: relativeDeadline(t, anchor, loc),
+			Checklist: checklist,
+		});
+	}
+
+	return addTemplate(template, userId, client, cancel);
+}
+
+/* Inserts a template and its tasks, as part of a larger transaction, and returns the template's id */
+func insertTemplate(tx pgx.Tx, params CreateTemplateParams, userId int) (int, error) {
+	var id int;
+	err := tx.QueryRow(context.Background(), "INSERT INTO task_templates (owner_id, title, description) VALUES ($1, $2, $3) RETURNING id;", userId, params.Title, params.Description).Scan(&id);
+	if (err != nil) {
+		return 0, err;
+	}
+
+	for position, t := range params.Tasks {
+		checklist := t.Checklist;
+		if (checklist == nil) {
+			checklist = []string{};
+		}
+		_, err = tx.Exec(context.Background(), "INSERT INTO template_tasks (template_id, position, title, description, deadline, checklist) VALUES ($1, $2, $3, $4, $5, $6);", id, position, t.Title, t.Description, t.Deadline, checklist);
+		if (err != nil) {
+			return 0, err;
+		}
+	}
+
+	return id, nil;
+}
+
+// returns why a template cannot be saved, or nil if it can
+func validateTemplate(params CreateTemplateParams) error {
+	if (params.Title == "") {
+		return errors.New("a template needs a title");
+	}
+	for i, t := range params.Tasks {
+		if (t.Title == "") {
+			return fmt.Errorf("task %v of the template needs a title", i + 1);
+		}
+		// any anchor will do, only whether the deadline can be worked out at all matters here
+		_, _, err := resolveRelativeDeadline(t.Deadline, time.Now(), time.UTC);
+		if (err != nil) {
+			return err;
+		}
+	}
+
+	return nil;
+}
+
+// reports to the client that a template cannot be saved or instantiated as given,
+//		and stops execution of any remaining function-calls
+func assertValidTemplate(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Invalid template: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that there is no template with the given id that belongs to the user,
+//		and stops execution of any remaining function-calls
+func assertTemplateFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no template found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
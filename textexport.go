@@ -0,0 +1,712 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// note: a category, or any other list of tasks picked out by a TaskListFilter, can be exported as a checklist for people
+//		who do not use the app, as Markdown, plain text or HTML:
+//			- [ ] Buy milk — due 13 Apr
+//			  Semi-skimmed, two bottles
+//			- [x] Call the plumber
+//		Descriptions are written below their task as indented notes, and dates in the user's timezone (with the year only
+//		when it is not this year). A list that covers more than one category has a heading for each of them.
+//
+//		The list can also be shared read-only through a share link, an address holding a secret token that works without
+//		logging in until its expiry date, or until it is revoked. A share link shows the tasks as they are when it is opened,
+//		and only those its owner can still see; /shared/<token> is in the link's format, and /shared/<token>.md, .txt or .html
+//		in the one asked for
+type TaskListFilter struct {
+	// the category to export, or null for every category the user has access to
+	Category_Id null.Int64 `json:"category_id"`
+	// also export the tasks of every category nested inside it
+	Include_Descendants bool `json:"include_descendants"`
+	// "today", "upcoming", "overdue" or "unscheduled" to only export the tasks in one of the smart views (see views.go),
+	//		or "" for all of them
+	View string `json:"view"`
+	// the number of days of the "upcoming" view, defaultUpcomingDays if not given
+	Days int `json:"days"`
+	// only export tasks that have every one of these tags
+	Tags []string `json:"tags"`
+	// only export tasks with this priority
+	Priority null.String `json:"priority"`
+	// leave out completed tasks; the smart views never have any
+	Hide_Completed bool `json:"hide_completed"`
+}
+
+type ExportTaskListParams struct {
+	TaskListFilter
+	// "markdown", "text" or "html", "markdown" if not given
+	Format string `json:"format"`
+}
+
+type ShareLink struct {
+	Id int `json:"id"`
+	Url string `json:"url"`
+	Format string `json:"format"`
+	Filter TaskListFilter `json:"filter"`
+	Expires_at Timestamp `json:"expires_at"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+type CreateShareLinkParams struct {
+	TaskListFilter
+	// "markdown", "text" or "html", "html" if not given, as the link is mostly opened in a browser
+	Format string `json:"format"`
+	// when the link stops working, at most maxShareLinkLifetime from now
+	Expires_at null.Time `json:"expires_at"`
+}
+
+type ShareLinkIdParams struct {
+	Id int `json:"id"`
+}
+
+// a list of tasks, ready to be written out
+type taskList struct {
+	title string
+	// the tasks by category, in the order their categories first come up in the list
+	groups []taskListGroup
+	// whether the list covers more than one category, and so has a heading for each of them
+	grouped bool
+}
+
+type taskListGroup struct {
+	title string
+	tasks []Task
+}
+
+// a format a task list can be written in
+type taskListFormat struct {
+	contentType string
+	extension string
+	write func(w io.Writer, list taskList, now time.Time, loc *time.Location) error
+}
+
+var taskListFormats = map[string]taskListFormat{
+	"markdown": {"text/markdown; charset=utf-8", ".md", writeMarkdownTaskList},
+	"text": {"text/plain; charset=utf-8", ".txt", writeTextTaskList},
+	"html": {"text/html; charset=utf-8", ".html", writeHTMLTaskList},
+}
+
+// the titles of the smart views a task list can be narrowed down to
+var taskListViews = map[string]string{
+	"today": "Today",
+	"upcoming": "Upcoming",
+	"overdue": "Overdue",
+	"unscheduled": "Unscheduled",
+}
+
+// the longest a share link can work for
+const maxShareLinkLifetime = 365 * 24 * time.Hour
+
+// where shared lists are served from; the token that follows it is kept out of the request log (see logFormatter)
+const sharedListPath = "/shared/"
+
+/* ------------------------------------------------------------ TASK LISTS --------------------- */
+/* Returns the tasks a user can see that match a filter, as a list grouped by category */
+func getTaskList(filter TaskListFilter, user User, client *gin.Context, cancel context.CancelFunc) (taskList, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	list := taskList{title: "All tasks", groups: []taskListGroup{}, grouped: !filter.Category_Id.Valid || filter.Include_Descendants};
+
+	if (filter.Category_Id.Valid) {
+		categoryId := int(filter.Category_Id.Int64);
+		role, err := categoryRole(c, user.Id, categoryId);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return list, err;
+		}
+		// categories the user has no access to (any more) are reported as missing, as they are everywhere else
+		if (role == "") {
+			return list, assertCategoryFound(client, cancel, categoryId);
+		}
+		err = c.QueryRow(context.Background(), "SELECT title FROM categories WHERE id=$1;", categoryId).Scan(&list.title);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return list, err;
+		}
+	}
+	if view, ok := taskListViews[filter.View]; (ok) {
+		if (filter.Category_Id.Valid) {
+			list.title += " — " + view;
+		} else {
+			list.title = view;
+		}
+	}
+
+	rows, err := c.Query(context.Background(), `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT $2::int
+			UNION
+			SELECT categories.id FROM categories INNER JOIN subtree ON categories.parent_id=subtree.id WHERE $3::boolean
+		)
+		SELECT tasks.* FROM public.get_all_tasks($1) AS tasks
+		WHERE $2::int IS NULL OR tasks.category_id IN (SELECT id FROM subtree)
+		ORDER BY tasks.category_id, tasks.rank COLLATE "C", tasks.id;`, user.Id, filter.Category_Id, filter.Include_Descendants)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return list, err;
+	}
+	defer rows.Close();
+
+	var tasks []Task;
+	for rows.Next() {
+		var t Task
+		err = scanTask(rows, &t)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return list, err;
+		}
+		tasks = append(tasks, t)
+	}
+	if (assertDBOperationSuccess(client, cancel, rows.Err()) != nil) {
+		return list, rows.Err();
+	}
+
+	loc := locationOf(user);
+	lastCategoryId := 0;
+	for _, t := range filterTaskList(localiseTasks(tasks, loc), filter, time.Now(), loc) {
+		if (len(list.groups) == 0 || t.Category_Id != lastCategoryId) {
+			lastCategoryId = t.Category_Id;
+			list.groups = append(list.groups, taskListGroup{title: t.Category});
+		}
+		list.groups[len(list.groups) - 1].tasks = append(list.groups[len(list.groups) - 1].tasks, t);
+	}
+
+	return list, nil;
+}
+
+// returns the tasks that match a filter; the tasks must have been passed through localiseTasks, as for the smart views
+func filterTaskList(tasks []Task, filter TaskListFilter, now time.Time, loc *time.Location) []Task {
+	matching := []Task{};
+	for _, t := range tasks {
+		if (filter.View != "" || filter.Hide_Completed) && t.Completed {
+			continue;
+		}
+		if (filter.Priority.Valid && t.Priority.String != filter.Priority.String) {
+			continue;
+		}
+		if (!hasEveryTag(t, filter.Tags)) {
+			continue;
+		}
+		matching = append(matching, t);
+	}
+
+	switch (filter.View) {
+	case "today":
+		matching = todayView(matching, now, loc).Tasks;
+	case "upcoming":
+		days := upcomingView(matching, filter.Days, now, loc).Days;
+		matching = []Task{};
+		for _, day := range days {
+			matching = append(matching, day.Tasks...);
+		}
+	case "overdue":
+		matching = overdueView(matching, now).Tasks;
+	case "unscheduled":
+		matching = unscheduledView(matching).Tasks;
+	default:
+		return matching;
+	}
+
+	// the smart views put the tasks in order of their deadline, which keeps within each category once they are grouped
+	grouped := []Task{};
+	added := map[int]bool{};
+	for _, t := range matching {
+		if (added[t.Category_Id]) {
+			continue;
+		}
+		added[t.Category_Id] = true;
+		for _, other := range matching {
+			if (other.Category_Id == t.Category_Id) {
+				grouped = append(grouped, other);
+			}
+		}
+	}
+
+	return grouped;
+}
+
+// checks if a task has every one of the given tags, ignoring case
+func hasEveryTag(t Task, tags []string) bool {
+	for _, tag := range tags {
+		found := false;
+		for _, own := range t.Tags {
+			if (strings.EqualFold(own, tag)) {
+				found = true;
+				break;
+			}
+		}
+		if (!found) {
+			return false;
+		}
+	}
+
+	return true;
+}
+
+// fills in the defaults of a filter
+func normaliseTaskListFilter(filter TaskListFilter) TaskListFilter {
+	if (filter.View == "upcoming" && filter.Days <= 0) {
+		filter.Days = defaultUpcomingDays;
+	} else if (filter.View == "upcoming" && filter.Days > maxUpcomingDays) {
+		filter.Days = maxUpcomingDays;
+	}
+	if (filter.View != "upcoming") {
+		filter.Days = 0;
+	}
+	if (filter.Tags == nil) {
+		filter.Tags = []string{};
+	}
+
+	return filter;
+}
+
+/* Writes a task list in the given format, as a download unless inline is true */
+func serveTaskList(list taskList, format string, inline bool, loc *time.Location, client *gin.Context) {
+	f := taskListFormats[format];
+
+	disposition := "attachment";
+	if (inline) {
+		disposition = "inline";
+	}
+	client.Header("Content-Type", f.contentType);
+	client.Header("Content-Disposition", fmt.Sprintf(`%v; filename="%v"`, disposition, taskListFilename(list.title) + f.extension));
+	// the HTML needs nothing but its own styles, and titles written by users must never run as scripts
+	client.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'");
+	client.Status(200);
+	err := f.write(client.Writer, list, time.Now(), loc);
+	if (err != nil) {
+		fmt.Fprintf(os.Stderr, "Unable to write task list: %v\n", err);
+	}
+}
+
+// returns the name of the file a task list is downloaded as, without its extension, e.g. "home-today" for "Home — Today"
+func taskListFilename(title string) string {
+	var b strings.Builder;
+	dash := false;
+	for _, r := range strings.ToLower(title) {
+		if (r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			if (dash && b.Len() > 0) {
+				b.WriteByte('-');
+			}
+			b.WriteRune(r);
+			dash = false;
+		} else {
+			dash = true;
+		}
+	}
+	if (b.Len() == 0) {
+		return "tasks";
+	}
+
+	return b.String();
+}
+
+/* ------------------------------------------------------------ FORMATS --------------------- */
+// writes a task list as a Markdown checklist, with a heading for every category if it covers more than one
+func writeMarkdownTaskList(w io.Writer, list taskList, now time.Time, loc *time.Location) error {
+	var b strings.Builder;
+	b.WriteString("# " + escapeMarkdown(list.title) + "\n");
+	if (len(list.groups) == 0) {
+		b.WriteString("\nNo tasks.\n");
+	}
+
+	for _, group := range list.groups {
+		if (list.grouped) {
+			b.WriteString("\n## " + escapeMarkdown(group.title) + "\n");
+		}
+		b.WriteString("\n");
+		for _, t := range group.tasks {
+			box := "[ ]";
+			if (t.Completed) {
+				box = "[x]";
+			}
+			b.WriteString("- " + box + " " + escapeMarkdown(t.Title) + taskListDue(t, now, loc) + "\n");
+			for _, line := range taskListNotes(t) {
+				b.WriteString(indentNote("  ", line) + "\n");
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String());
+	return err;
+}
+
+// writes a task list as plain text, underlining the title and the heading of every category
+func writeTextTaskList(w io.Writer, list taskList, now time.Time, loc *time.Location) error {
+	var b strings.Builder;
+	b.WriteString(list.title + "\n" + strings.Repeat("=", utf8.RuneCountInString(list.title)) + "\n");
+	if (len(list.groups) == 0) {
+		b.WriteString("\nNo tasks.\n");
+	}
+
+	for _, group := range list.groups {
+		if (list.grouped) {
+			b.WriteString("\n" + group.title + "\n" + strings.Repeat("-", utf8.RuneCountInString(group.title)) + "\n");
+		}
+		b.WriteString("\n");
+		for _, t := range group.tasks {
+			box := "[ ]";
+			if (t.Completed) {
+				box = "[x]";
+			}
+			b.WriteString(box + " " + t.Title + taskListDue(t, now, loc) + "\n");
+			for _, line := range taskListNotes(t) {
+				b.WriteString(indentNote("    ", line) + "\n");
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String());
+	return err;
+}
+
+// writes a task list as a web page that needs nothing but itself, with the checkboxes disabled
+func writeHTMLTaskList(w io.Writer, list taskList, now time.Time, loc *time.Location) error {
+	var b strings.Builder;
+	title := html.EscapeString(list.title);
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>` + title + `</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+ul { list-style: none; padding-left: 0; }
+li { margin: 0.25em 0; }
+.done .title { text-decoration: line-through; color: #777; }
+.due { color: #777; }
+.notes { margin-left: 1.75em; color: #444; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>` + title + "</h1>\n");
+	if (len(list.groups) == 0) {
+		b.WriteString("<p>No tasks.</p>\n");
+	}
+
+	for _, group := range list.groups {
+		if (list.grouped) {
+			b.WriteString("<h2>" + html.EscapeString(group.title) + "</h2>\n");
+		}
+		b.WriteString("<ul>\n");
+		for _, t := range group.tasks {
+			if (t.Completed) {
+				b.WriteString(`<li class="done"><input type="checkbox" checked disabled> `);
+			} else {
+				b.WriteString(`<li><input type="checkbox" disabled> `);
+			}
+			b.WriteString(`<span class="title">` + html.EscapeString(t.Title) + "</span>");
+			if due := taskListDue(t, now, loc); (due != "") {
+				b.WriteString(` <span class="due">` + html.EscapeString(strings.TrimSpace(due)) + "</span>");
+			}
+			if notes := taskListNotes(t); (len(notes) > 0) {
+				b.WriteString(`<div class="notes">` + html.EscapeString(strings.Join(notes, "\n")) + "</div>");
+			}
+			b.WriteString("</li>\n");
+		}
+		b.WriteString("</ul>\n");
+	}
+	b.WriteString("</body>\n</html>\n");
+
+	_, err := io.WriteString(w, b.String());
+	return err;
+}
+
+// returns " — due 13 Apr" for a task that is due on the 13th of April this year, " — due 13 Apr 2027 17:00" for one that is due
+//		at 5 in the afternoon on that day next year, and "" for a task without a deadline
+func taskListDue(t Task, now time.Time, loc *time.Location) string {
+	var due time.Time;
+	layout := "2 Jan";
+	if (t.Deadline_Date.Valid) {
+		due = t.Deadline_Date.Time.Time;
+	} else if (t.Deadline.Valid) {
+		due = t.Deadline.Time.Time.In(loc);
+	} else {
+		return "";
+	}
+	if (due.Year() != now.In(loc).Year()) {
+		layout += " 2006";
+	}
+	if (!t.Deadline_Date.Valid) {
+		layout += " 15:04";
+	}
+
+	return " — due " + due.Format(layout);
+}
+
+// returns the lines of a task's description, without the blank lines around it
+func taskListNotes(t Task) []string {
+	description := strings.TrimSpace(strings.ReplaceAll(t.Description, "\r\n", "\n"));
+	if (description == "") {
+		return nil;
+	}
+
+	lines := strings.Split(description, "\n");
+	for i := range lines {
+		lines[i] = strings.TrimRightFunc(lines[i], unicode.IsSpace);
+	}
+
+	return lines;
+}
+
+// indents a line of a note, leaving blank lines empty
+func indentNote(indent string, line string) string {
+	if (line == "") {
+		return "";
+	}
+
+	return indent + line;
+}
+
+// escapes the characters that would otherwise be read as Markdown formatting in a title
+func escapeMarkdown(text string) string {
+	var b strings.Builder;
+	for _, r := range text {
+		if (strings.ContainsRune("\\`*_[]<>#|~", r)) {
+			b.WriteByte('\\');
+		}
+		b.WriteRune(r);
+	}
+
+	return b.String();
+}
+
+/* ------------------------------------------------------------ SHARE LINKS --------------------- */
+/* Creates a share link to the tasks a user can see that match a filter, which works until the given time */
+func createShareLink(params CreateShareLinkParams, userId int, client *gin.Context, cancel context.CancelFunc) (ShareLink, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	link := ShareLink{Format: params.Format, Filter: normaliseTaskListFilter(params.TaskListFilter)};
+
+	b := make([]byte, 24);
+	_, err := rand.Read(b);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return link, err;
+	}
+	token := hex.EncodeToString(b);
+
+	err = c.QueryRow(context.Background(), `
+		INSERT INTO share_links (user_id, token, format, category_id, include_descendants, view, days, tags, priority, hide_completed, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, expires_at, created_at;`,
+		userId, token, link.Format, link.Filter.Category_Id, link.Filter.Include_Descendants, link.Filter.View, link.Filter.Days,
+		link.Filter.Tags, link.Filter.Priority, link.Filter.Hide_Completed, params.Expires_at).Scan(&link.Id, &link.Expires_at, &link.Created_at);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return link, err;
+	}
+	link.Url = shareLinkUrl(client, token, link.Format);
+
+	return link, nil;
+}
+
+/* Returns a user's share links, including the ones that have expired, newest first */
+func getShareLinks(userId int, client *gin.Context, cancel context.CancelFunc) ([]ShareLink) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	links := []ShareLink{};
+
+	rows, err := c.Query(context.Background(), "SELECT " + shareLinkColumns + " FROM share_links WHERE user_id=$1 ORDER BY id DESC;", userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return links;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		link, token, err := scanShareLink(rows);
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return links;
+		}
+		link.Url = shareLinkUrl(client, token, link.Format);
+		links = append(links, link)
+	}
+
+	return links;
+}
+
+/* Deletes one of a user's share links, after which its address no longer works */
+func revokeShareLink(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tag, err := c.Exec(context.Background(), "DELETE FROM share_links WHERE id=$1 AND user_id=$2;", id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (tag.RowsAffected() == 0) {
+		return assertShareLinkFound(client, cancel, fmt.Errorf("share link %v does not exist", id));
+	}
+
+	return nil;
+}
+
+/* Returns the share link with the given token, along with the user who created it, if it has not expired */
+func openShareLink(token string, client *gin.Context, cancel context.CancelFunc) (ShareLink, User, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var user User;
+	link, _, err := scanShareLink(c.QueryRow(context.Background(), `
+		SELECT ` + shareLinkColumns + `, users.id, users.username, users.timezone
+		FROM share_links INNER JOIN users ON share_links.user_id=users.id
+		WHERE share_links.token=$1;`, token), &user.Id, &user.Username, &user.Timezone);
+	if (err == pgx.ErrNoRows) {
+		return link, user, assertShareLinkFound(client, cancel, errors.New("there is no share link at this address, it may have been revoked"));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return link, user, err;
+	}
+	if (!link.Expires_at.Time.Time.After(time.Now())) {
+		return link, user, assertShareLinkActive(client, cancel, errors.New("this share link has expired"));
+	}
+
+	return link, user, nil;
+}
+
+// the columns of share_links read by scanShareLink, in order
+const shareLinkColumns = "share_links.id, share_links.token, share_links.format, share_links.category_id, share_links.include_descendants, share_links.view, share_links.days, share_links.tags, share_links.priority, share_links.hide_completed, share_links.expires_at, share_links.created_at"
+
+// reads a row of shareLinkColumns into a ShareLink, returning its token separately;
+//		any columns that come after them are read into extra
+func scanShareLink(row pgx.Row, extra ...interface{}) (ShareLink, string, error) {
+	var link ShareLink;
+	var token string;
+
+	dest := []interface{}{
+		&link.Id,
+		&token,
+		&link.Format,
+		&link.Filter.Category_Id,
+		&link.Filter.Include_Descendants,
+		&link.Filter.View,
+		&link.Filter.Days,
+		&link.Filter.Tags,
+		&link.Filter.Priority,
+		&link.Filter.Hide_Completed,
+		&link.Expires_at,
+		&link.Created_at,
+	};
+	err := row.Scan(append(dest, extra...)...);
+
+	return link, token, err;
+}
+
+// returns the address of a share link, in the given format
+func shareLinkUrl(client *gin.Context, token string, format string) string {
+	return serverUrl(client, sharedListPath + token + taskListFormats[format].extension);
+}
+
+// reads the address of a share link, e.g. "<token>.md", into its token and the format it asks for, "" for the link's own
+func parseShareLinkFile(file string) (string, string) {
+	for format, f := range taskListFormats {
+		if (strings.HasSuffix(file, f.extension)) {
+			return strings.TrimSuffix(file, f.extension), format;
+		}
+	}
+
+	return file, "";
+}
+
+// converts the times of a share link into the given timezone
+func localiseShareLinks(links []ShareLink, loc *time.Location) []ShareLink {
+	for i := range links {
+		links[i].Expires_at.Time.Time = links[i].Expires_at.Time.Time.In(loc);
+		links[i].Created_at.Time.Time = links[i].Created_at.Time.Time.In(loc);
+	}
+
+	return links;
+}
+
+/* ------------------------------------------------------------ HELPER FUNCTIONS --------------------- */
+// checks that a filter and format can be exported,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidTaskList(client *gin.Context, cancel context.CancelFunc, filter TaskListFilter, format string) error {
+	var e error;
+	if _, ok := taskListFormats[format]; (!ok) {
+		e = fmt.Errorf("unknown format %q, it must be \"markdown\", \"text\" or \"html\"", format);
+	} else if _, ok := taskListViews[filter.View]; (!ok && filter.View != "") {
+		e = fmt.Errorf("unknown view %q, it must be \"today\", \"upcoming\", \"overdue\" or \"unscheduled\"", filter.View);
+	} else if (filter.Include_Descendants && !filter.Category_Id.Valid) {
+		e = errors.New("include_descendants needs a category_id");
+	}
+	if (e == nil) {
+		return assertValidPriority(client, cancel, filter.Priority);
+	}
+
+	fmt.Fprintf(os.Stderr, "Invalid task list: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks that a share link expires in the future, and no later than maxShareLinkLifetime from now,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidShareExpiry(client *gin.Context, cancel context.CancelFunc, expiresAt null.Time) error {
+	var e error;
+	if (!expiresAt.Valid) {
+		e = errors.New("share links need an expires_at");
+	} else if (!expiresAt.Time.After(time.Now())) {
+		e = errors.New("expires_at must be in the future");
+	} else if (expiresAt.Time.After(time.Now().Add(maxShareLinkLifetime))) {
+		e = fmt.Errorf("share links can work for at most %v days", int(maxShareLinkLifetime.Hours() / 24));
+	}
+	if (e == nil) {
+		return nil;
+	}
+
+	fmt.Fprintf(os.Stderr, "Invalid share link: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that there is no share link with the given id or token,
+//		and stops execution of any remaining function-calls
+func assertShareLinkFound(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to find share link: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that a share link has expired, and stops execution of any remaining function-calls
+func assertShareLinkActive(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to open share link: %v\n", e);
+
+	// return http code of 410 to the client, which stands for "Gone"
+	client.JSON(410, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
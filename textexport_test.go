@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"github.com/emvi/null"
+	_ "time/tzdata"
+)
+
+// Wednesday 14 October 2026 in Amsterdam, and a list with a task due later this year, one due next year and one with a title that
+//		would be markup if it was not escaped
+func testTaskList(t *testing.T) (taskList, time.Time, *time.Location) {
+	t.Helper();
+	loc := mustLoadLocation(t, "Europe/Amsterdam");
+	now := time.Date(2026, time.October, 14, 9, 30, 0, 0, loc);
+
+	list := taskList{
+		title: "Home *stuff*",
+		grouped: true,
+		groups: []taskListGroup{
+			{title: "Home", tasks: []Task{
+				{Title: "buy *milk*", Deadline_Date: Date{null.NewTime(time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC), true)}},
+				{
+					Title: "pay rent", Completed: true,
+					Deadline: Timestamp{null.NewTime(time.Date(2027, time.January, 1, 9, 0, 0, 0, time.UTC), true)},
+					Description: "\r\n  first line  \r\n\r\n  second\n",
+				},
+			}},
+			{title: "Work", tasks: []Task{{Title: "<script>alert(1)</script>"}}},
+		},
+	};
+
+	return list, now, loc;
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"buy milk": "buy milk",
+		"*bold* and _italic_": "\\*bold\\* and \\_italic\\_",
+		"# not a heading": "\\# not a heading",
+		"[link](https://example.com)": "\\[link\\](https://example.com)",
+		"`code` | table ~strike~": "\\`code\\` \\| table \\~strike\\~",
+		"<b>html</b>": "\\<b\\>html\\</b\\>",
+		"C:\\Users": "C:\\\\Users",
+		"café – 5 €": "café – 5 €",
+		"": "",
+	}
+	for text, want := range tests {
+		if got := escapeMarkdown(text); (got != want) {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", text, got, want);
+		}
+	}
+}
+
+func TestWriteMarkdownTaskList(t *testing.T) {
+	list, now, loc := testTaskList(t);
+
+	var b strings.Builder;
+	err := writeMarkdownTaskList(&b, list, now, loc);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	want := "# Home \\*stuff\\*\n" +
+		"\n## Home\n\n" +
+		"- [ ] buy \\*milk\\* — due 15 Oct\n" +
+		"- [x] pay rent — due 1 Jan 2027 10:00\n" +
+		"  first line\n" +
+		"\n" +
+		"    second\n" +
+		"\n## Work\n\n" +
+		"- [ ] \\<script\\>alert(1)\\</script\\>\n";
+	if (b.String() != want) {
+		t.Errorf("the Markdown is\n%v\nwant\n%v", b.String(), want);
+	}
+}
+
+func TestWriteTextTaskList(t *testing.T) {
+	list, now, loc := testTaskList(t);
+
+	var b strings.Builder;
+	err := writeTextTaskList(&b, list, now, loc);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	want := "Home *stuff*\n============\n" +
+		"\nHome\n----\n\n" +
+		"[ ] buy *milk* — due 15 Oct\n" +
+		"[x] pay rent — due 1 Jan 2027 10:00\n" +
+		"    first line\n" +
+		"\n" +
+		"      second\n" +
+		"\nWork\n----\n\n" +
+		"[ ] <script>alert(1)</script>\n";
+	if (b.String() != want) {
+		t.Errorf("the text is\n%v\nwant\n%v", b.String(), want);
+	}
+}
+
+func TestWriteHTMLTaskList(t *testing.T) {
+	list, now, loc := testTaskList(t);
+
+	var b strings.Builder;
+	err := writeHTMLTaskList(&b, list, now, loc);
+	if (err != nil) {
+		t.Fatal(err);
+	}
+	page := b.String();
+	for _, want := range []string{
+		"<title>Home *stuff*</title>",
+		"<h1>Home *stuff*</h1>\n<h2>Home</h2>\n<ul>\n",
+		`<li><input type="checkbox" disabled> <span class="title">buy *milk*</span> <span class="due">— due 15 Oct</span></li>`,
+		`<li class="done"><input type="checkbox" checked disabled> <span class="title">pay rent</span> <span class="due">— due 1 Jan 2027 10:00</span>` +
+			"<div class=\"notes\">first line\n\n  second</div></li>",
+		`<span class="title">&lt;script&gt;alert(1)&lt;/script&gt;</span>`,
+	} {
+		if (!strings.Contains(page, want)) {
+			t.Errorf("the page does not contain %q:\n%v", want, page);
+		}
+	}
+	if (strings.Contains(page, "<script>")) {
+		t.Errorf("a title was written as markup:\n%v", page);
+	}
+}
+
+func TestWriteEmptyTaskList(t *testing.T) {
+	_, now, loc := testTaskList(t);
+	list := taskList{title: "Today", groups: []taskListGroup{}};
+
+	for format, f := range taskListFormats {
+		var b strings.Builder;
+		err := f.write(&b, list, now, loc);
+		if (err != nil) {
+			t.Errorf("%v: %v", format, err);
+			continue;
+		}
+		if (!strings.Contains(b.String(), "No tasks.")) {
+			t.Errorf("%v: an empty list is written as\n%v", format, b.String());
+		}
+	}
+}
+
+func TestTaskListFilename(t *testing.T) {
+	tests := map[string]string{
+		"Home — Today": "home-today",
+		"All tasks": "all-tasks",
+		"  CCA: 2026/27  ": "cca-2026-27",
+		"Café": "caf",
+		"—": "tasks",
+	}
+	for title, want := range tests {
+		if got := taskListFilename(title); (got != want) {
+			t.Errorf("taskListFilename(%q) = %q, want %q", title, got, want);
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+type TimeEntry struct {
+	Id int `json:"id"`
+	Task_Id int `json:"task_id"`
+	User_Id int `json:"user_id"`
+	Username string `json:"username"`
+	Started_at Timestamp `json:"started_at"`
+	// null while the timer is still running
+	Stopped_at Timestamp `json:"stopped_at"`
+	// whole minutes between Started_at and Stopped_at, or until now while the timer is running
+	Minutes int `json:"minutes"`
+	Note string `json:"note"`
+}
+
+// note: an estimate is given either in minutes or in pomodoros of 25 minutes each; leaving out both removes the estimate
+type SetEstimateParams struct {
+	Id int `json:"id"`
+	Minutes null.Int64 `json:"minutes"`
+	Pomodoros null.Int64 `json:"pomodoros"`
+}
+
+type StartTimerParams struct {
+	Task_Id int `json:"task_id"`
+	Note string `json:"note"`
+}
+
+// note: time added by hand needs either Stopped_at or Minutes, not both
+type AddTimeEntryParams struct {
+	Task_Id int `json:"task_id"`
+	Started_at time.Time `json:"started_at"`
+	Stopped_at null.Time `json:"stopped_at"`
+	Minutes int `json:"minutes"`
+	Note string `json:"note"`
+}
+
+type DeleteTimeEntryParams struct {
+	Id int `json:"id"`
+}
+
+type GetTimeEntriesParams struct {
+	Task_Id int `json:"task_id"`
+}
+
+type CategoryTimeParams struct {
+	Category_Id int `json:"category_id"`
+	// also count the tasks of every category nested inside it that the user has access to
+	Include_Descendants bool `json:"include_descendants"`
+}
+
+type TimeTotals struct {
+	Tasks int `json:"tasks"`
+	// the tasks that have an estimate, the sum of their estimates, and the time tracked on them,
+	//		so that estimates can be compared against the time the same tasks actually took
+	Estimated_Tasks int `json:"estimated_tasks"`
+	Estimated_Minutes int `json:"estimated_minutes"`
+	Estimated_Tracked_Minutes int `json:"estimated_tracked_minutes"`
+	// the time tracked on all of the tasks, with or without an estimate
+	Tracked_Minutes int `json:"tracked_minutes"`
+}
+
+type CategoryTime struct {
+	Category_Id int `json:"category_id"`
+	Open TimeTotals `json:"open"`
+	Completed TimeTotals `json:"completed"`
+}
+
+const pomodoroMinutes = 25
+
+/* ------------------------------------------------------------ TIME TRACKING --------------------- */
+/* Sets how many minutes a task is expected to take, or removes its estimate if minutes is null */
+func setEstimate(id int, minutes null.Int64, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	err := changeTask(c, id, userId, actionEstimate, "UPDATE tasks SET estimate_minutes=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 AND deleted_at IS NULL;", minutes, id);
+	return assertTaskChanged(client, cancel, id, err);
+}
+
+/* Starts a timer on a task for a user and returns its time entry's id; a timer the user already had running, on any task, is stopped first */
+func startTimer(params StartTimerParams, userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// lock the user so that timers started at the same time do not both find nothing to stop
+	_, err = tx.Exec(context.Background(), "SELECT 1 FROM users WHERE id=$1 FOR UPDATE;", userId)
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "UPDATE task_time_entries SET stopped_at=CURRENT_TIMESTAMP WHERE user_id=$1 AND stopped_at IS NULL;", userId)
+	}
+
+	var id int;
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "INSERT INTO task_time_entries (task_id, user_id, started_at, note) VALUES ($1, $2, CURRENT_TIMESTAMP, $3) RETURNING id;", params.Task_Id, userId, params.Note).Scan(&id);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Stops the timer a user has running and returns its time entry's id */
+func stopTimer(userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var id int;
+	err := c.QueryRow(context.Background(), "UPDATE task_time_entries SET stopped_at=CURRENT_TIMESTAMP WHERE user_id=$1 AND stopped_at IS NULL RETURNING id;", userId).Scan(&id);
+	if (err == pgx.ErrNoRows) {
+		return 0, assertTimeEntryFound(client, cancel, errors.New("no timer is running"));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Adds time spent on a task by hand and returns its time entry's id */
+func addTimeEntry(params AddTimeEntryParams, userId int, client *gin.Context, cancel context.CancelFunc) (int, error) {
+	stoppedAt, err := timeEntryEnd(params);
+	if (err != nil) {
+		return 0, assertValidTimeEntry(client, cancel, err);
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var id int;
+	err = c.QueryRow(context.Background(), "INSERT INTO task_time_entries (task_id, user_id, started_at, stopped_at, note) VALUES ($1, $2, $3, $4, $5) RETURNING id;", params.Task_Id, userId, params.Started_at, stoppedAt, params.Note).Scan(&id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	return id, nil;
+}
+
+/* Removes one of a user's own time entries */
+func deleteTimeEntry(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "DELETE FROM task_time_entries WHERE id=$1 AND user_id=$2;", id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertTimeEntryFound(client, cancel, fmt.Errorf("no time entry of yours found with id: %v", id));
+	}
+
+	return nil;
+}
+
+/* Returns the time entries of a task, newest first */
+func getTimeEntries(taskId int, client *gin.Context, cancel context.CancelFunc) ([]TimeEntry) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	entryList := []TimeEntry{};
+
+	entries, err := c.Query(context.Background(), `
+		SELECT task_time_entries.id, task_time_entries.task_id, task_time_entries.user_id, users.username,
+			task_time_entries.started_at, task_time_entries.stopped_at, task_time_entries.note,
+			FLOOR(EXTRACT(EPOCH FROM COALESCE(task_time_entries.stopped_at, CURRENT_TIMESTAMP) - task_time_entries.started_at) / 60)::INT
+		FROM task_time_entries
+			INNER JOIN users ON task_time_entries.user_id=users.id
+		WHERE task_time_entries.task_id=$1
+		ORDER BY task_time_entries.started_at DESC, task_time_entries.id DESC;`, taskId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return entryList;
+	}
+	defer entries.Close();
+
+	for entries.Next() {
+		var e TimeEntry
+		err = entries.Scan(&e.Id, &e.Task_Id, &e.User_Id, &e.Username, &e.Started_at, &e.Stopped_at, &e.Note, &e.Minutes)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return entryList;
+		}
+		entryList = append(entryList, e)
+	}
+
+	return entryList;
+}
+
+/* Sums the estimated and tracked time of the tasks in a category, separately for open and completed tasks */
+func getCategoryTime(params CategoryTimeParams, userId int, client *gin.Context, cancel context.CancelFunc) (CategoryTime) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	totals := CategoryTime{Category_Id: params.Category_Id};
+
+	rows, err := c.Query(context.Background(), `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT $1::int
+			UNION
+			SELECT categories.id FROM categories INNER JOIN subtree ON categories.parent_id=subtree.id WHERE $3
+		),
+		tracked AS (
+			SELECT COALESCE(tasks.completed, 'f') AS completed, tasks.estimate_minutes, public.get_task_tracked_minutes(tasks.id) AS minutes
+			FROM tasks
+			WHERE tasks.category_id IN (SELECT id FROM subtree) AND tasks.deleted_at IS NULL
+				AND tasks.category_id IN (SELECT category_id FROM public.get_accessible_categories($2))
+		)
+		SELECT completed, COUNT(*)::INT, COUNT(estimate_minutes)::INT, COALESCE(SUM(estimate_minutes), 0)::INT,
+			COALESCE(SUM(minutes) FILTER (WHERE estimate_minutes IS NOT NULL), 0)::INT, COALESCE(SUM(minutes), 0)::INT
+		FROM tracked
+		GROUP BY completed;`, params.Category_Id, userId, params.Include_Descendants)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return totals;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		var completed bool
+		var t TimeTotals
+		err = rows.Scan(&completed, &t.Tasks, &t.Estimated_Tasks, &t.Estimated_Minutes, &t.Estimated_Tracked_Minutes, &t.Tracked_Minutes)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return totals;
+		}
+		if (completed) {
+			totals.Completed = t;
+		} else {
+			totals.Open = t;
+		}
+	}
+
+	return totals;
+}
+
+// returns the estimate in minutes that the params ask for, null to remove the estimate,
+//		or an error if they ask for both minutes and pomodoros or for no time at all
+func estimateMinutes(params SetEstimateParams) (null.Int64, error) {
+	if (params.Minutes.Valid && params.Pomodoros.Valid) {
+		return null.Int64{}, errors.New("an estimate can be given in minutes or in pomodoros, but not both");
+	}
+
+	minutes := params.Minutes;
+	if (params.Pomodoros.Valid) {
+		minutes = null.NewInt64(params.Pomodoros.Int64 * pomodoroMinutes, true);
+	}
+	if (minutes.Valid && minutes.Int64 <= 0) {
+		return null.Int64{}, errors.New("an estimate must be more than 0 minutes");
+	}
+
+	return minutes, nil;
+}
+
+// returns when time added by hand ended, from either its stopped_at or its length in minutes
+func timeEntryEnd(params AddTimeEntryParams) (time.Time, error) {
+	if (params.Started_at.IsZero()) {
+		return time.Time{}, errors.New("a time entry needs a started_at");
+	}
+	if (params.Stopped_at.Valid == (params.Minutes != 0)) {
+		return time.Time{}, errors.New("a time entry needs either a stopped_at or a number of minutes, but not both");
+	}
+
+	stoppedAt := params.Started_at.Add(time.Duration(params.Minutes) * time.Minute);
+	if (params.Stopped_at.Valid) {
+		stoppedAt = params.Stopped_at.Time;
+	}
+	if (stoppedAt.Before(params.Started_at)) {
+		return time.Time{}, errors.New("a time entry cannot stop before it starts");
+	}
+
+	return stoppedAt, nil;
+}
+
+// converts the timestamps of every time entry into the given timezone
+func localiseTimeEntries(entries []TimeEntry, loc *time.Location) []TimeEntry {
+	for i := range entries {
+		entries[i].Started_at.Time.Time = entries[i].Started_at.Time.Time.In(loc);
+		if (entries[i].Stopped_at.Valid) {
+			entries[i].Stopped_at.Time.Time = entries[i].Stopped_at.Time.Time.In(loc);
+		}
+	}
+
+	return entries;
+}
+
+// reports to the client that the given estimate or time entry makes no sense,
+//		and stops execution of any remaining function-calls
+func assertValidTimeEntry(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Invalid time entry: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that the time entry or running timer it asked for does not exist,
+//		and stops execution of any remaining function-calls
+func assertTimeEntryFound(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
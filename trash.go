@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"github.com/joho/godotenv"
+)
+
+// structs
+
+type TrashedTask struct {
+	Task
+	Deleted_at Timestamp `json:"deleted_at"`
+}
+
+// number of days a task stays in the trash before it is permanently deleted,
+//		unless overridden by the TRASH_RETENTION_DAYS environment variable
+const defaultTrashRetentionDays = 30
+
+// a connection or a transaction, so that tasks can be purged as part of a larger change
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// how often the server checks for tasks that have been in the trash for too long
+const trashPurgeInterval = time.Hour
+
+/* ------------------------------------------------------------ TRASH --------------------- */
+/* Returns an array of all Tasks in the trash of the categories a user has access to, most recently deleted first */
+func getTrashedTasks(userId int, client *gin.Context, cancel context.CancelFunc) ([]TrashedTask) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tasks, err := c.Query(context.Background(), "SELECT * from public.get_trashed_tasks($1);", userId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer tasks.Close();
+
+	var taskSlice []TrashedTask
+	for tasks.Next() {
+		var t TrashedTask
+		err = scanTask(tasks, &t.Task, &t.Deleted_at)
+		assertDBOperationSuccess(client, cancel, err);
+		taskSlice = append(taskSlice, t)
+	}
+
+	return taskSlice;
+}
+
+/* Moves a Task out of the trash by its id */
+func restoreTask(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	err := changeTask(c, id, userId, actionRestore, "UPDATE tasks SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL;", id)
+	return assertTaskChanged(client, cancel, id, err);
+}
+
+/* Permanently deletes a Task that is in the trash by its id */
+func purgeTask(id int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	count, blobKeys, err := purgeTasks(c, "id=$1 AND deleted_at IS NOT NULL", id)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if count != 1 {
+		return assertTaskFound(client, cancel, id);
+	}
+	deleteBlobs(blobKeys);
+
+	return nil;
+}
+
+/* Permanently deletes every Task in the trash of the categories a user can edit, and returns how many were deleted */
+func emptyTrash(userId int, client *gin.Context, cancel context.CancelFunc) (int64, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	count, blobKeys, err := purgeTasks(c, "deleted_at IS NOT NULL AND category_id IN (SELECT category_id FROM public.get_accessible_categories($1) WHERE role<>$2)", userId, roleViewer)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	deleteBlobs(blobKeys);
+
+	return count, nil;
+}
+
+// converts every timestamp of a TrashedTask into the given timezone (see localiseTask)
+func localiseTrashedTask(t TrashedTask, loc *time.Location) TrashedTask {
+	t.Task = localiseTask(t.Task, loc);
+	if (t.Deleted_at.Valid) {
+		t.Deleted_at.Time.Time = t.Deleted_at.Time.Time.In(loc);
+	}
+
+	return t;
+}
+
+/* ------------------------------------------------------------ BACKGROUND JOBS --------------------- */
+// returns how long tasks are kept in the trash for
+func trashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"));
+	if (err != nil || days <= 0) {
+		days = defaultTrashRetentionDays;
+	}
+
+	return time.Duration(days) * 24 * time.Hour;
+}
+
+// permanently deletes tasks that have been in the trash for longer than the retention period,
+//		runs once straight away and then every trashPurgeInterval for as long as the server is up
+func purgeExpiredTrashPeriodically() {
+	// load the .env file that contains postgresql connection details
+	godotenv.Load(".env")
+
+	for {
+		count, err := purgeExpiredTrash(trashRetention());
+		if (err != nil) {
+			// print error message on server side so that its visible in the server logs
+			fmt.Fprintf(os.Stderr, "Unable to purge expired tasks from the trash: %v\n", err);
+		} else if (count > 0) {
+			fmt.Printf("Purged %v expired tasks from the trash\n", count);
+		}
+
+		time.Sleep(trashPurgeInterval);
+	}
+}
+
+/* Permanently deletes tasks that were moved to the trash more than retention ago */
+func purgeExpiredTrash(retention time.Duration) (int64, error) {
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return 0, err;
+	}
+	defer c.Close(context.Background())
+
+	count, blobKeys, err := purgeTasks(c, "deleted_at IS NOT NULL AND deleted_at < $1", time.Now().Add(-retention))
+	if (err != nil) {
+		return 0, err;
+	}
+	deleteBlobs(blobKeys);
+
+	return count, nil;
+}
+
+/* Permanently deletes the tasks matching a condition, and returns how many were deleted
+		along with the keys of the blobs of their attachments, which the caller should delete once nothing can roll the deletion back */
+func purgeTasks(c rowQuerier, condition string, args ...interface{}) (int64, []string, error) {
+	var count int64;
+	var blobKeys []string;
+
+	// the attachment rows go with their tasks, but the select still sees them as they were before the delete
+	err := c.QueryRow(context.Background(), `
+		WITH purged AS (DELETE FROM tasks WHERE ` + condition + ` RETURNING id)
+		SELECT (SELECT COUNT(*) FROM purged), ARRAY(SELECT blob_key FROM task_attachments WHERE task_id IN (SELECT id FROM purged));`, args...).Scan(&count, &blobKeys)
+
+	return count, blobKeys, err;
+}
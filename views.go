@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// structs
+
+type SmartView struct {
+	Count int `json:"count"`
+	Tasks []Task `json:"tasks"`
+}
+
+type TodayView struct {
+	Count int `json:"count"`
+	Due_Today_Count int `json:"due_today_count"`
+	Overdue_Count int `json:"overdue_count"`
+	Tasks []Task `json:"tasks"`
+}
+
+type UpcomingDay struct {
+	Date string `json:"date"`
+	Count int `json:"count"`
+	Tasks []Task `json:"tasks"`
+}
+
+type UpcomingView struct {
+	Count int `json:"count"`
+	Days []UpcomingDay `json:"days"`
+}
+
+// the number of tasks in each smart view, for showing as badges in the client
+type SmartViewCounts struct {
+	Today int `json:"today"`
+	Upcoming int `json:"upcoming"`
+	Overdue int `json:"overdue"`
+	Unscheduled int `json:"unscheduled"`
+}
+
+type GetUpcomingTasksParams struct {
+	Days int `json:"days"`
+}
+
+// number of days shown in the upcoming view when the client does not ask for a specific number
+const defaultUpcomingDays = 7
+
+// the furthest ahead the upcoming view will look
+const maxUpcomingDays = 60
+
+/* ------------------------------------------------------------ SMART VIEWS --------------------- */
+// note: all smart views take a list of incomplete tasks that have already been passed through localiseTasks,
+//		so that the Deadline of every task (including all-day ones) is set and is in the user's timezone
+
+// returns the calendar date that a moment falls on, as midnight of that day in the given timezone
+func dayOf(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc);
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc);
+}
+
+// checks if a task was due before the given moment
+func isOverdue(t Task, now time.Time) bool {
+	return t.Deadline.Valid && t.Deadline.Time.Time.Before(now);
+}
+
+// sorts tasks by deadline, earliest first, with tasks that have no deadline at the end
+func sortByDeadline(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if (!tasks[i].Deadline.Valid || !tasks[j].Deadline.Valid) {
+			return tasks[i].Deadline.Valid;
+		}
+		return tasks[i].Deadline.Time.Time.Before(tasks[j].Deadline.Time.Time);
+	})
+}
+
+/* Returns tasks that are due today, together with all overdue tasks */
+func todayView(tasks []Task, now time.Time, loc *time.Location) TodayView {
+	today := dayOf(now, loc);
+	view := TodayView{Tasks: []Task{}};
+
+	for _, t := range tasks {
+		if (isOverdue(t, now)) {
+			view.Overdue_Count++;
+		} else if (t.Deadline.Valid && dayOf(t.Deadline.Time.Time, loc).Equal(today)) {
+			view.Due_Today_Count++;
+		} else {
+			continue;
+		}
+		view.Tasks = append(view.Tasks, t);
+	}
+
+	sortByDeadline(view.Tasks);
+	view.Count = len(view.Tasks);
+
+	return view;
+}
+
+/* Returns tasks that are due over the next given number of days (starting with today), grouped by day;
+		tasks that are already overdue are left out */
+func upcomingView(tasks []Task, days int, now time.Time, loc *time.Location) UpcomingView {
+	today := dayOf(now, loc);
+	view := UpcomingView{Days: make([]UpcomingDay, days)};
+
+	for i := range view.Days {
+		view.Days[i] = UpcomingDay{Date: today.AddDate(0, 0, i).Format("2006-01-02"), Tasks: []Task{}};
+	}
+
+	for _, t := range tasks {
+		if (!t.Deadline.Valid || isOverdue(t, now)) {
+			continue;
+		}
+
+		// count days by the calendar, rather than in 24-hour blocks, so that daylight saving changes don't shift tasks
+		due := dayOf(t.Deadline.Time.Time, loc);
+		i := 0;
+		for (i < days && !today.AddDate(0, 0, i).Equal(due)) {
+			i++;
+		}
+		if (i == days) {
+			continue;
+		}
+
+		view.Days[i].Tasks = append(view.Days[i].Tasks, t);
+		view.Days[i].Count++;
+		view.Count++;
+	}
+
+	for i := range view.Days {
+		sortByDeadline(view.Days[i].Tasks);
+	}
+
+	return view;
+}
+
+/* Returns tasks whose deadline has already passed */
+func overdueView(tasks []Task, now time.Time) SmartView {
+	view := SmartView{Tasks: []Task{}};
+
+	for _, t := range tasks {
+		if (isOverdue(t, now)) {
+			view.Tasks = append(view.Tasks, t);
+		}
+	}
+
+	sortByDeadline(view.Tasks);
+	view.Count = len(view.Tasks);
+
+	return view;
+}
+
+/* Returns tasks that have no deadline at all */
+func unscheduledView(tasks []Task) SmartView {
+	view := SmartView{Tasks: []Task{}};
+
+	for _, t := range tasks {
+		if (!t.Deadline.Valid) {
+			view.Tasks = append(view.Tasks, t);
+		}
+	}
+
+	view.Count = len(view.Tasks);
+
+	return view;
+}
+
+/* Returns the number of tasks in each smart view */
+func smartViewCounts(tasks []Task, now time.Time, loc *time.Location) SmartViewCounts {
+	return SmartViewCounts{
+		Today: todayView(tasks, now, loc).Count,
+		Upcoming: upcomingView(tasks, defaultUpcomingDays, now, loc).Count,
+		Overdue: overdueView(tasks, now).Count,
+		Unscheduled: unscheduledView(tasks).Count,
+	}
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+	"github.com/joho/godotenv"
+)
+
+// structs
+
+// note: a webhook is sent every change event (see events.go) its owner can see that matches its filters, as a POST with a JSON body
+//		holding the event and the task or category as it was right after the change. Deliveries are queued in the database by the
+//		enqueue_webhook_deliveries trigger, so none are lost when the server restarts, and are retried with exponential backoff
+//		until the receiver answers with a 2xx status, or until they have failed webhookMaxAttempts times, after which they are dead.
+//
+//		Every request carries the headers
+//			X-Webhook-Event: the event type, or "ping" for a test event
+//			X-Webhook-Delivery: the id of the delivery, the same on every retry, so that receivers can ignore repeats
+//			X-Webhook-Signature: "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed with the webhook's secret>"
+//		Receivers should check the signature, and that the time is recent, to make sure the request came from this server.
+//		Webhooks are only sent to public addresses, and a redirect counts as a failed attempt
+type Webhook struct {
+	Id int `json:"id"`
+	Url string `json:"url"`
+	// the event types to send (see ChangeEvent), empty for all of them
+	Event_Types []string `json:"event_types"`
+	// only send events about this category and its tasks, null for every category
+	Category_Id null.Int64 `json:"category_id"`
+	// paused webhooks are not sent new events
+	Active bool `json:"active"`
+	// only given when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	Id int64 `json:"id"`
+	Webhook_Id int `json:"webhook_id"`
+	Event_Type string `json:"event_type"`
+	Payload RawJSON `json:"payload"`
+	// "pending" until the receiver accepts it, then "delivered", or "dead" once it has failed too many times
+	Status string `json:"status"`
+	Attempts int `json:"attempts"`
+	// when the delivery is next tried, while it is pending
+	Next_Attempt_At Timestamp `json:"next_attempt_at"`
+	Last_Attempt_At Timestamp `json:"last_attempt_at"`
+	// the receiver's answer to the last attempt, 0 if there was none; the body is only kept when it took the delivery
+	Response_Status int `json:"response_status"`
+	Response_Body string `json:"response_body"`
+	Last_Error string `json:"last_error"`
+	Created_at Timestamp `json:"created_at"`
+	Delivered_At Timestamp `json:"delivered_at"`
+}
+
+type CreateWebhookParams struct {
+	Url string `json:"url"`
+	Event_Types []string `json:"event_types"`
+	Category_Id null.Int64 `json:"category_id"`
+}
+
+type UpdateWebhookParams struct {
+	Id int `json:"id"`
+	Url string `json:"url"`
+	Event_Types []string `json:"event_types"`
+	Category_Id null.Int64 `json:"category_id"`
+	Active bool `json:"active"`
+}
+
+type WebhookIdParams struct {
+	Id int `json:"id"`
+}
+
+type GetWebhookDeliveriesParams struct {
+	Webhook_Id int `json:"webhook_id"`
+	// "pending", "delivered" or "dead", "" for all
+	Status string `json:"status"`
+	// only deliveries with smaller ids, for paging back through the log; 0 for the newest
+	Before int64 `json:"before"`
+}
+
+type RedeliverWebhookParams struct {
+	Delivery_Id int64 `json:"delivery_id"`
+}
+
+// a JSON value that is passed through as it is
+type RawJSON []byte
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if (len(j) == 0) {
+		return []byte("null"), nil;
+	}
+	return j, nil;
+}
+
+// a delivery claimed by the worker, with what is needed to send it
+type dueDelivery struct {
+	id int64
+	eventType string
+	payload []byte
+	attempts int
+	url string
+	secret string
+}
+
+// what came of sending a delivery
+type deliveryOutcome struct {
+	status int
+	body string
+	err error
+}
+
+const (
+	deliveryPending = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead = "dead"
+)
+
+var webhookEventTypes = map[string]bool{
+	"task.created": true, "task.updated": true, "task.completed": true, "task.deleted": true,
+	"category.created": true, "category.updated": true, "category.deleted": true,
+}
+
+// a delivery is dead after failing this many times, which with webhookBackoff takes about two days
+const webhookMaxAttempts = 12
+
+// how long to wait before retrying after the first failure, doubling with every failure after it up to webhookMaxBackoff
+const webhookBaseBackoff = 30 * time.Second
+const webhookMaxBackoff = 12 * time.Hour
+
+// how often the queue is checked for deliveries that are due
+const webhookPollInterval = 5 * time.Second
+
+// the number of deliveries claimed and sent at a time
+const webhookBatchSize = 20
+
+// how long a claimed delivery is left to the instance that claimed it, before another instance may try it again;
+//		longer than sending a whole batch can take
+const webhookClaimDuration = 2 * time.Minute
+
+// how long delivered and dead deliveries are kept in the log
+const webhookLogRetention = 30 * 24 * time.Hour
+const webhookCleanupInterval = time.Hour
+
+// the most deliveries returned from the log at a time
+const webhookDeliveryPageSize = 100
+
+// how much of a receiver's answer is kept in the log
+const webhookResponseLimit = 1024
+
+// how long a receiver has to answer; redirects are not followed, and receivers on loopback, private or link-local addresses
+//		are refused when connecting (see webhookDialControl), so that webhooks cannot be used to reach the server's own network
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: webhookTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse;
+	},
+}
+
+/* ------------------------------------------------------------ WEBHOOKS --------------------- */
+/* Registers a webhook for a user, with a new secret to sign its deliveries with */
+func addWebhook(params CreateWebhookParams, userId int, client *gin.Context, cancel context.CancelFunc) (Webhook, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	webhook := Webhook{Url: params.Url, Event_Types: params.Event_Types, Category_Id: params.Category_Id, Active: true};
+	if (webhook.Event_Types == nil) {
+		webhook.Event_Types = []string{};
+	}
+
+	b := make([]byte, 32);
+	_, err := rand.Read(b);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return webhook, err;
+	}
+	webhook.Secret = hex.EncodeToString(b);
+
+	err = c.QueryRow(context.Background(), `
+		INSERT INTO webhooks (owner_id, url, secret, event_types, category_id) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;`, userId, webhook.Url, webhook.Secret, webhook.Event_Types, webhook.Category_Id).Scan(&webhook.Id, &webhook.Created_at);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return webhook, err;
+	}
+
+	return webhook, nil;
+}
+
+/* Returns a user's webhooks, without their secrets */
+func getWebhooks(userId int, client *gin.Context, cancel context.CancelFunc) ([]Webhook) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	webhooks := []Webhook{};
+
+	rows, err := c.Query(context.Background(), "SELECT id, url, event_types, category_id, active, created_at FROM webhooks WHERE owner_id=$1 ORDER BY id;", userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return webhooks;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		var w Webhook
+		err = rows.Scan(&w.Id, &w.Url, &w.Event_Types, &w.Category_Id, &w.Active, &w.Created_at)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return webhooks;
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks;
+}
+
+/* Changes a user's webhook; deliveries that are already queued are still sent */
+func updateWebhook(params UpdateWebhookParams, userId int, client *gin.Context, cancel context.CancelFunc) (Webhook, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	webhook := Webhook{Id: params.Id, Url: params.Url, Event_Types: params.Event_Types, Category_Id: params.Category_Id, Active: params.Active};
+	if (webhook.Event_Types == nil) {
+		webhook.Event_Types = []string{};
+	}
+
+	err := c.QueryRow(context.Background(), `
+		UPDATE webhooks SET url=$3, event_types=$4, category_id=$5, active=$6 WHERE id=$1 AND owner_id=$2
+		RETURNING created_at;`, webhook.Id, userId, webhook.Url, webhook.Event_Types, webhook.Category_Id, webhook.Active).Scan(&webhook.Created_at);
+	if (err == pgx.ErrNoRows) {
+		return webhook, assertWebhookFound(client, cancel, fmt.Errorf("webhook %v does not exist", params.Id));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return webhook, err;
+	}
+
+	return webhook, nil;
+}
+
+/* Deletes a user's webhook along with its delivery log */
+func deleteWebhook(id int, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tag, err := c.Exec(context.Background(), "DELETE FROM webhooks WHERE id=$1 AND owner_id=$2;", id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (tag.RowsAffected() == 0) {
+		return assertWebhookFound(client, cancel, fmt.Errorf("webhook %v does not exist", id));
+	}
+
+	return nil;
+}
+
+/* Queues a "ping" event for one of a user's webhooks, whether or not it is paused, and returns the delivery;
+		it is sent like any other, so its result shows up in the delivery log */
+func testWebhook(id int, userId int, client *gin.Context, cancel context.CancelFunc) (WebhookDelivery, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	d, err := scanDelivery(c.QueryRow(context.Background(), `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT id, 'ping', jsonb_build_object('event', 'ping', 'webhook_id', id, 'created_at', CURRENT_TIMESTAMP)
+		FROM webhooks WHERE id=$1 AND owner_id=$2
+		RETURNING ` + deliveryColumns + `;`, id, userId))
+	if (err == pgx.ErrNoRows) {
+		return d, assertWebhookFound(client, cancel, fmt.Errorf("webhook %v does not exist", id));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return d, err;
+	}
+
+	return d, nil;
+}
+
+/* Returns the newest deliveries of one of a user's webhooks, newest first */
+func getWebhookDeliveries(params GetWebhookDeliveriesParams, userId int, client *gin.Context, cancel context.CancelFunc) ([]WebhookDelivery, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	deliveries := []WebhookDelivery{};
+
+	var exists bool;
+	err := c.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id=$1 AND owner_id=$2);", params.Webhook_Id, userId).Scan(&exists);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return deliveries, err;
+	}
+	if (!exists) {
+		return deliveries, assertWebhookFound(client, cancel, fmt.Errorf("webhook %v does not exist", params.Webhook_Id));
+	}
+
+	rows, err := c.Query(context.Background(), `
+		SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE webhook_id=$1 AND ($2 = '' OR status=$2) AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC LIMIT $4;`, params.Webhook_Id, params.Status, params.Before, webhookDeliveryPageSize)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return deliveries, err;
+	}
+	defer rows.Close();
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return deliveries, err;
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil;
+}
+
+/* Queues a delivery of one of a user's webhooks to be sent again right away, with a fresh set of attempts;
+		this is how dead deliveries are brought back once the receiver is fixed */
+func redeliverWebhook(deliveryId int64, userId int, client *gin.Context, cancel context.CancelFunc) (WebhookDelivery, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	d, err := scanDelivery(c.QueryRow(context.Background(), `
+		UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=CURRENT_TIMESTAMP, delivered_at=NULL
+		FROM webhooks
+		WHERE webhook_deliveries.id=$1 AND webhooks.id=webhook_deliveries.webhook_id AND webhooks.owner_id=$2
+		RETURNING ` + qualifiedDeliveryColumns + `;`, deliveryId, userId))
+	if (err == pgx.ErrNoRows) {
+		return d, assertWebhookFound(client, cancel, fmt.Errorf("delivery %v does not exist", deliveryId));
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return d, err;
+	}
+
+	return d, nil;
+}
+
+const deliveryColumns = `id, webhook_id, event_type, payload::TEXT, status, attempts, next_attempt_at, last_attempt_at,
+	COALESCE(response_status, 0), COALESCE(response_body, ''), COALESCE(last_error, ''), created_at, delivered_at`
+
+const qualifiedDeliveryColumns = `webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event_type,
+	webhook_deliveries.payload::TEXT, webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at,
+	webhook_deliveries.last_attempt_at, COALESCE(webhook_deliveries.response_status, 0), COALESCE(webhook_deliveries.response_body, ''),
+	COALESCE(webhook_deliveries.last_error, ''), webhook_deliveries.created_at, webhook_deliveries.delivered_at`
+
+// reads a delivery selected with deliveryColumns
+func scanDelivery(row pgx.Row) (WebhookDelivery, error) {
+	var d WebhookDelivery;
+	var payload string;
+	err := row.Scan(&d.Id, &d.Webhook_Id, &d.Event_Type, &payload, &d.Status, &d.Attempts, &d.Next_Attempt_At, &d.Last_Attempt_At,
+		&d.Response_Status, &d.Response_Body, &d.Last_Error, &d.Created_at, &d.Delivered_At);
+	d.Payload = RawJSON(payload);
+	if (d.Status != deliveryPending) {
+		d.Next_Attempt_At = Timestamp{};
+	}
+
+	return d, err;
+}
+
+/* ------------------------------------------------------------ DELIVERY --------------------- */
+/* Sends the queued deliveries for as long as the server runs; every instance runs this, and they share the queue */
+func runWebhookDeliveries() {
+	lastCleanup := time.Time{};
+	for {
+		sent, err := sendDueWebhooks();
+		if (err == nil && time.Since(lastCleanup) > webhookCleanupInterval) {
+			err = cleanUpWebhookDeliveries();
+			lastCleanup = time.Now();
+		}
+		if (err != nil) {
+			fmt.Fprintf(os.Stderr, "Unable to send webhooks: %v\n", err);
+		}
+		// keep going while there is a backlog
+		if (err != nil || sent < webhookBatchSize) {
+			time.Sleep(webhookPollInterval);
+		}
+	}
+}
+
+/* Claims a batch of due deliveries, sends them all at once, and records how each went; returns how many were sent.
+		Claiming a delivery only pushes back when it is next due, so a delivery claimed by an instance that stops before recording
+		how it went is tried again after webhookClaimDuration */
+func sendDueWebhooks() (int, error) {
+	godotenv.Load(".env")
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return 0, err;
+	}
+	defer c.Close(context.Background())
+
+	rows, err := c.Query(context.Background(), `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status='pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, webhooks
+		WHERE webhook_deliveries.id=due.id AND webhooks.id=webhook_deliveries.webhook_id
+		RETURNING webhook_deliveries.id, webhook_deliveries.event_type, webhook_deliveries.payload::TEXT, webhook_deliveries.attempts,
+			webhooks.url, webhooks.secret;`, webhookBatchSize, webhookClaimDuration.Seconds())
+	if (err != nil) {
+		return 0, err;
+	}
+	var due []dueDelivery;
+	for rows.Next() {
+		var d dueDelivery
+		var payload string
+		err = rows.Scan(&d.id, &d.eventType, &payload, &d.attempts, &d.url, &d.secret)
+		if (err != nil) {
+			rows.Close();
+			return 0, err;
+		}
+		d.payload = []byte(payload)
+		due = append(due, d)
+	}
+	rows.Close();
+	if (rows.Err() != nil) {
+		return 0, rows.Err();
+	}
+
+	outcomes := make([]deliveryOutcome, len(due));
+	var wg sync.WaitGroup;
+	for i := range due {
+		wg.Add(1);
+		go func(i int) {
+			defer wg.Done();
+			outcomes[i] = sendWebhook(due[i]);
+		}(i);
+	}
+	wg.Wait();
+
+	for i, d := range due {
+		err = recordDelivery(c, d, outcomes[i]);
+		if (err != nil) {
+			return len(due), err;
+		}
+	}
+
+	return len(due), nil;
+}
+
+// signs a delivery and posts it to its webhook's URL
+func sendWebhook(d dueDelivery) deliveryOutcome {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10);
+	mac := hmac.New(sha256.New, []byte(d.secret));
+	mac.Write([]byte(timestamp + "."));
+	mac.Write(d.payload);
+
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(d.payload));
+	if (err != nil) {
+		return deliveryOutcome{err: err};
+	}
+	req.Header.Set("Content-Type", "application/json");
+	req.Header.Set("X-Webhook-Event", d.eventType);
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.id, 10));
+	req.Header.Set("X-Webhook-Signature", "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil)));
+
+	resp, err := webhookClient.Do(req);
+	if (err != nil) {
+		return deliveryOutcome{err: err};
+	}
+	defer resp.Body.Close();
+
+	// only the answers of receivers that took the delivery are kept, so that the log does not pass on error pages
+	//		(or whatever else is at the URL) to whoever registered the webhook
+	outcome := deliveryOutcome{status: resp.StatusCode};
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		outcome.err = fmt.Errorf("the receiver answered with %v", resp.Status);
+	} else {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit));
+		outcome.body = string(bytes.ToValidUTF8(body, nil));
+	}
+
+	return outcome;
+}
+
+// returns the transport webhooks are sent with, which only connects to public addresses;
+//		proxies are not used, as they would connect to the receiver on the server's behalf
+func webhookTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone();
+	transport.Proxy = nil;
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, Control: webhookDialControl}).DialContext;
+
+	return transport;
+}
+
+// refuses to connect to an address a webhook must not be sent to; this runs on the address the host name resolved to,
+//		right before connecting, so a name that resolves to a private address is caught as well
+func webhookDialControl(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address);
+	if (err != nil) {
+		return err;
+	}
+	ip := net.ParseIP(host);
+	if (ip == nil || !isPublicAddress(ip)) {
+		return fmt.Errorf("webhooks cannot be sent to %v, it is not a public address", host);
+	}
+
+	return nil;
+}
+
+// ranges that are not on the internet either, but that net.IP has no check for: carrier-grade NAT (RFC 6598)
+//		and the addresses set aside for IETF protocols (RFC 6890)
+var sharedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet;
+	for _, cidr := range []string{"100.64.0.0/10", "192.0.0.0/24"} {
+		_, network, err := net.ParseCIDR(cidr);
+		if (err != nil) {
+			panic(err);
+		}
+		networks = append(networks, network);
+	}
+	return networks;
+}()
+
+// checks that an address is not loopback, private, link-local, multicast, unspecified or in one of the sharedNetworks
+func isPublicAddress(ip net.IP) bool {
+	if (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()) {
+		return false;
+	}
+	for _, network := range sharedNetworks {
+		if (network.Contains(ip)) {
+			return false;
+		}
+	}
+
+	return true;
+}
+
+// marks a delivery as delivered, or schedules its next attempt, or marks it as dead if it has run out of them
+func recordDelivery(c *pgx.Conn, d dueDelivery, outcome deliveryOutcome) error {
+	attempts := d.attempts + 1;
+	status := deliveryDelivered;
+	var lastError null.String;
+	if (outcome.err != nil) {
+		status = deliveryPending;
+		if (attempts >= webhookMaxAttempts) {
+			status = deliveryDead;
+		}
+		lastError.SetValid(outcome.err.Error());
+	}
+	var responseStatus null.Int64;
+	if (outcome.status != 0) {
+		responseStatus.SetValid(int64(outcome.status));
+	}
+
+	_, err := c.Exec(context.Background(), `
+		UPDATE webhook_deliveries SET
+			status=$2, attempts=$3, last_attempt_at=CURRENT_TIMESTAMP, response_status=$4, response_body=$5, last_error=$6,
+			next_attempt_at=CURRENT_TIMESTAMP + make_interval(secs => $7),
+			delivered_at=CASE WHEN $2 = 'delivered' THEN CURRENT_TIMESTAMP END
+		WHERE id=$1;`, d.id, status, attempts, responseStatus, outcome.body, lastError, webhookBackoff(attempts).Seconds())
+	return err;
+}
+
+// how long to wait before the next attempt after a delivery has failed the given number of times
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff;
+	for i := 1; (i < attempts && backoff < webhookMaxBackoff); i++ {
+		backoff *= 2;
+	}
+	if (backoff > webhookMaxBackoff) {
+		backoff = webhookMaxBackoff;
+	}
+
+	return backoff;
+}
+
+/* Removes delivered and dead deliveries that are older than webhookLogRetention from the log */
+func cleanUpWebhookDeliveries() error {
+	godotenv.Load(".env")
+	c, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if (err != nil) {
+		return err;
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Exec(context.Background(), "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1);", webhookLogRetention.Seconds())
+	return err;
+}
+
+// returns the timestamps of deliveries in the given timezone
+func localiseDeliveries(deliveries []WebhookDelivery, loc *time.Location) []WebhookDelivery {
+	for i := range deliveries {
+		deliveries[i] = localiseDelivery(deliveries[i], loc);
+	}
+
+	return deliveries;
+}
+
+func localiseDelivery(d WebhookDelivery, loc *time.Location) WebhookDelivery {
+	for _, t := range []*Timestamp{&d.Next_Attempt_At, &d.Last_Attempt_At, &d.Created_at, &d.Delivered_At} {
+		if (t.Valid) {
+			t.Time.Time = t.Time.Time.In(loc);
+		}
+	}
+
+	return d;
+}
+
+// checks that a webhook's URL and event types make sense,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidWebhook(client *gin.Context, cancel context.CancelFunc, rawUrl string, eventTypes []string) error {
+	var e error;
+	u, err := url.Parse(rawUrl);
+	if (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		e = fmt.Errorf("%q is not an http or https URL", rawUrl);
+	} else if ip := net.ParseIP(u.Hostname()); ((ip != nil && !isPublicAddress(ip)) || strings.EqualFold(u.Hostname(), "localhost")) {
+		// host names are checked again when connecting, as they can resolve to anything by then
+		e = fmt.Errorf("%q is not a public address", u.Hostname());
+	}
+	for _, t := range eventTypes {
+		if (e == nil && !webhookEventTypes[t]) {
+			e = fmt.Errorf("unknown event type %q", t);
+		}
+	}
+	if (e == nil) {
+		return nil;
+	}
+
+	fmt.Fprintf(os.Stderr, "Invalid webhook: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// checks that a delivery log filter is a delivery status,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func assertValidDeliveryStatus(client *gin.Context, cancel context.CancelFunc, status string) error {
+	if (status == "" || status == deliveryPending || status == deliveryDelivered || status == deliveryDead) {
+		return nil;
+	}
+	e := errors.New("status must be \"pending\", \"delivered\", \"dead\" or \"\"");
+
+	fmt.Fprintf(os.Stderr, "Invalid delivery status: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that a webhook or delivery does not exist or belongs to someone else,
+//		and stops execution of any remaining function-calls
+func assertWebhookFound(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
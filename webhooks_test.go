@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34": true,
+		"2606:2800:220:1:248:1893:25c8:1946": true,
+		"127.0.0.1": false,
+		"::1": false,
+		"10.1.2.3": false,
+		"172.16.0.1": false,
+		"192.168.1.1": false,
+		"fd00::1": false,
+		"169.254.169.254": false,
+		"fe80::1": false,
+		"224.0.0.1": false,
+		"0.0.0.0": false,
+		"::": false,
+		// carrier-grade NAT, and just either side of it
+		"100.64.0.1": false,
+		"100.127.255.254": false,
+		"100.63.255.255": true,
+		"100.128.0.0": true,
+		// IETF protocol assignments, and just after them
+		"192.0.0.8": false,
+		"192.0.0.255": false,
+		"192.0.1.1": true,
+		// IPv4 addresses written as IPv6 are checked as IPv4
+		"::ffff:100.64.0.1": false,
+		"::ffff:192.0.0.170": false,
+		"::ffff:93.184.216.34": true,
+	}
+	for address, want := range tests {
+		ip := net.ParseIP(address);
+		if (ip == nil) {
+			t.Fatalf("%q is not an IP address", address);
+		}
+		if got := isPublicAddress(ip); (got != want) {
+			t.Errorf("isPublicAddress(%q) = %v, want %v", address, got, want);
+		}
+	}
+}
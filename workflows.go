@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// a column of a category's board; a task is completed exactly when its status is a done state
+type WorkflowStatus struct {
+	Id int `json:"id"`
+	Name string `json:"name"`
+	Is_Done bool `json:"is_done"`
+}
+
+type Workflow struct {
+	Category_Id int `json:"category_id"`
+	// in the order they are shown on the board
+	Statuses []WorkflowStatus `json:"statuses"`
+}
+
+type BoardColumn struct {
+	Status WorkflowStatus `json:"status"`
+	Tasks []Task `json:"tasks"`
+}
+
+type Board struct {
+	Category_Id int `json:"category_id"`
+	Columns []BoardColumn `json:"columns"`
+}
+
+type GetWorkflowParams struct {
+	Category_Id int `json:"category_id"`
+}
+
+// note: the statuses given replace the category's whole workflow, in the order given;
+//		a status with an id keeps its tasks, a status without one is added,
+//		and the tasks of any status left out go to the first remaining status that is done or open in the same way
+type UpdateWorkflowParams struct {
+	Category_Id int `json:"category_id"`
+	Statuses []WorkflowStatus `json:"statuses"`
+}
+
+type SetTaskStatusParams struct {
+	Id int `json:"id"`
+	Status_Id int `json:"status_id"`
+}
+
+/* ------------------------------------------------------------ WORKFLOWS --------------------- */
+/* Returns the statuses of a category's workflow, in order */
+func getWorkflow(categoryId int, client *gin.Context, cancel context.CancelFunc) (Workflow) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	workflow := Workflow{Category_Id: categoryId, Statuses: []WorkflowStatus{}};
+
+	statuses, err := c.Query(context.Background(), "SELECT id, name, is_done FROM workflow_statuses WHERE category_id=$1 ORDER BY position, id;", categoryId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer statuses.Close();
+
+	for statuses.Next() {
+		var s WorkflowStatus
+		err = statuses.Scan(&s.Id, &s.Name, &s.Is_Done)
+		assertDBOperationSuccess(client, cancel, err);
+		workflow.Statuses = append(workflow.Statuses, s)
+	}
+
+	return workflow;
+}
+
+/* Replaces the statuses of a category's workflow, see UpdateWorkflowParams */
+func updateWorkflow(params UpdateWorkflowParams, client *gin.Context, cancel context.CancelFunc) error {
+	err := validateWorkflow(params.Statuses);
+	if (err != nil) {
+		return assertWorkflowChange(client, cancel, err);
+	}
+
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	err = lockCategory(tx, params.Category_Id);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	var kept []int;
+	for position, s := range params.Statuses {
+		name := strings.TrimSpace(s.Name);
+		if (s.Id == 0) {
+			err = tx.QueryRow(context.Background(), "INSERT INTO workflow_statuses (category_id, name, position, is_done) VALUES ($1, $2, $3, $4) RETURNING id;", params.Category_Id, name, position, s.Is_Done).Scan(&s.Id);
+		} else {
+			commandTag, execErr := tx.Exec(context.Background(), "UPDATE workflow_statuses SET name=$1, position=$2, is_done=$3 WHERE id=$4 AND category_id=$5;", name, position, s.Is_Done, s.Id, params.Category_Id);
+			err = execErr;
+			if (err == nil && commandTag.RowsAffected() != 1) {
+				return assertWorkflowChange(client, cancel, fmt.Errorf("no status with id: %v in category with id: %v", s.Id, params.Category_Id));
+			}
+		}
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return err;
+		}
+		kept = append(kept, s.Id);
+	}
+
+	// tasks follow their status if it became done or open, and are moved out of statuses that were left out;
+	//		these are changes to the workflow rather than to the tasks, so they are not recorded in the tasks' histories
+	_, err = tx.Exec(context.Background(), `
+		UPDATE tasks SET completed=workflow_statuses.is_done
+		FROM workflow_statuses
+		WHERE tasks.status_id=workflow_statuses.id AND workflow_statuses.category_id=$1
+			AND tasks.completed IS DISTINCT FROM workflow_statuses.is_done;`, params.Category_Id)
+	if (err == nil) {
+		// the first kept status of the same kind is picked here rather than by sync_task_status, which could pick one of the
+		//		statuses that are about to be deleted, as they still hold their old positions; validateWorkflow makes sure there is one
+		_, err = tx.Exec(context.Background(), `
+			UPDATE tasks SET status_id=(
+				SELECT id FROM workflow_statuses WHERE id = ANY($2::int[]) AND is_done=COALESCE(tasks.completed, 'f') ORDER BY position, id LIMIT 1
+			)
+			WHERE category_id=$1 AND status_id <> ALL($2::int[]);`, params.Category_Id, kept)
+	}
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "DELETE FROM workflow_statuses WHERE category_id=$1 AND id <> ALL($2::int[]);", params.Category_Id, kept)
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (err != nil && strings.Contains(err.Error(), "workflow_statuses_category_id_name_key")) {
+		return assertWorkflowChange(client, cancel, errors.New("every status in a workflow needs a different name"));
+	}
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Moves a task to another status of its category's workflow, completing or uncompleting it if needed;
+		returns the tasks that completing it has unblocked, as /completetask does */
+func setTaskStatus(params SetTaskStatusParams, userId int, client *gin.Context, cancel context.CancelFunc) ([]DependencyTask, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var unblocked []DependencyTask;
+	var wrongCategory bool;
+	err := changeTaskWith(c, params.Id, userId, actionStatus, func(tx pgx.Tx) error {
+		var wasCompleted, isDone bool;
+		err := tx.QueryRow(context.Background(), `
+			SELECT COALESCE(tasks.completed, 'f'), workflow_statuses.category_id IS DISTINCT FROM tasks.category_id, COALESCE(workflow_statuses.is_done, 'f')
+			FROM tasks
+				LEFT JOIN workflow_statuses ON workflow_statuses.id=$2
+			WHERE tasks.id=$1 AND tasks.deleted_at IS NULL;`, params.Id, params.Status_Id).Scan(&wasCompleted, &wrongCategory, &isDone);
+		if (err == nil && wrongCategory) {
+			err = errors.New("status is not part of the task's workflow");
+		}
+		if (err != nil) {
+			return err;
+		}
+
+		commandTag, err := tx.Exec(context.Background(), "UPDATE tasks SET status_id=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2;", params.Status_Id, params.Id);
+		if (err == nil && commandTag.RowsAffected() != 1) {
+			err = pgx.ErrNoRows;
+		}
+		if (err != nil || !isDone) {
+			return err;
+		}
+
+		unblocked, err = unblockedDependents(tx, params.Id, userId, wasCompleted);
+		return err;
+	})
+	if (wrongCategory) {
+		return nil, assertWorkflowChange(client, cancel, fmt.Errorf("status with id: %v is not part of the workflow of task with id: %v", params.Status_Id, params.Id));
+	}
+	if (unblocked == nil) {
+		unblocked = []DependencyTask{};
+	}
+
+	return unblocked, assertTaskChanged(client, cancel, params.Id, err);
+}
+
+/* Returns the tasks of a category grouped into the columns of its board, each column in the category's manual order */
+func getBoard(categoryId int, client *gin.Context, cancel context.CancelFunc) (Board) {
+	board := Board{Category_Id: categoryId, Columns: []BoardColumn{}};
+
+	workflow := getWorkflow(categoryId, client, cancel);
+	column := map[int]int{};
+	for i, s := range workflow.Statuses {
+		column[s.Id] = i;
+		board.Columns = append(board.Columns, BoardColumn{Status: s, Tasks: []Task{}});
+	}
+
+	for _, t := range getTaskByCategoryId(categoryId, client, cancel) {
+		if i, ok := column[int(t.Status_Id.Int64)]; (ok) {
+			board.Columns[i].Tasks = append(board.Columns[i].Tasks, t);
+		}
+	}
+
+	return board;
+}
+
+// returns why a list of statuses cannot be a workflow, or nil if it can:
+//		every status needs a name, and there must be at least one open status and one done status
+func validateWorkflow(statuses []WorkflowStatus) error {
+	var open, done bool;
+	for _, s := range statuses {
+		if (strings.TrimSpace(s.Name) == "") {
+			return errors.New("every status in a workflow needs a name");
+		}
+		open = open || !s.Is_Done;
+		done = done || s.Is_Done;
+	}
+	if (!open || !done) {
+		return errors.New("a workflow needs at least one open status and one done status");
+	}
+
+	return nil;
+}
+
+// reports to the client that the requested change to a workflow, or to where a task is in it, cannot be made,
+//		and stops execution of any remaining function-calls
+func assertWorkflowChange(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to change workflow: %v\n", e);
+
+	// return http code of 400 to the client, which stands for "Bad Request"
+	client.JSON(400, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
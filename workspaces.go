@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"github.com/gin-gonic/gin"
+	"github.com/emvi/null"
+	"github.com/jackc/pgx/v4"
+)
+
+// structs
+
+// note: a workspace (e.g. "School" or "Personal") groups categories, which can in turn nest inside each other;
+//		a category and everything nested inside it are always in the same workspace.
+//		A workspace belongs to the user who created it, and nesting does not change who has access to a category
+
+type Workspace struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+	Owner_Id int `json:"owner_id"`
+	Created_at Timestamp `json:"created_at"`
+}
+
+// the categories a user has access to in one workspace, nested; Id is null for categories that are not in any workspace
+type WorkspaceTree struct {
+	Id null.Int64 `json:"id"`
+	Title null.String `json:"title"`
+	Categories []Category `json:"categories"`
+}
+
+type CreateWorkspaceParams struct {
+	Title string `json:"title"`
+}
+
+type RenameWorkspaceParams struct {
+	Id int `json:"id"`
+	Title string `json:"title"`
+}
+
+type DeleteWorkspaceParams struct {
+	Id int `json:"id"`
+}
+
+// note: a category moved under a parent goes to the parent's workspace, and Workspace_Id is ignored;
+//		with no parent (0) it goes to the top level of Workspace_Id, or of no workspace if that is 0 too
+type MoveCategoryParams struct {
+	Category_Id int `json:"category_id"`
+	Workspace_Id int `json:"workspace_id"`
+	Parent_Id int `json:"parent_id"`
+}
+
+/* ------------------------------------------------------------ WORKSPACES --------------------- */
+/* Creates a new workspace owned by the given user and returns it */
+func addWorkspace(title string, userId int, client *gin.Context, cancel context.CancelFunc) (Workspace, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	workspace := Workspace{Title: title, Owner_Id: userId};
+	err := c.QueryRow(context.Background(), "INSERT INTO workspaces (title, owner_id) VALUES ($1, $2) RETURNING id, created_at;", title, userId).Scan(&workspace.Id, &workspace.Created_at);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return workspace, err;
+	}
+
+	return workspace, nil;
+}
+
+/* Returns the workspaces a user owns, along with the ones holding categories that have been shared with them */
+func getWorkspaces(userId int, client *gin.Context, cancel context.CancelFunc) ([]Workspace) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	workspaces, err := c.Query(context.Background(), `
+		SELECT id, title, owner_id, created_at FROM workspaces
+		WHERE owner_id=$1
+			OR id IN (SELECT categories.workspace_id FROM categories INNER JOIN public.get_accessible_categories($1) AS accessible ON categories.id=accessible.category_id)
+		ORDER BY id;`, userId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer workspaces.Close();
+
+	workspaceSlice := []Workspace{}
+	for workspaces.Next() {
+		var w Workspace
+		err = workspaces.Scan(
+			&w.Id,
+			&w.Title,
+			&w.Owner_Id,
+			&w.Created_at,
+		)
+		assertDBOperationSuccess(client, cancel, err);
+		workspaceSlice = append(workspaceSlice, w)
+	}
+
+	return workspaceSlice;
+}
+
+/* Changes the title of a workspace the user owns */
+func renameWorkspace(params RenameWorkspaceParams, userId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	commandTag, err := c.Exec(context.Background(), "UPDATE workspaces SET title=$1 WHERE id=$2 AND owner_id=$3;", params.Title, params.Id, userId)
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (commandTag.RowsAffected() != 1) {
+		return assertWorkspaceFound(client, cancel, params.Id);
+	}
+
+	return nil;
+}
+
+/* Deletes a workspace the user owns, together with every category in it the user owns and every task in those categories,
+		and returns how many categories were deleted; categories in it that belong to someone else are taken out of the workspace
+		(and out of the user's categories they are nested in) rather than deleted */
+func deleteWorkspace(id int, userId int, client *gin.Context, cancel context.CancelFunc) (int64, error) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	defer tx.Rollback(context.Background())
+
+	var ownerId int;
+	err = tx.QueryRow(context.Background(), "SELECT owner_id FROM workspaces WHERE id=$1 FOR UPDATE;", id).Scan(&ownerId);
+	if (err == pgx.ErrNoRows || (err == nil && ownerId != userId)) {
+		return 0, assertWorkspaceFound(client, cancel, id);
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	// categories that stay must not go with the workspace, or with the categories of the user's they are nested in
+	//		(which would take them along, as parent_id cascades)
+	_, err = tx.Exec(context.Background(), "UPDATE categories SET parent_id=NULL WHERE owner_id<>$2 AND parent_id IN (SELECT id FROM categories WHERE workspace_id=$1 AND owner_id=$2);", id, userId)
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "UPDATE categories SET workspace_id=NULL WHERE workspace_id=$1 AND owner_id<>$2;", id, userId)
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+
+	// tasks do not go away with their category on their own, so they are purged first, trash included;
+	//		the categories then take their statuses, members and invitations with them
+	var count int64;
+	_, blobKeys, err := purgeTasks(tx, "category_id IN (SELECT id FROM categories WHERE workspace_id=$1 AND owner_id=$2)", id, userId);
+	if (err == nil) {
+		err = tx.QueryRow(context.Background(), "WITH deleted AS (DELETE FROM categories WHERE workspace_id=$1 AND owner_id=$2 RETURNING id) SELECT COUNT(*) FROM deleted;", id, userId).Scan(&count);
+	}
+	if (err == nil) {
+		_, err = tx.Exec(context.Background(), "DELETE FROM workspaces WHERE id=$1;", id);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return 0, err;
+	}
+	deleteBlobs(blobKeys);
+
+	return count, nil;
+}
+
+// checks that a user owns a workspace,
+//		if not, returns an error message to the client and stops execution of any remaining function-calls
+func authorizeWorkspace(userId int, workspaceId int, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	var owned bool;
+	err := c.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM workspaces WHERE id=$1 AND owner_id=$2);", workspaceId, userId).Scan(&owned);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	if (!owned) {
+		return assertWorkspaceFound(client, cancel, workspaceId);
+	}
+
+	return nil;
+}
+
+/* ------------------------------------------------------------ NESTED CATEGORIES --------------------- */
+/* Moves a category, along with everything nested inside it, under another category or to the top level of a workspace;
+		only its owner can move it into another workspace, as deleting a workspace deletes the categories in it */
+func moveCategory(params MoveCategoryParams, role string, client *gin.Context, cancel context.CancelFunc) error {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tx, err := c.Begin(context.Background())
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	defer tx.Rollback(context.Background())
+
+	// only one category is moved at a time, otherwise two moves that are fine on their own could together form a cycle
+	_, err = tx.Exec(context.Background(), "SELECT pg_advisory_xact_lock(hashtext('categories'));");
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+
+	parentId := null.NewInt64(int64(params.Parent_Id), params.Parent_Id != 0);
+	workspaceId := null.NewInt64(int64(params.Workspace_Id), params.Workspace_Id != 0);
+
+	if (parentId.Valid) {
+		// a category cannot go inside itself, or inside anything nested in it
+		var cycle bool;
+		err = tx.QueryRow(context.Background(), `
+			WITH RECURSIVE ancestors(id) AS (
+				SELECT $1::int
+				UNION
+				SELECT categories.parent_id FROM categories INNER JOIN ancestors ON categories.id=ancestors.id WHERE categories.parent_id IS NOT NULL
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id=$2);`, params.Parent_Id, params.Category_Id).Scan(&cycle);
+		if (err == nil && cycle) {
+			return assertValidCategoryMove(client, cancel, fmt.Errorf("category with id: %v cannot be put inside itself", params.Category_Id));
+		}
+		if (err == nil) {
+			err = tx.QueryRow(context.Background(), "SELECT workspace_id FROM categories WHERE id=$1;", params.Parent_Id).Scan(&workspaceId);
+		}
+		if (assertDBOperationSuccess(client, cancel, err) != nil) {
+			return err;
+		}
+	}
+
+	var currentWorkspaceId null.Int64;
+	err = tx.QueryRow(context.Background(), "SELECT workspace_id FROM categories WHERE id=$1;", params.Category_Id).Scan(&currentWorkspaceId);
+	if (assertDBOperationSuccess(client, cancel, err) != nil) {
+		return err;
+	}
+	moved := currentWorkspaceId.Valid != workspaceId.Valid || currentWorkspaceId.Int64 != workspaceId.Int64;
+	if (moved && !hasRole(role, roleOwner)) {
+		return assertPermitted(client, cancel, fmt.Errorf("only the owner of category with id: %v can move it into another workspace", params.Category_Id));
+	}
+
+	_, err = tx.Exec(context.Background(), "UPDATE categories SET parent_id=$1 WHERE id=$2;", parentId, params.Category_Id);
+	if (err == nil) {
+		err = setSubtreeWorkspace(tx, params.Category_Id, workspaceId);
+	}
+	if (err == nil) {
+		err = tx.Commit(context.Background());
+	}
+
+	return assertDBOperationSuccess(client, cancel, err);
+}
+
+/* Puts a category and everything nested inside it into a workspace */
+func setSubtreeWorkspace(tx pgx.Tx, categoryId int, workspaceId null.Int64) error {
+	_, err := tx.Exec(context.Background(), `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT $1::int
+			UNION
+			SELECT categories.id FROM categories INNER JOIN subtree ON categories.parent_id=subtree.id
+		)
+		UPDATE categories SET workspace_id=$2 WHERE id IN (SELECT id FROM subtree);`, categoryId, workspaceId)
+
+	return err;
+}
+
+/* Returns an array of all Tasks in a category and in every category nested inside it that the user has access to,
+		ordered by category and then by their manual order */
+func getTasksInCategoryTree(categoryId int, userId int, client *gin.Context, cancel context.CancelFunc) ([]Task) {
+	c := connectDB(client, cancel)
+	defer c.Close(context.Background())
+
+	tasks, err := c.Query(context.Background(), `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT $1::int
+			UNION
+			SELECT categories.id FROM categories INNER JOIN subtree ON categories.parent_id=subtree.id
+		)
+		SELECT tasks.* FROM subtree, LATERAL public.get_tasks_in_category(subtree.id) AS tasks
+		WHERE subtree.id IN (SELECT category_id FROM public.get_accessible_categories($2))
+		ORDER BY tasks.category_id, tasks.rank COLLATE "C", tasks.id;`, categoryId, userId)
+	assertDBOperationSuccess(client, cancel, err);
+	defer tasks.Close();
+
+	var taskSlice []Task
+	for tasks.Next() {
+		var t Task
+		err = scanTask(tasks, &t)
+		assertDBOperationSuccess(client, cancel, err);
+		taskSlice = append(taskSlice, t)
+	}
+
+	return taskSlice;
+}
+
+// arranges the categories a user has access to into a tree for each workspace, workspaces in the order given
+//		followed by the categories in no workspace; a category whose parent the user cannot see is shown at the top level
+func buildCategoryTree(workspaces []Workspace, categories []Category) []WorkspaceTree {
+	visible := map[int64]bool{};
+	for _, cat := range categories {
+		visible[int64(cat.Id)] = true;
+	}
+
+	// returns a category with everything nested inside it filled in
+	children := map[int64][]Category{};
+	var build func(cat Category) Category;
+	build = func(cat Category) Category {
+		for _, child := range children[int64(cat.Id)] {
+			cat.Children = append(cat.Children, build(child));
+		}
+		return cat;
+	}
+
+	roots := map[int64][]Category{};
+	var unfiled []Category;
+	for _, cat := range categories {
+		if (cat.Parent_Id.Valid && visible[cat.Parent_Id.Int64]) {
+			children[cat.Parent_Id.Int64] = append(children[cat.Parent_Id.Int64], cat);
+		} else if (cat.Workspace_Id.Valid) {
+			roots[cat.Workspace_Id.Int64] = append(roots[cat.Workspace_Id.Int64], cat);
+		} else {
+			unfiled = append(unfiled, cat);
+		}
+	}
+
+	tree := []WorkspaceTree{};
+	for _, w := range workspaces {
+		node := WorkspaceTree{Id: null.NewInt64(int64(w.Id), true), Title: null.NewString(w.Title, true), Categories: []Category{}};
+		for _, cat := range roots[int64(w.Id)] {
+			node.Categories = append(node.Categories, build(cat));
+		}
+		tree = append(tree, node);
+	}
+
+	node := WorkspaceTree{Categories: []Category{}};
+	for _, cat := range unfiled {
+		node.Categories = append(node.Categories, build(cat));
+	}
+	tree = append(tree, node);
+
+	return tree;
+}
+
+// reports to the client that there is no workspace with the given id that the user owns,
+//		and stops execution of any remaining function-calls
+func assertWorkspaceFound(client *gin.Context, cancel context.CancelFunc, id int) error {
+	e := fmt.Errorf("no workspace found with id: %v", id);
+	fmt.Fprintf(os.Stderr, "Unable to perform the requested action: %v\n", e);
+
+	// return http code of 404 to the client, which stands for "Not Found"
+	client.JSON(404, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}
+
+// reports to the client that a category cannot be moved to where it was asked to be moved,
+//		and stops execution of any remaining function-calls
+func assertValidCategoryMove(client *gin.Context, cancel context.CancelFunc, e error) error {
+	fmt.Fprintf(os.Stderr, "Unable to move category: %v\n", e);
+
+	// return http code of 409 to the client, which stands for "Conflict"
+	client.JSON(409, gin.H{"error": e.Error()});
+
+	cancel();
+
+	return e;
+}